@@ -3,104 +3,305 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
+	"modress/internal/config"
 	"modress/internal/controllers"
+	"modress/internal/database"
+	"modress/internal/health"
+	"modress/internal/hub"
+	"modress/internal/jobs"
+	"modress/internal/logging"
+	"modress/internal/mail"
+	"modress/internal/metrics"
 	"modress/internal/middleware"
+	"modress/internal/models"
+	"modress/internal/ratelimit"
 	"modress/internal/repositories"
+	"modress/internal/server"
+	"modress/internal/tracing"
 	"modress/internal/services"
+	"modress/internal/webhook"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 	"github.com/jmoiron/sqlx"
-	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
 
 func main() {
-	// Load environment variables
-	if err := godotenv.Load(".env"); err != nil {
-		log.Fatal("Error loading .env file: ", err)
+	// SIGINT/SIGTERM cancelam o contexto e iniciam o shutdown ordenado
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx); err != nil {
+		slog.Error("API stopped with an error", logging.Err(err))
+		os.Exit(1)
 	}
+}
 
-	// Get environment variables
-	dbURL := os.Getenv("DB_URL")
-	if dbURL == "" {
-		log.Fatal("DB_URL must be set")
+// run arranca a API e bloqueia até ctx ser cancelado e o shutdown terminar
+func run(ctx context.Context) error {
+	// Load configuration (env, optional .env and optional YAML file)
+	cfg, err := config.Load()
+	if err != nil {
+		return err
 	}
 
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		log.Fatal("JWT_SECRET must be set")
+	logger, err := logging.New(logging.Options{Level: cfg.Log.Level, Format: cfg.Log.Format})
+	if err != nil {
+		return err
 	}
+	// O log da biblioteca padrão (e o de dependências que o usam) passa pelo mesmo handler
+	slog.SetDefault(logger)
+	logger.Info("starting API", "env", cfg.Env, "config", strings.Split(cfg.Summary(), "\n"))
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8000"
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Options{
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		Insecure:    cfg.Tracing.Insecure,
+		ServiceName: cfg.Tracing.ServiceName,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		return err
 	}
 
 	// Connect to database with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	connectCtx, cancel := context.WithTimeout(ctx, cfg.Database.ConnectTimeout)
 	defer cancel()
 
-	db, err := sqlx.ConnectContext(ctx, "postgres", dbURL)
+	db, err := sqlx.ConnectContext(connectCtx, "postgres", cfg.Database.URL)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		return fmt.Errorf("failed to connect to database: %w", err)
 	}
 	defer db.Close()
 
+	db.SetMaxOpenConns(cfg.Database.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.Database.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.Database.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.Database.ConnMaxIdleTime)
+
+	// Aplicar migrações pendentes
+	if err := database.Migrate(connectCtx, db); err != nil {
+		return fmt.Errorf("failed to run migrations: %w", err)
+	}
+
+	if err := os.MkdirAll(cfg.Uploads.Dir, 0755); err != nil {
+		return fmt.Errorf("failed to create upload directory: %w", err)
+	}
+
 	// Initialize validator
 	validate := validator.New()
-	wsController := controllers.NewWebSocketController()
-	go wsController.Run()
 
 	// Initialize repositories
-	userRepo := repositories.NewUserRepository(db)
-	productRepo := repositories.NewProductRepository(db) // Assumes this exists
-	storeRepo := repositories.NewStoreRepository(db)     // Assumes this exists
-	
+	// Os repositórios usam a ligação instrumentada: cada query gera um span
+	tracedDB := database.Wrap(db)
+	userRepo := repositories.NewUserRepository(tracedDB)
+	productRepo := repositories.NewProductRepository(tracedDB)
+	storeRepo := repositories.NewStoreRepository(tracedDB)
+	jobRepo := repositories.NewJobRepository(tracedDB)
+	idempotencyRepo := repositories.NewIdempotencyRepository(tracedDB)
+	auditRepo := repositories.NewAuditRepository(tracedDB)
+	chatRepo := repositories.NewChatRepository(tracedDB)
+	notificationRepo := repositories.NewNotificationRepository(tracedDB)
+	webhookRepo := repositories.NewWebhookRepository(tracedDB)
+	reviewRepo := repositories.NewReviewRepository(tracedDB)
+	wishlistRepo := repositories.NewWishlistRepository(tracedDB)
+	couponRepo := repositories.NewCouponRepository(tracedDB)
+
+	// Initialize job runner
+	jobRunner := jobs.NewRunner(jobRepo, jobs.Options{
+		Workers:      cfg.Jobs.Workers,
+		PollInterval: cfg.Jobs.PollInterval,
+	})
+
+	// Com várias instâncias os eventos e a presença passam pelo Postgres
+	var hubBackend hub.Backend
+	if cfg.WebSocket.Backend == "postgres" {
+		hubBackend = hub.NewPostgresBackend(tracedDB, hub.PostgresOptions{DSN: cfg.Database.URL})
+	} else {
+		hubBackend = hub.NewMemoryBackend()
+	}
+
+	var mailer mail.Sender = mail.LogSender{}
+	if cfg.Mail.Driver == "smtp" {
+		mailer = mail.NewSMTPSender(mail.SMTPOptions{
+			Host:     cfg.Mail.SMTPHost,
+			Port:     cfg.Mail.SMTPPort,
+			Username: cfg.Mail.SMTPUsername,
+			Password: cfg.Mail.SMTPPassword,
+			From:     cfg.Mail.From,
+		})
+	}
+
+	webhookClient := webhook.NewClient(webhook.Options{
+		Timeout:              cfg.Webhooks.Timeout,
+		AllowPrivateNetworks: cfg.Webhooks.AllowPrivateNetworks,
+	})
 
 	// Initialize services
-	authService := services.NewAuthService(userRepo, jwtSecret)
-	storeService := services.NewStoreService(storeRepo)
-	productService := services.NewProductService(productRepo, storeRepo)
+	auditService := services.NewAuditService(auditRepo)
+	authService := services.NewAuthService(userRepo, cfg.Auth.JWTSecret, cfg.Auth.AccessTokenTTL, services.LoginLockout{
+		MaxFailures: cfg.Auth.LoginMaxFailures,
+		Duration:    cfg.Auth.LoginLockout,
+		MaxDuration: cfg.Auth.LoginMaxLockout,
+	}, auditService)
+	jobService := services.NewJobService(jobRepo, jobRunner, auditService)
+	// As notificações chegam às ligações WebSocket pelo backend do hub, sem depender do controller
+	notificationService := services.NewNotificationService(notificationRepo, userRepo, jobService, hubBackend, mailer)
+	webhookService := services.NewWebhookService(webhookRepo, jobService, webhookClient, cfg.Webhooks.MaxAttempts, auditService)
+	storeService := services.NewStoreService(storeRepo, chatRepo, auditService, notificationService, webhookService)
+	wishlistService := services.NewWishlistService(wishlistRepo, productRepo, jobService, notificationService)
+	productService := services.NewProductService(productRepo, storeRepo, auditService, notificationService, webhookService, wishlistService)
+	productImportService := services.NewProductImportService(productRepo, storeRepo, jobService, auditService, notificationService, webhookService, wishlistService)
+	idempotencyService := services.NewIdempotencyService(idempotencyRepo, cfg.Idempotency.TTL)
+	purgeService := services.NewPurgeService(productRepo, storeRepo, userRepo, jobService, cfg.Retention.SoftDeleted, auditService)
+	chatService := services.NewChatService(chatRepo, storeRepo, notificationService)
+	reviewService := services.NewReviewService(reviewRepo, productRepo, storeRepo, notificationService, auditService)
+	couponService := services.NewCouponService(couponRepo, productRepo, auditService)
+
+	// Register job handlers
+	jobRunner.Register(models.JobTypeProductImport, jobs.Handle(productImportService.HandleImportJob))
+	jobRunner.Register(models.JobTypePurgeDeleted, jobs.Handle(purgeService.HandlePurgeJob))
+	jobRunner.Register(models.JobTypeNotificationEmail, jobs.Handle(notificationService.HandleEmailJob))
+	jobRunner.Register(models.JobTypeWebhookDelivery, jobs.Handle(webhookService.HandleDeliveryJob))
+	jobRunner.Register(models.JobTypeWishlistAlert, jobs.Handle(wishlistService.HandleAlertJob))
 
 	authController := controllers.NewAuthController(authService)
-	productController := controllers.NewProductController(productService, storeService)
+	productController := controllers.NewProductController(productService, storeService, cfg.Uploads)
 	storeController := controllers.NewStoreController(storeService)
+	productImportController := controllers.NewProductImportController(productImportService, storeService, cfg.Uploads.MaxImportSize)
+	jobController := controllers.NewJobController(jobService)
+	purgeController := controllers.NewPurgeController(purgeService)
+	auditController := controllers.NewAuditController(auditService)
+	notificationController := controllers.NewNotificationController(notificationService)
+	webhookController := controllers.NewWebhookController(webhookService, storeService)
+	reviewController := controllers.NewReviewController(reviewService, storeService, cfg.Uploads)
+	wishlistController := controllers.NewWishlistController(wishlistService)
+	couponController := controllers.NewCouponController(couponService, storeService)
+	wsConfig := cfg.WebSocket
+	wsConfig.AllowedOrigins = cfg.WebSocketOrigins()
+	wsController := controllers.NewWebSocketController(authService, chatService, hubBackend, wsConfig)
+	if err := hubBackend.Start(ctx); err != nil {
+		return fmt.Errorf("failed to start websocket hub backend: %w", err)
+	}
+	wsController.Start()
+	chatController := controllers.NewChatController(chatService, wsController)
+
+	// Readiness checks
+	healthChecker := health.NewChecker(cfg.Health.CheckTimeout)
+	healthChecker.Add("database", health.DatabaseCheck(db))
+	healthChecker.Add("migrations", health.MigrationsCheck(db))
+	healthChecker.Add("uploads", health.WritableDirCheck(cfg.Uploads.Dir))
+	healthChecker.Add("websocket", wsController.HealthCheck)
+	healthController := controllers.NewHealthController(healthChecker)
 	// No seu main.go, antes do router.Run()
 
+	if cfg.IsProduction() {
+		// Sem as linhas de debug do gin em texto simples no meio dos logs JSON
+		gin.SetMode(gin.ReleaseMode)
+	}
 	router := gin.New()
-	router.Use(gin.Logger(), gin.Recovery()) // Manually add default middleware (replaces gin.Default())
+	router.Use(middleware.RequestIDMiddleware(logger), middleware.TracingMiddleware())
+	if cfg.Metrics.Enabled {
+		// Antes do Recovery, para que os pânicos sejam contados como 500
+		router.Use(middleware.MetricsMiddleware())
+		metrics.RegisterDB(db.DB, "modress")
+		metrics.RegisterWebSocketHub(wsController.Stats)
+	}
+	// O ErrorMiddleware fica entre o logger e o Recovery: escreve as respostas de erro,
+	// incluindo o 500 dos pânicos, antes de o logger registar o status
+	router.Use(middleware.RequestLoggerMiddleware(), middleware.ErrorMiddleware(), middleware.RecoveryMiddleware())
 	router.RedirectTrailingSlash = false
+	router.NoRoute(middleware.NotFoundHandler())
+	// Sem proxies confiáveis o X-Forwarded-For é ignorado; caso contrário qualquer
+	// cliente escolheria o IP usado nos logs e no rate limit
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		return fmt.Errorf("invalid TRUSTED_PROXIES: %w", err)
+	}
+	// O IP guardado para a auditoria é o mesmo dos logs e do rate limit
+	router.Use(middleware.AuditMiddleware())
 
-	router.Use(middleware.CORSMiddleware())
+	router.Use(middleware.SecurityHeadersMiddleware(cfg.Security, "/images/"), middleware.CORSMiddleware(cfg.CORS))
 
 	router.Use(func(c *gin.Context) {
 		c.Set("validator", validate)
 		c.Next()
 	})
 
-	router.Static("/images", "./uploads/images")
+	router.Static("/images", cfg.Uploads.Dir)
+
+	// Liveness and readiness probes
+	router.GET("/healthz", healthController.Liveness)
+	router.GET("/readyz", healthController.Readiness)
+
+	if cfg.Metrics.Enabled {
+		router.GET(cfg.Metrics.Path, gin.WrapH(metrics.Handler()))
+	}
+
+	// Rate limiting: um limite geral por IP, um mais apertado por IP nas rotas de
+	// auth e outro por utilizador nas escritas autenticadas
+	var rateLimitStore ratelimit.Store
+	if cfg.RateLimit.Enabled {
+		if cfg.RateLimit.Store == "postgres" {
+			rateLimitStore = ratelimit.NewPostgresStore(tracedDB)
+		} else {
+			rateLimitStore = ratelimit.NewMemoryStore()
+		}
+		go ratelimit.RunSweeper(ctx, rateLimitStore, 5*time.Minute, func(err error) {
+			logger.Warn("rate limit sweep failed", logging.Err(err))
+		})
+	}
+	rateLimit := func(rule middleware.RateLimitRule) gin.HandlerFunc {
+		if rateLimitStore == nil {
+			return func(c *gin.Context) { c.Next() }
+		}
+		return middleware.RateLimitMiddleware(rateLimitStore, rule)
+	}
+	writeLimit := rateLimit(middleware.RateLimitRule{
+		Name:    "write",
+		Limit:   ratelimit.PerMinute(cfg.RateLimit.WriteRequestsPerMinute, cfg.RateLimit.WriteBurst),
+		Key:     middleware.UserOrIPKey,
+		Methods: []string{http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete},
+	})
+
+	// Idempotency-Key nos POST que criam recursos; as chaves expiradas são apagadas de hora a hora
+	idempotent := middleware.IdempotencyMiddleware(idempotencyService)
+	go runPeriodically(ctx, time.Hour, func(ctx context.Context) {
+		if _, err := idempotencyService.PurgeExpired(ctx); err != nil {
+			logger.Warn("idempotency key purge failed", logging.Err(err))
+		}
+	})
 
 	// Group all routes under /api/v1
 	api := router.Group("/api/v1")
+	api.Use(rateLimit(middleware.RateLimitRule{
+		Name:  "api",
+		Limit: ratelimit.PerMinute(cfg.RateLimit.RequestsPerMinute, cfg.RateLimit.Burst),
+		Key:   middleware.ClientIPKey,
+	}))
 
 	// WebSocket route
-	api.GET("/ws", middleware.AuthMiddleware(jwtSecret), wsController.HandleConnections)
+	api.GET("/ws", middleware.AuthMiddleware(cfg.Auth.JWTSecret), wsController.HandleConnections)
+	api.GET("/presence", middleware.AuthMiddleware(cfg.Auth.JWTSecret), wsController.Presence)
 
 	// Health Check
-	api.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{
-			"status":   "ok",
-			"database": "connected",
-		})
-	})
+	api.GET("/health", healthController.Readiness)
 
 	// Public routes (auth)
 	auth := api.Group("/auth")
+	auth.Use(rateLimit(middleware.RateLimitRule{
+		Name:  "auth",
+		Limit: ratelimit.PerMinute(cfg.RateLimit.AuthRequestsPerMinute, cfg.RateLimit.AuthBurst),
+		Key:   middleware.ClientIPKey,
+	}))
 	{
 		auth.POST("/register", authController.Register)
 		auth.POST("/login", authController.Login)
@@ -111,7 +312,7 @@ func main() {
 		temp.GET("/users", func(c *gin.Context) {
 			users, err := userRepo.ListAll(c.Request.Context())
 			if err != nil {
-				c.JSON(500, gin.H{"error": err.Error()})
+				c.Error(err)
 				return
 			}
 			c.JSON(200, users)
@@ -120,11 +321,13 @@ func main() {
 
 	// Protected routes (users)
 	users := api.Group("/users")
-	users.Use(middleware.AuthMiddleware(jwtSecret))
+	users.Use(middleware.AuthMiddleware(cfg.Auth.JWTSecret), writeLimit)
 	{
 		users.GET("/me", authController.GetProfile)
 		users.PUT("/me", authController.UpdateProfile)
 		users.DELETE("/me", authController.DeleteProfile)
+		users.GET("/me/following", storeController.ListFollowedStores)
+		users.GET("/me/feed", productController.GetFeed)
 	}
 
 	// Product routes
@@ -136,14 +339,17 @@ func main() {
 		products.GET("/category/:category", productController.GetProductsByCategory)
 		products.GET("/", productController.ListProducts)
 		products.GET("/search", productController.SearchProducts)
+		products.GET("/:id/reviews", reviewController.ListReviews)
 
 		// Protected product routes (require authentication)
-		products.Use(middleware.AuthMiddleware(jwtSecret))
+		products.Use(middleware.AuthMiddleware(cfg.Auth.JWTSecret), writeLimit)
 		{
-			products.POST("/", productController.CreateProduct)
+			products.POST("/", idempotent, productController.CreateProduct)
 			products.PUT("/:id", productController.UpdateProduct)
 			products.DELETE("/:id", productController.DeleteProduct)
+			products.POST("/:id/restore", productController.RestoreProduct)
 			products.PUT("/:id/quantity", productController.UpdateQuantity)
+			products.POST("/:id/reviews", reviewController.CreateReview)
 		}
 	}
 
@@ -157,21 +363,153 @@ func main() {
 		stores.GET("/approved", storeController.ListApprovedStores)
 
 		// Protected store routes (require authentication)
-		stores.Use(middleware.AuthMiddleware(jwtSecret))
+		stores.Use(middleware.AuthMiddleware(cfg.Auth.JWTSecret), writeLimit)
 		{
-			stores.POST("/", storeController.CreateStore)
+			stores.POST("/", idempotent, storeController.CreateStore)
 			stores.GET("/my", storeController.GetMyStore)
+			stores.POST("/my/products/import", productImportController.ImportProducts)
+			stores.GET("/my/products/import/:jobId", productImportController.GetImportJob)
+			stores.GET("/my/products/export", productImportController.ExportProducts)
+			stores.GET("/my/webhooks", webhookController.ListWebhooks)
+			stores.POST("/my/webhooks", webhookController.CreateWebhook)
+			stores.GET("/my/webhooks/:id", webhookController.GetWebhook)
+			stores.PUT("/my/webhooks/:id", webhookController.UpdateWebhook)
+			stores.DELETE("/my/webhooks/:id", webhookController.DeleteWebhook)
+			stores.POST("/my/webhooks/:id/secret", webhookController.RotateSecret)
+			stores.GET("/my/webhooks/:id/deliveries", webhookController.ListDeliveries)
+			stores.POST("/my/webhooks/:id/deliveries/:deliveryId/redeliver", webhookController.Redeliver)
+			stores.GET("/my/coupons", couponController.StoreScope, couponController.ListCoupons)
+			stores.POST("/my/coupons", couponController.StoreScope, couponController.CreateCoupon)
+			stores.GET("/my/coupons/:id", couponController.StoreScope, couponController.GetCoupon)
+			stores.PUT("/my/coupons/:id", couponController.StoreScope, couponController.UpdateCoupon)
+			stores.DELETE("/my/coupons/:id", couponController.StoreScope, couponController.DeleteCoupon)
+			stores.GET("/my/coupons/:id/redemptions", couponController.StoreScope, couponController.ListRedemptions)
 			stores.PUT("/:id", storeController.UpdateStore)
 			stores.DELETE("/:id", storeController.DeleteStore)
+			stores.POST("/:id/restore", storeController.RestoreStore)
+			stores.POST("/:id/follow", storeController.FollowStore)
+			stores.DELETE("/:id/follow", storeController.UnfollowStore)
 
 			// Admin-only route
 			stores.PUT("/:id/approve", storeController.ApproveStore)
 		}
 	}
 
-	// Start the server
-	log.Printf("Server running on port %s...", port)
-	if err := router.Run(fmt.Sprintf(":%s", port)); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	// Conversation routes
+	conversations := api.Group("/conversations")
+	conversations.Use(middleware.AuthMiddleware(cfg.Auth.JWTSecret), writeLimit)
+	{
+		conversations.GET("/", chatController.ListConversations)
+		conversations.POST("/", chatController.StartConversation)
+		conversations.GET("/unread", chatController.UnreadCount)
+		conversations.GET("/:id/messages", chatController.GetMessages)
+		conversations.POST("/:id/messages", chatController.SendMessage)
+		conversations.POST("/:id/read", chatController.MarkRead)
+	}
+
+	// Review routes
+	reviews := api.Group("/reviews")
+	reviews.Use(middleware.AuthMiddleware(cfg.Auth.JWTSecret), writeLimit)
+	{
+		reviews.PUT("/:id", reviewController.UpdateReview)
+		reviews.DELETE("/:id", reviewController.DeleteReview)
+		reviews.POST("/:id/photos", reviewController.AddReviewPhoto)
+		reviews.PUT("/:id/reply", reviewController.ReplyToReview)
+		reviews.DELETE("/:id/reply", reviewController.DeleteReply)
+		reviews.POST("/:id/report", reviewController.ReportReview)
+	}
+
+	// Wishlist routes
+	wishlists := api.Group("/wishlists")
+	{
+		// Public link of a shared wishlist
+		wishlists.GET("/shared/:token", wishlistController.GetSharedWishlist)
+
+		wishlists.Use(middleware.AuthMiddleware(cfg.Auth.JWTSecret), writeLimit)
+		{
+			wishlists.GET("/", wishlistController.ListWishlists)
+			wishlists.POST("/", wishlistController.CreateWishlist)
+			wishlists.GET("/:id", wishlistController.GetWishlist)
+			wishlists.PUT("/:id", wishlistController.UpdateWishlist)
+			wishlists.DELETE("/:id", wishlistController.DeleteWishlist)
+			wishlists.POST("/:id/items", wishlistController.AddItem)
+			wishlists.DELETE("/:id/items/:productId", wishlistController.RemoveItem)
+			wishlists.POST("/:id/items/:productId/move", wishlistController.MoveItem)
+		}
+	}
+
+	// Coupon routes
+	coupons := api.Group("/coupons")
+	coupons.Use(middleware.AuthMiddleware(cfg.Auth.JWTSecret), writeLimit)
+	{
+		coupons.POST("/quote", couponController.QuoteCoupon)
+		coupons.POST("/redeem", idempotent, couponController.RedeemCoupon)
+	}
+
+	// Notification routes
+	notifications := api.Group("/notifications")
+	notifications.Use(middleware.AuthMiddleware(cfg.Auth.JWTSecret), writeLimit)
+	{
+		notifications.GET("/", notificationController.ListNotifications)
+		notifications.GET("/unread", notificationController.UnreadCount)
+		notifications.POST("/:id/read", notificationController.MarkRead)
+		notifications.POST("/read-all", notificationController.MarkAllRead)
+		notifications.GET("/preferences", notificationController.GetPreferences)
+		notifications.PUT("/preferences", notificationController.UpdatePreferences)
+	}
+
+	// Admin routes
+	admin := api.Group("/admin")
+	admin.Use(middleware.AuthMiddleware(cfg.Auth.JWTSecret), middleware.RoleMiddleware("admin"))
+	{
+		admin.GET("/jobs", jobController.ListJobs)
+		admin.GET("/jobs/:id", jobController.GetJob)
+		admin.POST("/jobs/:id/retry", jobController.RetryJob)
+		admin.POST("/purge", purgeController.SchedulePurge)
+		admin.GET("/audit-events", auditController.ListEvents)
+		admin.GET("/review-reports", reviewController.ListReports)
+		admin.POST("/reviews/:id/moderate", reviewController.ModerateReview)
+		admin.GET("/coupons", couponController.MarketplaceScope, couponController.ListCoupons)
+		admin.POST("/coupons", couponController.MarketplaceScope, couponController.CreateCoupon)
+		admin.GET("/coupons/:id", couponController.MarketplaceScope, couponController.GetCoupon)
+		admin.PUT("/coupons/:id", couponController.MarketplaceScope, couponController.UpdateCoupon)
+		admin.DELETE("/coupons/:id", couponController.MarketplaceScope, couponController.DeleteCoupon)
+		admin.GET("/coupons/:id/redemptions", couponController.MarketplaceScope, couponController.ListRedemptions)
+	}
+
+	jobRunner.Start()
+
+	// Start the server. A ordem dos hooks é a ordem do shutdown: primeiro os
+	// clientes WebSocket, depois os workers e por fim a base de dados.
+	srv := server.New(fmt.Sprintf(":%s", cfg.Server.Port), router, server.Options{
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		ShutdownTimeout:   cfg.Server.ShutdownTimeout,
+		DrainDelay:        cfg.Server.DrainDelay,
+	})
+	srv.BeforeShutdown(healthChecker.SetShuttingDown)
+	srv.OnShutdown("websocket hub", wsController.Shutdown)
+	srv.OnShutdown("websocket hub backend", hubBackend.Close)
+	srv.OnShutdown("job runner", jobRunner.Shutdown)
+	srv.OnShutdown("database", func(context.Context) error { return db.Close() })
+	srv.OnShutdown("tracing", shutdownTracing)
+
+	return srv.Run(ctx)
+}
+
+// runPeriodically chama fn a cada interval até ctx ser cancelado
+func runPeriodically(ctx context.Context, interval time.Duration, fn func(context.Context)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			fn(ctx)
+		}
 	}
 }
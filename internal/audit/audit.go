@@ -0,0 +1,151 @@
+// Package audit transporta no contexto quem está a fazer o pedido e calcula as
+// diferenças entre o estado anterior e o posterior de uma entidade, para os
+// eventos de auditoria escritos pelos serviços.
+package audit
+
+import (
+	"context"
+	"reflect"
+	"strings"
+)
+
+// Actor identifica quem fez uma alteração. UserID é 0 em pedidos anónimos (registo).
+type Actor struct {
+	UserID int64  `json:"user_id,omitempty"`
+	Role   string `json:"role,omitempty"`
+	IP     string `json:"ip,omitempty"`
+}
+
+type actorKey struct{}
+
+// WithActor guarda actor em ctx
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// WithClientIP guarda o IP do cliente, mantendo o utilizador já conhecido
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	actor := ActorFrom(ctx)
+	actor.IP = ip
+	return WithActor(ctx, actor)
+}
+
+// WithUser guarda o utilizador autenticado, mantendo o IP já conhecido
+func WithUser(ctx context.Context, userID int64, role string) context.Context {
+	actor := ActorFrom(ctx)
+	actor.UserID = userID
+	actor.Role = role
+	return WithActor(ctx, actor)
+}
+
+// ActorFrom devolve o actor guardado em ctx, ou um Actor vazio
+func ActorFrom(ctx context.Context) Actor {
+	actor, _ := ctx.Value(actorKey{}).(Actor)
+	return actor
+}
+
+// Change é o valor de um campo antes e depois da alteração
+type Change struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// Changes associa o nome JSON de cada campo alterado à sua Change
+type Changes map[string]Change
+
+// Redacted substitui os valores dos campos marcados com `audit:"redact"`
+const Redacted = "[redacted]"
+
+// ignoredFields são campos de controlo que mudam em todas as escritas e só fariam ruído
+var ignoredFields = map[string]bool{
+	"created_at": true,
+	"updated_at": true,
+	"version":    true,
+}
+
+// Diff compara dois valores do mesmo tipo struct (ou ponteiros para ele) e devolve os
+// campos que mudaram. before nil descreve uma criação e after nil uma remoção: todos
+// os campos aparecem. Os campos sem nome JSON (json:"-") ou com `audit:"-"` são
+// ignorados; os campos com `audit:"redact"` aparecem, mas sem os valores.
+func Diff(before, after interface{}) Changes {
+	b, a := structValue(before), structValue(after)
+	var t reflect.Type
+	switch {
+	case b.IsValid():
+		t = b.Type()
+	case a.IsValid():
+		t = a.Type()
+	default:
+		return Changes{}
+	}
+
+	changes := Changes{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, ok := fieldName(field)
+		if !ok || ignoredFields[name] {
+			continue
+		}
+
+		var oldValue, newValue interface{}
+		if b.IsValid() {
+			oldValue = plain(b.Field(i))
+		}
+		if a.IsValid() {
+			newValue = plain(a.Field(i))
+		}
+		if b.IsValid() && a.IsValid() && reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+
+		if field.Tag.Get("audit") == "redact" {
+			if oldValue != nil {
+				oldValue = Redacted
+			}
+			if newValue != nil {
+				newValue = Redacted
+			}
+		}
+		changes[name] = Change{Before: oldValue, After: newValue}
+	}
+	return changes
+}
+
+func structValue(v interface{}) reflect.Value {
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return reflect.Value{}
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return reflect.Value{}
+	}
+	return value
+}
+
+func fieldName(field reflect.StructField) (string, bool) {
+	if !field.IsExported() || field.Tag.Get("audit") == "-" {
+		return "", false
+	}
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "-" {
+		return "", false
+	}
+	if name == "" {
+		name = field.Name
+	}
+	return name, true
+}
+
+// plain desfaz os ponteiros, para que *string nil e "x" se comparem e serializem pelo valor
+func plain(v reflect.Value) interface{} {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	return v.Interface()
+}
@@ -0,0 +1,543 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Config reúne toda a configuração da API. Cada campo pode vir, por ordem crescente
+// de prioridade, dos valores por omissão, do ficheiro YAML, do .env e do ambiente.
+type Config struct {
+	Env         string            `yaml:"env" env:"APP_ENV"`
+	Server      ServerConfig      `yaml:"server"`
+	Database    DatabaseConfig    `yaml:"database"`
+	Auth        AuthConfig        `yaml:"auth"`
+	CORS        CORSConfig        `yaml:"cors"`
+	Security    SecurityConfig    `yaml:"security"`
+	WebSocket   WebSocketConfig   `yaml:"websocket"`
+	Health      HealthConfig      `yaml:"health"`
+	Uploads     UploadConfig      `yaml:"uploads"`
+	RateLimit   RateLimitConfig   `yaml:"rate_limit"`
+	Jobs        JobsConfig        `yaml:"jobs"`
+	Mail        MailConfig        `yaml:"mail"`
+	Webhooks    WebhooksConfig    `yaml:"webhooks"`
+	Idempotency IdempotencyConfig `yaml:"idempotency"`
+	Retention   RetentionConfig   `yaml:"retention"`
+	Metrics     MetricsConfig     `yaml:"metrics"`
+	Log         LogConfig         `yaml:"log"`
+	Tracing     TracingConfig     `yaml:"tracing"`
+}
+
+type ServerConfig struct {
+	Port              string        `yaml:"port" env:"PORT"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"SERVER_READ_HEADER_TIMEOUT"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" env:"SERVER_READ_TIMEOUT"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" env:"SERVER_WRITE_TIMEOUT"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" env:"SERVER_IDLE_TIMEOUT"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout" env:"SERVER_SHUTDOWN_TIMEOUT"`
+	DrainDelay        time.Duration `yaml:"drain_delay" env:"SERVER_DRAIN_DELAY"`
+	TrustedProxies    []string      `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+}
+
+type DatabaseConfig struct {
+	URL             string        `yaml:"url" env:"DB_URL" secret:"url"`
+	MaxOpenConns    int           `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME"`
+	ConnectTimeout  time.Duration `yaml:"connect_timeout" env:"DB_CONNECT_TIMEOUT"`
+}
+
+type AuthConfig struct {
+	JWTSecret        string        `yaml:"jwt_secret" env:"JWT_SECRET" secret:"true"`
+	AccessTokenTTL   time.Duration `yaml:"access_token_ttl" env:"ACCESS_TOKEN_TTL"`
+	LoginMaxFailures int           `yaml:"login_max_failures" env:"LOGIN_MAX_FAILURES"`
+	LoginLockout     time.Duration `yaml:"login_lockout" env:"LOGIN_LOCKOUT"`
+	LoginMaxLockout  time.Duration `yaml:"login_max_lockout" env:"LOGIN_MAX_LOCKOUT"`
+}
+
+// CORSConfig define a política CORS. As origens podem ser exatas
+// (https://app.example.com), com wildcard de subdomínio (https://*.example.com) ou "*".
+type CORSConfig struct {
+	AllowedOrigins   []string      `yaml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS"`
+	AllowedMethods   []string      `yaml:"allowed_methods" env:"CORS_ALLOWED_METHODS"`
+	AllowedHeaders   []string      `yaml:"allowed_headers" env:"CORS_ALLOWED_HEADERS"`
+	ExposedHeaders   []string      `yaml:"exposed_headers" env:"CORS_EXPOSED_HEADERS"`
+	AllowCredentials bool          `yaml:"allow_credentials" env:"CORS_ALLOW_CREDENTIALS"`
+	MaxAge           time.Duration `yaml:"max_age" env:"CORS_MAX_AGE"`
+}
+
+// SecurityConfig define os cabeçalhos de segurança enviados em todas as respostas
+type SecurityConfig struct {
+	HSTSMaxAge            time.Duration `yaml:"hsts_max_age" env:"SECURITY_HSTS_MAX_AGE"`
+	HSTSIncludeSubdomains bool          `yaml:"hsts_include_subdomains" env:"SECURITY_HSTS_INCLUDE_SUBDOMAINS"`
+	ContentSecurityPolicy string        `yaml:"content_security_policy" env:"SECURITY_CSP"`
+	StaticCSP             string        `yaml:"static_content_security_policy" env:"SECURITY_STATIC_CSP"`
+}
+
+// WebSocketConfig define os limites das ligações WebSocket. Sem AllowedOrigins valem
+// as origens do CORS; pedidos sem Origin (clientes que não são browsers) são sempre aceites.
+// Com várias instâncias, Backend tem de ser postgres para os eventos chegarem a todas.
+type WebSocketConfig struct {
+	Backend               string        `yaml:"backend" env:"WS_BACKEND"`
+	AllowedOrigins        []string      `yaml:"allowed_origins" env:"WS_ALLOWED_ORIGINS"`
+	MaxMessageSize        int64         `yaml:"max_message_size" env:"WS_MAX_MESSAGE_SIZE"`
+	MaxConnectionsPerUser int           `yaml:"max_connections_per_user" env:"WS_MAX_CONNECTIONS_PER_USER"`
+	SendBuffer            int           `yaml:"send_buffer" env:"WS_SEND_BUFFER"`
+	PingInterval          time.Duration `yaml:"ping_interval" env:"WS_PING_INTERVAL"`
+	PongTimeout           time.Duration `yaml:"pong_timeout" env:"WS_PONG_TIMEOUT"`
+	WriteTimeout          time.Duration `yaml:"write_timeout" env:"WS_WRITE_TIMEOUT"`
+}
+
+type HealthConfig struct {
+	CheckTimeout time.Duration `yaml:"check_timeout" env:"HEALTH_CHECK_TIMEOUT"`
+}
+
+type UploadConfig struct {
+	Dir               string   `yaml:"dir" env:"UPLOAD_DIR"`
+	MaxImageSize      int64    `yaml:"max_image_size" env:"UPLOAD_MAX_IMAGE_SIZE"`
+	AllowedImageTypes []string `yaml:"allowed_image_types" env:"UPLOAD_ALLOWED_IMAGE_TYPES"`
+	MaxImportSize     int64    `yaml:"max_import_size" env:"UPLOAD_MAX_IMPORT_SIZE"`
+}
+
+type RateLimitConfig struct {
+	Enabled                bool   `yaml:"enabled" env:"RATE_LIMIT_ENABLED"`
+	Store                  string `yaml:"store" env:"RATE_LIMIT_STORE"`
+	RequestsPerMinute      int    `yaml:"requests_per_minute" env:"RATE_LIMIT_RPM"`
+	Burst                  int    `yaml:"burst" env:"RATE_LIMIT_BURST"`
+	AuthRequestsPerMinute  int    `yaml:"auth_requests_per_minute" env:"RATE_LIMIT_AUTH_RPM"`
+	AuthBurst              int    `yaml:"auth_burst" env:"RATE_LIMIT_AUTH_BURST"`
+	WriteRequestsPerMinute int    `yaml:"write_requests_per_minute" env:"RATE_LIMIT_WRITE_RPM"`
+	WriteBurst             int    `yaml:"write_burst" env:"RATE_LIMIT_WRITE_BURST"`
+}
+
+type IdempotencyConfig struct {
+	TTL time.Duration `yaml:"ttl" env:"IDEMPOTENCY_TTL"`
+}
+
+// RetentionConfig define quanto tempo os registos apagados (soft delete) são
+// guardados antes de o job de limpeza os remover de vez
+type RetentionConfig struct {
+	SoftDeleted time.Duration `yaml:"soft_deleted" env:"SOFT_DELETE_RETENTION"`
+}
+
+type JobsConfig struct {
+	Workers      int           `yaml:"workers" env:"JOB_WORKERS"`
+	PollInterval time.Duration `yaml:"poll_interval" env:"JOB_POLL_INTERVAL"`
+}
+
+// MailConfig define como são enviados os emails. Com o driver log as mensagens são só
+// registadas nos logs, o que chega para desenvolvimento.
+type MailConfig struct {
+	Driver       string `yaml:"driver" env:"MAIL_DRIVER"`
+	From         string `yaml:"from" env:"MAIL_FROM"`
+	SMTPHost     string `yaml:"smtp_host" env:"SMTP_HOST"`
+	SMTPPort     int    `yaml:"smtp_port" env:"SMTP_PORT"`
+	SMTPUsername string `yaml:"smtp_username" env:"SMTP_USERNAME"`
+	SMTPPassword string `yaml:"smtp_password" env:"SMTP_PASSWORD" secret:"true"`
+}
+
+// WebhooksConfig define as entregas aos webhooks das lojas. Cada entrega é um job,
+// repetido com backoff exponencial até MaxAttempts.
+type WebhooksConfig struct {
+	Timeout     time.Duration `yaml:"timeout" env:"WEBHOOK_TIMEOUT"`
+	MaxAttempts int           `yaml:"max_attempts" env:"WEBHOOK_MAX_ATTEMPTS"`
+	// AllowPrivateNetworks permite entregar a localhost e a redes privadas; só para
+	// desenvolvimento ou recetores na mesma rede
+	AllowPrivateNetworks bool `yaml:"allow_private_networks" env:"WEBHOOK_ALLOW_PRIVATE_NETWORKS"`
+}
+
+type MetricsConfig struct {
+	Enabled bool   `yaml:"enabled" env:"METRICS_ENABLED"`
+	Path    string `yaml:"path" env:"METRICS_PATH"`
+}
+
+type LogConfig struct {
+	Level  string `yaml:"level" env:"LOG_LEVEL"`
+	Format string `yaml:"format" env:"LOG_FORMAT"`
+}
+
+type TracingConfig struct {
+	Exporter    string  `yaml:"exporter" env:"TRACING_EXPORTER"`
+	Endpoint    string  `yaml:"endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+	Insecure    bool    `yaml:"insecure" env:"OTEL_EXPORTER_OTLP_INSECURE"`
+	SampleRatio float64 `yaml:"sample_ratio" env:"TRACING_SAMPLE_RATIO"`
+	ServiceName string  `yaml:"service_name" env:"OTEL_SERVICE_NAME"`
+}
+
+// Default devolve a configuração usada quando nada é definido
+func Default() *Config {
+	return &Config{
+		Env: "development",
+		Server: ServerConfig{
+			Port:              "8000",
+			ReadHeaderTimeout: 10 * time.Second,
+			ReadTimeout:       30 * time.Second,
+			WriteTimeout:      60 * time.Second,
+			IdleTimeout:       120 * time.Second,
+			ShutdownTimeout:   30 * time.Second,
+		},
+		Database: DatabaseConfig{
+			MaxOpenConns:    25,
+			MaxIdleConns:    10,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+			ConnectTimeout:  5 * time.Second,
+		},
+		Auth: AuthConfig{
+			AccessTokenTTL:   24 * time.Hour,
+			LoginMaxFailures: 5,
+			LoginLockout:     time.Minute,
+			LoginMaxLockout:  time.Hour,
+		},
+		CORS: CORSConfig{
+			AllowedOrigins: []string{
+				"http://localhost:3000",
+				"http://localhost:5173",
+				"http://localhost:8080",
+				"http://127.0.0.1:3000",
+				"http://127.0.0.1:5173",
+				"http://127.0.0.1:8080",
+			},
+			AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+			AllowedHeaders: []string{
+				"Accept", "Authorization", "Cache-Control", "Content-Type",
+				"X-Requested-With", "X-Request-ID", "Idempotency-Key",
+				"If-Match", "If-None-Match",
+			},
+			ExposedHeaders: []string{
+				"X-Request-ID", "Retry-After", "Location", "ETag", "Idempotent-Replayed",
+				"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset",
+			},
+			MaxAge: 24 * time.Hour,
+		},
+		Security: SecurityConfig{
+			HSTSMaxAge:            365 * 24 * time.Hour,
+			ContentSecurityPolicy: "default-src 'none'; frame-ancestors 'none'",
+			// As imagens são ficheiros enviados pelos vendedores: nada de scripts
+			// mesmo que alguém consiga enviar um SVG ou HTML
+			StaticCSP: "default-src 'none'; img-src 'self'; style-src 'unsafe-inline'; sandbox",
+		},
+		WebSocket: WebSocketConfig{
+			Backend:               "memory",
+			MaxMessageSize:        16 * 1024,
+			MaxConnectionsPerUser: 5,
+			SendBuffer:            256,
+			PingInterval:          30 * time.Second,
+			PongTimeout:           60 * time.Second,
+			WriteTimeout:          10 * time.Second,
+		},
+		Health: HealthConfig{
+			CheckTimeout: 2 * time.Second,
+		},
+		Uploads: UploadConfig{
+			Dir:               "./uploads/images",
+			MaxImageSize:      5 * 1024 * 1024,
+			AllowedImageTypes: []string{".jpg", ".jpeg", ".png", ".gif"},
+			MaxImportSize:     20 * 1024 * 1024,
+		},
+		RateLimit: RateLimitConfig{
+			Enabled:                true,
+			Store:                  "memory",
+			RequestsPerMinute:      120,
+			Burst:                  30,
+			AuthRequestsPerMinute:  10,
+			AuthBurst:              5,
+			WriteRequestsPerMinute: 60,
+			WriteBurst:             20,
+		},
+		Jobs: JobsConfig{
+			Workers:      4,
+			PollInterval: 2 * time.Second,
+		},
+		Mail: MailConfig{
+			Driver:   "log",
+			From:     "Modress <no-reply@modress.local>",
+			SMTPPort: 587,
+		},
+		Webhooks: WebhooksConfig{
+			Timeout:     10 * time.Second,
+			MaxAttempts: 8,
+		},
+		Idempotency: IdempotencyConfig{
+			TTL: 24 * time.Hour,
+		},
+		Retention: RetentionConfig{
+			SoftDeleted: 30 * 24 * time.Hour,
+		},
+		Metrics: MetricsConfig{
+			Enabled: true,
+			Path:    "/metrics",
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "json",
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			SampleRatio: 1,
+			ServiceName: "modress-api",
+		},
+	}
+}
+
+// Load lê a configuração. O ficheiro YAML é indicado por CONFIG_FILE (por omissão
+// config.yaml) e o .env por ENV_FILE (por omissão .env); ambos são opcionais.
+func Load() (*Config, error) {
+	cfg := Default()
+
+	yamlPath := os.Getenv("CONFIG_FILE")
+	if yamlPath == "" {
+		yamlPath = "config.yaml"
+	}
+	if err := loadYAML(cfg, yamlPath, os.Getenv("CONFIG_FILE") != ""); err != nil {
+		return nil, err
+	}
+
+	// O .env não substitui variáveis já definidas no ambiente (ex.: em containers)
+	envPath := os.Getenv("ENV_FILE")
+	if envPath == "" {
+		envPath = ".env"
+	}
+	if err := godotenv.Load(envPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("error loading %s: %w", envPath, err)
+	}
+
+	if err := applyEnv(cfg); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func loadYAML(cfg *Config, path string, required bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && !required {
+			return nil
+		}
+		return fmt.Errorf("error reading config file %s: %w", path, err)
+	}
+
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// IsProduction indica se a API corre em produção
+func (c *Config) IsProduction() bool {
+	return c.Env == "production"
+}
+
+// Validate verifica a configuração e devolve todos os problemas encontrados de uma vez
+func (c *Config) Validate() error {
+	var errs []error
+	add := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	switch c.Env {
+	case "development", "staging", "production", "test":
+	default:
+		add("APP_ENV must be one of development, staging, production, test")
+	}
+
+	if c.Server.Port == "" {
+		add("PORT must be set")
+	} else {
+		var port int
+		if _, err := fmt.Sscanf(c.Server.Port, "%d", &port); err != nil || port < 0 || port > 65535 {
+			add("PORT must be a number between 0 and 65535")
+		}
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		add("SERVER_SHUTDOWN_TIMEOUT must be positive")
+	}
+	if c.Server.DrainDelay < 0 {
+		add("SERVER_DRAIN_DELAY must not be negative")
+	}
+
+	if c.Database.URL == "" {
+		add("DB_URL must be set")
+	}
+	if c.Database.MaxOpenConns < 1 {
+		add("DB_MAX_OPEN_CONNS must be at least 1")
+	}
+	if c.Database.MaxIdleConns < 0 || c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		add("DB_MAX_IDLE_CONNS must be between 0 and DB_MAX_OPEN_CONNS")
+	}
+	if c.Database.ConnectTimeout <= 0 {
+		add("DB_CONNECT_TIMEOUT must be positive")
+	}
+
+	if c.Auth.JWTSecret == "" {
+		add("JWT_SECRET must be set")
+	} else if c.IsProduction() && len(c.Auth.JWTSecret) < 32 {
+		add("JWT_SECRET must be at least 32 characters in production")
+	}
+	if c.Auth.AccessTokenTTL <= 0 {
+		add("ACCESS_TOKEN_TTL must be positive")
+	}
+	if c.Auth.LoginMaxFailures < 0 {
+		add("LOGIN_MAX_FAILURES must not be negative")
+	}
+	if c.Auth.LoginMaxFailures > 0 && (c.Auth.LoginLockout <= 0 || c.Auth.LoginMaxLockout < c.Auth.LoginLockout) {
+		add("LOGIN_LOCKOUT must be positive and not greater than LOGIN_MAX_LOCKOUT")
+	}
+
+	validateOrigins("CORS_ALLOWED_ORIGINS", c.CORS.AllowedOrigins, c.CORS.AllowCredentials, add)
+	if len(c.CORS.AllowedMethods) == 0 {
+		add("CORS_ALLOWED_METHODS must not be empty")
+	}
+	if c.CORS.MaxAge < 0 {
+		add("CORS_MAX_AGE must not be negative")
+	}
+
+	if c.WebSocket.Backend != "memory" && c.WebSocket.Backend != "postgres" {
+		add("WS_BACKEND must be memory or postgres")
+	}
+	validateOrigins("WS_ALLOWED_ORIGINS", c.WebSocket.AllowedOrigins, false, add)
+	if c.WebSocket.MaxMessageSize < 1024 {
+		add("WS_MAX_MESSAGE_SIZE must be at least 1024")
+	}
+	if c.WebSocket.MaxConnectionsPerUser < 1 {
+		add("WS_MAX_CONNECTIONS_PER_USER must be at least 1")
+	}
+	if c.WebSocket.SendBuffer < 1 {
+		add("WS_SEND_BUFFER must be at least 1")
+	}
+	if c.WebSocket.WriteTimeout <= 0 {
+		add("WS_WRITE_TIMEOUT must be positive")
+	}
+	if c.WebSocket.PingInterval <= 0 || c.WebSocket.PongTimeout <= c.WebSocket.PingInterval {
+		add("WS_PING_INTERVAL must be positive and less than WS_PONG_TIMEOUT")
+	}
+
+	if c.Security.HSTSMaxAge < 0 {
+		add("SECURITY_HSTS_MAX_AGE must not be negative")
+	}
+
+	if c.Uploads.Dir == "" {
+		add("UPLOAD_DIR must be set")
+	}
+	if c.Uploads.MaxImageSize <= 0 {
+		add("UPLOAD_MAX_IMAGE_SIZE must be positive")
+	}
+	if c.Uploads.MaxImportSize <= 0 {
+		add("UPLOAD_MAX_IMPORT_SIZE must be positive")
+	}
+	if len(c.Uploads.AllowedImageTypes) == 0 {
+		add("UPLOAD_ALLOWED_IMAGE_TYPES must not be empty")
+	}
+
+	if c.RateLimit.Enabled {
+		if c.RateLimit.Store != "memory" && c.RateLimit.Store != "postgres" {
+			add("RATE_LIMIT_STORE must be memory or postgres")
+		}
+		if c.RateLimit.RequestsPerMinute < 1 || c.RateLimit.AuthRequestsPerMinute < 1 || c.RateLimit.WriteRequestsPerMinute < 1 {
+			add("RATE_LIMIT_RPM, RATE_LIMIT_AUTH_RPM and RATE_LIMIT_WRITE_RPM must be at least 1")
+		}
+		if c.RateLimit.Burst < 1 || c.RateLimit.AuthBurst < 1 || c.RateLimit.WriteBurst < 1 {
+			add("RATE_LIMIT_BURST, RATE_LIMIT_AUTH_BURST and RATE_LIMIT_WRITE_BURST must be at least 1")
+		}
+	}
+
+	if c.Jobs.Workers < 1 {
+		add("JOB_WORKERS must be at least 1")
+	}
+	switch c.Mail.Driver {
+	case "log":
+	case "smtp":
+		if c.Mail.SMTPHost == "" {
+			add("SMTP_HOST must be set when MAIL_DRIVER is smtp")
+		}
+		if c.Mail.SMTPPort < 1 || c.Mail.SMTPPort > 65535 {
+			add("SMTP_PORT must be a valid port")
+		}
+		if _, err := mail.ParseAddress(c.Mail.From); err != nil {
+			add("MAIL_FROM must be a valid address")
+		}
+	default:
+		add("MAIL_DRIVER must be log or smtp")
+	}
+	if c.Webhooks.Timeout <= 0 {
+		add("WEBHOOK_TIMEOUT must be positive")
+	}
+	if c.Webhooks.MaxAttempts < 1 {
+		add("WEBHOOK_MAX_ATTEMPTS must be at least 1")
+	}
+	if c.Idempotency.TTL <= 0 {
+		add("IDEMPOTENCY_TTL must be positive")
+	}
+	if c.Retention.SoftDeleted <= 0 {
+		add("SOFT_DELETE_RETENTION must be positive")
+	}
+
+	switch c.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		add("LOG_LEVEL must be one of debug, info, warn, error")
+	}
+	if c.Log.Format != "json" && c.Log.Format != "text" {
+		add("LOG_FORMAT must be json or text")
+	}
+
+	switch c.Tracing.Exporter {
+	case "none", "stdout", "otlp":
+	default:
+		add("TRACING_EXPORTER must be one of none, stdout, otlp")
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		add("TRACING_SAMPLE_RATIO must be between 0 and 1")
+	}
+
+	if c.Metrics.Enabled && !strings.HasPrefix(c.Metrics.Path, "/") {
+		add("METRICS_PATH must start with /")
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// validateOrigins verifica uma lista de origens: exatas, com wildcard de subdomínio ou "*"
+func validateOrigins(name string, origins []string, credentials bool, add func(string, ...interface{})) {
+	for _, origin := range origins {
+		if origin == "*" {
+			if credentials {
+				add("%s cannot contain * when CORS_ALLOW_CREDENTIALS is true", name)
+			}
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" {
+			add("%s contains an invalid origin: %q", name, origin)
+			continue
+		}
+		if host := u.Hostname(); strings.Contains(host, "*") && (!strings.HasPrefix(host, "*.") || strings.Count(host, "*") > 1) {
+			add("%s wildcard must be a leading subdomain, like https://*.example.com: %q", name, origin)
+		}
+	}
+}
+
+// WebSocketOrigins devolve as origens aceites no WebSocket: as próprias ou, sem elas, as do CORS
+func (c *Config) WebSocketOrigins() []string {
+	if len(c.WebSocket.AllowedOrigins) > 0 {
+		return c.WebSocket.AllowedOrigins
+	}
+	return c.CORS.AllowedOrigins
+}
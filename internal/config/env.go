@@ -0,0 +1,134 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// applyEnv percorre a struct e substitui cada campo com tag env pela variável de ambiente,
+// quando esta está definida
+func applyEnv(cfg *Config) error {
+	return walk(reflect.ValueOf(cfg).Elem(), func(field reflect.StructField, v reflect.Value) error {
+		name := field.Tag.Get("env")
+		if name == "" {
+			return nil
+		}
+		raw, ok := os.LookupEnv(name)
+		if !ok {
+			return nil
+		}
+		if err := setValue(v, strings.TrimSpace(raw)); err != nil {
+			return fmt.Errorf("invalid value for %s: %w", name, err)
+		}
+		return nil
+	})
+}
+
+func walk(v reflect.Value, fn func(reflect.StructField, reflect.Value) error) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field, value := t.Field(i), v.Field(i)
+		if field.Type.Kind() == reflect.Struct && field.Type != reflect.TypeOf(time.Duration(0)) {
+			if err := walk(value, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := fn(field, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setValue(v reflect.Value, raw string) error {
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported config type %s", v.Type())
+	}
+	return nil
+}
+
+// Summary devolve a configuração efetiva, uma linha por variável, com os segredos ocultados
+func (c *Config) Summary() string {
+	var lines []string
+	walk(reflect.ValueOf(c).Elem(), func(field reflect.StructField, v reflect.Value) error {
+		name := field.Tag.Get("env")
+		if name == "" {
+			return nil
+		}
+		lines = append(lines, fmt.Sprintf("%s=%s", name, redact(field.Tag.Get("secret"), v)))
+		return nil
+	})
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
+
+func redact(secret string, v reflect.Value) string {
+	value := fmt.Sprint(v.Interface())
+	if v.Kind() == reflect.Slice {
+		parts := make([]string, v.Len())
+		for i := range parts {
+			parts[i] = fmt.Sprint(v.Index(i).Interface())
+		}
+		value = strings.Join(parts, ",")
+	}
+
+	switch {
+	case value == "":
+		return "(unset)"
+	case secret == "true":
+		return "********"
+	case secret == "url":
+		// Manter host e base de dados visíveis, esconder apenas a password
+		if u, err := url.Parse(value); err == nil && u.Scheme != "" {
+			return u.Redacted()
+		}
+		return "********"
+	default:
+		return value
+	}
+}
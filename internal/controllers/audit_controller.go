@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"modress/internal/models"
+	"modress/internal/services"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuditController exposes the audit log to admins.
+type AuditController struct {
+	auditService services.AuditService
+}
+
+// NewAuditController creates a new AuditController instance.
+func NewAuditController(auditService services.AuditService) *AuditController {
+	return &AuditController{auditService: auditService}
+}
+
+// ListEvents lists audit events, newest first, optionally filtered by actor,
+// entity, action and time range.
+func (c *AuditController) ListEvents(ctx *gin.Context) {
+	page, limit := parsePaginationParams(ctx.Query("page"), ctx.Query("limit"))
+	filter := models.AuditFilter{
+		EntityType: ctx.Query("entity_type"),
+		Action:     ctx.Query("action"),
+		Page:       page,
+		Limit:      limit,
+	}
+
+	var err error
+	if filter.ActorID, err = queryID(ctx, "actor_id"); err != nil {
+		ctx.Error(err)
+		return
+	}
+	if filter.EntityID, err = queryID(ctx, "entity_id"); err != nil {
+		ctx.Error(err)
+		return
+	}
+	if filter.From, err = queryTime(ctx, "from"); err != nil {
+		ctx.Error(err)
+		return
+	}
+	if filter.To, err = queryTime(ctx, "to"); err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	events, err := c.auditService.ListEvents(ctx.Request.Context(), filter)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, events)
+}
+
+// queryID reads an optional positive ID from the query string; absent means 0.
+func queryID(ctx *gin.Context, name string) (int64, error) {
+	value := ctx.Query(name)
+	if value == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, services.NewFieldError(name, "invalid", name+" must be a positive integer")
+	}
+	return id, nil
+}
+
+// queryTime reads an optional RFC 3339 timestamp from the query string.
+func queryTime(ctx *gin.Context, name string) (time.Time, error) {
+	value := ctx.Query(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, services.NewFieldError(name, "invalid", name+" must be an RFC 3339 timestamp")
+	}
+	return t, nil
+}
@@ -0,0 +1,196 @@
+package controllers
+
+import (
+	"modress/internal/models"
+	"modress/internal/services"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ChatController exposes conversations and their message history. Messages sent
+// here are delivered in real time through the WebSocket hub, like those sent on
+// the socket itself.
+type ChatController struct {
+	chatService services.ChatService
+	hub         *WebSocketController
+}
+
+// NewChatController creates a new ChatController instance.
+func NewChatController(chatService services.ChatService, hub *WebSocketController) *ChatController {
+	return &ChatController{
+		chatService: chatService,
+		hub:         hub,
+	}
+}
+
+// ListConversations lists the user's conversations, most recent first, with
+// their unread counts.
+func (c *ChatController) ListConversations(ctx *gin.Context) {
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	page, limit := parsePaginationParams(ctx.Query("page"), ctx.Query("limit"))
+	conversations, err := c.chatService.ListConversations(ctx.Request.Context(), userID, page, limit)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, conversations)
+}
+
+// StartConversation opens the user's conversation with a store, or returns the
+// existing one.
+func (c *ChatController) StartConversation(ctx *gin.Context) {
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var req models.StartConversationRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.Error(services.NewValidationError(err))
+		return
+	}
+	if err := req.Validate(); err != nil {
+		ctx.Error(services.NewValidationError(err))
+		return
+	}
+
+	conversation, created, err := c.chatService.StartConversation(ctx.Request.Context(), userID, req.StoreID)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	ctx.JSON(status, conversation)
+}
+
+// UnreadCount returns how many received messages the user has not read yet.
+func (c *ChatController) UnreadCount(ctx *gin.Context) {
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	count, err := c.chatService.UnreadCount(ctx.Request.Context(), userID)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"unread": count})
+}
+
+// GetMessages pages backwards through a conversation: newest first, and
+// before_id returns the messages older than the given one.
+func (c *ChatController) GetMessages(ctx *gin.Context) {
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	id, err := paramID(ctx, "id", "conversation")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	beforeID, err := queryID(ctx, "before_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	limit, _ := strconv.Atoi(ctx.Query("limit"))
+
+	messages, err := c.chatService.GetMessages(ctx.Request.Context(), userID, id, beforeID, limit)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, messages)
+}
+
+// SendMessage stores a message in the conversation and delivers it to the
+// other participant if they are connected.
+func (c *ChatController) SendMessage(ctx *gin.Context) {
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	id, err := paramID(ctx, "id", "conversation")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var req models.SendMessageRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.Error(services.NewValidationError(err))
+		return
+	}
+	req.ConversationID = id
+	req.StoreID = 0
+
+	message, err := c.chatService.SendMessage(ctx.Request.Context(), userID, &req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	c.hub.DeliverMessage(ctx.Request.Context(), message)
+
+	ctx.JSON(http.StatusCreated, message)
+}
+
+// MarkRead marks the messages received in the conversation as read, up to
+// up_to_id or all of them, and sends a read receipt to the sender.
+func (c *ChatController) MarkRead(ctx *gin.Context) {
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	id, err := paramID(ctx, "id", "conversation")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	// O corpo é opcional: sem ele marca todas
+	var req models.MarkReadRequest
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.Error(services.NewValidationError(err))
+			return
+		}
+	}
+
+	receipt, err := c.chatService.MarkRead(ctx.Request.Context(), userID, id, req.UpToID)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	if receipt == nil {
+		ctx.Status(http.StatusNoContent)
+		return
+	}
+	c.hub.SendReadReceipt(ctx.Request.Context(), receipt)
+
+	ctx.JSON(http.StatusOK, receipt)
+}
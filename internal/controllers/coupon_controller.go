@@ -0,0 +1,212 @@
+package controllers
+
+import (
+	"net/http"
+
+	"modress/internal/models"
+	"modress/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// couponScopeKey guarda no contexto a loja dos cupões geridos no pedido; 0 são os
+// do marketplace
+const couponScopeKey = "couponStoreID"
+
+// CouponController handles discount coupons: their management by store owners
+// (for their store) and admins (marketplace-wide), and applying them to a cart.
+type CouponController struct {
+	couponService services.CouponService
+	storeService  services.StoreService
+}
+
+// NewCouponController creates a new CouponController instance.
+func NewCouponController(couponService services.CouponService, storeService services.StoreService) *CouponController {
+	return &CouponController{
+		couponService: couponService,
+		storeService:  storeService,
+	}
+}
+
+// StoreScope makes the coupon routes it guards manage the coupons of the
+// authenticated user's store.
+func (c *CouponController) StoreScope(ctx *gin.Context) {
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		ctx.Abort()
+		return
+	}
+
+	store, err := storeOwnedBy(ctx, c.storeService, userID)
+	if err != nil {
+		ctx.Error(err)
+		ctx.Abort()
+		return
+	}
+
+	ctx.Set(couponScopeKey, store.ID)
+	ctx.Next()
+}
+
+// MarketplaceScope makes the coupon routes it guards manage the marketplace-wide
+// coupons. It must run after the admin role check.
+func (c *CouponController) MarketplaceScope(ctx *gin.Context) {
+	ctx.Set(couponScopeKey, int64(0))
+	ctx.Next()
+}
+
+// ListCoupons lists the coupons of the scope, newest first.
+func (c *CouponController) ListCoupons(ctx *gin.Context) {
+	page, limit := parsePaginationParams(ctx.Query("page"), ctx.Query("limit"))
+	coupons, err := c.couponService.ListCoupons(ctx.Request.Context(), ctx.GetInt64(couponScopeKey), page, limit)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, coupons)
+}
+
+// CreateCoupon creates a coupon in the scope.
+func (c *CouponController) CreateCoupon(ctx *gin.Context) {
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var req models.CreateCouponRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.Error(services.NewValidationError(err))
+		return
+	}
+
+	coupon, err := c.couponService.CreateCoupon(ctx.Request.Context(), ctx.GetInt64(couponScopeKey), userID, &req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, coupon)
+}
+
+// GetCoupon returns a coupon of the scope.
+func (c *CouponController) GetCoupon(ctx *gin.Context) {
+	id, err := paramID(ctx, "id", "coupon")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	coupon, err := c.couponService.GetCoupon(ctx.Request.Context(), ctx.GetInt64(couponScopeKey), id)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, coupon)
+}
+
+// UpdateCoupon changes the limits, validity or status of a coupon of the scope.
+func (c *CouponController) UpdateCoupon(ctx *gin.Context) {
+	id, err := paramID(ctx, "id", "coupon")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var req models.UpdateCouponRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.Error(services.NewValidationError(err))
+		return
+	}
+
+	coupon, err := c.couponService.UpdateCoupon(ctx.Request.Context(), ctx.GetInt64(couponScopeKey), id, &req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, coupon)
+}
+
+// DeleteCoupon deletes a coupon of the scope that was never redeemed.
+func (c *CouponController) DeleteCoupon(ctx *gin.Context) {
+	id, err := paramID(ctx, "id", "coupon")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	if err := c.couponService.DeleteCoupon(ctx.Request.Context(), ctx.GetInt64(couponScopeKey), id); err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// ListRedemptions lists the redemptions of a coupon of the scope, newest first.
+func (c *CouponController) ListRedemptions(ctx *gin.Context) {
+	id, err := paramID(ctx, "id", "coupon")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	page, limit := parsePaginationParams(ctx.Query("page"), ctx.Query("limit"))
+	redemptions, err := c.couponService.ListRedemptions(ctx.Request.Context(), ctx.GetInt64(couponScopeKey), id, page, limit)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, redemptions)
+}
+
+// QuoteCoupon calculates the discount of a coupon on a cart without redeeming it.
+func (c *CouponController) QuoteCoupon(ctx *gin.Context) {
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var req models.QuoteCouponRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.Error(services.NewValidationError(err))
+		return
+	}
+
+	quote, err := c.couponService.Quote(ctx.Request.Context(), userID, &req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, quote)
+}
+
+// RedeemCoupon redeems a coupon on a cart and returns the recorded redemption.
+func (c *CouponController) RedeemCoupon(ctx *gin.Context) {
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var req models.RedeemCouponRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.Error(services.NewValidationError(err))
+		return
+	}
+
+	redemption, err := c.couponService.Redeem(ctx.Request.Context(), userID, &req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, redemption)
+}
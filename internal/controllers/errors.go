@@ -0,0 +1,61 @@
+package controllers
+
+import (
+	"errors"
+	"strconv"
+
+	"modress/internal/models"
+	"modress/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Os controllers não escrevem respostas de erro: registam o erro com ctx.Error e
+// retornam, e o middleware.ErrorMiddleware converte-o em problem+json.
+
+var (
+	errUnauthenticated = services.NewError(services.ErrUnauthorized, "unauthenticated", "authentication required")
+	errStoreRequired   = services.NewError(services.ErrForbidden, "store_required", "user does not have a store")
+
+	errOriginNotAllowed   = services.NewError(services.ErrForbidden, "origin_not_allowed", "websocket connections are not allowed from this origin")
+	errTooManyConnections = services.NewError(services.ErrRateLimited, "too_many_connections", "too many open websocket connections")
+)
+
+// currentUserID devolve o ID do utilizador autenticado, definido pelo AuthMiddleware
+func currentUserID(ctx *gin.Context) (int64, error) {
+	userID, exists := ctx.Get("userID")
+	if !exists {
+		return 0, errUnauthenticated
+	}
+
+	id, ok := userID.(int64)
+	if !ok {
+		return 0, errUnauthenticated
+	}
+
+	return id, nil
+}
+
+// isAdmin indica se o utilizador autenticado tem o papel admin
+func isAdmin(ctx *gin.Context) bool {
+	role, _ := ctx.Get("userRole")
+	return role == "admin"
+}
+
+// paramID lê um ID numérico da rota; label entra na mensagem ("invalid product ID")
+func paramID(ctx *gin.Context, name, label string) (int64, error) {
+	id, err := strconv.ParseInt(ctx.Param(name), 10, 64)
+	if err != nil {
+		return 0, services.NewFieldError(name, "invalid", "invalid "+label+" ID")
+	}
+	return id, nil
+}
+
+// storeOwnedBy devolve a loja do utilizador; não ter loja é um 403, não um 404
+func storeOwnedBy(ctx *gin.Context, storeService services.StoreService, userID int64) (*models.StoreResponse, error) {
+	store, err := storeService.GetStoreByOwnerID(ctx.Request.Context(), userID)
+	if errors.Is(err, services.ErrStoreNotFound) {
+		return nil, errStoreRequired
+	}
+	return store, err
+}
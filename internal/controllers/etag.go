@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"modress/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Os produtos e as lojas têm uma coluna version incrementada em cada escrita aos seus
+// próprios campos. A ETag junta essa versão a um hash do corpo ("<id>-<version>.<hash>"):
+// If-Match só olha para a versão, para os clientes não sobrescreverem alterações de
+// outros, e If-None-Match compara a ETag inteira. Os valores agregados (médias das
+// avaliações, seguidores) mudam sem incrementar a versão, mas mudam o hash, por isso
+// uma cópia revalidada nunca os mostra desatualizados.
+
+// respondVersioned escreve body com a ETag do recurso. Num GET cujo If-None-Match
+// corresponde à ETag atual responde 304 sem corpo.
+func respondVersioned(ctx *gin.Context, status int, id, version int64, body interface{}) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		ctx.Error(fmt.Errorf("error encoding response: %w", err))
+		return
+	}
+	sum := sha256.Sum256(payload)
+	tag := fmt.Sprintf(`"%d-%d.%s"`, id, version, hex.EncodeToString(sum[:8]))
+	respondTagged(ctx, status, tag, payload)
+}
+
+// respondHashed é o respondVersioned das representações com dados calculados no
+// momento, como o perfil da loja: a ETag é o hash do corpo e serve só para revalidar
+// (If-None-Match), nunca para If-Match.
+func respondHashed(ctx *gin.Context, status int, body interface{}) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		ctx.Error(fmt.Errorf("error encoding response: %w", err))
+		return
+	}
+	sum := sha256.Sum256(payload)
+	respondTagged(ctx, status, `"`+hex.EncodeToString(sum[:16])+`"`, payload)
+}
+
+// respondTagged escreve payload com a ETag tag, ou 304 num GET cujo If-None-Match
+// lhe corresponde.
+func respondTagged(ctx *gin.Context, status int, tag string, payload []byte) {
+	ctx.Header("ETag", tag)
+
+	method := ctx.Request.Method
+	if (method == http.MethodGet || method == http.MethodHead) && noneMatch(ctx.GetHeader("If-None-Match"), tag) {
+		ctx.Status(http.StatusNotModified)
+		return
+	}
+
+	ctx.Data(status, "application/json; charset=utf-8", payload)
+}
+
+// noneMatch diz se If-None-Match corresponde a tag; usa a comparação fraca (RFC 9110 13.1.2)
+func noneMatch(header, tag string) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatchVersion lê a versão pedida em If-Match para o recurso id. Sem cabeçalho, ou
+// com "*", devolve 0 (sem pré-condição). Conta só a versão: o hash que a segue na ETag
+// pode mudar com os valores agregados sem que o recurso tenha sido alterado. Uma ETag
+// fraca ou de outro recurso nunca corresponde, e o pedido falha com 412.
+func ifMatchVersion(ctx *gin.Context, id int64) (int64, error) {
+	header := strings.TrimSpace(ctx.GetHeader("If-Match"))
+	if header == "" || header == "*" {
+		return 0, nil
+	}
+
+	prefix := `"` + strconv.FormatInt(id, 10) + "-"
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if !strings.HasPrefix(candidate, prefix) || !strings.HasSuffix(candidate, `"`) {
+			continue
+		}
+		value := candidate[len(prefix) : len(candidate)-1]
+		if dot := strings.IndexByte(value, '.'); dot >= 0 {
+			value = value[:dot]
+		}
+		version, err := strconv.ParseInt(value, 10, 64)
+		if err == nil && version > 0 {
+			return version, nil
+		}
+	}
+	return 0, services.ErrVersionMismatch
+}
@@ -0,0 +1,38 @@
+package controllers
+
+import (
+	"net/http"
+
+	"modress/internal/health"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HealthController serves the liveness and readiness probes.
+type HealthController struct {
+	checker *health.Checker
+}
+
+// NewHealthController creates a new HealthController instance.
+func NewHealthController(checker *health.Checker) *HealthController {
+	return &HealthController{checker: checker}
+}
+
+// Liveness reports that the process is up. It never touches dependencies, so a
+// slow database does not get the pod restarted.
+func (c *HealthController) Liveness(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"status": health.StatusOK})
+}
+
+// Readiness runs every dependency check and returns 503 if any of them fails.
+func (c *HealthController) Readiness(ctx *gin.Context) {
+	report := c.checker.Ready(ctx.Request.Context())
+
+	status := http.StatusOK
+	if report.Status != health.StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+
+	ctx.Header("Cache-Control", "no-store")
+	ctx.JSON(status, report)
+}
@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"modress/internal/models"
+	"modress/internal/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JobController exposes the background job queue to admins.
+type JobController struct {
+	jobService services.JobService
+}
+
+// NewJobController creates a new JobController instance.
+func NewJobController(jobService services.JobService) *JobController {
+	return &JobController{jobService: jobService}
+}
+
+// ListJobs lists jobs, optionally filtered by status and type.
+func (c *JobController) ListJobs(ctx *gin.Context) {
+	page, limit := parsePaginationParams(ctx.Query("page"), ctx.Query("limit"))
+
+	jobs, err := c.jobService.ListJobs(ctx.Request.Context(), models.JobFilter{
+		Status: ctx.Query("status"),
+		Type:   ctx.Query("type"),
+		Page:   page,
+		Limit:  limit,
+	})
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, jobs)
+}
+
+// GetJob returns a single job, including its payload and last error.
+func (c *JobController) GetJob(ctx *gin.Context) {
+	id, err := paramID(ctx, "id", "job")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	job, err := c.jobService.GetJob(ctx.Request.Context(), id)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, job)
+}
+
+// RetryJob puts a dead job back on the queue.
+func (c *JobController) RetryJob(ctx *gin.Context) {
+	id, err := paramID(ctx, "id", "job")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	job, err := c.jobService.RetryJob(ctx.Request.Context(), id)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, job)
+}
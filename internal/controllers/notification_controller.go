@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"modress/internal/models"
+	"modress/internal/services"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NotificationController exposes the user's notification centre and the
+// preferences that choose how each notification type is delivered.
+type NotificationController struct {
+	notificationService services.NotificationService
+}
+
+// NewNotificationController creates a new NotificationController instance.
+func NewNotificationController(notificationService services.NotificationService) *NotificationController {
+	return &NotificationController{notificationService: notificationService}
+}
+
+// ListNotifications lists the user's notifications, newest first; unread=true
+// returns only those not read yet.
+func (c *NotificationController) ListNotifications(ctx *gin.Context) {
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	unreadOnly := false
+	if value := ctx.Query("unread"); value != "" {
+		if unreadOnly, err = strconv.ParseBool(value); err != nil {
+			ctx.Error(services.NewFieldError("unread", "boolean", "unread must be true or false"))
+			return
+		}
+	}
+
+	page, limit := parsePaginationParams(ctx.Query("page"), ctx.Query("limit"))
+	notifications, err := c.notificationService.List(ctx.Request.Context(), userID, unreadOnly, page, limit)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, notifications)
+}
+
+// UnreadCount returns how many notifications the user has not read yet.
+func (c *NotificationController) UnreadCount(ctx *gin.Context) {
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	count, err := c.notificationService.UnreadCount(ctx.Request.Context(), userID)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"unread": count})
+}
+
+// MarkRead marks one of the user's notifications as read.
+func (c *NotificationController) MarkRead(ctx *gin.Context) {
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	id, err := paramID(ctx, "id", "notification")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	notification, err := c.notificationService.MarkRead(ctx.Request.Context(), userID, id)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, notification)
+}
+
+// MarkAllRead marks every unread notification of the user as read.
+func (c *NotificationController) MarkAllRead(ctx *gin.Context) {
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	count, err := c.notificationService.MarkAllRead(ctx.Request.Context(), userID)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"updated": count})
+}
+
+// GetPreferences returns the delivery channels of every notification type.
+func (c *NotificationController) GetPreferences(ctx *gin.Context) {
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	preferences, err := c.notificationService.GetPreferences(ctx.Request.Context(), userID)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, preferences)
+}
+
+// UpdatePreferences changes the delivery channels of the given notification
+// types and returns the preferences of all types.
+func (c *NotificationController) UpdatePreferences(ctx *gin.Context) {
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var req models.UpdateNotificationPreferencesRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.Error(services.NewValidationError(err))
+		return
+	}
+
+	preferences, err := c.notificationService.UpdatePreferences(ctx.Request.Context(), userID, &req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, preferences)
+}
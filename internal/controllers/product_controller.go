@@ -11,6 +11,7 @@ import (
 	"strings"
 	"time"
 
+	"modress/internal/config"
 	"modress/internal/models"
 	"modress/internal/services"
 
@@ -21,41 +22,31 @@ import (
 type ProductController struct {
     productService services.ProductService
     storeService   services.StoreService
+    uploads        config.UploadConfig
 }
 
 // NewProductController creates a new ProductController instance.
-func NewProductController(productService services.ProductService, storeService services.StoreService) *ProductController {
+func NewProductController(productService services.ProductService, storeService services.StoreService, uploads config.UploadConfig) *ProductController {
     return &ProductController{
         productService: productService,
         storeService:   storeService,
+        uploads:        uploads,
     }
 }
 
-// getUserAndStore retrieves the user ID and store from the context, performing necessary validations.
+// getUserAndStore retrieves the user ID and the store they own from the context.
 func (c *ProductController) getUserAndStore(ctx *gin.Context) (int64, *models.StoreResponse, error) {
-    userID, exists := ctx.Get("userID")
-    if !exists {
-        ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized: user ID not found in context"})
-        return 0, nil, nil
-    }
-
-    userIDInt64, ok := userID.(int64)
-    if !ok {
-        ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID format"})
-        return 0, nil, nil
+    userID, err := currentUserID(ctx)
+    if err != nil {
+        return 0, nil, err
     }
 
-    store, err := c.storeService.GetStoreByOwnerID(ctx.Request.Context(), userIDInt64)
+    store, err := storeOwnedBy(ctx, c.storeService, userID)
     if err != nil {
-        if err.Error() == "store not found" {
-            ctx.JSON(http.StatusForbidden, gin.H{"error": "User does not have a store"})
-        } else {
-            ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve store: " + err.Error()})
-        }
         return 0, nil, err
     }
 
-    return userIDInt64, store, nil
+    return userID, store, nil
 }
 
 // parsePaginationParams validates and parses pagination parameters, setting defaults if needed.
@@ -76,71 +67,66 @@ func parsePaginationParams(pageStr, limitStr string) (int, int) {
 // CreateProduct handles the creation of a new product.
 func (c *ProductController) CreateProduct(ctx *gin.Context) {
     // Check for context cancellation
-    if ctx.Request.Context().Err() != nil {
-        ctx.JSON(http.StatusRequestTimeout, gin.H{"error": "Request cancelled or timed out"})
+    if err := ctx.Request.Context().Err(); err != nil {
+        ctx.Error(err)
         return
     }
 
     _, store, err := c.getUserAndStore(ctx)
     if err != nil {
-        return 
+        ctx.Error(err)
+        return
     }
 
     var req models.CreateProductRequest
     if err := ctx.ShouldBindJSON(&req); err != nil {
-        ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON: " + err.Error()})
+        ctx.Error(services.NewValidationError(err))
         return
     }
 
     product, err := c.productService.CreateProduct(ctx.Request.Context(), store.ID, &req)
     if err != nil {
-        ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        ctx.Error(err)
         return
     }
 
-    ctx.JSON(http.StatusCreated, product)
+    respondVersioned(ctx, http.StatusCreated, product.ID, product.Version, product)
 }
 
 // GetProduct retrieves a product by its ID.
 func (c *ProductController) GetProduct(ctx *gin.Context) {
-    idStr := ctx.Param("id")
-    id, err := strconv.ParseInt(idStr, 10, 64)
+    id, err := paramID(ctx, "id", "product")
     if err != nil {
-        ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+        ctx.Error(err)
         return
     }
 
     // Check for context cancellation
-    if ctx.Request.Context().Err() != nil {
-        ctx.JSON(http.StatusRequestTimeout, gin.H{"error": "Request cancelled or timed out"})
+    if err := ctx.Request.Context().Err(); err != nil {
+        ctx.Error(err)
         return
     }
 
     product, err := c.productService.GetProductByID(ctx.Request.Context(), id)
     if err != nil {
-        if err.Error() == "product not found" {
-            ctx.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
-        } else {
-            ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve product: " + err.Error()})
-        }
+        ctx.Error(err)
         return
     }
 
-    ctx.JSON(http.StatusOK, product)
+    respondVersioned(ctx, http.StatusOK, product.ID, product.Version, product)
 }
 
 // GetProductsByStore retrieves products for a specific store with pagination.
 func (c *ProductController) GetProductsByStore(ctx *gin.Context) {
-    storeIDStr := ctx.Param("storeId")
-    storeID, err := strconv.ParseInt(storeIDStr, 10, 64)
+    storeID, err := paramID(ctx, "storeId", "store")
     if err != nil {
-        ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid store ID"})
+        ctx.Error(err)
         return
     }
 
     // Check for context cancellation
-    if ctx.Request.Context().Err() != nil {
-        ctx.JSON(http.StatusRequestTimeout, gin.H{"error": "Request cancelled or timed out"})
+    if err := ctx.Request.Context().Err(); err != nil {
+        ctx.Error(err)
         return
     }
 
@@ -148,7 +134,7 @@ func (c *ProductController) GetProductsByStore(ctx *gin.Context) {
 
     products, err := c.productService.GetProductsByStoreID(ctx.Request.Context(), storeID, page, limit)
     if err != nil {
-        ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve products: " + err.Error()})
+        ctx.Error(err)
         return
     }
 
@@ -159,13 +145,13 @@ func (c *ProductController) GetProductsByStore(ctx *gin.Context) {
 func (c *ProductController) GetProductsByCategory(ctx *gin.Context) {
     category := ctx.Param("category")
     if category == "" {
-        ctx.JSON(http.StatusBadRequest, gin.H{"error": "Category parameter is required"})
+        ctx.Error(services.NewFieldError("category", "required", "category is required"))
         return
     }
 
     // Check for context cancellation
-    if ctx.Request.Context().Err() != nil {
-        ctx.JSON(http.StatusRequestTimeout, gin.H{"error": "Request cancelled or timed out"})
+    if err := ctx.Request.Context().Err(); err != nil {
+        ctx.Error(err)
         return
     }
 
@@ -173,7 +159,7 @@ func (c *ProductController) GetProductsByCategory(ctx *gin.Context) {
 
     products, err := c.productService.GetProductsByCategory(ctx.Request.Context(), category, page, limit)
     if err != nil {
-        ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve products by category: " + err.Error()})
+        ctx.Error(err)
         return
     }
 
@@ -183,117 +169,166 @@ func (c *ProductController) GetProductsByCategory(ctx *gin.Context) {
 // UpdateProduct updates an existing product.
 func (c *ProductController) UpdateProduct(ctx *gin.Context) {
     // Check for context cancellation
-    if ctx.Request.Context().Err() != nil {
-        ctx.JSON(http.StatusRequestTimeout, gin.H{"error": "Request cancelled or timed out"})
+    if err := ctx.Request.Context().Err(); err != nil {
+        ctx.Error(err)
         return
     }
 
     _, store, err := c.getUserAndStore(ctx)
     if err != nil {
-        return 
+        ctx.Error(err)
+        return
     }
 
-    idStr := ctx.Param("id")
-    id, err := strconv.ParseInt(idStr, 10, 64)
+    id, err := paramID(ctx, "id", "product")
     if err != nil {
-        ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+        ctx.Error(err)
+        return
+    }
+
+    version, err := ifMatchVersion(ctx, id)
+    if err != nil {
+        ctx.Error(err)
         return
     }
 
     var req models.UpdateProductRequest
     if err := ctx.ShouldBindJSON(&req); err != nil {
-        ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON: " + err.Error()})
+        ctx.Error(services.NewValidationError(err))
         return
     }
 
-    product, err := c.productService.UpdateProduct(ctx.Request.Context(), id, store.ID, &req)
+    product, err := c.productService.UpdateProduct(ctx.Request.Context(), id, store.ID, version, &req)
     if err != nil {
-        if err.Error() == "product not found" {
-            ctx.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
-        } else if err.Error() == "unauthorized: product does not belong to store" {
-            ctx.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized: product does not belong to store"})
-        } else {
-            ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-        }
+        ctx.Error(err)
         return
     }
 
-    ctx.JSON(http.StatusOK, product)
+    respondVersioned(ctx, http.StatusOK, product.ID, product.Version, product)
 }
 
 // DeleteProduct deletes a product.
 func (c *ProductController) DeleteProduct(ctx *gin.Context) {
     // Check for context cancellation
-    if ctx.Request.Context().Err() != nil {
-        ctx.JSON(http.StatusRequestTimeout, gin.H{"error": "Request cancelled or timed out"})
+    if err := ctx.Request.Context().Err(); err != nil {
+        ctx.Error(err)
         return
     }
 
     _, store, err := c.getUserAndStore(ctx)
     if err != nil {
+        ctx.Error(err)
         return
     }
 
-    idStr := ctx.Param("id")
-    id, err := strconv.ParseInt(idStr, 10, 64)
+    id, err := paramID(ctx, "id", "product")
     if err != nil {
-        ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+        ctx.Error(err)
         return
     }
 
-    err = c.productService.DeleteProduct(ctx.Request.Context(), id, store.ID)
+    version, err := ifMatchVersion(ctx, id)
     if err != nil {
-        if err.Error() == "product not found" {
-            ctx.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
-        } else if err.Error() == "unauthorized: product does not belong to store" {
-            ctx.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized: product does not belong to store"})
-        } else {
-            ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete product: " + err.Error()})
-        }
+        ctx.Error(err)
+        return
+    }
+
+    err = c.productService.DeleteProduct(ctx.Request.Context(), id, store.ID, version)
+    if err != nil {
+        ctx.Error(err)
         return
     }
 
     ctx.Status(http.StatusNoContent)
 }
 
-// ListProducts lists all products with pagination.
+// RestoreProduct restores a deleted product. Store owners can restore their own
+// products; admins can restore any product.
+func (c *ProductController) RestoreProduct(ctx *gin.Context) {
+    id, err := paramID(ctx, "id", "product")
+    if err != nil {
+        ctx.Error(err)
+        return
+    }
+
+    var storeID int64
+    if !isAdmin(ctx) {
+        _, store, err := c.getUserAndStore(ctx)
+        if err != nil {
+            ctx.Error(err)
+            return
+        }
+        storeID = store.ID
+    }
+
+    product, err := c.productService.RestoreProduct(ctx.Request.Context(), id, storeID)
+    if err != nil {
+        ctx.Error(err)
+        return
+    }
+
+    respondVersioned(ctx, http.StatusOK, product.ID, product.Version, product)
+}
+
+// ListProducts lists all products with pagination; sort=rating orders them by
+// average rating instead of newest first.
 func (c *ProductController) ListProducts(ctx *gin.Context) {
     // Check for context cancellation
-    if ctx.Request.Context().Err() != nil {
-        ctx.JSON(http.StatusRequestTimeout, gin.H{"error": "Request cancelled or timed out"})
+    if err := ctx.Request.Context().Err(); err != nil {
+        ctx.Error(err)
         return
     }
 
     page, limit := parsePaginationParams(ctx.Query("page"), ctx.Query("limit"))
 
-    products, err := c.productService.ListProducts(ctx.Request.Context(), page, limit)
+    products, err := c.productService.ListProducts(ctx.Request.Context(), ctx.Query("sort"), page, limit)
     if err != nil {
-        ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list products: " + err.Error()})
+        ctx.Error(err)
         return
     }
 
     ctx.JSON(http.StatusOK, products)
 }
 
-// SearchProducts searches products by query with pagination.
+// SearchProducts searches products by query with pagination, accepting the same
+// sort values as ListProducts.
 func (c *ProductController) SearchProducts(ctx *gin.Context) {
     query := ctx.Query("q")
     if query == "" {
-        ctx.JSON(http.StatusBadRequest, gin.H{"error": "Query parameter 'q' is required"})
+        ctx.Error(services.NewFieldError("q", "required", "query parameter 'q' is required"))
         return
     }
 
     // Check for context cancellation
-    if ctx.Request.Context().Err() != nil {
-        ctx.JSON(http.StatusRequestTimeout, gin.H{"error": "Request cancelled or timed out"})
+    if err := ctx.Request.Context().Err(); err != nil {
+        ctx.Error(err)
         return
     }
 
     page, limit := parsePaginationParams(ctx.Query("page"), ctx.Query("limit"))
 
-    products, err := c.productService.SearchProducts(ctx.Request.Context(), query, page, limit)
+    products, err := c.productService.SearchProducts(ctx.Request.Context(), query, ctx.Query("sort"), page, limit)
     if err != nil {
-        ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search products: " + err.Error()})
+        ctx.Error(err)
+        return
+    }
+
+    ctx.JSON(http.StatusOK, products)
+}
+
+// GetFeed lists the newest products of the stores the user follows.
+func (c *ProductController) GetFeed(ctx *gin.Context) {
+    userID, err := currentUserID(ctx)
+    if err != nil {
+        ctx.Error(err)
+        return
+    }
+
+    page, limit := parsePaginationParams(ctx.Query("page"), ctx.Query("limit"))
+
+    products, err := c.productService.GetFeed(ctx.Request.Context(), userID, page, limit)
+    if err != nil {
+        ctx.Error(err)
         return
     }
 
@@ -303,20 +338,26 @@ func (c *ProductController) SearchProducts(ctx *gin.Context) {
 // UpdateQuantity updates the quantity of a product.
 func (c *ProductController) UpdateQuantity(ctx *gin.Context) {
     // Check for context cancellation
-    if ctx.Request.Context().Err() != nil {
-        ctx.JSON(http.StatusRequestTimeout, gin.H{"error": "Request cancelled or timed out"})
+    if err := ctx.Request.Context().Err(); err != nil {
+        ctx.Error(err)
         return
     }
 
     _, store, err := c.getUserAndStore(ctx)
     if err != nil {
-        return 
+        ctx.Error(err)
+        return
     }
 
-    idStr := ctx.Param("id")
-    id, err := strconv.ParseInt(idStr, 10, 64)
+    id, err := paramID(ctx, "id", "product")
     if err != nil {
-        ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+        ctx.Error(err)
+        return
+    }
+
+    version, err := ifMatchVersion(ctx, id)
+    if err != nil {
+        ctx.Error(err)
         return
     }
 
@@ -325,21 +366,13 @@ func (c *ProductController) UpdateQuantity(ctx *gin.Context) {
     }
 
     if err := ctx.ShouldBindJSON(&req); err != nil {
-        ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON: " + err.Error()})
+        ctx.Error(services.NewValidationError(err))
         return
     }
 
-    err = c.productService.UpdateProductQuantity(ctx.Request.Context(), id, store.ID, req.Quantity)
+    err = c.productService.UpdateProductQuantity(ctx.Request.Context(), id, store.ID, version, req.Quantity)
     if err != nil {
-        if err.Error() == "product not found" {
-            ctx.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
-        } else if err.Error() == "unauthorized: product does not belong to store" {
-            ctx.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized: product does not belong to store"})
-        } else if err.Error() == "quantity cannot be negative" {
-            ctx.JSON(http.StatusBadRequest, gin.H{"error": "Quantity cannot be negative"})
-        } else {
-            ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-        }
+        ctx.Error(err)
         return
     }
 
@@ -349,62 +382,28 @@ func (c *ProductController) UpdateQuantity(ctx *gin.Context) {
 
 func (c *ProductController) AddProductImage(ctx *gin.Context) {
     // Check for context cancellation
-    if ctx.Request.Context().Err() != nil {
-        ctx.JSON(http.StatusRequestTimeout, gin.H{"error": "Request cancelled or timed out"})
+    if err := ctx.Request.Context().Err(); err != nil {
+        ctx.Error(err)
         return
     }
 
     // Get user and store
     _, store, err := c.getUserAndStore(ctx)
     if err != nil {
-        return 
-    }
-
-    idStr := ctx.Param("id")
-    productID, err := strconv.ParseInt(idStr, 10, 64)
-    if err != nil {
-        ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+        ctx.Error(err)
         return
     }
 
-    // Get form file
-    file, header, err := ctx.Request.FormFile("image")
+    productID, err := paramID(ctx, "id", "product")
     if err != nil {
-        ctx.JSON(http.StatusBadRequest, gin.H{"error": "Image file is required"})
-        return
-    }
-    defer file.Close()
-
-    // Validate file type and size
-    if !isValidImageType(header.Filename) {
-        ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file type. Only JPEG, PNG, and GIF are allowed"})
-        return
-    }
-    if header.Size > 5*1024*1024 { 
-        ctx.JSON(http.StatusBadRequest, gin.H{"error": "File size exceeds 5MB limit"})
-        return
-    }
-
-    // Generate unique filename
-    filename := fmt.Sprintf("%d-%d-%s", productID, time.Now().UnixNano(), sanitizeFilename(header.Filename))
-    filePath := filepath.Join("uploads/images", filename)
-
-    // Create uploads directory if it doesn't exist
-    if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
-        ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create upload directory"})
+        ctx.Error(err)
         return
     }
 
-    // Save file to disk
-    out, err := os.Create(filePath)
+    // Save the uploaded file next to the other images
+    filename, filePath, err := saveImageUpload(ctx, c.uploads, strconv.FormatInt(productID, 10))
     if err != nil {
-        ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save image"})
-        return
-    }
-    defer out.Close()
-
-    if _, err := io.Copy(out, file); err != nil {
-        ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save image"})
+        ctx.Error(err)
         return
     }
 
@@ -425,7 +424,7 @@ func (c *ProductController) AddProductImage(ctx *gin.Context) {
     // Save image metadata
     if err := c.productService.CreateProductImage(ctx.Request.Context(), productID, store.ID, image); err != nil {
         os.Remove(filePath)
-        ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        ctx.Error(err)
         return
     }
 
@@ -435,30 +434,87 @@ func (c *ProductController) AddProductImage(ctx *gin.Context) {
 // GetProductImages retrieves all images for a product.
 func (c *ProductController) GetProductImages(ctx *gin.Context) {
     // Check for context cancellation
-    if ctx.Request.Context().Err() != nil {
-        ctx.JSON(http.StatusRequestTimeout, gin.H{"error": "Request cancelled or timed out"})
+    if err := ctx.Request.Context().Err(); err != nil {
+        ctx.Error(err)
         return
     }
 
-    idStr := ctx.Param("id")
-    productID, err := strconv.ParseInt(idStr, 10, 64)
+    productID, err := paramID(ctx, "id", "product")
     if err != nil {
-        ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+        ctx.Error(err)
         return
     }
 
     images, err := c.productService.GetProductImages(ctx.Request.Context(), productID)
     if err != nil {
-        ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        ctx.Error(err)
         return
     }
 
     ctx.JSON(http.StatusOK, images)
 }
 
-func isValidImageType(filename string) bool {
+// saveImageUpload validates the multipart "image" field against the upload limits
+// and saves it in the uploads directory, served under /images. The file name starts
+// with prefix; callers remove filePath if they fail to record the image.
+func saveImageUpload(ctx *gin.Context, uploads config.UploadConfig, prefix string) (string, string, error) {
+    file, header, err := ctx.Request.FormFile("image")
+    if err != nil {
+        return "", "", services.NewFieldError("image", "required", "image file is required")
+    }
+    defer file.Close()
+
+    // Validate file type and size
+    if !isValidImageType(header.Filename, uploads.AllowedImageTypes) {
+        return "", "", services.NewFieldError("image", "file_type", "invalid file type, allowed types: "+strings.Join(uploads.AllowedImageTypes, ", "))
+    }
+    if header.Size > uploads.MaxImageSize {
+        return "", "", services.NewError(services.ErrTooLarge, "file_too_large", fmt.Sprintf("file size exceeds %s limit", formatBytes(uploads.MaxImageSize)))
+    }
+
+    // Generate unique filename
+    filename := fmt.Sprintf("%s-%d-%s", prefix, time.Now().UnixNano(), sanitizeFilename(header.Filename))
+    filePath := filepath.Join(uploads.Dir, filename)
+
+    // Create uploads directory if it doesn't exist
+    if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+        return "", "", fmt.Errorf("error creating upload directory: %w", err)
+    }
+
+    // Save file to disk
+    out, err := os.Create(filePath)
+    if err != nil {
+        return "", "", err
+    }
+    defer out.Close()
+
+    if _, err := io.Copy(out, file); err != nil {
+        os.Remove(filePath)
+        return "", "", fmt.Errorf("error saving image: %w", err)
+    }
+
+    return filename, filePath, nil
+}
+
+func isValidImageType(filename string, allowed []string) bool {
     ext := strings.ToLower(filepath.Ext(filename))
-    return ext == ".jpg" || ext == ".jpeg" || ext == ".png" || ext == ".gif"
+    for _, allowedExt := range allowed {
+        if ext == strings.ToLower(allowedExt) {
+            return true
+        }
+    }
+    return false
+}
+
+// formatBytes formats a size limit for error messages (e.g. 5MB).
+func formatBytes(size int64) string {
+    if size >= 1024*1024 && size%(1024*1024) == 0 {
+        return fmt.Sprintf("%dMB", size/(1024*1024))
+    }
+    if size >= 1024 && size%1024 == 0 {
+        return fmt.Sprintf("%dKB", size/1024)
+    }
+    return fmt.Sprintf("%d bytes", size)
 }
 
 // sanitizeFilename removes unsafe characters from filenames.
@@ -0,0 +1,217 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"modress/internal/logging"
+	"modress/internal/models"
+	"modress/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// asyncImportThreshold define a partir de quantas linhas a importação corre em segundo plano
+const asyncImportThreshold = 500
+
+// exportWriteTimeout é o prazo de cada bloco da exportação; o WriteTimeout do servidor
+// conta desde o início do pedido e cortaria o download dos catálogos grandes
+const exportWriteTimeout = 30 * time.Second
+
+// ProductImportController handles bulk product import and export for store owners.
+type ProductImportController struct {
+	importService services.ProductImportService
+	storeService  services.StoreService
+	maxFileSize   int64
+}
+
+// NewProductImportController creates a new ProductImportController instance.
+func NewProductImportController(importService services.ProductImportService, storeService services.StoreService, maxFileSize int64) *ProductImportController {
+	return &ProductImportController{
+		importService: importService,
+		storeService:  storeService,
+		maxFileSize:   maxFileSize,
+	}
+}
+
+// getMyStore retrieves the store owned by the authenticated user.
+func (c *ProductImportController) getMyStore(ctx *gin.Context) (*models.StoreResponse, bool) {
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return nil, false
+	}
+
+	store, err := storeOwnedBy(ctx, c.storeService, userID)
+	if err != nil {
+		ctx.Error(err)
+		return nil, false
+	}
+
+	return store, true
+}
+
+// ImportProducts accepts a CSV or NDJSON file and upserts the store's products by SKU.
+// Query params: dry_run=true validates without writing, async=true forces a background job.
+func (c *ProductImportController) ImportProducts(ctx *gin.Context) {
+	store, ok := c.getMyStore(ctx)
+	if !ok {
+		return
+	}
+
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, c.maxFileSize)
+
+	rows, err := c.parseImportFile(ctx)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			ctx.Error(services.NewError(services.ErrTooLarge, "file_too_large", fmt.Sprintf("file size exceeds %s limit", formatBytes(c.maxFileSize))))
+			return
+		}
+		ctx.Error(services.NewError(services.ErrValidation, "invalid_import_file", err.Error()))
+		return
+	}
+	if len(rows) == 0 {
+		ctx.Error(services.NewError(services.ErrValidation, "invalid_import_file", "import file has no rows"))
+		return
+	}
+
+	dryRun := ctx.Query("dry_run") == "true"
+	if ctx.Query("async") == "true" || len(rows) > asyncImportThreshold {
+		job, err := c.importService.StartImportJob(ctx.Request.Context(), store.ID, rows, dryRun)
+		if err != nil {
+			ctx.Error(err)
+			return
+		}
+		ctx.Header("Location", fmt.Sprintf("/api/v1/stores/my/products/import/%d", job.ID))
+		ctx.JSON(http.StatusAccepted, job)
+		return
+	}
+
+	result, err := c.importService.ImportProducts(ctx.Request.Context(), store.ID, rows, dryRun)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	status := http.StatusOK
+	if result.Failed > 0 && result.Created == 0 && result.Updated == 0 {
+		status = http.StatusUnprocessableEntity
+	}
+	ctx.JSON(status, result)
+}
+
+// GetImportJob returns the progress of a background import.
+func (c *ProductImportController) GetImportJob(ctx *gin.Context) {
+	store, ok := c.getMyStore(ctx)
+	if !ok {
+		return
+	}
+
+	jobID, err := paramID(ctx, "jobId", "job")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	job, err := c.importService.GetImportJob(ctx.Request.Context(), store.ID, jobID)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, job)
+}
+
+// ExportProducts streams the store's catalogue as CSV.
+func (c *ProductImportController) ExportProducts(ctx *gin.Context) {
+	store, ok := c.getMyStore(ctx)
+	if !ok {
+		return
+	}
+
+	filename := fmt.Sprintf("%s-products-%s.csv", store.Slug, time.Now().Format("20060102"))
+	ctx.Header("Content-Type", "text/csv; charset=utf-8")
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	ctx.Status(http.StatusOK)
+
+	// O cabeçalho já foi enviado, por isso um erro a meio só pode ser registado
+	w := &deadlineWriter{w: ctx.Writer, rc: http.NewResponseController(ctx.Writer), timeout: exportWriteTimeout}
+	if err := c.importService.ExportProducts(ctx.Request.Context(), store.ID, w); err != nil {
+		logging.FromContext(ctx.Request.Context()).Error("product export failed", "store_id", store.ID, logging.Err(err))
+	}
+}
+
+// deadlineWriter extends the connection's write deadline before each chunk, so a long
+// download is only cut off when a single chunk stalls.
+type deadlineWriter struct {
+	w       io.Writer
+	rc      *http.ResponseController
+	timeout time.Duration
+}
+
+func (d *deadlineWriter) Write(p []byte) (int, error) {
+	if err := d.rc.SetWriteDeadline(time.Now().Add(d.timeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return 0, err
+	}
+	n, err := d.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	// Enviar já o bloco, em vez de esperar que o buffer da ligação encha
+	if err := d.rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return n, err
+	}
+	return n, nil
+}
+
+// parseImportFile reads the rows from a multipart upload ("file" field) or from the raw body.
+func (c *ProductImportController) parseImportFile(ctx *gin.Context) ([]models.ProductImportRow, error) {
+	var (
+		body   io.Reader = ctx.Request.Body
+		format           = strings.ToLower(ctx.Query("format"))
+	)
+
+	mediaType, _, _ := mime.ParseMediaType(ctx.GetHeader("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		file, header, err := ctx.Request.FormFile("file")
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		body = file
+
+		if format == "" {
+			switch strings.ToLower(filepath.Ext(header.Filename)) {
+			case ".csv":
+				format = "csv"
+			case ".ndjson", ".jsonl", ".json":
+				format = "ndjson"
+			}
+		}
+	}
+
+	if format == "" {
+		switch mediaType {
+		case "text/csv":
+			format = "csv"
+		case "application/x-ndjson", "application/jsonl", "application/json":
+			format = "ndjson"
+		}
+	}
+
+	switch format {
+	case "csv":
+		return services.ParseProductCSV(body)
+	case "ndjson", "jsonl", "json":
+		return services.ParseProductNDJSON(body)
+	default:
+		return nil, fmt.Errorf("unsupported import format: use text/csv or application/x-ndjson")
+	}
+}
@@ -0,0 +1,33 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+
+	"modress/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PurgeController lets admins remove soft-deleted records for good.
+type PurgeController struct {
+	purgeService services.PurgeService
+}
+
+// NewPurgeController creates a new PurgeController instance.
+func NewPurgeController(purgeService services.PurgeService) *PurgeController {
+	return &PurgeController{purgeService: purgeService}
+}
+
+// SchedulePurge queues a job that hard-deletes records deleted before the
+// retention period; progress is followed through the jobs API.
+func (c *PurgeController) SchedulePurge(ctx *gin.Context) {
+	job, err := c.purgeService.SchedulePurge(ctx.Request.Context())
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.Header("Location", fmt.Sprintf("/api/v1/admin/jobs/%d", job.ID))
+	ctx.JSON(http.StatusAccepted, job)
+}
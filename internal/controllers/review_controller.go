@@ -0,0 +1,302 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"modress/internal/config"
+	"modress/internal/models"
+	"modress/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReviewController handles product reviews: writing and listing them, their
+// photos, the seller's reply, reports and the moderation of reported reviews.
+type ReviewController struct {
+	reviewService services.ReviewService
+	storeService  services.StoreService
+	uploads       config.UploadConfig
+}
+
+// NewReviewController creates a new ReviewController instance.
+func NewReviewController(reviewService services.ReviewService, storeService services.StoreService, uploads config.UploadConfig) *ReviewController {
+	return &ReviewController{
+		reviewService: reviewService,
+		storeService:  storeService,
+		uploads:       uploads,
+	}
+}
+
+// getMyStore retrieves the store owned by the authenticated user.
+func (c *ReviewController) getMyStore(ctx *gin.Context) (*models.StoreResponse, bool) {
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return nil, false
+	}
+
+	store, err := storeOwnedBy(ctx, c.storeService, userID)
+	if err != nil {
+		ctx.Error(err)
+		return nil, false
+	}
+
+	return store, true
+}
+
+// ListReviews lists the published reviews of a product; sort accepts newest
+// (default), highest and lowest.
+func (c *ReviewController) ListReviews(ctx *gin.Context) {
+	productID, err := paramID(ctx, "id", "product")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	page, limit := parsePaginationParams(ctx.Query("page"), ctx.Query("limit"))
+	reviews, err := c.reviewService.ListReviews(ctx.Request.Context(), productID, ctx.Query("sort"), page, limit)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, reviews)
+}
+
+// CreateReview reviews a product; each user reviews a product once.
+func (c *ReviewController) CreateReview(ctx *gin.Context) {
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	productID, err := paramID(ctx, "id", "product")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var req models.CreateReviewRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.Error(services.NewValidationError(err))
+		return
+	}
+
+	review, err := c.reviewService.CreateReview(ctx.Request.Context(), userID, productID, &req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, review)
+}
+
+// UpdateReview changes the rating or the text of the user's review.
+func (c *ReviewController) UpdateReview(ctx *gin.Context) {
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	id, err := paramID(ctx, "id", "review")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var req models.UpdateReviewRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.Error(services.NewValidationError(err))
+		return
+	}
+
+	review, err := c.reviewService.UpdateReview(ctx.Request.Context(), userID, id, &req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, review)
+}
+
+// DeleteReview deletes the user's review; admins can delete any review.
+func (c *ReviewController) DeleteReview(ctx *gin.Context) {
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	id, err := paramID(ctx, "id", "review")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	if isAdmin(ctx) {
+		userID = 0
+	}
+	if err := c.reviewService.DeleteReview(ctx.Request.Context(), userID, id); err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// AddReviewPhoto uploads a photo for the user's review. Photos are stored and
+// served like product images, under /images.
+func (c *ReviewController) AddReviewPhoto(ctx *gin.Context) {
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	id, err := paramID(ctx, "id", "review")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	filename, filePath, err := saveImageUpload(ctx, c.uploads, fmt.Sprintf("review-%d", id))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	photo, err := c.reviewService.AddPhoto(ctx.Request.Context(), userID, id, "/images/"+filename)
+	if err != nil {
+		os.Remove(filePath)
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, photo)
+}
+
+// ReplyToReview sets the store's public reply to a review of one of its
+// products, replacing any previous reply.
+func (c *ReviewController) ReplyToReview(ctx *gin.Context) {
+	store, ok := c.getMyStore(ctx)
+	if !ok {
+		return
+	}
+
+	id, err := paramID(ctx, "id", "review")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var req models.ReplyReviewRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.Error(services.NewValidationError(err))
+		return
+	}
+
+	review, err := c.reviewService.Reply(ctx.Request.Context(), store.ID, id, &req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, review)
+}
+
+// DeleteReply removes the store's reply to a review.
+func (c *ReviewController) DeleteReply(ctx *gin.Context) {
+	store, ok := c.getMyStore(ctx)
+	if !ok {
+		return
+	}
+
+	id, err := paramID(ctx, "id", "review")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	review, err := c.reviewService.DeleteReply(ctx.Request.Context(), store.ID, id)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, review)
+}
+
+// ReportReview reports a review to the moderators.
+func (c *ReviewController) ReportReview(ctx *gin.Context) {
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	id, err := paramID(ctx, "id", "review")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var req models.ReportReviewRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.Error(services.NewValidationError(err))
+		return
+	}
+
+	report, err := c.reviewService.Report(ctx.Request.Context(), userID, id, &req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, report)
+}
+
+// ListReports lists review reports for moderation, pending ones by default.
+func (c *ReviewController) ListReports(ctx *gin.Context) {
+	page, limit := parsePaginationParams(ctx.Query("page"), ctx.Query("limit"))
+	reports, err := c.reviewService.ListReports(ctx.Request.Context(), ctx.Query("status"), page, limit)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, reports)
+}
+
+// ModerateReview resolves the pending reports of a review: hide upholds them
+// and hides the review, dismiss rejects them and publishes it again.
+func (c *ReviewController) ModerateReview(ctx *gin.Context) {
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	id, err := paramID(ctx, "id", "review")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var req models.ModerateReviewRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.Error(services.NewValidationError(err))
+		return
+	}
+
+	review, err := c.reviewService.Moderate(ctx.Request.Context(), userID, id, &req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, review)
+}
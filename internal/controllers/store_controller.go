@@ -9,6 +9,8 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+var errAdminRequired = services.NewError(services.ErrForbidden, "admin_required", "admin access required")
+
 type StoreController struct {
 	storeService services.StoreService
 }
@@ -21,183 +23,166 @@ func NewStoreController(storeService services.StoreService) *StoreController {
 
 func (c *StoreController) CreateStore(ctx *gin.Context) {
 	// Obter o ID do usuário do contexto
-	userID, exists := ctx.Get("userID")
-	if !exists {
-		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-		return
-	}
-
-	userIDInt64, ok := userID.(int64)
-	if !ok {
-		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		ctx.Error(err)
 		return
 	}
 
 	var req models.CreateStoreRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
+		ctx.Error(services.NewValidationError(err))
 		return
 	}
 
-	store, err := c.storeService.CreateStore(ctx.Request.Context(), userIDInt64, &req)
+	store, err := c.storeService.CreateStore(ctx.Request.Context(), userID, &req)
 	if err != nil {
-		if err.Error() == "user already has a store" {
-			ctx.JSON(http.StatusConflict, gin.H{"error": "User already has a store"})
-			return
-		}
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ctx.Error(err)
 		return
 	}
 
-	ctx.JSON(http.StatusCreated, store)
+	respondVersioned(ctx, http.StatusCreated, store.ID, store.Version, store)
 }
 
 func (c *StoreController) GetStore(ctx *gin.Context) {
-	idStr := ctx.Param("id")
-	id, err := strconv.ParseInt(idStr, 10, 64)
+	id, err := paramID(ctx, "id", "store")
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid store ID"})
+		ctx.Error(err)
 		return
 	}
 
 	store, err := c.storeService.GetStoreByID(ctx.Request.Context(), id)
 	if err != nil {
-		if err.Error() == "store not found" {
-			ctx.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
-			return
-		}
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx.Error(err)
 		return
 	}
 
-	ctx.JSON(http.StatusOK, store)
+	respondVersioned(ctx, http.StatusOK, store.ID, store.Version, store)
 }
 
 func (c *StoreController) GetStoreBySlug(ctx *gin.Context) {
 	slug := ctx.Param("slug")
 
-	store, err := c.storeService.GetStoreBySlug(ctx.Request.Context(), slug)
+	profile, err := c.storeService.GetStoreBySlug(ctx.Request.Context(), slug)
 	if err != nil {
-		if err.Error() == "store not found" {
-			ctx.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
-			return
-		}
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx.Error(err)
 		return
 	}
 
-	ctx.JSON(http.StatusOK, store)
+	// O perfil junta à loja números que mudam sem mudar a versão
+	respondHashed(ctx, http.StatusOK, profile)
 }
 
 func (c *StoreController) GetMyStore(ctx *gin.Context) {
 	// Obter o ID do usuário do contexto
-	userID, exists := ctx.Get("userID")
-	if !exists {
-		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-		return
-	}
-
-	userIDInt64, ok := userID.(int64)
-	if !ok {
-		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		ctx.Error(err)
 		return
 	}
 
-	store, err := c.storeService.GetStoreByOwnerID(ctx.Request.Context(), userIDInt64)
+	store, err := c.storeService.GetStoreByOwnerID(ctx.Request.Context(), userID)
 	if err != nil {
-		if err.Error() == "store not found" {
-			ctx.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
-			return
-		}
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx.Error(err)
 		return
 	}
 
-	ctx.JSON(http.StatusOK, store)
+	respondVersioned(ctx, http.StatusOK, store.ID, store.Version, store)
 }
 
 func (c *StoreController) UpdateStore(ctx *gin.Context) {
 	// Obter o ID do usuário do contexto
-	userID, exists := ctx.Get("userID")
-	if !exists {
-		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		ctx.Error(err)
 		return
 	}
 
-	userIDInt64, ok := userID.(int64)
-	if !ok {
-		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+	id, err := paramID(ctx, "id", "store")
+	if err != nil {
+		ctx.Error(err)
 		return
 	}
 
-	idStr := ctx.Param("id")
-	id, err := strconv.ParseInt(idStr, 10, 64)
+	version, err := ifMatchVersion(ctx, id)
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid store ID"})
+		ctx.Error(err)
 		return
 	}
 
 	var req models.UpdateStoreRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
+		ctx.Error(services.NewValidationError(err))
 		return
 	}
 
-	store, err := c.storeService.UpdateStore(ctx.Request.Context(), id, userIDInt64, &req)
+	store, err := c.storeService.UpdateStore(ctx.Request.Context(), id, userID, version, &req)
 	if err != nil {
-		if err.Error() == "store not found" {
-			ctx.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
-			return
-		}
-		if err.Error() == "unauthorized: not store owner" {
-			ctx.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized"})
-			return
-		}
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ctx.Error(err)
 		return
 	}
 
-	ctx.JSON(http.StatusOK, store)
+	respondVersioned(ctx, http.StatusOK, store.ID, store.Version, store)
 }
 
 func (c *StoreController) DeleteStore(ctx *gin.Context) {
 	// Obter o ID do usuário do contexto
-	userID, exists := ctx.Get("userID")
-	if !exists {
-		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		ctx.Error(err)
 		return
 	}
 
-	userIDInt64, ok := userID.(int64)
-	if !ok {
-		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+	id, err := paramID(ctx, "id", "store")
+	if err != nil {
+		ctx.Error(err)
 		return
 	}
 
-	idStr := ctx.Param("id")
-	id, err := strconv.ParseInt(idStr, 10, 64)
+	version, err := ifMatchVersion(ctx, id)
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid store ID"})
+		ctx.Error(err)
 		return
 	}
 
-	err = c.storeService.DeleteStore(ctx.Request.Context(), id, userIDInt64)
+	err = c.storeService.DeleteStore(ctx.Request.Context(), id, userID, version)
 	if err != nil {
-		if err.Error() == "store not found" {
-			ctx.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
-			return
-		}
-		if err.Error() == "unauthorized: not store owner" {
-			ctx.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized"})
-			return
-		}
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx.Error(err)
 		return
 	}
 
 	ctx.Status(http.StatusNoContent)
 }
 
+// RestoreStore restaura uma loja apagada. O dono pode restaurar a sua; um
+// administrador pode restaurar qualquer uma.
+func (c *StoreController) RestoreStore(ctx *gin.Context) {
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	id, err := paramID(ctx, "id", "store")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ownerID := userID
+	if isAdmin(ctx) {
+		ownerID = 0
+	}
+
+	store, err := c.storeService.RestoreStore(ctx.Request.Context(), id, ownerID)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	respondVersioned(ctx, http.StatusOK, store.ID, store.Version, store)
+}
+
 func (c *StoreController) ListStores(ctx *gin.Context) {
 	page, _ := strconv.Atoi(ctx.Query("page"))
 	if page < 1 {
@@ -211,7 +196,7 @@ func (c *StoreController) ListStores(ctx *gin.Context) {
 
 	stores, err := c.storeService.ListStores(ctx.Request.Context(), page, limit)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx.Error(err)
 		return
 	}
 
@@ -231,7 +216,7 @@ func (c *StoreController) ListApprovedStores(ctx *gin.Context) {
 
 	stores, err := c.storeService.ListApprovedStores(ctx.Request.Context(), page, limit)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx.Error(err)
 		return
 	}
 
@@ -240,34 +225,81 @@ func (c *StoreController) ListApprovedStores(ctx *gin.Context) {
 
 func (c *StoreController) ApproveStore(ctx *gin.Context) {
 	// Verificar se o usuário é admin
-	userRole, exists := ctx.Get("userRole")
-	if !exists {
-		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+	if !isAdmin(ctx) {
+		ctx.Error(errAdminRequired)
 		return
 	}
 
-	role, ok := userRole.(string)
-	if !ok || role != "admin" {
-		ctx.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: admin access required"})
+	id, err := paramID(ctx, "id", "store")
+	if err != nil {
+		ctx.Error(err)
 		return
 	}
 
-	idStr := ctx.Param("id")
-	id, err := strconv.ParseInt(idStr, 10, 64)
+	err = c.storeService.ApproveStore(ctx.Request.Context(), id)
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid store ID"})
+		ctx.Error(err)
 		return
 	}
 
-	err = c.storeService.ApproveStore(ctx.Request.Context(), id)
+	ctx.Status(http.StatusNoContent)
+}
+
+func (c *StoreController) FollowStore(ctx *gin.Context) {
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	id, err := paramID(ctx, "id", "store")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	if err := c.storeService.FollowStore(ctx.Request.Context(), userID, id); err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func (c *StoreController) UnfollowStore(ctx *gin.Context) {
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	id, err := paramID(ctx, "id", "store")
 	if err != nil {
-		if err.Error() == "store not found" {
-			ctx.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
-			return
-		}
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx.Error(err)
+		return
+	}
+
+	if err := c.storeService.UnfollowStore(ctx.Request.Context(), userID, id); err != nil {
+		ctx.Error(err)
 		return
 	}
 
 	ctx.Status(http.StatusNoContent)
-}
\ No newline at end of file
+}
+
+func (c *StoreController) ListFollowedStores(ctx *gin.Context) {
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	page, limit := parsePaginationParams(ctx.Query("page"), ctx.Query("limit"))
+	stores, err := c.storeService.ListFollowedStores(ctx.Request.Context(), userID, page, limit)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, stores)
+}
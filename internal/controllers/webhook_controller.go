@@ -0,0 +1,224 @@
+package controllers
+
+import (
+	"net/http"
+
+	"modress/internal/models"
+	"modress/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WebhookController lets store owners manage the webhooks of their store and
+// inspect and redeliver their deliveries.
+type WebhookController struct {
+	webhookService services.WebhookService
+	storeService   services.StoreService
+}
+
+// NewWebhookController creates a new WebhookController instance.
+func NewWebhookController(webhookService services.WebhookService, storeService services.StoreService) *WebhookController {
+	return &WebhookController{
+		webhookService: webhookService,
+		storeService:   storeService,
+	}
+}
+
+// getMyStore retrieves the store owned by the authenticated user.
+func (c *WebhookController) getMyStore(ctx *gin.Context) (*models.StoreResponse, bool) {
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return nil, false
+	}
+
+	store, err := storeOwnedBy(ctx, c.storeService, userID)
+	if err != nil {
+		ctx.Error(err)
+		return nil, false
+	}
+
+	return store, true
+}
+
+// ListWebhooks lists the store's webhooks, without their secrets.
+func (c *WebhookController) ListWebhooks(ctx *gin.Context) {
+	store, ok := c.getMyStore(ctx)
+	if !ok {
+		return
+	}
+
+	webhooks, err := c.webhookService.ListWebhooks(ctx.Request.Context(), store.ID)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, webhooks)
+}
+
+// CreateWebhook subscribes a URL to events of the store. The response is the
+// only one that includes the signing secret.
+func (c *WebhookController) CreateWebhook(ctx *gin.Context) {
+	store, ok := c.getMyStore(ctx)
+	if !ok {
+		return
+	}
+
+	var req models.CreateWebhookRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.Error(services.NewValidationError(err))
+		return
+	}
+
+	webhook, err := c.webhookService.CreateWebhook(ctx.Request.Context(), store.ID, &req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, webhook)
+}
+
+// GetWebhook returns one of the store's webhooks.
+func (c *WebhookController) GetWebhook(ctx *gin.Context) {
+	store, ok := c.getMyStore(ctx)
+	if !ok {
+		return
+	}
+
+	id, err := paramID(ctx, "id", "webhook")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	webhook, err := c.webhookService.GetWebhook(ctx.Request.Context(), store.ID, id)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, webhook)
+}
+
+// UpdateWebhook changes the URL, the events or the active flag of a webhook.
+func (c *WebhookController) UpdateWebhook(ctx *gin.Context) {
+	store, ok := c.getMyStore(ctx)
+	if !ok {
+		return
+	}
+
+	id, err := paramID(ctx, "id", "webhook")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var req models.UpdateWebhookRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.Error(services.NewValidationError(err))
+		return
+	}
+
+	webhook, err := c.webhookService.UpdateWebhook(ctx.Request.Context(), store.ID, id, &req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, webhook)
+}
+
+// DeleteWebhook removes a webhook and its delivery log.
+func (c *WebhookController) DeleteWebhook(ctx *gin.Context) {
+	store, ok := c.getMyStore(ctx)
+	if !ok {
+		return
+	}
+
+	id, err := paramID(ctx, "id", "webhook")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	if err := c.webhookService.DeleteWebhook(ctx.Request.Context(), store.ID, id); err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// RotateSecret replaces the signing secret of a webhook and returns the new one.
+func (c *WebhookController) RotateSecret(ctx *gin.Context) {
+	store, ok := c.getMyStore(ctx)
+	if !ok {
+		return
+	}
+
+	id, err := paramID(ctx, "id", "webhook")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	webhook, err := c.webhookService.RotateSecret(ctx.Request.Context(), store.ID, id)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, webhook)
+}
+
+// ListDeliveries pages through the delivery log of a webhook, newest first.
+func (c *WebhookController) ListDeliveries(ctx *gin.Context) {
+	store, ok := c.getMyStore(ctx)
+	if !ok {
+		return
+	}
+
+	id, err := paramID(ctx, "id", "webhook")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	page, limit := parsePaginationParams(ctx.Query("page"), ctx.Query("limit"))
+	deliveries, err := c.webhookService.ListDeliveries(ctx.Request.Context(), store.ID, id, page, limit)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, deliveries)
+}
+
+// Redeliver queues a new delivery of the same event.
+func (c *WebhookController) Redeliver(ctx *gin.Context) {
+	store, ok := c.getMyStore(ctx)
+	if !ok {
+		return
+	}
+
+	id, err := paramID(ctx, "id", "webhook")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	deliveryID, err := paramID(ctx, "deliveryId", "delivery")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	delivery, err := c.webhookService.Redeliver(ctx.Request.Context(), store.ID, id, deliveryID)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, delivery)
+}
@@ -1,84 +1,174 @@
 package controllers
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"modress/internal/config"
+	"modress/internal/hub"
+	"modress/internal/logging"
+	"modress/internal/metrics"
+	"modress/internal/middleware"
+	"modress/internal/models"
+	"modress/internal/services"
+	"modress/internal/wsproto"
+
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true 
-	},
-}
-
 type Client struct {
 	Conn     *websocket.Conn
 	UserID   int64
 	Username string
 	Send     chan []byte
-}
 
-type Message struct {
-	SenderID   int64     `json:"sender_id"`
-	SenderName string    `json:"sender_name"`
-	ReceiverID int64     `json:"receiver_id"`
-	Content    string    `json:"content"`
-	Timestamp  time.Time `json:"timestamp"`
+	// ctx é o contexto do pedido de ligação sem o cancelamento, que acontece logo
+	// depois do upgrade: mantém o logger, o request_id e o actor da auditoria
+	ctx    context.Context
+	logger *slog.Logger
+
+	// closeMsg é o close frame que o writeMessages envia quando o Send é fechado;
+	// definido antes de o fechar
+	closeMsg []byte
 }
 
+// WebSocketController é o hub das ligações WebSocket. Cada utilizador pode ter
+// várias ligações (separadores, dispositivos), nesta e noutras instâncias, e recebe
+// os eventos em todas: os eventos passam pelo backend, que os entrega ao hub de cada
+// instância, e a presença é contada no cluster.
 type WebSocketController struct {
-	clients    map[int64]*Client
-	broadcast  chan Message
+	authService services.AuthService
+	chatService services.ChatService
+	backend     hub.Backend
+	cfg         config.WebSocketConfig
+	upgrader    websocket.Upgrader
+	allowOrigin func(origin string) bool
+
+	clients    map[int64]map[*Client]struct{}
 	register   chan *Client
 	unregister chan *Client
 	mu         sync.Mutex
+
+	// quit pede ao ciclo do hub para fechar todas as ligações; done é fechado quando
+	// o ciclo termina
+	quit      chan struct{}
+	done      chan struct{}
+	startOnce sync.Once
+	stopOnce  sync.Once
+	running   atomic.Bool
 }
 
-func NewWebSocketController() *WebSocketController {
-	return &WebSocketController{
-		clients:    make(map[int64]*Client),
-		broadcast:  make(chan Message),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
+func NewWebSocketController(authService services.AuthService, chatService services.ChatService, backend hub.Backend, cfg config.WebSocketConfig) *WebSocketController {
+	wsc := &WebSocketController{
+		authService: authService,
+		chatService: chatService,
+		backend:     backend,
+		cfg:         cfg,
+		allowOrigin: middleware.OriginAllowed(cfg.AllowedOrigins),
+		clients:     make(map[int64]map[*Client]struct{}),
+		register:    make(chan *Client),
+		unregister:  make(chan *Client),
+		quit:        make(chan struct{}),
+		done:        make(chan struct{}),
 	}
+	wsc.upgrader = websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		Subprotocols:    []string{wsproto.Subprotocol},
+		CheckOrigin:     wsc.checkOrigin,
+	}
+	backend.Subscribe(wsc.deliverLocal, wsc.userOffline)
+	return wsc
+}
+
+// checkOrigin aceita pedidos sem Origin, que não vêm de browsers, e as origens configuradas
+func (wsc *WebSocketController) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	return origin == "" || wsc.allowOrigin(origin)
 }
 
 func (wsc *WebSocketController) HandleConnections(c *gin.Context) {
-	userID, exists := c.Get("userID")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+	userID, err := currentUserID(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	// Verificado antes do upgrade para a resposta ser um erro da API; o Upgrader só
+	// responderia com texto
+	if !wsc.checkOrigin(c.Request) {
+		c.Error(errOriginNotAllowed)
+		return
+	}
+	if wsc.connectionCount(userID) >= wsc.cfg.MaxConnectionsPerUser {
+		c.Error(errTooManyConnections)
 		return
 	}
 
-	username, exists := c.Get("username")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+	// O token só traz o ID e o papel; o nome vai nas mensagens de estado
+	user, err := wsc.authService.GetUser(c.Request.Context(), userID)
+	if err != nil {
+		c.Error(err)
 		return
 	}
 
 	// Atualizar para conexão WebSocket
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	logger := logging.FromContext(c.Request.Context())
+	conn, err := wsc.upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
-		log.Printf("Error upgrading to websocket: %v", err)
+		logger.Warn("websocket upgrade failed", logging.Err(err))
 		return
 	}
 
 	client := &Client{
 		Conn:     conn,
-		UserID:   userID.(int64),
-		Username: username.(string),
-		Send:     make(chan []byte, 256),
+		UserID:   userID,
+		Username: user.Username,
+		Send:     make(chan []byte, wsc.cfg.SendBuffer),
+		ctx:      context.WithoutCancel(c.Request.Context()),
+		logger:   logger,
 	}
 
-	wsc.register <- client
+	// A presença conta a ligação antes de o hub a registar: o Disconnect, no fim do
+	// readMessages, vem sempre depois
+	first, err := wsc.backend.Connect(client.ctx, userID)
+	if err != nil {
+		logger.Error("failed to register websocket presence", logging.Err(err))
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseInternalServerErr, "internal server error"),
+			time.Now().Add(time.Second))
+		conn.Close()
+		return
+	}
+
+	select {
+	case wsc.register <- client:
+	case <-wsc.quit:
+		// O hub já não regista a ligação, por isso o readMessages não vai retirá-la
+		// da presença
+		if _, err := wsc.backend.Disconnect(client.ctx, userID); err != nil {
+			logger.Error("failed to unregister websocket presence", logging.Err(err))
+		}
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"),
+			time.Now().Add(time.Second))
+		conn.Close()
+		return
+	}
+
+	// Só a primeira ligação do utilizador no cluster muda a presença
+	if first {
+		wsc.notifyUserStatus(client.ctx, userID, user.Username, true)
+	}
 
 	// Goroutine para ler mensagens do cliente
 	go wsc.readMessages(client)
@@ -88,89 +178,550 @@ func (wsc *WebSocketController) HandleConnections(c *gin.Context) {
 
 func (wsc *WebSocketController) readMessages(client *Client) {
 	defer func() {
-		wsc.unregister <- client
 		client.Conn.Close()
+		select {
+		case wsc.unregister <- client:
+		case <-wsc.done:
+			// No shutdown o backend retira de uma vez as ligações da instância
+			return
+		}
+
+		last, err := wsc.backend.Disconnect(client.ctx, client.UserID)
+		if err != nil {
+			client.logger.Error("failed to unregister websocket presence", logging.Err(err))
+			return
+		}
+		if last {
+			wsc.notifyUserStatus(client.ctx, client.UserID, client.Username, false)
+		}
 	}()
 
+	// Frames maiores que o limite fecham a ligação com 1009 (message too big). Sem um
+	// pong (ou outro frame) dentro de PongTimeout a leitura falha e a ligação é fechada.
+	client.Conn.SetReadLimit(wsc.cfg.MaxMessageSize)
+	client.Conn.SetReadDeadline(time.Now().Add(wsc.cfg.PongTimeout))
+	client.Conn.SetPongHandler(func(string) error {
+		return client.Conn.SetReadDeadline(time.Now().Add(wsc.cfg.PongTimeout))
+	})
+
 	for {
-		var msg Message
-		err := client.Conn.ReadJSON(&msg)
+		frameType, data, err := client.Conn.ReadMessage()
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("Error reading message: %v", err)
+			switch {
+			case errors.Is(err, websocket.ErrReadLimit):
+				client.logger.Info("websocket frame too large", "limit", wsc.cfg.MaxMessageSize)
+			case websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseAbnormalClosure):
+				client.logger.Warn("websocket read failed", logging.Err(err))
 			}
 			break
 		}
+		client.Conn.SetReadDeadline(time.Now().Add(wsc.cfg.PongTimeout))
+
+		select {
+		case <-wsc.done:
+			return
+		default:
+		}
+
+		if frameType != websocket.TextMessage {
+			wsc.sendError(client, "", wsproto.NewError(wsproto.CodeInvalidFrame, "frames must be JSON text messages"))
+			continue
+		}
+		env, protoErr := wsproto.Decode(data)
+		if protoErr != nil {
+			wsc.sendError(client, env.ID, protoErr)
+			continue
+		}
+
+		// Cada handler devolve o payload do ack, ou o erro a enviar com o ID do frame
+		var ack interface{}
+		switch env.Type {
+		case wsproto.TypeChatSend:
+			ack, err = wsc.handleSend(client, env)
+		case wsproto.TypeChatRead:
+			ack, err = wsc.handleRead(client, env)
+		case wsproto.TypeTyping:
+			ack, err = wsc.handleTyping(client, env)
+		default:
+			err = wsproto.NewError(wsproto.CodeUnknownType, "unknown event type "+env.Type)
+		}
+		if err != nil {
+			wsc.sendError(client, env.ID, err)
+			continue
+		}
+		if env.ID != "" {
+			wsc.sendTo(client, wsproto.TypeAck, env.ID, ack)
+		}
+	}
+}
+
+// handleSend guarda a mensagem e entrega-a ao destinatário; o ack leva a mensagem guardada
+func (wsc *WebSocketController) handleSend(client *Client, env wsproto.Envelope) (interface{}, error) {
+	var req wsproto.ChatSend
+	if err := env.DecodePayload(&req); err != nil {
+		return nil, err
+	}
+
+	message, err := wsc.chatService.SendMessage(client.ctx, client.UserID, &models.SendMessageRequest{
+		ConversationID: req.ConversationID,
+		StoreID:        req.StoreID,
+		Content:        req.Content,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	wsc.DeliverMessage(client.ctx, message)
+	return message, nil
+}
+
+// handleRead marca as mensagens como lidas e envia o recibo ao remetente; o ack leva
+// o recibo, ou nada se não havia mensagens por ler
+func (wsc *WebSocketController) handleRead(client *Client, env wsproto.Envelope) (interface{}, error) {
+	var req wsproto.ChatRead
+	if err := env.DecodePayload(&req); err != nil {
+		return nil, err
+	}
+
+	receipt, err := wsc.chatService.MarkRead(client.ctx, client.UserID, req.ConversationID, req.UpToID)
+	if err != nil {
+		return nil, err
+	}
+	wsc.SendReadReceipt(client.ctx, receipt)
+	if receipt == nil {
+		return nil, nil
+	}
+	return receipt, nil
+}
+
+// handleTyping reencaminha o indicador de escrita à outra parte da conversa, sem o guardar
+func (wsc *WebSocketController) handleTyping(client *Client, env wsproto.Envelope) (interface{}, error) {
+	var req wsproto.Typing
+	if err := env.DecodePayload(&req); err != nil {
+		return nil, err
+	}
+
+	recipientID, err := wsc.chatService.Recipient(client.ctx, client.UserID, req.ConversationID)
+	if err != nil {
+		return nil, err
+	}
+	req.UserID = client.UserID
+	wsc.notifyUser(client.ctx, recipientID, wsproto.TypeTyping, req)
+	return nil, nil
+}
+
+// DeliverMessage envia uma mensagem já guardada às ligações do destinatário, em
+// qualquer instância. A instância que a entregar marca-a como entregue e envia o
+// recibo ao remetente; se o destinatário não estiver ligado, a mensagem é entregue
+// na próxima ligação.
+func (wsc *WebSocketController) DeliverMessage(ctx context.Context, message *models.Message) {
+	frame, err := wsproto.Encode(wsproto.TypeChatMessage, "", message)
+	if err != nil {
+		logging.FromContext(ctx).Error("error encoding websocket event", "type", wsproto.TypeChatMessage, logging.Err(err))
+		return
+	}
+	wsc.publish(ctx, hub.Event{UserID: message.RecipientID, MessageID: message.ID, Frame: frame})
+}
+
+// SendReadReceipt avisa o remetente de que as suas mensagens foram lidas; um recibo
+// nil (nada por ler) é ignorado
+func (wsc *WebSocketController) SendReadReceipt(ctx context.Context, receipt *models.ReadReceipt) {
+	if receipt != nil {
+		wsc.notifyUser(ctx, receipt.SenderID, wsproto.TypeChatRead, receipt)
+	}
+}
+
+// deliverPending envia a um cliente acabado de ligar as mensagens recebidas enquanto
+// esteve desligado
+func (wsc *WebSocketController) deliverPending(client *Client) {
+	messages, err := wsc.chatService.PendingMessages(client.ctx, client.UserID)
+	if err != nil {
+		client.logger.Warn("failed to load pending messages", logging.Err(err))
+		return
+	}
+
+	ids := make([]int64, 0, len(messages))
+	for i := range messages {
+		if !wsc.sendTo(client, wsproto.TypeChatMessage, "", &messages[i]) {
+			break
+		}
+		metrics.WebSocketMessagesRelayed.Inc()
+		ids = append(ids, messages[i].ID)
+	}
+	wsc.markDelivered(client.ctx, client.UserID, ids)
+}
 
-		msg.SenderID = client.UserID
-		msg.SenderName = client.Username
-		msg.Timestamp = time.Now()
+// markDelivered regista a entrega e envia os recibos aos remetentes
+func (wsc *WebSocketController) markDelivered(ctx context.Context, recipientID int64, ids []int64) {
+	receipts, err := wsc.chatService.MarkDelivered(ctx, recipientID, ids)
+	if err != nil {
+		logging.FromContext(ctx).Warn("failed to mark messages delivered", logging.Err(err))
+		return
+	}
+	for i := range receipts {
+		wsc.notifyUser(ctx, receipts[i].SenderID, wsproto.TypeChatDelivered, &receipts[i])
+	}
+}
+
+// sendError envia ao cliente um evento error com o ID do frame que falhou. Os erros
+// do protocolo e os erros de domínio levam o seu código; os internos não são expostos:
+// são registados nos logs e o cliente recebe internal_error.
+func (wsc *WebSocketController) sendError(client *Client, id string, err error) {
+	payload := wsproto.NewError(wsproto.CodeInternal, "internal server error")
+	var protoErr *wsproto.Error
+	var svcErr *services.Error
+	switch {
+	case errors.As(err, &protoErr):
+		payload = protoErr
+	case errors.As(err, &svcErr):
+		payload = wsproto.NewError(svcErr.Code, svcErr.Message)
+		for _, field := range svcErr.Fields {
+			payload.Errors = append(payload.Errors, wsproto.FieldError(field))
+		}
+	default:
+		client.logger.Error("websocket request failed", logging.Err(err))
+	}
+	wsc.sendTo(client, wsproto.TypeError, id, payload)
+}
 
-		wsc.broadcast <- msg
+// notifyUser envia um evento a todas as ligações do utilizador, em qualquer instância
+func (wsc *WebSocketController) notifyUser(ctx context.Context, userID int64, eventType string, data interface{}) {
+	frame, err := wsproto.Encode(eventType, "", data)
+	if err != nil {
+		logging.FromContext(ctx).Error("error encoding websocket event", "type", eventType, logging.Err(err))
+		return
+	}
+	wsc.publish(ctx, hub.Event{UserID: userID, Frame: frame})
+}
+
+// publish entrega o evento através do backend. Uma falha só afeta as outras
+// instâncias: as ligações desta já o receberam.
+func (wsc *WebSocketController) publish(ctx context.Context, event hub.Event) {
+	if err := wsc.backend.Publish(ctx, event); err != nil {
+		logging.FromContext(ctx).Warn("failed to publish websocket event", logging.Err(err))
 	}
 }
 
+// deliverLocal põe um evento do backend nas filas das ligações desta instância. Uma
+// mensagem de chat entregue a alguma ligação é marcada como entregue.
+func (wsc *WebSocketController) deliverLocal(ctx context.Context, event hub.Event) {
+	delivered := false
+	wsc.mu.Lock()
+	if len(event.UserIDs) > 0 {
+		for _, id := range event.UserIDs {
+			for client := range wsc.clients[id] {
+				wsc.enqueueLocked(client, event.Frame)
+			}
+		}
+	} else {
+		for client := range wsc.clients[event.UserID] {
+			if wsc.enqueueLocked(client, event.Frame) {
+				delivered = true
+			}
+		}
+	}
+	wsc.mu.Unlock()
+
+	if delivered && event.MessageID != 0 {
+		metrics.WebSocketMessagesRelayed.Inc()
+		wsc.markDelivered(ctx, event.UserID, []int64{event.MessageID})
+	}
+}
+
+// userOffline anuncia a saída de um utilizador cujas ligações estavam numa instância
+// que morreu ou foi desligada
+func (wsc *WebSocketController) userOffline(ctx context.Context, userID int64) {
+	var username string
+	if user, err := wsc.authService.GetUser(ctx, userID); err == nil {
+		username = user.Username
+	}
+	wsc.notifyUserStatus(ctx, userID, username, false)
+}
+
+// sendTo põe um evento na fila de envio de uma ligação. Falha se a ligação já foi
+// fechada ou se não acompanha os envios. id é o ID do frame a que o evento responde.
+func (wsc *WebSocketController) sendTo(client *Client, eventType, id string, data interface{}) bool {
+	payload, err := wsproto.Encode(eventType, id, data)
+	if err != nil {
+		client.logger.Error("error encoding websocket event", "type", eventType, logging.Err(err))
+		return false
+	}
+
+	wsc.mu.Lock()
+	defer wsc.mu.Unlock()
+	if _, ok := wsc.clients[client.UserID][client]; !ok {
+		metrics.WebSocketSendsDropped.WithLabelValues("receiver_offline").Inc()
+		return false
+	}
+	return wsc.enqueueLocked(client, payload)
+}
+
+// enqueueLocked põe o payload na fila sem bloquear, com wsc.mu. Uma ligação com a fila
+// cheia não está a ler o que lhe enviamos: em vez de atrasar o hub ou perder eventos
+// em silêncio, é fechada e o cliente volta a ligar-se e a pedir o histórico.
+func (wsc *WebSocketController) enqueueLocked(client *Client, payload []byte) bool {
+	select {
+	case client.Send <- payload:
+		return true
+	default:
+		metrics.WebSocketSendsDropped.WithLabelValues("slow_consumer").Inc()
+		client.logger.Warn("dropping slow websocket client", "buffer", cap(client.Send))
+		client.closeMsg = websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "client too slow")
+		wsc.removeLocked(client)
+		return false
+	}
+}
+
+// removeLocked retira a ligação do hub e fecha o Send, com wsc.mu; devolve se ainda
+// estava registada
+func (wsc *WebSocketController) removeLocked(client *Client) bool {
+	conns, ok := wsc.clients[client.UserID]
+	if !ok {
+		return false
+	}
+	if _, ok := conns[client]; !ok {
+		return false
+	}
+	delete(conns, client)
+	if len(conns) == 0 {
+		delete(wsc.clients, client.UserID)
+	}
+	close(client.Send)
+	return true
+}
+
+// connectionCount devolve quantas ligações o utilizador tem abertas
+func (wsc *WebSocketController) connectionCount(userID int64) int {
+	wsc.mu.Lock()
+	defer wsc.mu.Unlock()
+	return len(wsc.clients[userID])
+}
+
+// writeMessages escreve a fila de envio na ligação e envia um ping a cada
+// PingInterval. Quando o Send é fechado envia o close frame, se houver, e fecha a ligação.
 func (wsc *WebSocketController) writeMessages(client *Client) {
+	ticker := time.NewTicker(wsc.cfg.PingInterval)
 	defer func() {
+		ticker.Stop()
 		client.Conn.Close()
 	}()
 
-	for message := range client.Send {
-		err := client.Conn.WriteMessage(websocket.TextMessage, message)
-		if err != nil {
-			log.Printf("Error writing message: %v", err)
-			return
+	for {
+		select {
+		case message, ok := <-client.Send:
+			client.Conn.SetWriteDeadline(time.Now().Add(wsc.cfg.WriteTimeout))
+			if !ok {
+				if client.closeMsg != nil {
+					client.Conn.WriteMessage(websocket.CloseMessage, client.closeMsg)
+				}
+				return
+			}
+			if err := client.Conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				// Depois de o cliente fechar a ligação as escritas falham com ErrCloseSent
+				if !errors.Is(err, websocket.ErrCloseSent) {
+					client.logger.Warn("websocket write failed", logging.Err(err))
+				}
+				return
+			}
+
+		case <-ticker.C:
+			client.Conn.SetWriteDeadline(time.Now().Add(wsc.cfg.WriteTimeout))
+			if err := client.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				client.logger.Debug("websocket ping failed", logging.Err(err))
+				return
+			}
 		}
 	}
 }
 
-func (wsc *WebSocketController) Run() {
+// Start marca o hub como a correr e arranca o ciclo do hub. A marca é feita antes de
+// a goroutine arrancar, para a readiness não falhar logo depois de o servidor abrir.
+func (wsc *WebSocketController) Start() {
+	wsc.startOnce.Do(func() {
+		wsc.running.Store(true)
+		go wsc.run()
+	})
+}
+
+func (wsc *WebSocketController) run() {
+	defer func() {
+		wsc.running.Store(false)
+		close(wsc.done)
+	}()
+
 	for {
 		select {
+		case <-wsc.quit:
+			wsc.closeAll()
+			return
+
 		case client := <-wsc.register:
 			wsc.mu.Lock()
-			wsc.clients[client.UserID] = client
+			conns, ok := wsc.clients[client.UserID]
+			if !ok {
+				conns = make(map[*Client]struct{})
+				wsc.clients[client.UserID] = conns
+			}
+			conns[client] = struct{}{}
 			wsc.mu.Unlock()
 
-			// Notificar outros usuários sobre a nova conexão
-			wsc.notifyUserStatus(client.UserID, client.Username, true)
+			// Entregar o que chegou enquanto esteve desligado, fora do ciclo do hub
+			go wsc.deliverPending(client)
 
 		case client := <-wsc.unregister:
+			// A ligação pode já ter sido retirada por não acompanhar os envios
 			wsc.mu.Lock()
-			if _, ok := wsc.clients[client.UserID]; ok {
-				delete(wsc.clients, client.UserID)
-				close(client.Send)
-			}
+			wsc.removeLocked(client)
 			wsc.mu.Unlock()
+		}
+	}
+}
 
-			// Notificar outros usuários sobre a desconexão
-			wsc.notifyUserStatus(client.UserID, client.Username, false)
+// maxPresenceUsers limita os utilizadores consultados num pedido de presença
+const maxPresenceUsers = 100
 
-		case message := <-wsc.broadcast:
-			// Enviar mensagem para o destinatário específico
-			wsc.mu.Lock()
-			if receiver, ok := wsc.clients[message.ReceiverID]; ok {
-				receiver.Send <- []byte(message.Content)
-			}
-			wsc.mu.Unlock()
+// Presence returns which of the given users (user_ids, comma-separated) have an
+// open WebSocket connection on any instance. Only users the caller shares a
+// conversation with, or whose store the caller follows, can be reported online.
+func (wsc *WebSocketController) Presence(c *gin.Context) {
+	viewerID, err := currentUserID(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	var userIDs []int64
+	for _, raw := range strings.Split(c.Query("user_ids"), ",") {
+		if raw = strings.TrimSpace(raw); raw == "" {
+			continue
 		}
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || id < 1 {
+			c.Error(services.NewFieldError("user_ids", "invalid", "user_ids must be a comma-separated list of user IDs"))
+			return
+		}
+		userIDs = append(userIDs, id)
+	}
+	if len(userIDs) == 0 {
+		c.Error(services.NewFieldError("user_ids", "required", "user_ids is required"))
+		return
+	}
+	if len(userIDs) > maxPresenceUsers {
+		c.Error(services.NewFieldError("user_ids", "max", fmt.Sprintf("at most %d user IDs per request", maxPresenceUsers)))
+		return
+	}
+
+	// Os outros aparecem sempre como desligados, sem distinguir quem não existe
+	visible, err := wsc.chatService.VisiblePresence(c.Request.Context(), viewerID, userIDs)
+	if err != nil {
+		c.Error(err)
+		return
 	}
+	online := []int64{}
+	if len(visible) > 0 {
+		if online, err = wsc.backend.Online(c.Request.Context(), visible); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"online": online})
 }
 
-func (wsc *WebSocketController) notifyUserStatus(userID int64, username string, online bool) {
-	statusMessage := struct {
-		UserID   int64  `json:"user_id"`
-		Username string `json:"username"`
-		Online   bool   `json:"online"`
-	}{
-		UserID:   userID,
-		Username: username,
-		Online:   online,
+// HealthCheck reporta se o hub está a correr e quantos clientes estão ligados
+func (wsc *WebSocketController) HealthCheck(ctx context.Context) (map[string]interface{}, error) {
+	stats := wsc.Stats()
+	details := map[string]interface{}{
+		"connected_clients": stats.ConnectedClients,
+		"connected_users":   stats.ConnectedUsers,
+	}
+	if !wsc.running.Load() {
+		return details, errors.New("websocket hub is not running")
+	}
+	if err := wsc.backend.Ping(ctx); err != nil {
+		return details, err
+	}
+	return details, nil
+}
+
+// Stats devolve o número de ligações, de utilizadores ligados e de mensagens à espera nos buffers de envio
+func (wsc *WebSocketController) Stats() metrics.HubStats {
+	wsc.mu.Lock()
+	defer wsc.mu.Unlock()
+
+	stats := metrics.HubStats{ConnectedUsers: len(wsc.clients)}
+	for _, conns := range wsc.clients {
+		stats.ConnectedClients += len(conns)
+		for client := range conns {
+			stats.QueuedMessages += len(client.Send)
+		}
 	}
+	return stats
+}
+
+// Shutdown envia um close frame a todos os clientes e para o hub. Deve ser chamado
+// depois de o servidor HTTP deixar de aceitar novas ligações.
+func (wsc *WebSocketController) Shutdown(ctx context.Context) error {
+	wsc.stopOnce.Do(func() { close(wsc.quit) })
+
+	select {
+	case <-wsc.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
 
-	for id, client := range wsc.clients {
-		if id != userID { 
-			client.Send <- []byte(fmt.Sprintf(`{"type":"status","data":%s}`, statusMessage))
+// closeAll retira todas as ligações do hub e fecha-as em paralelo, fora do wsc.mu:
+// um cliente lento a receber o close frame não atrasa os outros nem bloqueia o hub
+func (wsc *WebSocketController) closeAll() {
+	// Fora do mapa ninguém volta a escrever no Send, por isso pode ser fechado sem o lock
+	var clients []*Client
+	wsc.mu.Lock()
+	for id, conns := range wsc.clients {
+		for client := range conns {
+			clients = append(clients, client)
 		}
+		delete(wsc.clients, id)
 	}
-}
\ No newline at end of file
+	wsc.mu.Unlock()
+
+	closeMsg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	var wg sync.WaitGroup
+	for _, client := range clients {
+		wg.Add(1)
+		go func(client *Client) {
+			defer wg.Done()
+			if err := client.Conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(time.Second)); err != nil {
+				client.logger.Debug("error sending close frame", logging.Err(err))
+			}
+			close(client.Send)
+			client.Conn.Close()
+		}(client)
+	}
+	wg.Wait()
+}
+
+// notifyUserStatus envia a presença do utilizador às ligações, em qualquer instância,
+// de quem tem uma conversa com ele ou segue a sua loja
+func (wsc *WebSocketController) notifyUserStatus(ctx context.Context, userID int64, username string, online bool) {
+	watchers, err := wsc.chatService.PresenceWatchers(ctx, userID)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to list presence watchers", logging.Err(err))
+		return
+	}
+	if len(watchers) == 0 {
+		return
+	}
+
+	frame, err := wsproto.Encode(wsproto.TypePresence, "", wsproto.Presence{
+		UserID:   userID,
+		Username: username,
+		Online:   online,
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("error encoding websocket status message", logging.Err(err))
+		return
+	}
+	wsc.publish(ctx, hub.Event{UserIDs: watchers, Frame: frame})
+}
@@ -0,0 +1,239 @@
+package controllers
+
+import (
+	"net/http"
+
+	"modress/internal/models"
+	"modress/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WishlistController handles the user's wishlists, the products saved in them
+// and the public links of shared wishlists.
+type WishlistController struct {
+	wishlistService services.WishlistService
+}
+
+// NewWishlistController creates a new WishlistController instance.
+func NewWishlistController(wishlistService services.WishlistService) *WishlistController {
+	return &WishlistController{wishlistService: wishlistService}
+}
+
+// ListWishlists lists the user's wishlists with the number of products in each.
+func (c *WishlistController) ListWishlists(ctx *gin.Context) {
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	wishlists, err := c.wishlistService.ListWishlists(ctx.Request.Context(), userID)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, wishlists)
+}
+
+// CreateWishlist creates a named wishlist; a public one gets a share token.
+func (c *WishlistController) CreateWishlist(ctx *gin.Context) {
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var req models.CreateWishlistRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.Error(services.NewValidationError(err))
+		return
+	}
+
+	wishlist, err := c.wishlistService.CreateWishlist(ctx.Request.Context(), userID, &req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, wishlist)
+}
+
+// GetWishlist returns one of the user's wishlists with its products.
+func (c *WishlistController) GetWishlist(ctx *gin.Context) {
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	id, err := paramID(ctx, "id", "wishlist")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	wishlist, err := c.wishlistService.GetWishlist(ctx.Request.Context(), userID, id)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, wishlist)
+}
+
+// GetSharedWishlist returns a public wishlist by its share token, without
+// authentication and without identifying its owner.
+func (c *WishlistController) GetSharedWishlist(ctx *gin.Context) {
+	wishlist, err := c.wishlistService.GetSharedWishlist(ctx.Request.Context(), ctx.Param("token"))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, wishlist)
+}
+
+// UpdateWishlist renames a wishlist or changes whether it can be shared.
+func (c *WishlistController) UpdateWishlist(ctx *gin.Context) {
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	id, err := paramID(ctx, "id", "wishlist")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var req models.UpdateWishlistRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.Error(services.NewValidationError(err))
+		return
+	}
+
+	wishlist, err := c.wishlistService.UpdateWishlist(ctx.Request.Context(), userID, id, &req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, wishlist)
+}
+
+// DeleteWishlist deletes a wishlist and the products saved in it.
+func (c *WishlistController) DeleteWishlist(ctx *gin.Context) {
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	id, err := paramID(ctx, "id", "wishlist")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	if err := c.wishlistService.DeleteWishlist(ctx.Request.Context(), userID, id); err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// AddItem saves a product in a wishlist.
+func (c *WishlistController) AddItem(ctx *gin.Context) {
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	id, err := paramID(ctx, "id", "wishlist")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var req models.AddWishlistItemRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.Error(services.NewValidationError(err))
+		return
+	}
+
+	item, err := c.wishlistService.AddItem(ctx.Request.Context(), userID, id, &req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, item)
+}
+
+// RemoveItem removes a product from a wishlist.
+func (c *WishlistController) RemoveItem(ctx *gin.Context) {
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	id, err := paramID(ctx, "id", "wishlist")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	productID, err := paramID(ctx, "productId", "product")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	if err := c.wishlistService.RemoveItem(ctx.Request.Context(), userID, id, productID); err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// MoveItem moves a product to another of the user's wishlists, keeping the date
+// and the price it was saved with.
+func (c *WishlistController) MoveItem(ctx *gin.Context) {
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	id, err := paramID(ctx, "id", "wishlist")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	productID, err := paramID(ctx, "productId", "product")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var req models.MoveWishlistItemRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.Error(services.NewValidationError(err))
+		return
+	}
+
+	if err := c.wishlistService.MoveItem(ctx.Request.Context(), userID, id, productID, &req); err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
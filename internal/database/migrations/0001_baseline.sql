@@ -0,0 +1,54 @@
+-- Esquema base da API. Usa IF NOT EXISTS para não alterar bases de dados já existentes.
+CREATE TABLE IF NOT EXISTS users (
+    id            BIGSERIAL PRIMARY KEY,
+    username      VARCHAR(100) NOT NULL,
+    email         VARCHAR(255) NOT NULL UNIQUE,
+    phone         VARCHAR(20),
+    password_hash TEXT NOT NULL,
+    role          VARCHAR(20) NOT NULL DEFAULT 'buyer',
+    status        VARCHAR(20) NOT NULL DEFAULT 'active',
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS stores (
+    id          BIGSERIAL PRIMARY KEY,
+    owner_id    BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name        VARCHAR(150) NOT NULL,
+    slug        VARCHAR(150) NOT NULL UNIQUE,
+    description TEXT,
+    logo_url    TEXT,
+    banner_url  TEXT,
+    is_approved BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS products (
+    id          BIGSERIAL PRIMARY KEY,
+    store_id    BIGINT NOT NULL REFERENCES stores(id) ON DELETE CASCADE,
+    title       VARCHAR(255) NOT NULL,
+    description TEXT,
+    price_cents INTEGER NOT NULL DEFAULT 0,
+    cost_cents  INTEGER,
+    sku         VARCHAR(100),
+    barcode     VARCHAR(100),
+    quantity    INTEGER NOT NULL DEFAULT 0,
+    is_active   BOOLEAN NOT NULL DEFAULT TRUE,
+    category    VARCHAR(100),
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_products_store_id ON products (store_id);
+CREATE INDEX IF NOT EXISTS idx_products_store_sku ON products (store_id, sku);
+
+CREATE TABLE IF NOT EXISTS product_images (
+    id         BIGSERIAL PRIMARY KEY,
+    product_id BIGINT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    url        TEXT NOT NULL,
+    alt_text   VARCHAR(255),
+    position   INTEGER NOT NULL DEFAULT 1,
+    is_primary BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS jobs (
+    id           BIGSERIAL PRIMARY KEY,
+    type         VARCHAR(100) NOT NULL,
+    payload      JSONB NOT NULL DEFAULT '{}',
+    status       VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts     INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL DEFAULT 5,
+    run_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    locked_at    TIMESTAMPTZ,
+    locked_by    VARCHAR(100),
+    last_error   TEXT,
+    progress     INTEGER NOT NULL DEFAULT 0,
+    total        INTEGER NOT NULL DEFAULT 0,
+    result       JSONB,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    finished_at  TIMESTAMPTZ
+);
+
+-- Índice parcial usado pelos workers ao procurar o próximo job
+CREATE INDEX IF NOT EXISTS idx_jobs_pending_run_at ON jobs (run_at, id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_jobs_status ON jobs (status);
+CREATE INDEX IF NOT EXISTS idx_jobs_type ON jobs (type);
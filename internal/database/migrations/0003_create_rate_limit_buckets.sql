@@ -0,0 +1,10 @@
+-- Baldes do rate limit partilhados entre instâncias. UNLOGGED: perder os contadores
+-- num crash da base de dados é aceitável e evita escrever no WAL a cada pedido.
+CREATE UNLOGGED TABLE IF NOT EXISTS rate_limit_buckets (
+    key        VARCHAR(255) PRIMARY KEY,
+    tokens     DOUBLE PRECISION NOT NULL,
+    allowed    BOOLEAN NOT NULL DEFAULT TRUE,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_rate_limit_buckets_updated_at ON rate_limit_buckets (updated_at);
@@ -0,0 +1,18 @@
+-- Respostas guardadas para pedidos com Idempotency-Key, por utilizador
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    user_id          BIGINT NOT NULL,
+    key              VARCHAR(255) NOT NULL,
+    method           VARCHAR(10) NOT NULL,
+    path             TEXT NOT NULL,
+    fingerprint      CHAR(64) NOT NULL,
+    status           VARCHAR(20) NOT NULL DEFAULT 'processing',
+    response_status  INTEGER,
+    response_headers JSONB,
+    response_body    BYTEA,
+    locked_until     TIMESTAMPTZ NOT NULL,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at       TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (user_id, key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys (expires_at);
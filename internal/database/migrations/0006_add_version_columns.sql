@@ -0,0 +1,6 @@
+-- Versão para controlo de concorrência otimista (ETag / If-Match); cada escrita incrementa-a
+ALTER TABLE products
+    ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+
+ALTER TABLE stores
+    ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
@@ -0,0 +1,17 @@
+-- Soft delete: os registos apagados ficam com deleted_at até o job de limpeza os remover
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+ALTER TABLE stores
+    ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+ALTER TABLE products
+    ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+-- O slug só tem de ser único entre as lojas ativas; uma loja apagada não o reserva
+ALTER TABLE stores DROP CONSTRAINT IF EXISTS stores_slug_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_stores_slug_active ON stores (slug) WHERE deleted_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_stores_deleted_at ON stores (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_products_deleted_at ON products (deleted_at) WHERE deleted_at IS NOT NULL;
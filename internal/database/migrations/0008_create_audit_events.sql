@@ -0,0 +1,18 @@
+-- Registo de auditoria das alterações feitas pelos utilizadores e administradores
+CREATE TABLE IF NOT EXISTS audit_events (
+    id          BIGSERIAL PRIMARY KEY,
+    actor_id    BIGINT,
+    actor_role  VARCHAR(20),
+    ip          VARCHAR(45),
+    request_id  VARCHAR(128),
+    action      VARCHAR(50) NOT NULL,
+    entity_type VARCHAR(30) NOT NULL,
+    entity_id   BIGINT NOT NULL,
+    changes     JSONB NOT NULL DEFAULT '{}',
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Sem chaves estrangeiras: o registo tem de sobreviver à purga das entidades e dos utilizadores
+CREATE INDEX IF NOT EXISTS idx_audit_events_entity ON audit_events (entity_type, entity_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor ON audit_events (actor_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events (created_at DESC);
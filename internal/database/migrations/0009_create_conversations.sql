@@ -0,0 +1,27 @@
+-- Conversas entre um comprador e uma loja, e as mensagens trocadas nelas
+CREATE TABLE IF NOT EXISTS conversations (
+    id              BIGSERIAL PRIMARY KEY,
+    buyer_id        BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    store_id        BIGINT NOT NULL REFERENCES stores(id) ON DELETE CASCADE,
+    last_message_at TIMESTAMPTZ,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (buyer_id, store_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_conversations_store ON conversations (store_id, last_message_at DESC);
+
+CREATE TABLE IF NOT EXISTS messages (
+    id              BIGSERIAL PRIMARY KEY,
+    conversation_id BIGINT NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    sender_id       BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    recipient_id    BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    content         TEXT NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    delivered_at    TIMESTAMPTZ,
+    read_at         TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_messages_conversation ON messages (conversation_id, id DESC);
+-- Contagem de não lidas e entrega das pendentes quando o destinatário se liga
+CREATE INDEX IF NOT EXISTS idx_messages_unread ON messages (recipient_id, conversation_id) WHERE read_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_messages_undelivered ON messages (recipient_id, id) WHERE delivered_at IS NULL;
@@ -0,0 +1,28 @@
+-- Estado partilhado do hub WebSocket quando corre em várias instâncias (WS_BACKEND=postgres).
+-- UNLOGGED: depois de um crash da base de dados as ligações voltam a registar-se.
+
+-- Instâncias vivas; uma instância sem heartbeat recente é dada como morta e as suas
+-- ligações deixam de contar para a presença
+CREATE UNLOGGED TABLE IF NOT EXISTS ws_instances (
+    id           VARCHAR(64) PRIMARY KEY,
+    heartbeat_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Ligações abertas por utilizador em cada instância
+CREATE UNLOGGED TABLE IF NOT EXISTS ws_presence (
+    instance_id VARCHAR(64) NOT NULL,
+    user_id     BIGINT NOT NULL,
+    connections INT NOT NULL,
+    PRIMARY KEY (instance_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_ws_presence_user_id ON ws_presence (user_id);
+
+-- Eventos maiores do que o payload máximo do NOTIFY: o NOTIFY leva só o ID
+CREATE UNLOGGED TABLE IF NOT EXISTS ws_events (
+    id         BIGSERIAL PRIMARY KEY,
+    payload    TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_ws_events_created_at ON ws_events (created_at);
@@ -0,0 +1,23 @@
+-- Notificações mostradas na aplicação e preferências de cada utilizador por tipo
+CREATE TABLE IF NOT EXISTS notifications (
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type       VARCHAR(50) NOT NULL,
+    title      VARCHAR(255) NOT NULL,
+    body       TEXT NOT NULL DEFAULT '',
+    data       JSONB NOT NULL DEFAULT '{}',
+    read_at    TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications (user_id, id DESC);
+CREATE INDEX IF NOT EXISTS idx_notifications_unread ON notifications (user_id) WHERE read_at IS NULL;
+
+-- Sem linha para um tipo valem as preferências por omissão desse tipo
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type    VARCHAR(50) NOT NULL,
+    in_app  BOOLEAN NOT NULL,
+    email   BOOLEAN NOT NULL,
+    PRIMARY KEY (user_id, type)
+);
@@ -0,0 +1,35 @@
+-- Webhooks das lojas: cada subscrição recebe, assinados, os eventos dos tipos escolhidos
+CREATE TABLE IF NOT EXISTS webhooks (
+    id         BIGSERIAL PRIMARY KEY,
+    store_id   BIGINT NOT NULL REFERENCES stores(id) ON DELETE CASCADE,
+    url        TEXT NOT NULL,
+    secret     VARCHAR(100) NOT NULL,
+    events     TEXT[] NOT NULL,
+    is_active  BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhooks_store_id ON webhooks (store_id);
+
+-- Registo das entregas. Uma reentrega é uma nova linha com o mesmo event_id, para que
+-- o recetor a reconheça como repetida.
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id              BIGSERIAL PRIMARY KEY,
+    webhook_id      BIGINT NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+    event_id        VARCHAR(64) NOT NULL,
+    event_type      VARCHAR(50) NOT NULL,
+    payload         JSONB NOT NULL,
+    status          VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts        INT NOT NULL DEFAULT 0,
+    response_status INT,
+    response_body   TEXT,
+    error           TEXT,
+    duration_ms     BIGINT,
+    redelivery_of   BIGINT REFERENCES webhook_deliveries(id) ON DELETE SET NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_attempt_at TIMESTAMPTZ,
+    delivered_at    TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries (webhook_id, id DESC);
@@ -0,0 +1,51 @@
+-- Avaliações dos produtos. Cada utilizador avalia um produto uma vez; a média e o
+-- número das avaliações publicadas ficam guardados no produto para a listagem as
+-- poder ordenar.
+CREATE TABLE IF NOT EXISTS reviews (
+    id                BIGSERIAL PRIMARY KEY,
+    product_id        BIGINT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    user_id           BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    rating            SMALLINT NOT NULL CHECK (rating BETWEEN 1 AND 5),
+    body              TEXT NOT NULL DEFAULT '',
+    -- Virá das encomendas; enquanto não existirem fica a false
+    verified_purchase BOOLEAN NOT NULL DEFAULT FALSE,
+    status            VARCHAR(20) NOT NULL DEFAULT 'published',
+    reply             TEXT,
+    replied_at        TIMESTAMPTZ,
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (product_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_reviews_product ON reviews (product_id, created_at DESC) WHERE status = 'published';
+
+CREATE TABLE IF NOT EXISTS review_photos (
+    id         BIGSERIAL PRIMARY KEY,
+    review_id  BIGINT NOT NULL REFERENCES reviews(id) ON DELETE CASCADE,
+    url        TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_review_photos_review ON review_photos (review_id);
+
+-- Denúncias para a moderação; cada utilizador denuncia uma avaliação uma vez
+CREATE TABLE IF NOT EXISTS review_reports (
+    id          BIGSERIAL PRIMARY KEY,
+    review_id   BIGINT NOT NULL REFERENCES reviews(id) ON DELETE CASCADE,
+    reporter_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reason      VARCHAR(20) NOT NULL,
+    details     TEXT,
+    status      VARCHAR(20) NOT NULL DEFAULT 'pending',
+    resolved_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    resolved_at TIMESTAMPTZ,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (review_id, reporter_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_review_reports_status ON review_reports (status, id DESC);
+
+ALTER TABLE products
+    ADD COLUMN IF NOT EXISTS rating_average NUMERIC(3,2) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS rating_count INT NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_products_rating ON products (rating_average DESC, rating_count DESC) WHERE deleted_at IS NULL;
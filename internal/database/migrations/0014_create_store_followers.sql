@@ -0,0 +1,30 @@
+-- Avaliação da loja (as avaliações publicadas de todos os seus produtos) e número de
+-- seguidores, guardados na loja como a média dos produtos
+ALTER TABLE stores
+    ADD COLUMN IF NOT EXISTS rating_average NUMERIC(3,2) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS rating_count INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS follower_count INT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS store_followers (
+    user_id    BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    store_id   BIGINT NOT NULL REFERENCES stores(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, store_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_store_followers_store ON store_followers (store_id);
+
+-- O feed percorre os produtos das lojas seguidas do mais recente para o mais antigo
+CREATE INDEX IF NOT EXISTS idx_products_store_created ON products (store_id, created_at DESC) WHERE deleted_at IS NULL;
+
+-- As estatísticas de resposta percorrem as mensagens recentes das conversas de cada loja
+CREATE INDEX IF NOT EXISTS idx_messages_conversation_created ON messages (conversation_id, created_at);
+
+-- As avaliações já guardadas contam para a loja a partir de agora
+UPDATE stores SET
+    rating_average = COALESCE((
+        SELECT ROUND(AVG(r.rating), 2) FROM reviews r JOIN products p ON p.id = r.product_id
+        WHERE p.store_id = stores.id AND r.status = 'published'), 0),
+    rating_count = (
+        SELECT COUNT(*) FROM reviews r JOIN products p ON p.id = r.product_id
+        WHERE p.store_id = stores.id AND r.status = 'published');
@@ -0,0 +1,25 @@
+-- Listas de produtos guardados pelos utilizadores. Uma lista pública pode ser vista
+-- por quem tiver o link com o share_token.
+CREATE TABLE IF NOT EXISTS wishlists (
+    id          BIGSERIAL PRIMARY KEY,
+    user_id     BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name        VARCHAR(100) NOT NULL,
+    is_public   BOOLEAN NOT NULL DEFAULT FALSE,
+    share_token VARCHAR(64) UNIQUE,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_wishlists_user ON wishlists (user_id);
+
+-- O preço no momento em que o produto foi guardado mostra quanto já baixou
+CREATE TABLE IF NOT EXISTS wishlist_items (
+    wishlist_id        BIGINT NOT NULL REFERENCES wishlists(id) ON DELETE CASCADE,
+    product_id         BIGINT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    price_cents_at_add INT NOT NULL,
+    created_at         TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (wishlist_id, product_id)
+);
+
+-- Os alertas de preço e de stock procuram quem guardou o produto
+CREATE INDEX IF NOT EXISTS idx_wishlist_items_product ON wishlist_items (product_id);
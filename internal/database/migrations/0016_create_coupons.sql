@@ -0,0 +1,39 @@
+-- Cupões de desconto. Sem store_id valem em todo o marketplace; com store_id só nos
+-- produtos dessa loja. O desconto é uma percentagem ou um valor fixo, nunca os dois.
+CREATE TABLE IF NOT EXISTS coupons (
+    id                       BIGSERIAL PRIMARY KEY,
+    store_id                 BIGINT REFERENCES stores(id) ON DELETE CASCADE,
+    code                     VARCHAR(50) NOT NULL UNIQUE,
+    description              TEXT,
+    percent_off              SMALLINT CHECK (percent_off BETWEEN 1 AND 100),
+    amount_off_cents         INT CHECK (amount_off_cents > 0),
+    min_order_cents          INT NOT NULL DEFAULT 0,
+    valid_from               TIMESTAMPTZ,
+    valid_until              TIMESTAMPTZ,
+    max_redemptions          INT CHECK (max_redemptions > 0),
+    max_redemptions_per_user INT CHECK (max_redemptions_per_user > 0),
+    redemption_count         INT NOT NULL DEFAULT 0,
+    is_active                BOOLEAN NOT NULL DEFAULT TRUE,
+    created_by               BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    created_at               TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at               TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK ((percent_off IS NULL) <> (amount_off_cents IS NULL)),
+    CHECK (valid_until IS NULL OR valid_from IS NULL OR valid_until > valid_from)
+);
+
+CREATE INDEX IF NOT EXISTS idx_coupons_store ON coupons (store_id);
+
+-- Cada utilização fica registada com a repartição do desconto pelas linhas. Um cupão
+-- já utilizado não pode ser apagado, só desativado.
+CREATE TABLE IF NOT EXISTS coupon_redemptions (
+    id             BIGSERIAL PRIMARY KEY,
+    coupon_id      BIGINT NOT NULL REFERENCES coupons(id) ON DELETE RESTRICT,
+    user_id        BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reference      VARCHAR(100),
+    subtotal_cents INT NOT NULL,
+    discount_cents INT NOT NULL,
+    lines          JSONB NOT NULL DEFAULT '[]',
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_coupon_redemptions_coupon_user ON coupon_redemptions (coupon_id, user_id);
@@ -0,0 +1,16 @@
+-- As utilizações guardam o código e a loja do cupão e ficam no histórico quando o
+-- cupão é apagado com a sua loja (na purga das lojas e das contas apagadas). Com
+-- ON DELETE RESTRICT uma só loja purgada com um cupão usado fazia falhar a purga toda.
+ALTER TABLE coupon_redemptions
+    ADD COLUMN IF NOT EXISTS coupon_code VARCHAR(50),
+    ADD COLUMN IF NOT EXISTS store_id BIGINT;
+
+UPDATE coupon_redemptions SET coupon_code = c.code, store_id = c.store_id
+FROM coupons c WHERE c.id = coupon_redemptions.coupon_id;
+
+ALTER TABLE coupon_redemptions
+    ALTER COLUMN coupon_code SET NOT NULL,
+    ALTER COLUMN coupon_id DROP NOT NULL,
+    DROP CONSTRAINT IF EXISTS coupon_redemptions_coupon_id_fkey,
+    ADD CONSTRAINT coupon_redemptions_coupon_id_fkey
+        FOREIGN KEY (coupon_id) REFERENCES coupons(id) ON DELETE SET NULL;
@@ -0,0 +1,26 @@
+-- O SKU passa a ser único entre os produtos não apagados de cada loja, para a
+-- importação poder usar INSERT ... ON CONFLICT em vez de procurar e depois criar.
+-- Os duplicados que já existam ficam com o SKU do mais antigo; os outros recebem
+-- um sufixo com o seu ID e cada mudança fica no registo de auditoria
+-- (product.rename_duplicate_sku), para o lojista os poder encontrar e corrigir.
+WITH duplicates AS (
+    SELECT p.id, p.sku FROM products p
+    WHERE p.deleted_at IS NULL AND p.sku IS NOT NULL AND EXISTS (
+        SELECT 1 FROM products o
+        WHERE o.store_id = p.store_id AND o.sku = p.sku AND o.deleted_at IS NULL AND o.id < p.id
+    )
+), renamed AS (
+    UPDATE products p SET sku = LEFT(d.sku, 80) || '-dup-' || p.id, updated_at = NOW(), version = version + 1
+    FROM duplicates d
+    WHERE p.id = d.id
+    RETURNING p.id, d.sku AS old_sku, p.sku AS new_sku
+)
+INSERT INTO audit_events (actor_role, action, entity_type, entity_id, changes)
+SELECT 'system', 'product.rename_duplicate_sku', 'product', id,
+    jsonb_build_object('sku', jsonb_build_object('before', old_sku, 'after', new_sku))
+FROM renamed;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_products_store_sku_unique
+    ON products (store_id, sku) WHERE deleted_at IS NULL;
+
+DROP INDEX IF EXISTS idx_products_store_sku;
@@ -0,0 +1,4 @@
+-- Cada reserva de uma chave tem um token próprio. Um pedido cujo locked_until passou
+-- pode perder a chave para uma repetição; com o token o Complete e o Release do
+-- pedido antigo já não mexem no registo de quem ficou com ela.
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS lock_token VARCHAR(64) NOT NULL DEFAULT '';
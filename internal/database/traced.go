@@ -0,0 +1,265 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"modress/internal/tracing"
+
+	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "modress/internal/database"
+
+// maxStatementLength limita o texto SQL guardado em cada span
+const maxStatementLength = 2000
+
+// DB envolve o *sqlx.DB e cria um span por instrução SQL, com o texto da query
+// sanitizado e o número de linhas devolvidas ou afetadas. As transações abertas com
+// BeginTxx são instrumentadas da mesma forma (Tx). Os restantes métodos do sqlx
+// continuam disponíveis através do campo embutido, mas não são instrumentados.
+type DB struct {
+	*sqlx.DB
+}
+
+// Wrap devolve a versão instrumentada de db
+func Wrap(db *sqlx.DB) *DB {
+	return &DB{DB: db}
+}
+
+// BeginTxx abre uma transação cujas instruções têm o seu próprio span, como as do DB
+func (db *DB) BeginTxx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	tx, err := db.DB.BeginTxx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx}, nil
+}
+
+func (db *DB) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return getContext(ctx, db.DB, dest, query, args...)
+}
+
+func (db *DB) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return selectContext(ctx, db.DB, dest, query, args...)
+}
+
+func (db *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return execContext(ctx, db.DB, query, args...)
+}
+
+func (db *DB) NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error) {
+	ctx, span := startSpan(ctx, query)
+	defer span.End()
+
+	result, err := db.DB.NamedExecContext(ctx, query, arg)
+	endQuery(span, err, rowsAffected(result, err))
+	return result, err
+}
+
+// NamedGetContext executa uma query com parâmetros nomeados (:campo) e lê uma linha
+// para dest, tipicamente um INSERT ... RETURNING id
+func (db *DB) NamedGetContext(ctx context.Context, dest interface{}, query string, arg interface{}) error {
+	ctx, span := startSpan(ctx, query)
+	defer span.End()
+
+	stmt, err := db.DB.PrepareNamedContext(ctx, query)
+	if err != nil {
+		endQuery(span, err, -1)
+		return err
+	}
+	defer stmt.Close()
+
+	err = stmt.GetContext(ctx, dest, arg)
+	endQuery(span, err, singleRow(err))
+	return err
+}
+
+// QueryxContext só cobre a execução da query; a iteração das linhas fica fora do span
+func (db *DB) QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	return queryxContext(ctx, db.DB, query, args...)
+}
+
+// Tx envolve o *sqlx.Tx devolvido por DB.BeginTxx com os mesmos spans por instrução.
+// Commit e Rollback vêm do campo embutido e não têm span.
+type Tx struct {
+	*sqlx.Tx
+}
+
+func (tx *Tx) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return getContext(ctx, tx.Tx, dest, query, args...)
+}
+
+func (tx *Tx) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return selectContext(ctx, tx.Tx, dest, query, args...)
+}
+
+func (tx *Tx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return execContext(ctx, tx.Tx, query, args...)
+}
+
+func (tx *Tx) QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	return queryxContext(ctx, tx.Tx, query, args...)
+}
+
+// QueryRowxContext regista só os erros da execução; os do Scan (incluindo
+// sql.ErrNoRows) chegam depois de o span terminar
+func (tx *Tx) QueryRowxContext(ctx context.Context, query string, args ...interface{}) *sqlx.Row {
+	ctx, span := startSpan(ctx, query)
+	defer span.End()
+
+	row := tx.Tx.QueryRowxContext(ctx, query, args...)
+	endQuery(span, row.Err(), -1)
+	return row
+}
+
+func getContext(ctx context.Context, q sqlx.QueryerContext, dest interface{}, query string, args ...interface{}) error {
+	ctx, span := startSpan(ctx, query)
+	defer span.End()
+
+	err := sqlx.GetContext(ctx, q, dest, query, args...)
+	endQuery(span, err, singleRow(err))
+	return err
+}
+
+func selectContext(ctx context.Context, q sqlx.QueryerContext, dest interface{}, query string, args ...interface{}) error {
+	ctx, span := startSpan(ctx, query)
+	defer span.End()
+
+	err := sqlx.SelectContext(ctx, q, dest, query, args...)
+	endQuery(span, err, sliceLen(dest))
+	return err
+}
+
+func execContext(ctx context.Context, e sqlx.ExecerContext, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := startSpan(ctx, query)
+	defer span.End()
+
+	result, err := e.ExecContext(ctx, query, args...)
+	endQuery(span, err, rowsAffected(result, err))
+	return result, err
+}
+
+func queryxContext(ctx context.Context, q sqlx.QueryerContext, query string, args ...interface{}) (*sqlx.Rows, error) {
+	ctx, span := startSpan(ctx, query)
+	defer span.End()
+
+	rows, err := q.QueryxContext(ctx, query, args...)
+	endQuery(span, err, -1)
+	return rows, err
+}
+
+func startSpan(ctx context.Context, query string) (context.Context, trace.Span) {
+	// Queries fora de um pedido ou job (polling da fila, health checks) não abrem
+	// traces próprios: seriam milhares de traces com um único span
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx, trace.SpanFromContext(ctx)
+	}
+
+	statement := SanitizeQuery(query)
+	operation := operationName(statement)
+	return tracing.Start(ctx, tracerName, operation,
+		attribute.String("db.system", "postgresql"),
+		attribute.String("db.operation", operation),
+		attribute.String("db.statement", statement),
+	)
+}
+
+// endQuery regista o número de linhas (quando conhecido) e o erro. sql.ErrNoRows
+// não é uma falha: o repositório converte-o em "não encontrado".
+func endQuery(span trace.Span, err error, rows int64) {
+	if rows >= 0 {
+		span.SetAttributes(attribute.Int64("db.rows", rows))
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		tracing.RecordError(span, err)
+	}
+}
+
+func singleRow(err error) int64 {
+	if err != nil {
+		return 0
+	}
+	return 1
+}
+
+func sliceLen(dest interface{}) int64 {
+	v := reflect.ValueOf(dest)
+	for v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Slice {
+		return -1
+	}
+	return int64(v.Len())
+}
+
+func rowsAffected(result sql.Result, err error) int64 {
+	if err != nil || result == nil {
+		return -1
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+var (
+	whitespace     = regexp.MustCompile(`\s+`)
+	stringLiteral  = regexp.MustCompile(`'(?:[^']|'')*'`)
+	numericLiteral = regexp.MustCompile(`([^\w$.:])\d+(?:\.\d+)?\b`)
+)
+
+// SanitizeQuery normaliza o espaçamento e substitui literais por "?", para que os
+// spans não transportem dados escritos diretamente no SQL. Os parâmetros ($1, :nome)
+// nunca são registados.
+func SanitizeQuery(query string) string {
+	q := whitespace.ReplaceAllString(strings.TrimSpace(query), " ")
+	q = stringLiteral.ReplaceAllString(q, "?")
+	q = numericLiteral.ReplaceAllString(q, "${1}?")
+	if len(q) > maxStatementLength {
+		q = q[:maxStatementLength] + "..."
+	}
+	return q
+}
+
+// operationName devolve "SELECT products", "UPDATE stores", etc. para nomear o span
+func operationName(statement string) string {
+	fields := strings.Fields(statement)
+	if len(fields) == 0 {
+		return "SQL"
+	}
+	verb := strings.ToUpper(fields[0])
+
+	var keyword string
+	switch verb {
+	case "SELECT", "DELETE":
+		keyword = "FROM"
+	case "INSERT":
+		keyword = "INTO"
+	case "UPDATE":
+		return verb + " " + tableAt(fields, 1)
+	default:
+		return verb
+	}
+	for i, f := range fields {
+		if strings.EqualFold(f, keyword) {
+			return verb + " " + tableAt(fields, i+1)
+		}
+	}
+	return verb
+}
+
+func tableAt(fields []string, i int) string {
+	if i >= len(fields) {
+		return ""
+	}
+	return strings.Trim(fields[i], "(),;")
+}
@@ -0,0 +1,67 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"modress/internal/database"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// DatabaseCheck faz ping à base de dados e reporta o estado do pool
+func DatabaseCheck(db *sqlx.DB) Check {
+	return func(ctx context.Context) (map[string]interface{}, error) {
+		if err := db.PingContext(ctx); err != nil {
+			return nil, fmt.Errorf("ping failed: %w", err)
+		}
+
+		stats := db.Stats()
+		return map[string]interface{}{
+			"open_connections": stats.OpenConnections,
+			"in_use":           stats.InUse,
+			"idle":             stats.Idle,
+		}, nil
+	}
+}
+
+// MigrationsCheck falha se a base de dados estiver atrás da versão embutida no binário
+func MigrationsCheck(db *sqlx.DB) Check {
+	return func(ctx context.Context) (map[string]interface{}, error) {
+		expected, err := database.ExpectedVersion()
+		if err != nil {
+			return nil, err
+		}
+		current, err := database.CurrentVersion(ctx, db)
+		if err != nil {
+			return nil, err
+		}
+
+		details := map[string]interface{}{
+			"current":  current,
+			"expected": expected,
+		}
+		if current < expected {
+			return details, fmt.Errorf("schema is at version %d, expected %d", current, expected)
+		}
+		return details, nil
+	}
+}
+
+// WritableDirCheck confirma que é possível criar ficheiros na diretoria de uploads
+func WritableDirCheck(dir string) Check {
+	return func(ctx context.Context) (map[string]interface{}, error) {
+		details := map[string]interface{}{"dir": dir}
+
+		f, err := os.CreateTemp(dir, ".readyz-*")
+		if err != nil {
+			return details, fmt.Errorf("directory is not writable: %w", err)
+		}
+		name := f.Name()
+		f.Close()
+		os.Remove(name)
+
+		return details, nil
+	}
+}
@@ -0,0 +1,113 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+// Check verifica uma dependência. Pode devolver detalhes para incluir no relatório.
+type Check func(ctx context.Context) (map[string]interface{}, error)
+
+// CheckResult é o resultado de uma verificação individual
+type CheckResult struct {
+	Status    string                 `json:"status"`
+	Error     string                 `json:"error,omitempty"`
+	LatencyMS int64                  `json:"latency_ms"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+// Report é a resposta do endpoint de readiness
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker corre as verificações de readiness em paralelo, cada uma com o seu timeout
+type Checker struct {
+	timeout      time.Duration
+	checks       []namedCheck
+	shuttingDown atomic.Bool
+}
+
+func NewChecker(timeout time.Duration) *Checker {
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	return &Checker{timeout: timeout}
+}
+
+// Add regista uma verificação. Deve ser chamado antes de o servidor arrancar.
+func (c *Checker) Add(name string, check Check) {
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+}
+
+// SetShuttingDown faz a readiness falhar a partir de agora, para que o load balancer
+// deixe de enviar tráfego enquanto os pedidos em curso drenam
+func (c *Checker) SetShuttingDown() {
+	c.shuttingDown.Store(true)
+}
+
+// Ready corre todas as verificações e devolve o relatório
+func (c *Checker) Ready(ctx context.Context) Report {
+	report := Report{
+		Status: StatusOK,
+		Checks: make(map[string]CheckResult, len(c.checks)+1),
+	}
+
+	if c.shuttingDown.Load() {
+		report.Status = StatusUnavailable
+		report.Checks["shutdown"] = CheckResult{Status: StatusUnavailable, Error: "server is shutting down"}
+	}
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, nc := range c.checks {
+		wg.Add(1)
+		go func(nc namedCheck) {
+			defer wg.Done()
+			result := c.run(ctx, nc.check)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[nc.name] = result
+			if result.Status != StatusOK {
+				report.Status = StatusUnavailable
+			}
+		}(nc)
+	}
+	wg.Wait()
+
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, check Check) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	details, err := check(ctx)
+	result := CheckResult{
+		Status:    StatusOK,
+		LatencyMS: time.Since(start).Milliseconds(),
+		Details:   details,
+	}
+	if err != nil {
+		result.Status = StatusUnavailable
+		result.Error = err.Error()
+	}
+	return result
+}
@@ -0,0 +1,54 @@
+// Package hub liga os hubs WebSocket das várias instâncias da API. Cada instância só
+// conhece as suas ligações; um Backend leva os eventos a todas as instâncias e conta
+// as ligações de cada utilizador no cluster, para que a presença mude só na primeira
+// ligação e na última.
+package hub
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// Event é um frame do protocolo para as ligações de um utilizador ou, com UserIDs,
+// para as de vários
+type Event struct {
+	UserID  int64   `json:"user_id,omitempty"`
+	UserIDs []int64 `json:"user_ids,omitempty"`
+
+	// MessageID é a mensagem de chat que o frame entrega: a instância que a entregar
+	// a uma ligação marca-a como entregue
+	MessageID int64 `json:"message_id,omitempty"`
+
+	// Frame é o frame wsproto já codificado
+	Frame json.RawMessage `json:"frame"`
+}
+
+// Handler entrega um evento às ligações desta instância
+type Handler func(ctx context.Context, event Event)
+
+// OfflineHandler é chamado para cada utilizador que ficou sem ligações porque a
+// instância onde estavam morreu ou foi desligada, sem passar por Disconnect
+type OfflineHandler func(ctx context.Context, userID int64)
+
+// Backend distribui os eventos e guarda a presença. A memória serve para uma
+// instância; com várias atrás de um balanceador é preciso o Postgres.
+type Backend interface {
+	// Subscribe define quem recebe os eventos e as saídas; chamado uma vez, antes de Start
+	Subscribe(handler Handler, offline OfflineHandler)
+	// Start liga o backend; a partir daí os eventos de outras instâncias chegam ao handler
+	Start(ctx context.Context) error
+	// Publish entrega o evento ao handler desta instância e ao das outras
+	Publish(ctx context.Context, event Event) error
+
+	// Connect regista uma ligação do utilizador e devolve se é a primeira no cluster
+	Connect(ctx context.Context, userID int64) (first bool, err error)
+	// Disconnect retira uma ligação do utilizador e devolve se era a última no cluster
+	Disconnect(ctx context.Context, userID int64) (last bool, err error)
+	// Online devolve os utilizadores, de entre userIDs, com alguma ligação no cluster
+	Online(ctx context.Context, userIDs []int64) ([]int64, error)
+
+	// Ping verifica o backend, para o health check
+	Ping(ctx context.Context) error
+	// Close retira as ligações desta instância da presença e desliga o backend
+	Close(ctx context.Context) error
+}
@@ -0,0 +1,80 @@
+package hub
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryBackend entrega os eventos só a esta instância. A presença é a das ligações
+// locais.
+type MemoryBackend struct {
+	handler Handler
+
+	mu          sync.Mutex
+	connections map[int64]int
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{connections: make(map[int64]int)}
+}
+
+// Subscribe guarda só o handler: numa instância todas as ligações saem por Disconnect
+func (b *MemoryBackend) Subscribe(handler Handler, offline OfflineHandler) {
+	b.handler = handler
+}
+
+func (b *MemoryBackend) Start(ctx context.Context) error {
+	return nil
+}
+
+func (b *MemoryBackend) Publish(ctx context.Context, event Event) error {
+	if b.handler != nil {
+		b.handler(ctx, event)
+	}
+	return nil
+}
+
+func (b *MemoryBackend) Connect(ctx context.Context, userID int64) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.connections[userID]++
+	return b.connections[userID] == 1, nil
+}
+
+func (b *MemoryBackend) Disconnect(ctx context.Context, userID int64) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n, ok := b.connections[userID]
+	if !ok {
+		return false, nil
+	}
+	if n <= 1 {
+		delete(b.connections, userID)
+		return true, nil
+	}
+	b.connections[userID] = n - 1
+	return false, nil
+}
+
+func (b *MemoryBackend) Online(ctx context.Context, userIDs []int64) ([]int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	online := []int64{}
+	for _, id := range userIDs {
+		if b.connections[id] > 0 {
+			online = append(online, id)
+		}
+	}
+	return online, nil
+}
+
+func (b *MemoryBackend) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (b *MemoryBackend) Close(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,403 @@
+package hub
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"modress/internal/database"
+	"modress/internal/logging"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// channel é o canal do LISTEN/NOTIFY partilhado por todas as instâncias
+	channel = "modress_ws"
+
+	// maxNotifyPayload fica abaixo do limite de 8000 bytes do NOTIFY; eventos maiores
+	// vão para a tabela ws_events
+	maxNotifyPayload = 7900
+
+	// eventRetention é quanto tempo um evento em ws_events fica disponível para as
+	// outras instâncias o lerem
+	eventRetention = time.Minute
+)
+
+// PostgresOptions configura o PostgresBackend
+type PostgresOptions struct {
+	// DSN é usado pelo listener, que precisa de uma ligação própria fora do pool
+	DSN string
+	// HeartbeatInterval é a frequência com que a instância se dá como viva
+	HeartbeatInterval time.Duration
+	// InstanceTimeout define ao fim de quanto tempo sem heartbeat uma instância é dada
+	// como morta e as suas ligações deixam de contar
+	InstanceTimeout time.Duration
+}
+
+// notification é o payload do NOTIFY: o evento, ou o ID em ws_events quando não cabe
+type notification struct {
+	Origin string `json:"origin"`
+	Event  *Event `json:"event,omitempty"`
+	Ref    int64  `json:"ref,omitempty"`
+}
+
+// PostgresBackend distribui os eventos com LISTEN/NOTIFY e guarda a presença nas
+// tabelas ws_instances e ws_presence, partilhadas por todas as instâncias. Cada
+// instância entrega os seus eventos diretamente e ignora os que recebe de si própria.
+type PostgresBackend struct {
+	db         *database.DB
+	opts       PostgresOptions
+	instanceID string
+
+	handler Handler
+	offline OfflineHandler
+
+	listener  *pq.Listener
+	stop      chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+}
+
+func NewPostgresBackend(db *database.DB, opts PostgresOptions) *PostgresBackend {
+	if opts.HeartbeatInterval <= 0 {
+		opts.HeartbeatInterval = 10 * time.Second
+	}
+	if opts.InstanceTimeout <= 0 {
+		opts.InstanceTimeout = 3 * opts.HeartbeatInterval
+	}
+
+	return &PostgresBackend{
+		db:         db,
+		opts:       opts,
+		instanceID: newInstanceID(),
+		stop:       make(chan struct{}),
+	}
+}
+
+// maxHostnameInID deixa espaço no ID, que cabe em VARCHAR(64), para o PID (até 7
+// dígitos no Linux), o sufixo e os separadores
+const maxHostnameInID = 40
+
+// newInstanceID devolve "<hostname>-<pid>-<sufixo>". O sufixo aleatório distingue a
+// instância de uma anterior com o mesmo host e PID (ex.: um container reiniciado),
+// cujas ligações já não existem. Um hostname longo é cortado: continua a servir para
+// identificar o host nos logs, e o sufixo mantém o ID único.
+func newInstanceID() string {
+	hostname, _ := os.Hostname()
+	if len(hostname) > maxHostnameInID {
+		hostname = hostname[:maxHostnameInID]
+	}
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), hex.EncodeToString(suffix))
+}
+
+func (b *PostgresBackend) Subscribe(handler Handler, offline OfflineHandler) {
+	b.handler = handler
+	b.offline = offline
+}
+
+func (b *PostgresBackend) Start(ctx context.Context) error {
+	if err := b.heartbeat(ctx); err != nil {
+		return err
+	}
+
+	b.listener = pq.NewListener(b.opts.DSN, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		switch event {
+		case pq.ListenerEventDisconnected, pq.ListenerEventConnectionAttemptFailed:
+			slog.Warn("websocket hub listener disconnected", logging.Err(err))
+		case pq.ListenerEventReconnected:
+			slog.Info("websocket hub listener reconnected")
+		}
+	})
+	if err := b.listener.Listen(channel); err != nil {
+		b.listener.Close()
+		return fmt.Errorf("error listening on %s: %w", channel, err)
+	}
+
+	b.wg.Add(2)
+	go b.listen()
+	go b.maintain()
+
+	slog.Info("websocket hub backend started", "backend", "postgres", "instance", b.instanceID)
+	return nil
+}
+
+func (b *PostgresBackend) Publish(ctx context.Context, event Event) error {
+	if b.handler != nil {
+		b.handler(ctx, event)
+	}
+
+	payload, err := json.Marshal(notification{Origin: b.instanceID, Event: &event})
+	if err != nil {
+		return fmt.Errorf("error encoding hub event: %w", err)
+	}
+	if len(payload) > maxNotifyPayload {
+		eventData, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("error encoding hub event: %w", err)
+		}
+		var ref int64
+		if err := b.db.GetContext(ctx, &ref, `INSERT INTO ws_events (payload) VALUES ($1) RETURNING id`, string(eventData)); err != nil {
+			return fmt.Errorf("error storing hub event: %w", err)
+		}
+		if payload, err = json.Marshal(notification{Origin: b.instanceID, Ref: ref}); err != nil {
+			return fmt.Errorf("error encoding hub event: %w", err)
+		}
+	}
+
+	if _, err := b.db.ExecContext(ctx, `SELECT pg_notify($1, $2)`, channel, string(payload)); err != nil {
+		return fmt.Errorf("error publishing hub event: %w", err)
+	}
+	return nil
+}
+
+func (b *PostgresBackend) Connect(ctx context.Context, userID int64) (bool, error) {
+	total, _, err := b.changeConnections(ctx, userID, `
+	INSERT INTO ws_presence (instance_id, user_id, connections) VALUES ($1, $2, 1)
+	ON CONFLICT (instance_id, user_id) DO UPDATE SET connections = ws_presence.connections + 1`)
+	if err != nil {
+		return false, err
+	}
+	return total <= 1, nil
+}
+
+func (b *PostgresBackend) Disconnect(ctx context.Context, userID int64) (bool, error) {
+	// Sem linha a ligação já foi retirada com a instância e a saída já foi anunciada
+	total, changed, err := b.changeConnections(ctx, userID, `
+	UPDATE ws_presence SET connections = connections - 1 WHERE instance_id = $1 AND user_id = $2`)
+	if err != nil {
+		return false, err
+	}
+	return changed && total == 0, nil
+}
+
+// changeConnections aplica a alteração às ligações do utilizador nesta instância e
+// devolve o total no cluster. O advisory lock serializa as alterações do mesmo
+// utilizador entre instâncias: sem ele, uma ligação numa instância e um fecho noutra
+// podiam ver ambos a contagem antiga e a presença ficava errada.
+func (b *PostgresBackend) changeConnections(ctx context.Context, userID int64, query string) (int64, bool, error) {
+	tx, err := b.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, false, fmt.Errorf("error starting presence transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtextextended('ws_presence:' || $1::text, 0))`, userID); err != nil {
+		return 0, false, fmt.Errorf("error locking presence: %w", err)
+	}
+
+	result, err := tx.ExecContext(ctx, query, b.instanceID, userID)
+	if err != nil {
+		return 0, false, fmt.Errorf("error updating presence: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, false, fmt.Errorf("error updating presence: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM ws_presence WHERE instance_id = $1 AND user_id = $2 AND connections <= 0`, b.instanceID, userID); err != nil {
+		return 0, false, fmt.Errorf("error updating presence: %w", err)
+	}
+
+	var total int64
+	query = `
+	SELECT COALESCE(SUM(p.connections), 0)
+	FROM ws_presence p
+	JOIN ws_instances i ON i.id = p.instance_id
+	WHERE p.user_id = $1 AND i.heartbeat_at > NOW() - $2::float8 * INTERVAL '1 second'`
+	if err := tx.GetContext(ctx, &total, query, userID, b.opts.InstanceTimeout.Seconds()); err != nil {
+		return 0, false, fmt.Errorf("error counting connections: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, false, fmt.Errorf("error committing presence: %w", err)
+	}
+	return total, rows > 0, nil
+}
+
+func (b *PostgresBackend) Online(ctx context.Context, userIDs []int64) ([]int64, error) {
+	online := []int64{}
+	if len(userIDs) == 0 {
+		return online, nil
+	}
+
+	query := `
+	SELECT p.user_id
+	FROM ws_presence p
+	JOIN ws_instances i ON i.id = p.instance_id
+	WHERE p.user_id = ANY($1) AND i.heartbeat_at > NOW() - $2::float8 * INTERVAL '1 second'
+	GROUP BY p.user_id
+	HAVING SUM(p.connections) > 0
+	ORDER BY p.user_id`
+	if err := b.db.SelectContext(ctx, &online, query, pq.Array(userIDs), b.opts.InstanceTimeout.Seconds()); err != nil {
+		return nil, fmt.Errorf("error listing online users: %w", err)
+	}
+	return online, nil
+}
+
+func (b *PostgresBackend) Ping(ctx context.Context) error {
+	if b.listener == nil {
+		return errors.New("websocket hub backend not started")
+	}
+	if err := b.listener.Ping(); err != nil {
+		return fmt.Errorf("websocket hub listener: %w", err)
+	}
+	return nil
+}
+
+// Close para o listener e retira as ligações desta instância; os utilizadores que
+// ficam sem ligações no cluster são anunciados como offline
+func (b *PostgresBackend) Close(ctx context.Context) error {
+	var err error
+	b.closeOnce.Do(func() {
+		close(b.stop)
+		if b.listener != nil {
+			b.listener.Close()
+		}
+		b.wg.Wait()
+
+		_, err = b.db.ExecContext(ctx, `DELETE FROM ws_instances WHERE id = $1`, b.instanceID)
+		if err != nil {
+			err = fmt.Errorf("error removing hub instance: %w", err)
+			return
+		}
+		err = b.removeConnections(ctx, `DELETE FROM ws_presence WHERE instance_id = $1 RETURNING user_id`, b.instanceID)
+	})
+	return err
+}
+
+// listen entrega ao handler os eventos publicados pelas outras instâncias
+func (b *PostgresBackend) listen() {
+	defer b.wg.Done()
+
+	for {
+		select {
+		case <-b.stop:
+			return
+		case n := <-b.listener.Notify:
+			if n == nil {
+				// O listener voltou a ligar-se: o que foi publicado entretanto perdeu-se
+				slog.Warn("websocket hub listener reconnected, events published meanwhile were lost")
+				continue
+			}
+			b.receive(n.Extra)
+		case <-time.After(90 * time.Second):
+			// Sem eventos há algum tempo: confirmar que a ligação continua viva
+			go b.listener.Ping()
+		}
+	}
+}
+
+func (b *PostgresBackend) receive(payload string) {
+	var n notification
+	if err := json.Unmarshal([]byte(payload), &n); err != nil {
+		slog.Warn("invalid websocket hub notification", logging.Err(err))
+		return
+	}
+	if n.Origin == b.instanceID || b.handler == nil {
+		return
+	}
+
+	ctx := context.Background()
+	event := n.Event
+	if n.Ref != 0 {
+		var data string
+		if err := b.db.GetContext(ctx, &data, `SELECT payload FROM ws_events WHERE id = $1`, n.Ref); err != nil {
+			slog.Warn("error loading websocket hub event", "ref", n.Ref, logging.Err(err))
+			return
+		}
+		event = &Event{}
+		if err := json.Unmarshal([]byte(data), event); err != nil {
+			slog.Warn("invalid websocket hub event", "ref", n.Ref, logging.Err(err))
+			return
+		}
+	}
+	if event != nil {
+		b.handler(ctx, *event)
+	}
+}
+
+// maintain renova o heartbeat, retira as ligações das instâncias mortas e apaga os
+// eventos antigos de ws_events
+func (b *PostgresBackend) maintain() {
+	defer b.wg.Done()
+
+	ticker := time.NewTicker(b.opts.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), b.opts.HeartbeatInterval)
+		if err := b.heartbeat(ctx); err != nil {
+			slog.Warn("websocket hub heartbeat failed", logging.Err(err))
+		}
+
+		// Só uma instância apaga cada instância morta, e é essa que anuncia as saídas
+		query := `
+		WITH dead AS (
+			DELETE FROM ws_instances WHERE heartbeat_at < NOW() - $1::float8 * INTERVAL '1 second' RETURNING id
+		)
+		DELETE FROM ws_presence p USING dead WHERE p.instance_id = dead.id RETURNING p.user_id`
+		if err := b.removeConnections(ctx, query, b.opts.InstanceTimeout.Seconds()); err != nil {
+			slog.Warn("error removing dead websocket hub instances", logging.Err(err))
+		}
+
+		query = `DELETE FROM ws_events WHERE created_at < NOW() - $1::float8 * INTERVAL '1 second'`
+		if _, err := b.db.ExecContext(ctx, query, eventRetention.Seconds()); err != nil {
+			slog.Warn("error sweeping websocket hub events", logging.Err(err))
+		}
+		cancel()
+	}
+}
+
+func (b *PostgresBackend) heartbeat(ctx context.Context) error {
+	query := `
+	INSERT INTO ws_instances (id, heartbeat_at) VALUES ($1, NOW())
+	ON CONFLICT (id) DO UPDATE SET heartbeat_at = NOW()`
+	if _, err := b.db.ExecContext(ctx, query, b.instanceID); err != nil {
+		return fmt.Errorf("error updating hub heartbeat: %w", err)
+	}
+	return nil
+}
+
+// removeConnections apaga ligações com query (que devolve os user_id apagados) e
+// chama o OfflineHandler para os utilizadores que ficaram sem ligações
+func (b *PostgresBackend) removeConnections(ctx context.Context, query string, args ...interface{}) error {
+	var userIDs []int64
+	if err := b.db.SelectContext(ctx, &userIDs, query, args...); err != nil {
+		return fmt.Errorf("error removing connections: %w", err)
+	}
+	if len(userIDs) == 0 || b.offline == nil {
+		return nil
+	}
+
+	stillOnline, err := b.Online(ctx, userIDs)
+	if err != nil {
+		return err
+	}
+	online := make(map[int64]bool, len(stillOnline))
+	for _, id := range stillOnline {
+		online[id] = true
+	}
+	seen := make(map[int64]bool, len(userIDs))
+	for _, id := range userIDs {
+		if !online[id] && !seen[id] {
+			seen[id] = true
+			b.offline(ctx, id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"modress/internal/logging"
+	"modress/internal/repositories"
+)
+
+type reporterKey struct{}
+
+// reporter guarda o progresso e o resultado do job em execução
+type reporter struct {
+	repo     repositories.JobRepository
+	jobID    int64
+	workerID string
+	// lastAttempt indica que uma falha não volta a ser tentada
+	lastAttempt bool
+
+	mu         sync.Mutex
+	result     []byte
+	lastReport time.Time
+}
+
+func withReporter(ctx context.Context, r *reporter) context.Context {
+	return context.WithValue(ctx, reporterKey{}, r)
+}
+
+func reporterFrom(ctx context.Context) *reporter {
+	r, _ := ctx.Value(reporterKey{}).(*reporter)
+	return r
+}
+
+// LastAttempt indica se o job atual está na última tentativa: se falhar, passa a dead
+func LastAttempt(ctx context.Context) bool {
+	r := reporterFrom(ctx)
+	return r != nil && r.lastAttempt
+}
+
+// ReportProgress regista o progresso do job atual. As escritas são limitadas a
+// uma por segundo, exceto quando o job chega ao fim.
+func ReportProgress(ctx context.Context, processed, total int) {
+	r := reporterFrom(ctx)
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	if processed < total && time.Since(r.lastReport) < time.Second {
+		r.mu.Unlock()
+		return
+	}
+	r.lastReport = time.Now()
+	r.mu.Unlock()
+
+	if err := r.repo.UpdateProgress(ctx, r.jobID, r.workerID, processed, total); err != nil {
+		logging.FromContext(ctx).Warn("error updating job progress", logging.Err(err))
+	}
+}
+
+// SetResult guarda um valor serializável em JSON como resultado do job atual
+func SetResult(ctx context.Context, v interface{}) error {
+	r := reporterFrom(ctx)
+	if r == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.result = data
+	r.mu.Unlock()
+	return nil
+}
+
+func resultFrom(ctx context.Context) []byte {
+	r := reporterFrom(ctx)
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.result
+}
@@ -0,0 +1,363 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"modress/internal/logging"
+	"modress/internal/models"
+	"modress/internal/repositories"
+	"modress/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const tracerName = "modress/internal/jobs"
+
+// Handler processa um job. Devolver erro faz com que o job seja repetido com backoff.
+type Handler func(ctx context.Context, job *models.Job) error
+
+// Handle adapta uma função tipada num Handler, descodificando o payload JSON para T
+func Handle[T any](fn func(ctx context.Context, payload T) error) Handler {
+	return func(ctx context.Context, job *models.Job) error {
+		var payload T
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return Permanent(fmt.Errorf("error decoding payload: %w", err))
+		}
+		return fn(ctx, payload)
+	}
+}
+
+// permanentError marca um erro que não deve ser repetido
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent envolve um erro para que o job vá diretamente para dead, sem novas tentativas
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// Options configura o Runner
+type Options struct {
+	Workers      int
+	PollInterval time.Duration
+	// LockTimeout define ao fim de quanto tempo um job em running é considerado abandonado
+	LockTimeout time.Duration
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+}
+
+// Runner é um pool de workers que consome a tabela jobs
+type Runner struct {
+	repo     repositories.JobRepository
+	opts     Options
+	workerID string
+
+	mu       sync.RWMutex
+	handlers map[string]Handler
+
+	wake    chan struct{}
+	stop    chan struct{}
+	jobCtx  context.Context
+	abort   context.CancelFunc
+	wg      sync.WaitGroup
+	started bool
+}
+
+func NewRunner(repo repositories.JobRepository, opts Options) *Runner {
+	if opts.Workers < 1 {
+		opts.Workers = 4
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = 2 * time.Second
+	}
+	if opts.LockTimeout <= 0 {
+		opts.LockTimeout = 15 * time.Minute
+	}
+	if opts.BaseBackoff <= 0 {
+		opts.BaseBackoff = 10 * time.Second
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = time.Hour
+	}
+
+	hostname, _ := os.Hostname()
+	jobCtx, abort := context.WithCancel(context.Background())
+
+	return &Runner{
+		repo:     repo,
+		opts:     opts,
+		workerID: fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		handlers: make(map[string]Handler),
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		jobCtx:   jobCtx,
+		abort:    abort,
+	}
+}
+
+// Register associa um handler a um tipo de job. Deve ser chamado antes de Start.
+func (r *Runner) Register(jobType string, handler Handler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[jobType] = handler
+}
+
+// Notify acorda um worker parado, útil logo após colocar um job na fila
+func (r *Runner) Notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start arranca os workers e o processo que recupera jobs abandonados
+func (r *Runner) Start() {
+	r.mu.Lock()
+	if r.started {
+		r.mu.Unlock()
+		return
+	}
+	r.started = true
+	r.mu.Unlock()
+
+	for i := 0; i < r.opts.Workers; i++ {
+		r.wg.Add(1)
+		go r.work(fmt.Sprintf("%s-w%d", r.workerID, i))
+	}
+
+	r.wg.Add(1)
+	go r.reapStale()
+
+	slog.Info("job runner started", "workers", r.opts.Workers)
+}
+
+// Shutdown deixa de aceitar jobs e espera pelos que estão a correr. Se ctx expirar
+// primeiro, o contexto dos jobs é cancelado e os workers terminam assim que possível.
+func (r *Runner) Shutdown(ctx context.Context) error {
+	r.mu.Lock()
+	if !r.started {
+		r.mu.Unlock()
+		return nil
+	}
+	r.started = false
+	close(r.stop)
+	r.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		r.abort()
+		return nil
+	case <-ctx.Done():
+		r.abort()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (r *Runner) types() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	types := make([]string, 0, len(r.handlers))
+	for t := range r.handlers {
+		types = append(types, t)
+	}
+	return types
+}
+
+func (r *Runner) handler(jobType string) Handler {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.handlers[jobType]
+}
+
+func (r *Runner) work(workerID string) {
+	defer r.wg.Done()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		default:
+		}
+
+		job, err := r.repo.ClaimNext(r.jobCtx, workerID, r.types())
+		if err != nil {
+			slog.Error("error claiming job", "worker", workerID, logging.Err(err))
+		}
+		if job != nil {
+			r.execute(workerID, job)
+			continue
+		}
+
+		select {
+		case <-r.stop:
+			return
+		case <-r.wake:
+		case <-time.After(r.opts.PollInterval):
+		}
+	}
+}
+
+func (r *Runner) execute(workerID string, job *models.Job) {
+	handler := r.handler(job.Type)
+	// Os handlers e os serviços que chamam registam com o id e o tipo do job
+	ctx, span := tracing.Start(r.jobCtx, tracerName, "job "+job.Type,
+		attribute.Int64("job.id", job.ID),
+		attribute.String("job.type", job.Type),
+		attribute.Int("job.attempt", job.Attempts),
+	)
+	defer span.End()
+
+	logger := slog.Default().With("job_id", job.ID, "job_type", job.Type, "attempt", job.Attempts, "worker", workerID)
+	if traceID := tracing.TraceID(ctx); traceID != "" {
+		logger = logger.With("trace_id", traceID)
+	}
+	ctx = logging.NewContext(ctx, logger)
+	ctx = withReporter(ctx, &reporter{repo: r.repo, jobID: job.ID, workerID: workerID, lastAttempt: job.Attempts >= job.MaxAttempts})
+	start := time.Now()
+
+	stopHeartbeat := make(chan struct{})
+	go r.heartbeat(workerID, job.ID, logger, stopHeartbeat)
+
+	var err error
+	if handler == nil {
+		err = Permanent(fmt.Errorf("no handler registered for job type %q", job.Type))
+	} else {
+		err = safeRun(ctx, handler, job)
+	}
+	close(stopHeartbeat)
+
+	// Usar um contexto próprio para registar o resultado mesmo durante o shutdown
+	saveCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err == nil {
+		logger.Info("job succeeded", "duration_ms", time.Since(start).Milliseconds())
+		if saveErr := r.repo.MarkSucceeded(saveCtx, job.ID, workerID, resultFrom(ctx)); saveErr == sql.ErrNoRows {
+			logger.Warn("job lock lost before marking it succeeded")
+		} else if saveErr != nil {
+			logger.Error("error marking job succeeded", logging.Err(saveErr))
+		}
+		return
+	}
+
+	tracing.RecordError(span, err)
+	if r.jobCtx.Err() != nil {
+		// Interrompido pelo shutdown: devolver à fila sem penalizar o job
+		logger.Warn("job interrupted by shutdown, requeued", logging.Err(err))
+		if saveErr := r.repo.Requeue(saveCtx, job.ID, workerID, err.Error()); saveErr == sql.ErrNoRows {
+			logger.Warn("job lock lost before requeuing it")
+		} else if saveErr != nil {
+			logger.Error("error requeuing job", logging.Err(saveErr))
+		}
+		return
+	}
+
+	var (
+		retryAt   *time.Time
+		permanent *permanentError
+	)
+	if !errors.As(err, &permanent) && job.Attempts < job.MaxAttempts {
+		next := time.Now().Add(r.backoff(job.Attempts))
+		retryAt = &next
+	}
+
+	if retryAt == nil {
+		logger.Error("job failed permanently", logging.Err(err))
+	} else {
+		logger.Warn("job failed, will retry", "retry_at", retryAt.Format(time.RFC3339), logging.Err(err))
+	}
+
+	if saveErr := r.repo.MarkFailed(saveCtx, job.ID, workerID, err.Error(), retryAt); saveErr == sql.ErrNoRows {
+		logger.Warn("job lock lost before marking it failed")
+	} else if saveErr != nil {
+		logger.Error("error marking job failed", logging.Err(saveErr))
+	}
+}
+
+// heartbeat renova a reserva do job enquanto ele corre, para que jobs longos que não
+// reportam progresso não sejam devolvidos à fila pelo reapStale de outra instância
+func (r *Runner) heartbeat(workerID string, jobID int64, logger *slog.Logger, stop <-chan struct{}) {
+	ticker := time.NewTicker(r.opts.LockTimeout / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			err := r.repo.Heartbeat(ctx, jobID, workerID)
+			cancel()
+			if err == sql.ErrNoRows {
+				logger.Warn("job lock lost while running")
+				return
+			}
+			if err != nil {
+				logger.Warn("error renewing job lock", logging.Err(err))
+			}
+		}
+	}
+}
+
+// backoff calcula o atraso exponencial com jitter para a tentativa indicada
+func (r *Runner) backoff(attempt int) time.Duration {
+	delay := r.opts.BaseBackoff
+	for i := 1; i < attempt && delay < r.opts.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > r.opts.MaxBackoff {
+		delay = r.opts.MaxBackoff
+	}
+	jitter := time.Duration(rand.Int63n(int64(delay)/5 + 1))
+	return delay + jitter
+}
+
+func (r *Runner) reapStale() {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(r.opts.LockTimeout / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			released, err := r.repo.ReleaseStale(r.jobCtx, time.Now().Add(-r.opts.LockTimeout))
+			if err != nil {
+				slog.Error("error releasing stale jobs", logging.Err(err))
+			} else if released > 0 {
+				slog.Warn("released stale jobs", "count", released)
+			}
+		}
+	}
+}
+
+func safeRun(ctx context.Context, handler Handler, job *models.Job) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("panic: %v", rec)
+		}
+	}()
+	return handler(ctx, job)
+}
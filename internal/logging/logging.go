@@ -0,0 +1,151 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Options controla o formato e o nível dos logs
+type Options struct {
+	Level  string // debug, info, warn, error
+	Format string // json ou text
+	Output io.Writer
+}
+
+// New cria o logger da aplicação. Atributos com nomes sensíveis são sempre redigidos.
+func New(opts Options) (*slog.Logger, error) {
+	level, err := ParseLevel(opts.Level)
+	if err != nil {
+		return nil, err
+	}
+	out := opts.Output
+	if out == nil {
+		out = os.Stdout
+	}
+
+	handlerOpts := &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redact,
+	}
+
+	var handler slog.Handler
+	switch strings.ToLower(opts.Format) {
+	case "", "json":
+		handler = slog.NewJSONHandler(out, handlerOpts)
+	case "text":
+		handler = slog.NewTextHandler(out, handlerOpts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", opts.Format)
+	}
+	return slog.New(handler), nil
+}
+
+// ParseLevel converte "debug", "info", "warn" ou "error" num slog.Level
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if s == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q", s)
+	}
+	return level, nil
+}
+
+const redacted = "[REDACTED]"
+
+// sensitiveKeys são nomes de atributos cujo valor nunca deve chegar aos logs
+var sensitiveKeys = map[string]bool{
+	"password":      true,
+	"password_hash": true,
+	"passwordhash":  true,
+	"token":         true,
+	"access_token":  true,
+	"refresh_token": true,
+	"secret":        true,
+	"jwt_secret":    true,
+	"authorization": true,
+	"cookie":        true,
+	"set-cookie":    true,
+	"api_key":       true,
+	"db_url":        true,
+	"dsn":           true,
+}
+
+func redact(groups []string, a slog.Attr) slog.Attr {
+	if sensitiveKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, redacted)
+	}
+	return a
+}
+
+type loggerKey struct{}
+type requestIDKey struct{}
+
+// NewContext devolve uma cópia de ctx que transporta o logger
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext devolve o logger do pedido, ou o logger por omissão se não houver nenhum
+func FromContext(ctx context.Context) *slog.Logger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+			return logger
+		}
+	}
+	return slog.Default()
+}
+
+// With acrescenta atributos ao logger transportado em ctx
+func With(ctx context.Context, args ...any) context.Context {
+	return NewContext(ctx, FromContext(ctx).With(args...))
+}
+
+// WithRequestID guarda o request ID em ctx e acrescenta-o ao logger
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	ctx = context.WithValue(ctx, requestIDKey{}, requestID)
+	return With(ctx, "request_id", requestID)
+}
+
+// RequestID devolve o request ID guardado em ctx, ou "" se não houver
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Err formata um erro com a sua cadeia de tipos, para distinguir por exemplo um
+// *pq.Error de um erro de validação com a mesma mensagem
+func Err(err error) slog.Attr {
+	if err == nil {
+		return slog.Attr{}
+	}
+	return slog.Group("error",
+		slog.String("message", err.Error()),
+		slog.Any("chain", errorChain(err)),
+	)
+}
+
+func errorChain(err error) []string {
+	var chain []string
+	for err != nil {
+		chain = append(chain, fmt.Sprintf("%T", err))
+		switch e := err.(type) {
+		case interface{ Unwrap() []error }:
+			// errors.Join e fmt.Errorf com vários %w: seguir apenas o primeiro ramo
+			errs := e.Unwrap()
+			if len(errs) == 0 {
+				return chain
+			}
+			err = errs[0]
+		default:
+			err = errors.Unwrap(err)
+		}
+	}
+	return chain
+}
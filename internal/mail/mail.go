@@ -0,0 +1,121 @@
+// Package mail envia emails. Em desenvolvimento o LogSender só regista a mensagem;
+// em produção o SMTPSender entrega-a a um servidor SMTP.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"modress/internal/logging"
+)
+
+// Message é um email de texto simples
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender entrega uma mensagem
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// LogSender regista as mensagens em vez de as enviar
+type LogSender struct{}
+
+func (LogSender) Send(ctx context.Context, msg Message) error {
+	logging.FromContext(ctx).Info("email not sent (MAIL_DRIVER=log)",
+		"to", msg.To,
+		"subject", msg.Subject,
+		"body_length", len(msg.Body),
+	)
+	return nil
+}
+
+// SMTPOptions configura o SMTPSender. Com Username a autenticação é PLAIN, que o
+// net/smtp só aceita sobre TLS ou para localhost.
+type SMTPOptions struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// SMTPSender entrega as mensagens a um servidor SMTP, com STARTTLS quando o servidor
+// o anuncia
+type SMTPSender struct {
+	opts SMTPOptions
+}
+
+func NewSMTPSender(opts SMTPOptions) *SMTPSender {
+	return &SMTPSender{opts: opts}
+}
+
+func (s *SMTPSender) Send(ctx context.Context, msg Message) error {
+	data, err := s.build(msg)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if s.opts.Username != "" {
+		auth = smtp.PlainAuth("", s.opts.Username, s.opts.Password, s.opts.Host)
+	}
+	addr := net.JoinHostPort(s.opts.Host, strconv.Itoa(s.opts.Port))
+
+	// O net/smtp não aceita contexto: o envio corre à parte e o contexto só limita a espera
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(addr, auth, s.opts.From, []string{msg.To}, data)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("error sending email: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// build escreve a mensagem em RFC 5322. As quebras de linha são retiradas dos
+// cabeçalhos, para que um assunto não possa acrescentar cabeçalhos.
+func (s *SMTPSender) build(msg Message) ([]byte, error) {
+	to := headerValue(msg.To)
+	if to == "" || strings.ContainsAny(msg.To, "\r\n") {
+		return nil, fmt.Errorf("invalid recipient %q", msg.To)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", headerValue(s.opts.From))
+	fmt.Fprintf(&buf, "To: %s\r\n", to)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", headerValue(msg.Subject)))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	w := quotedprintable.NewWriter(&buf)
+	if _, err := w.Write([]byte(msg.Body)); err != nil {
+		return nil, fmt.Errorf("error encoding email body: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("error encoding email body: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func headerValue(s string) string {
+	return strings.TrimSpace(strings.NewReplacer("\r", " ", "\n", " ").Replace(s))
+}
@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// HubStats é o estado instantâneo do hub WebSocket
+type HubStats struct {
+	ConnectedClients int
+	ConnectedUsers   int
+	QueuedMessages   int
+}
+
+// hubCollector lê o estado do hub a cada scrape, em vez de manter gauges sincronizados
+type hubCollector struct {
+	stats     func() HubStats
+	connected *prometheus.Desc
+	users     *prometheus.Desc
+	queued    *prometheus.Desc
+}
+
+// RegisterWebSocketHub expõe os gauges do hub WebSocket
+func RegisterWebSocketHub(stats func() HubStats) {
+	Registry.MustRegister(&hubCollector{
+		stats: stats,
+		connected: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "websocket", "connected_clients"),
+			"WebSocket clients currently connected.", nil, nil),
+		users: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "websocket", "connected_users"),
+			"Users with at least one WebSocket connection.", nil, nil),
+		queued: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "websocket", "queued_messages"),
+			"Messages waiting in client send buffers.", nil, nil),
+	})
+}
+
+func (c *hubCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.connected
+	ch <- c.users
+	ch <- c.queued
+}
+
+func (c *hubCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.stats()
+	ch <- prometheus.MustNewConstMetric(c.connected, prometheus.GaugeValue, float64(stats.ConnectedClients))
+	ch <- prometheus.MustNewConstMetric(c.users, prometheus.GaugeValue, float64(stats.ConnectedUsers))
+	ch <- prometheus.MustNewConstMetric(c.queued, prometheus.GaugeValue, float64(stats.QueuedMessages))
+}
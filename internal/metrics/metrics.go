@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "modress"
+
+// Registry guarda todas as métricas da API. Usar um registry próprio evita expor
+// métricas registadas por bibliotecas no registry global.
+var Registry = prometheus.NewRegistry()
+
+// Métricas HTTP
+var (
+	HTTPRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Total HTTP requests by method, route template and status code.",
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by method, route template and status code.",
+		Buckets:   []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestsInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_in_flight",
+		Help:      "HTTP requests currently being served.",
+	})
+)
+
+// Métricas WebSocket
+var (
+	WebSocketMessagesRelayed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "websocket",
+		Name:      "messages_relayed_total",
+		Help:      "Chat messages delivered to a connected receiver.",
+	})
+
+	WebSocketSendsDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "websocket",
+		Name:      "sends_dropped_total",
+		Help:      "Messages that could not be queued for a client, by reason.",
+	}, []string{"reason"})
+)
+
+// Métricas de negócio
+var (
+	ProductsCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "products_created_total",
+		Help:      "Products created, by source (api or import).",
+	}, []string{"source"})
+
+	LoginsFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_failed_total",
+		Help:      "Failed login attempts, by reason.",
+	}, []string{"reason"})
+
+	StoresApproved = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "stores_approved_total",
+		Help:      "Stores approved by an admin.",
+	})
+
+	AccountsLocked = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "accounts_locked_total",
+		Help:      "Accounts locked after repeated failed logins.",
+	})
+
+	RateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_requests_total",
+		Help:      "Requests rejected by the rate limiter, by rule.",
+	}, []string{"rule"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequestsTotal,
+		HTTPRequestDuration,
+		HTTPRequestsInFlight,
+		WebSocketMessagesRelayed,
+		WebSocketSendsDropped,
+		ProductsCreated,
+		LoginsFailed,
+		StoresApproved,
+		AccountsLocked,
+		RateLimited,
+	)
+}
+
+// RegisterDB expõe as estatísticas do pool (db.Stats()) como métricas
+func RegisterDB(db *sql.DB, name string) {
+	Registry.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// Handler devolve o handler HTTP do endpoint /metrics
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
@@ -2,46 +2,126 @@ package middleware
 
 import (
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"modress/internal/config"
 
 	"github.com/gin-gonic/gin"
 )
 
-// CORSMiddleware handles Cross-Origin Resource Sharing (CORS)
-func CORSMiddleware() gin.HandlerFunc {
+// CORSMiddleware handles Cross-Origin Resource Sharing (CORS) according to cfg.
+// Only allowed origins are echoed back; responses always vary on Origin so caches
+// never serve one origin's headers to another.
+func CORSMiddleware(cfg config.CORSConfig) gin.HandlerFunc {
+	allowed := newOriginMatcher(cfg.AllowedOrigins)
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	exposed := strings.Join(cfg.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+
 	return func(c *gin.Context) {
+		c.Writer.Header().Add("Vary", "Origin")
+
 		origin := c.GetHeader("Origin")
-		
-		allowedOrigins := []string{
-			"http://localhost:3000",
-			"http://localhost:5173",
-			"http://localhost:8080",
-			"http://127.0.0.1:3000",
-			"http://127.0.0.1:5173",
-			"http://127.0.0.1:8080",
-		}
-		
-		isAllowed := false
-		for _, allowedOrigin := range allowedOrigins {
-			if origin == allowedOrigin {
-				isAllowed = true
-				break
-			}
-		}
-		
-		if isAllowed {
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+
+		if origin != "" && allowed.match(origin) {
 			c.Header("Access-Control-Allow-Origin", origin)
+			if cfg.AllowCredentials {
+				c.Header("Access-Control-Allow-Credentials", "true")
+			}
+			if exposed != "" {
+				c.Header("Access-Control-Expose-Headers", exposed)
+			}
+			if preflight {
+				c.Writer.Header().Add("Vary", "Access-Control-Request-Method")
+				c.Writer.Header().Add("Vary", "Access-Control-Request-Headers")
+				c.Header("Access-Control-Allow-Methods", methods)
+				if headers != "" {
+					c.Header("Access-Control-Allow-Headers", headers)
+				}
+				c.Header("Access-Control-Max-Age", maxAge)
+			}
 		}
-		
-		c.Header("Access-Control-Allow-Credentials", "true")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Header("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE, PATCH")
-		c.Header("Access-Control-Max-Age", "86400") 
-		
-		if c.Request.Method == "OPTIONS" {
+
+		if c.Request.Method == http.MethodOptions {
 			c.AbortWithStatus(http.StatusNoContent)
 			return
 		}
-		
+
 		c.Next()
 	}
-}
\ No newline at end of file
+}
+
+// OriginAllowed devolve uma função que indica se uma origem está na lista, com as
+// mesmas regras do CORS. Serve o WebSocket, onde o browser não aplica o CORS.
+func OriginAllowed(origins []string) func(origin string) bool {
+	return newOriginMatcher(origins).match
+}
+
+// originPattern é uma origem permitida; com wildcard, host guarda o sufixo (".example.com")
+type originPattern struct {
+	scheme   string
+	host     string
+	port     string
+	wildcard bool
+}
+
+type originMatcher struct {
+	any      bool
+	patterns []originPattern
+}
+
+// newOriginMatcher assume origens já validadas pela configuração
+func newOriginMatcher(origins []string) originMatcher {
+	var m originMatcher
+	for _, origin := range origins {
+		if origin == "*" {
+			m.any = true
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil {
+			continue
+		}
+		p := originPattern{
+			scheme: strings.ToLower(u.Scheme),
+			host:   strings.ToLower(u.Hostname()),
+			port:   u.Port(),
+		}
+		if strings.HasPrefix(p.host, "*.") {
+			p.wildcard = true
+			p.host = p.host[1:]
+		}
+		m.patterns = append(m.patterns, p)
+	}
+	return m
+}
+
+func (m originMatcher) match(origin string) bool {
+	if m.any {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	scheme, host, port := strings.ToLower(u.Scheme), strings.ToLower(u.Hostname()), u.Port()
+
+	for _, p := range m.patterns {
+		if p.scheme != scheme || p.port != port {
+			continue
+		}
+		if p.wildcard {
+			// *.example.com cobre a.example.com e a.b.example.com, mas não example.com
+			if strings.HasSuffix(host, p.host) && len(host) > len(p.host) {
+				return true
+			}
+		} else if p.host == host {
+			return true
+		}
+	}
+	return false
+}
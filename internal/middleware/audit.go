@@ -0,0 +1,16 @@
+package middleware
+
+import (
+	"modress/internal/audit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuditMiddleware guarda o IP do cliente no contexto do pedido, para os eventos de
+// auditoria; o utilizador é acrescentado depois pelo AuthMiddleware
+func AuditMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(audit.WithClientIP(c.Request.Context(), c.ClientIP()))
+		c.Next()
+	}
+}
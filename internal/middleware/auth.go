@@ -1,39 +1,48 @@
 package middleware
 
 import (
+	"errors"
 	"fmt"
-	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	"modress/internal/audit"
+	"modress/internal/logging"
+	"modress/internal/services"
+
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
 
+var (
+	errMissingToken            = services.NewError(services.ErrUnauthorized, "missing_token", "authorization header missing")
+	errInvalidAuthScheme       = services.NewError(services.ErrUnauthorized, "invalid_token", "invalid authorization format, use 'Bearer <token>'")
+	errInvalidToken            = services.NewError(services.ErrUnauthorized, "invalid_token", "invalid token")
+	errTokenExpired            = services.NewError(services.ErrUnauthorized, "token_expired", "token has expired")
+	errInsufficientPermissions = services.NewError(services.ErrForbidden, "insufficient_permissions", "insufficient permissions")
+)
+
 func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		
 		authHeader := ctx.GetHeader("Authorization")
 		if authHeader == "" {
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"error": "Authorization header missing",
-			})
+			ctx.Error(errMissingToken)
+			ctx.Abort()
 			return
 		}
 		
 		if !strings.HasPrefix(authHeader, "Bearer ") {
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"error": "Invalid authorization format. Use 'Bearer <token>'",
-			})
+			ctx.Error(errInvalidAuthScheme)
+			ctx.Abort()
 			return
 		}
 
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 		if tokenString == "" {
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"error": "Token is empty",
-			})
+			ctx.Error(errMissingToken)
+			ctx.Abort()
 			return
 		}
 
@@ -47,34 +56,34 @@ func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
 		})
 
 		if err != nil {
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"error": "Invalid token",
-			})
+			if errors.Is(err, jwt.ErrTokenExpired) {
+				ctx.Error(errTokenExpired)
+			} else {
+				ctx.Error(errInvalidToken.Wrap(err))
+			}
+			ctx.Abort()
 			return
 		}
 
 		if !token.Valid {
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"error": "Token is not valid",
-			})
+			ctx.Error(errInvalidToken)
+			ctx.Abort()
 			return
 		}
 
 		// Extrair claims
 		claims, ok := token.Claims.(jwt.MapClaims)
 		if !ok {
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"error": "Invalid token claims",
-			})
+			ctx.Error(errInvalidToken)
+			ctx.Abort()
 			return
 		}
 
 		// Verificar expiração
 		if exp, ok := claims["exp"].(float64); ok {
 			if time.Now().Unix() > int64(exp) {
-				ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-					"error": "Token has expired",
-				})
+				ctx.Error(errTokenExpired)
+				ctx.Abort()
 				return
 			}
 		}
@@ -82,25 +91,22 @@ func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
 		// Extrair user ID
 		userIDStr, err := claims.GetSubject()
 		if err != nil {
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"error": "Invalid token subject",
-			})
+			ctx.Error(errInvalidToken)
+			ctx.Abort()
 			return
 		}
 
 		if userIDStr == "" {
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"error": "User ID not found in token",
-			})
+			ctx.Error(errInvalidToken)
+			ctx.Abort()
 			return
 		}
 
 		// Converter para int64
 		userID, err := strconv.ParseInt(userIDStr, 10, 64)
 		if err != nil {
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"error": "Invalid user ID in token",
-			})
+			ctx.Error(errInvalidToken)
+			ctx.Abort()
 			return
 		}
 
@@ -113,6 +119,8 @@ func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
 		// Adicionar informações ao contexto
 		ctx.Set("userID", userID)
 		ctx.Set("userRole", role)
+		reqCtx := logging.With(ctx.Request.Context(), "user_id", userID)
+		ctx.Request = ctx.Request.WithContext(audit.WithUser(reqCtx, userID, role))
 		
 		ctx.Next()
 	}
@@ -123,17 +131,15 @@ func RoleMiddleware(allowedRoles ...string) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		userRole, exists := ctx.Get("userRole")
 		if !exists {
-			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
-				"error": "User role not found",
-			})
+			ctx.Error(errInsufficientPermissions)
+			ctx.Abort()
 			return
 		}
 
 		role, ok := userRole.(string)
 		if !ok {
-			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
-				"error": "Invalid user role",
-			})
+			ctx.Error(errInsufficientPermissions)
+			ctx.Abort()
 			return
 		}
 
@@ -145,8 +151,7 @@ func RoleMiddleware(allowedRoles ...string) gin.HandlerFunc {
 			}
 		}
 
-		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
-			"error": "Insufficient permissions",
-		})
+		ctx.Error(errInsufficientPermissions)
+		ctx.Abort()
 	}
 }
\ No newline at end of file
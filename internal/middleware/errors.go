@@ -0,0 +1,132 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"modress/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProblemContentType é o media type das respostas de erro (RFC 7807)
+const ProblemContentType = "application/problem+json"
+
+// Problem é o corpo de todas as respostas de erro da API. Os clientes devem decidir
+// pelo Code, que é estável; Title e Detail são apenas para pessoas.
+type Problem struct {
+	Type      string                `json:"type"`
+	Title     string                `json:"title"`
+	Status    int                   `json:"status"`
+	Detail    string                `json:"detail,omitempty"`
+	Instance  string                `json:"instance,omitempty"`
+	Code      string                `json:"code"`
+	RequestID string                `json:"request_id,omitempty"`
+	Errors    []services.FieldError `json:"errors,omitempty"`
+}
+
+var errRouteNotFound = services.NewError(services.ErrNotFound, "route_not_found", "route not found")
+
+// ErrorMiddleware converte o último erro registado com ctx.Error numa resposta
+// problem+json. Os controllers só registam o erro e retornam; o status vem da
+// categoria do erro de domínio. Erros sem categoria são 500 e a mensagem original
+// fica apenas nos logs.
+func ErrorMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+
+		err := c.Errors.Last().Err
+		problem := NewProblem(err)
+		problem.Instance = c.Request.URL.Path
+		problem.RequestID = c.GetString("requestID")
+
+		if problem.Status == http.StatusUnauthorized {
+			c.Header("WWW-Authenticate", "Bearer")
+		}
+		var domainErr *services.Error
+		if errors.As(err, &domainErr) && domainErr.RetryAfter > 0 {
+			c.Header("Retry-After", retryAfterSeconds(domainErr.RetryAfter))
+		}
+		c.Header("Content-Type", ProblemContentType)
+		c.JSON(problem.Status, problem)
+	}
+}
+
+// NotFoundHandler responde às rotas inexistentes no mesmo formato dos restantes erros
+func NotFoundHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Error(errRouteNotFound)
+	}
+}
+
+// NewProblem constrói o Problem correspondente a err, sem Instance nem RequestID
+func NewProblem(err error) Problem {
+	var domainErr *services.Error
+	if errors.As(err, &domainErr) {
+		status := statusForKind(domainErr.Kind)
+		if status == http.StatusInternalServerError {
+			return internalProblem()
+		}
+		return Problem{
+			Type:   "about:blank",
+			Title:  http.StatusText(status),
+			Status: status,
+			Detail: domainErr.Message,
+			Code:   domainErr.Code,
+			Errors: domainErr.Fields,
+		}
+	}
+
+	// O cliente desistiu ou o pedido excedeu o prazo antes de haver resposta
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return Problem{
+			Type:   "about:blank",
+			Title:  http.StatusText(http.StatusRequestTimeout),
+			Status: http.StatusRequestTimeout,
+			Detail: "request cancelled or timed out",
+			Code:   "request_timeout",
+		}
+	}
+
+	return internalProblem()
+}
+
+func internalProblem() Problem {
+	return Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(http.StatusInternalServerError),
+		Status: http.StatusInternalServerError,
+		Detail: "an unexpected error occurred",
+		Code:   "internal_error",
+	}
+}
+
+func statusForKind(kind error) int {
+	switch {
+	case errors.Is(kind, services.ErrValidation):
+		return http.StatusBadRequest
+	case errors.Is(kind, services.ErrUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(kind, services.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(kind, services.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(kind, services.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(kind, services.ErrTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(kind, services.ErrRateLimited):
+		return http.StatusTooManyRequests
+	case errors.Is(kind, services.ErrUnprocessable):
+		return http.StatusUnprocessableEntity
+	case errors.Is(kind, services.ErrPreconditionFailed):
+		return http.StatusPreconditionFailed
+	default:
+		return http.StatusInternalServerError
+	}
+}
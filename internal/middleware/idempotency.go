@@ -0,0 +1,167 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	"modress/internal/logging"
+	"modress/internal/models"
+	"modress/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotentReplayedHeader  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	maxIdempotentRequestBytes = 1 << 20
+)
+
+var errInvalidIdempotencyKey = services.NewFieldError(IdempotencyKeyHeader, "invalid", "Idempotency-Key must be 1 to 255 printable ASCII characters")
+
+// replayedHeaders são os cabeçalhos guardados e devolvidos nas repetições
+var replayedHeaders = []string{"Content-Type", "Location", "ETag"}
+
+// IdempotencyMiddleware torna um POST seguro de repetir: o primeiro pedido com um
+// dado Idempotency-Key é executado e a resposta guardada; as repetições (mesmo
+// utilizador, mesma chave, mesmo corpo) recebem a resposta guardada com
+// Idempotent-Replayed: true. Um duplicado em curso recebe 409 e uma chave reutilizada
+// com outro corpo recebe 422. Sem o cabeçalho o pedido segue normalmente.
+// Tem de correr depois do AuthMiddleware.
+func IdempotencyMiddleware(svc services.IdempotencyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		userID, authenticated := c.Get("userID")
+		if key == "" || c.Request.Method != http.MethodPost || !authenticated {
+			c.Next()
+			return
+		}
+		uid, _ := userID.(int64)
+
+		if !validIdempotencyKey(key) {
+			c.Error(errInvalidIdempotencyKey)
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxIdempotentRequestBytes+1))
+		if err != nil {
+			c.Error(services.NewValidationError(err))
+			c.Abort()
+			return
+		}
+		if len(body) > maxIdempotentRequestBytes {
+			c.Error(services.NewError(services.ErrTooLarge, "body_too_large", "request body is too large for an idempotent request"))
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		ctx := c.Request.Context()
+		path := c.Request.URL.Path
+		stored, lockToken, err := svc.Begin(ctx, uid, key, c.Request.Method, path, fingerprint(c.Request.Method, path, body))
+		if err != nil {
+			c.Error(err)
+			c.Abort()
+			return
+		}
+		if stored != nil {
+			for name, value := range stored.Headers {
+				c.Header(name, value)
+			}
+			c.Header(IdempotentReplayedHeader, "true")
+			c.Status(stored.Status)
+			c.Writer.Write(stored.Body)
+			c.Abort()
+			return
+		}
+
+		recorder := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = recorder
+
+		completed := false
+		defer func() {
+			if completed {
+				return
+			}
+			// O pedido falhou (erro ou pânico): libertar a chave para que a
+			// repetição volte a executar. O contexto do pedido pode já ter sido
+			// cancelado, por isso usa um contexto próprio.
+			releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+			defer cancel()
+			if err := svc.Release(releaseCtx, uid, key, lockToken); err != nil {
+				logging.FromContext(ctx).Warn("failed to release idempotency key", logging.Err(err))
+			}
+		}()
+
+		c.Next()
+
+		// Os erros registados com ctx.Error só são escritos depois, pelo
+		// ErrorMiddleware; não são guardados, e tal como os 5xx podem ser repetidos
+		status := c.Writer.Status()
+		if len(c.Errors) > 0 || !c.Writer.Written() || status >= http.StatusInternalServerError {
+			return
+		}
+
+		response := models.StoredResponse{
+			Status:  status,
+			Headers: make(map[string]string),
+			Body:    recorder.body.Bytes(),
+		}
+		for _, name := range replayedHeaders {
+			if value := c.Writer.Header().Get(name); value != "" {
+				response.Headers[name] = value
+			}
+		}
+		// Se o pedido demorou mais do que a reserva e uma repetição ficou com a chave,
+		// a resposta desta não substitui a dela
+		if err := svc.Complete(context.WithoutCancel(ctx), uid, key, lockToken, response); err != nil {
+			logging.FromContext(ctx).Warn("failed to store idempotent response", logging.Err(err))
+			return
+		}
+		completed = true
+	}
+}
+
+// fingerprint identifica o pedido: a mesma chave só pode ser repetida com o mesmo
+// método, caminho e corpo
+func fingerprint(method, path string, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, method+" "+path+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func validIdempotencyKey(key string) bool {
+	if len(key) > maxIdempotencyKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x20 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// recordingWriter copia o corpo da resposta para poder ser guardado
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"modress/internal/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// RequestIDMiddleware reutiliza o X-Request-ID recebido (se for seguro) ou gera um novo,
+// devolve-o na resposta e coloca no contexto do pedido um logger com o request_id
+func RequestIDMiddleware(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = newRequestID()
+		}
+
+		c.Set("requestID", requestID)
+		c.Header(RequestIDHeader, requestID)
+
+		ctx := logging.NewContext(c.Request.Context(), logger)
+		c.Request = c.Request.WithContext(logging.WithRequestID(ctx, requestID))
+
+		c.Next()
+	}
+}
+
+// validRequestID aceita apenas IDs curtos e sem caracteres que possam partir os logs
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// RequestLoggerMiddleware substitui o gin.Logger: uma linha JSON por pedido com a rota,
+// o estado, a latência, o utilizador autenticado e os erros registados com ctx.Error
+func RequestLoggerMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		status := c.Writer.Status()
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("route", c.FullPath()),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.Int("bytes", c.Writer.Size()),
+			slog.String("client_ip", c.ClientIP()),
+		}
+		if userID, ok := c.Get("userID"); ok {
+			attrs = append(attrs, slog.Any("user_id", userID))
+		}
+		if len(c.Errors) > 0 {
+			// Só o último erro tem a cadeia completa; os restantes vão como mensagens
+			attrs = append(attrs, logging.Err(c.Errors.Last().Err))
+			if len(c.Errors) > 1 {
+				attrs = append(attrs, slog.Any("errors", c.Errors.Errors()))
+			}
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+
+		ctx := c.Request.Context()
+		logging.FromContext(ctx).LogAttrs(ctx, level, "request completed", attrs...)
+	}
+}
+
+// RecoveryMiddleware regista pânicos com o request_id e a stack e deixa a resposta 500
+// para o ErrorMiddleware, que tem de estar registado antes dele
+func RecoveryMiddleware() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, recovered any) {
+		logging.FromContext(c.Request.Context()).Error("panic recovered",
+			"panic", recovered,
+			"stack", string(debug.Stack()),
+		)
+		c.Error(fmt.Errorf("panic: %v", recovered))
+		c.Abort()
+	})
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"modress/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MetricsMiddleware records request count and latency labelled by route template,
+// so /products/1 and /products/2 share the /api/v1/products/:id series.
+func MetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		metrics.HTTPRequestsInFlight.Inc()
+		defer metrics.HTTPRequestsInFlight.Dec()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			// Rotas inexistentes não devem criar uma série por URL
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+
+		metrics.HTTPRequestsTotal.WithLabelValues(c.Request.Method, route, status).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
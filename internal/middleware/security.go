@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"strconv"
+	"strings"
+
+	"modress/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SecurityHeadersMiddleware define os cabeçalhos de segurança de todas as respostas.
+// Os pedidos a staticPrefixes (ficheiros enviados pelos utilizadores) recebem o
+// StaticCSP em vez da CSP da API.
+func SecurityHeadersMiddleware(cfg config.SecurityConfig, staticPrefixes ...string) gin.HandlerFunc {
+	hsts := ""
+	if cfg.HSTSMaxAge > 0 {
+		hsts = "max-age=" + strconv.Itoa(int(cfg.HSTSMaxAge.Seconds()))
+		if cfg.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+	}
+
+	return func(c *gin.Context) {
+		h := c.Writer.Header()
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("Referrer-Policy", "no-referrer")
+
+		// Os browsers ignoram HSTS em HTTP; só faz sentido atrás de TLS
+		if hsts != "" && (c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https") {
+			h.Set("Strict-Transport-Security", hsts)
+		}
+
+		csp := cfg.ContentSecurityPolicy
+		for _, prefix := range staticPrefixes {
+			if strings.HasPrefix(c.Request.URL.Path, prefix) {
+				csp = cfg.StaticCSP
+				// As imagens são carregadas pelos front-ends noutras origens
+				h.Set("Cross-Origin-Resource-Policy", "cross-origin")
+				break
+			}
+		}
+		if csp != "" {
+			h.Set("Content-Security-Policy", csp)
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"modress/internal/logging"
+	"modress/internal/tracing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "modress/internal/middleware"
+
+// TracingMiddleware abre um span por pedido, continuando o trace do cliente se vier
+// um cabeçalho traceparent. O span fica no contexto do pedido, pelo que os serviços e
+// as queries SQL aparecem como filhos. O trace_id é também acrescentado aos logs.
+func TracingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+
+		route := c.FullPath()
+		spanName := c.Request.Method + " " + route
+		if route == "" {
+			spanName = c.Request.Method
+		}
+
+		ctx, span := otel.Tracer(tracerName).Start(ctx, spanName,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", c.Request.Method),
+				attribute.String("http.route", route),
+				attribute.String("url.path", c.Request.URL.Path),
+				attribute.String("client.address", c.ClientIP()),
+				attribute.String("user_agent.original", c.Request.UserAgent()),
+			),
+		)
+		defer span.End()
+
+		if requestID := logging.RequestID(ctx); requestID != "" {
+			span.SetAttributes(attribute.String("request.id", requestID))
+		}
+		if traceID := tracing.TraceID(ctx); traceID != "" {
+			ctx = logging.With(ctx, "trace_id", traceID)
+		}
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if userID, ok := c.Get("userID"); ok {
+			span.SetAttributes(attribute.String("enduser.id", fmt.Sprint(userID)))
+		}
+		for _, e := range c.Errors {
+			span.RecordError(e.Err)
+		}
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
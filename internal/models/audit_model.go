@@ -0,0 +1,43 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Entidades auditadas
+const (
+	AuditEntityProduct = "product"
+	AuditEntityStore   = "store"
+	AuditEntityUser    = "user"
+	AuditEntityJob     = "job"
+	AuditEntityWebhook = "webhook"
+	AuditEntityReview  = "review"
+	AuditEntityCoupon  = "coupon"
+)
+
+// AuditEvent regista uma alteração: quem a fez, de onde, em que entidade e o que mudou
+type AuditEvent struct {
+	ID         int64           `db:"id" json:"id"`
+	ActorID    *int64          `db:"actor_id" json:"actor_id,omitempty"`
+	ActorRole  *string         `db:"actor_role" json:"actor_role,omitempty"`
+	IP         *string         `db:"ip" json:"ip,omitempty"`
+	RequestID  *string         `db:"request_id" json:"request_id,omitempty"`
+	Action     string          `db:"action" json:"action"`
+	EntityType string          `db:"entity_type" json:"entity_type"`
+	EntityID   int64           `db:"entity_id" json:"entity_id"`
+	Changes    json.RawMessage `db:"changes" json:"changes"`
+	CreatedAt  time.Time       `db:"created_at" json:"created_at"`
+}
+
+// AuditFilter filtra a consulta do registo de auditoria; os campos vazios não filtram
+type AuditFilter struct {
+	ActorID    int64
+	EntityType string
+	EntityID   int64
+	Action     string
+	From       time.Time
+	To         time.Time
+	Page       int
+	Limit      int
+}
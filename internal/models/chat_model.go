@@ -0,0 +1,87 @@
+package models
+
+import "time"
+
+// Conversation é a conversa entre um comprador e uma loja; do lado da loja responde o dono
+type Conversation struct {
+	ID            int64      `db:"id" json:"id"`
+	BuyerID       int64      `db:"buyer_id" json:"buyer_id"`
+	StoreID       int64      `db:"store_id" json:"store_id"`
+	LastMessageAt *time.Time `db:"last_message_at" json:"last_message_at,omitempty"`
+	CreatedAt     time.Time  `db:"created_at" json:"created_at"`
+}
+
+// ConversationSummary é uma conversa na lista de um utilizador, com as duas partes,
+// a última mensagem e quantas mensagens recebidas ainda não foram lidas
+type ConversationSummary struct {
+	Conversation
+	BuyerName   string  `db:"buyer_name" json:"buyer_name"`
+	StoreName   string  `db:"store_name" json:"store_name"`
+	SellerID    int64   `db:"seller_id" json:"seller_id"`
+	LastMessage *string `db:"last_message" json:"last_message,omitempty"`
+	UnreadCount int64   `db:"unread_count" json:"unread_count"`
+}
+
+// Message é uma mensagem de uma conversa. É guardada antes de ser entregue:
+// DeliveredAt fica preenchido quando chega a uma ligação do destinatário e ReadAt
+// quando o destinatário a marca como lida.
+type Message struct {
+	ID             int64      `db:"id" json:"id"`
+	ConversationID int64      `db:"conversation_id" json:"conversation_id"`
+	SenderID       int64      `db:"sender_id" json:"sender_id"`
+	RecipientID    int64      `db:"recipient_id" json:"recipient_id"`
+	Content        string     `db:"content" json:"content"`
+	CreatedAt      time.Time  `db:"created_at" json:"created_at"`
+	DeliveredAt    *time.Time `db:"delivered_at" json:"delivered_at,omitempty"`
+	ReadAt         *time.Time `db:"read_at" json:"read_at,omitempty"`
+}
+
+// StartConversationRequest abre (ou reabre) a conversa do comprador com uma loja
+type StartConversationRequest struct {
+	StoreID int64 `json:"store_id" validate:"required,min=1"`
+}
+
+// Validate start conversation request
+func (r *StartConversationRequest) Validate() error {
+	return validate.Struct(r)
+}
+
+// SendMessageRequest envia uma mensagem numa conversa existente (ConversationID) ou
+// na conversa do remetente com uma loja, criada se ainda não existir (StoreID)
+type SendMessageRequest struct {
+	ConversationID int64  `json:"conversation_id" validate:"required_without=StoreID"`
+	StoreID        int64  `json:"store_id" validate:"required_without=ConversationID"`
+	Content        string `json:"content" validate:"required,max=4000"`
+}
+
+// Validate send message request
+func (r *SendMessageRequest) Validate() error {
+	return validate.Struct(r)
+}
+
+// MarkReadRequest marca como lidas as mensagens recebidas até UpToID; 0 marca todas
+type MarkReadRequest struct {
+	UpToID int64 `json:"up_to_id" validate:"min=0"`
+}
+
+// DeliveryReceipt avisa o remetente de que as mensagens chegaram ao destinatário
+type DeliveryReceipt struct {
+	ConversationID int64     `json:"conversation_id"`
+	MessageIDs     []int64   `json:"message_ids"`
+	DeliveredAt    time.Time `json:"delivered_at"`
+
+	// Quem enviou as mensagens, a quem o recibo é entregue
+	SenderID int64 `json:"-"`
+}
+
+// ReadReceipt avisa o remetente de que o destinatário leu as mensagens até UpToID
+type ReadReceipt struct {
+	ConversationID int64     `json:"conversation_id"`
+	ReaderID       int64     `json:"reader_id"`
+	UpToID         int64     `json:"up_to_id"`
+	Count          int64     `json:"count"`
+	ReadAt         time.Time `json:"read_at"`
+
+	// Quem enviou as mensagens lidas, a quem o recibo é entregue
+	SenderID int64 `json:"-"`
+}
@@ -0,0 +1,186 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Coupon é um código de desconto. Sem StoreID vale em todo o marketplace; com
+// StoreID só nos produtos dessa loja. O desconto é PercentOff ou AmountOffCents,
+// nunca os dois, e não pode ser alterado depois de criado.
+type Coupon struct {
+	ID                    int64      `db:"id" json:"id"`
+	StoreID               *int64     `db:"store_id" json:"store_id,omitempty"`
+	Code                  string     `db:"code" json:"code"`
+	Description           *string    `db:"description" json:"description,omitempty"`
+	PercentOff            *int       `db:"percent_off" json:"percent_off,omitempty"`
+	AmountOffCents        *int       `db:"amount_off_cents" json:"amount_off_cents,omitempty"`
+	MinOrderCents         int        `db:"min_order_cents" json:"min_order_cents"`
+	ValidFrom             *time.Time `db:"valid_from" json:"valid_from,omitempty"`
+	ValidUntil            *time.Time `db:"valid_until" json:"valid_until,omitempty"`
+	MaxRedemptions        *int       `db:"max_redemptions" json:"max_redemptions,omitempty"`
+	MaxRedemptionsPerUser *int       `db:"max_redemptions_per_user" json:"max_redemptions_per_user,omitempty"`
+	RedemptionCount       int        `db:"redemption_count" json:"redemption_count"`
+	IsActive              bool       `db:"is_active" json:"is_active"`
+	CreatedBy             *int64     `db:"created_by" json:"created_by,omitempty"`
+	CreatedAt             time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt             time.Time  `db:"updated_at" json:"updated_at"`
+}
+
+// CouponResponse é o cupão devolvido pela API, com os valores em unidades da moeda
+type CouponResponse struct {
+	ID                    int64      `json:"id"`
+	StoreID               *int64     `json:"store_id,omitempty"`
+	Code                  string     `json:"code"`
+	Description           *string    `json:"description,omitempty"`
+	PercentOff            *int       `json:"percent_off,omitempty"`
+	AmountOff             *float64   `json:"amount_off,omitempty"`
+	MinOrder              float64    `json:"min_order"`
+	ValidFrom             *time.Time `json:"valid_from,omitempty"`
+	ValidUntil            *time.Time `json:"valid_until,omitempty"`
+	MaxRedemptions        *int       `json:"max_redemptions,omitempty"`
+	MaxRedemptionsPerUser *int       `json:"max_redemptions_per_user,omitempty"`
+	RedemptionCount       int        `json:"redemption_count"`
+	IsActive              bool       `json:"is_active"`
+	CreatedAt             time.Time  `json:"created_at"`
+	UpdatedAt             time.Time  `json:"updated_at"`
+}
+
+// ToResponse converte Coupon para CouponResponse
+func (c *Coupon) ToResponse() CouponResponse {
+	var amountOff *float64
+	if c.AmountOffCents != nil {
+		amount := float64(*c.AmountOffCents) / 100
+		amountOff = &amount
+	}
+
+	return CouponResponse{
+		ID:                    c.ID,
+		StoreID:               c.StoreID,
+		Code:                  c.Code,
+		Description:           c.Description,
+		PercentOff:            c.PercentOff,
+		AmountOff:             amountOff,
+		MinOrder:              float64(c.MinOrderCents) / 100,
+		ValidFrom:             c.ValidFrom,
+		ValidUntil:            c.ValidUntil,
+		MaxRedemptions:        c.MaxRedemptions,
+		MaxRedemptionsPerUser: c.MaxRedemptionsPerUser,
+		RedemptionCount:       c.RedemptionCount,
+		IsActive:              c.IsActive,
+		CreatedAt:             c.CreatedAt,
+		UpdatedAt:             c.UpdatedAt,
+	}
+}
+
+// CreateCouponRequest cria um cupão: percent_off ou amount_off, exatamente um deles.
+// Sem max_redemptions ou max_redemptions_per_user não há limite.
+type CreateCouponRequest struct {
+	Code                  string     `json:"code" validate:"required,min=3,max=50"`
+	Description           *string    `json:"description,omitempty" validate:"omitempty,max=500"`
+	PercentOff            *int       `json:"percent_off,omitempty" validate:"required_without=AmountOff,excluded_with=AmountOff,omitempty,min=1,max=100"`
+	AmountOff             *float64   `json:"amount_off,omitempty" validate:"required_without=PercentOff,omitempty,gt=0"`
+	MinOrder              float64    `json:"min_order" validate:"min=0"`
+	ValidFrom             *time.Time `json:"valid_from,omitempty"`
+	ValidUntil            *time.Time `json:"valid_until,omitempty"`
+	MaxRedemptions        *int       `json:"max_redemptions,omitempty" validate:"omitempty,min=1"`
+	MaxRedemptionsPerUser *int       `json:"max_redemptions_per_user,omitempty" validate:"omitempty,min=1"`
+	IsActive              *bool      `json:"is_active,omitempty"`
+}
+
+// Validate create coupon request
+func (r *CreateCouponRequest) Validate() error {
+	return validate.Struct(r)
+}
+
+// UpdateCouponRequest altera os campos indicados. O código e o desconto não mudam;
+// um limite a 0 deixa de limitar.
+type UpdateCouponRequest struct {
+	Description           *string    `json:"description,omitempty" validate:"omitempty,max=500"`
+	MinOrder              *float64   `json:"min_order,omitempty" validate:"omitempty,min=0"`
+	ValidFrom             *time.Time `json:"valid_from,omitempty"`
+	ValidUntil            *time.Time `json:"valid_until,omitempty"`
+	MaxRedemptions        *int       `json:"max_redemptions,omitempty" validate:"omitempty,min=0"`
+	MaxRedemptionsPerUser *int       `json:"max_redemptions_per_user,omitempty" validate:"omitempty,min=0"`
+	IsActive              *bool      `json:"is_active,omitempty"`
+}
+
+// Validate update coupon request
+func (r *UpdateCouponRequest) Validate() error {
+	return validate.Struct(r)
+}
+
+// CouponItem é uma linha do carrinho a que o cupão se aplica. O preço é sempre o
+// atual do produto, nunca o enviado pelo cliente.
+type CouponItem struct {
+	ProductID int64 `json:"product_id" validate:"required,min=1"`
+	Quantity  int   `json:"quantity" validate:"required,min=1,max=1000"`
+}
+
+// QuoteCouponRequest calcula o desconto de um cupão sobre um carrinho, sem o usar
+type QuoteCouponRequest struct {
+	Code  string       `json:"code" validate:"required,max=50"`
+	Items []CouponItem `json:"items" validate:"required,min=1,max=100,dive"`
+}
+
+// Validate quote coupon request
+func (r *QuoteCouponRequest) Validate() error {
+	return validate.Struct(r)
+}
+
+// RedeemCouponRequest usa o cupão no carrinho. Reference identifica a compra do lado
+// do cliente, enquanto não houver encomendas.
+type RedeemCouponRequest struct {
+	QuoteCouponRequest
+	Reference *string `json:"reference,omitempty" validate:"omitempty,max=100"`
+}
+
+// Validate redeem coupon request
+func (r *RedeemCouponRequest) Validate() error {
+	return validate.Struct(r)
+}
+
+// CouponQuote é o desconto de um cupão sobre um carrinho, repartido pelas linhas
+type CouponQuote struct {
+	CouponID         int64             `json:"coupon_id"`
+	Code             string            `json:"code"`
+	Subtotal         float64           `json:"subtotal"`
+	EligibleSubtotal float64           `json:"eligible_subtotal"`
+	Discount         float64           `json:"discount"`
+	Total            float64           `json:"total"`
+	Lines            []CouponQuoteLine `json:"lines"`
+}
+
+// CouponQuoteLine é uma linha do carrinho com a parte do desconto que lhe coube.
+// As linhas de outras lojas num cupão de loja não são elegíveis e não têm desconto.
+type CouponQuoteLine struct {
+	ProductID int64   `json:"product_id"`
+	StoreID   int64   `json:"store_id"`
+	Title     string  `json:"title"`
+	Quantity  int     `json:"quantity"`
+	UnitPrice float64 `json:"unit_price"`
+	LineTotal float64 `json:"line_total"`
+	Eligible  bool    `json:"eligible"`
+	Discount  float64 `json:"discount"`
+	Total     float64 `json:"total"`
+}
+
+// CouponRedemption é uma utilização de um cupão, com as linhas do carrinho e a
+// repartição do desconto tal como foram calculadas. O código e a loja são copiados do
+// cupão: quando este é apagado com a sua loja, CouponID fica vazio e o resto mantém-se.
+type CouponRedemption struct {
+	ID            int64           `db:"id" json:"id"`
+	CouponID      *int64          `db:"coupon_id" json:"coupon_id,omitempty"`
+	CouponCode    string          `db:"coupon_code" json:"coupon_code"`
+	StoreID       *int64          `db:"store_id" json:"store_id,omitempty"`
+	UserID        int64           `db:"user_id" json:"user_id"`
+	Reference     *string         `db:"reference" json:"reference,omitempty"`
+	SubtotalCents int             `db:"subtotal_cents" json:"-"`
+	DiscountCents int             `db:"discount_cents" json:"-"`
+	Lines         json.RawMessage `db:"lines" json:"lines"`
+	CreatedAt     time.Time       `db:"created_at" json:"created_at"`
+
+	Subtotal float64 `db:"-" json:"subtotal"`
+	Discount float64 `db:"-" json:"discount"`
+	Total    float64 `db:"-" json:"total"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	IdempotencyStatusProcessing = "processing"
+	IdempotencyStatusCompleted  = "completed"
+)
+
+// IdempotencyKey guarda o pedido feito com um Idempotency-Key e, depois de concluído,
+// a resposta que é devolvida às repetições
+type IdempotencyKey struct {
+	UserID          int64            `db:"user_id"`
+	Key             string           `db:"key"`
+	Method          string           `db:"method"`
+	Path            string           `db:"path"`
+	Fingerprint     string           `db:"fingerprint"`
+	Status          string           `db:"status"`
+	ResponseStatus  *int             `db:"response_status"`
+	ResponseHeaders *json.RawMessage `db:"response_headers"`
+	ResponseBody    []byte           `db:"response_body"`
+	LockedUntil     time.Time        `db:"locked_until"`
+	LockToken       string           `db:"lock_token"`
+	CreatedAt       time.Time        `db:"created_at"`
+	ExpiresAt       time.Time        `db:"expires_at"`
+}
+
+// StoredResponse é a resposta guardada para repetir
+type StoredResponse struct {
+	Status  int
+	Headers map[string]string
+	Body    []byte
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	JobStatusPending   = "pending"
+	JobStatusRunning   = "running"
+	JobStatusSucceeded = "succeeded"
+	JobStatusDead      = "dead"
+)
+
+// Tipos de job conhecidos
+const (
+	JobTypeProductImport     = "product.import"
+	JobTypePurgeDeleted      = "records.purge"
+	JobTypeNotificationEmail = "notification.email"
+	JobTypeWebhookDelivery   = "webhook.deliver"
+	JobTypeWishlistAlert     = "wishlist.alert"
+)
+
+// Job é uma unidade de trabalho assíncrona guardada na tabela jobs
+type Job struct {
+	ID          int64            `db:"id" json:"id"`
+	Type        string           `db:"type" json:"type"`
+	Payload     json.RawMessage  `db:"payload" json:"payload"`
+	Status      string           `db:"status" json:"status"`
+	Attempts    int              `db:"attempts" json:"attempts"`
+	MaxAttempts int              `db:"max_attempts" json:"max_attempts"`
+	RunAt       time.Time        `db:"run_at" json:"run_at"`
+	LockedAt    *time.Time       `db:"locked_at" json:"locked_at,omitempty"`
+	LockedBy    *string          `db:"locked_by" json:"locked_by,omitempty"`
+	LastError   *string          `db:"last_error" json:"last_error,omitempty"`
+	Progress    int              `db:"progress" json:"progress"`
+	Total       int              `db:"total" json:"total"`
+	Result      *json.RawMessage `db:"result" json:"result,omitempty"`
+	CreatedAt   time.Time        `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time        `db:"updated_at" json:"updated_at"`
+	FinishedAt  *time.Time       `db:"finished_at" json:"finished_at,omitempty"`
+}
+
+// EnqueueJobRequest descreve um novo job a colocar na fila
+type EnqueueJobRequest struct {
+	Type        string
+	Payload     interface{}
+	RunAt       time.Time
+	MaxAttempts int
+}
+
+// JobFilter filtra a listagem de jobs no painel de administração
+type JobFilter struct {
+	Status string
+	Type   string
+	Page   int
+	Limit  int
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Tipos de notificação
+const (
+	NotificationStoreApproved     = "store.approved"
+	NotificationProductOutOfStock = "product.out_of_stock"
+	NotificationMessageReceived   = "message.received"
+	NotificationReviewReceived    = "review.received"
+	NotificationReviewReplied     = "review.replied"
+	NotificationPriceDrop         = "wishlist.price_drop"
+	NotificationBackInStock       = "wishlist.back_in_stock"
+)
+
+// NotificationTypes são os tipos conhecidos, com as preferências de quem nunca as
+// alterou. As mensagens já chegam pelo chat: por omissão não vão por email.
+var NotificationTypes = []NotificationPreference{
+	{Type: NotificationStoreApproved, InApp: true, Email: true},
+	{Type: NotificationProductOutOfStock, InApp: true, Email: true},
+	{Type: NotificationMessageReceived, InApp: true, Email: false},
+	{Type: NotificationReviewReceived, InApp: true, Email: false},
+	{Type: NotificationReviewReplied, InApp: true, Email: true},
+	{Type: NotificationPriceDrop, InApp: true, Email: true},
+	{Type: NotificationBackInStock, InApp: true, Email: true},
+}
+
+// Notification é uma notificação mostrada na aplicação. Data leva os IDs de que o
+// cliente precisa para abrir o que a notificação refere.
+type Notification struct {
+	ID        int64           `db:"id" json:"id"`
+	UserID    int64           `db:"user_id" json:"user_id"`
+	Type      string          `db:"type" json:"type"`
+	Title     string          `db:"title" json:"title"`
+	Body      string          `db:"body" json:"body"`
+	Data      json.RawMessage `db:"data" json:"data"`
+	ReadAt    *time.Time      `db:"read_at" json:"read_at,omitempty"`
+	CreatedAt time.Time       `db:"created_at" json:"created_at"`
+}
+
+// NotificationPreference diz por onde chega um tipo de notificação: na aplicação,
+// por email, pelos dois ou por nenhum
+type NotificationPreference struct {
+	Type  string `db:"type" json:"type"`
+	InApp bool   `db:"in_app" json:"in_app"`
+	Email bool   `db:"email" json:"email"`
+}
+
+// NotificationPreferenceUpdate muda as preferências de um tipo; os dois canais são
+// obrigatórios
+type NotificationPreferenceUpdate struct {
+	Type  string `json:"type" validate:"required,max=50"`
+	InApp *bool  `json:"in_app" validate:"required"`
+	Email *bool  `json:"email" validate:"required"`
+}
+
+// UpdateNotificationPreferencesRequest muda as preferências dos tipos indicados; os
+// restantes ficam como estavam
+type UpdateNotificationPreferencesRequest struct {
+	Preferences []NotificationPreferenceUpdate `json:"preferences" validate:"required,min=1,max=50,dive"`
+}
+
+// Validate update notification preferences request
+func (r *UpdateNotificationPreferencesRequest) Validate() error {
+	return validate.Struct(r)
+}
+
+// NotifyRequest é uma notificação pedida por outro serviço. Data é codificado em
+// JSON e guardado com a notificação.
+type NotifyRequest struct {
+	UserID int64
+	Type   string
+	Title  string
+	Body   string
+	Data   interface{}
+}
+
+// NotificationEmailJobPayload é o payload do job notification.email. O endereço é
+// lido quando o job corre, para que um email alterado entretanto seja respeitado.
+type NotificationEmailJobPayload struct {
+	UserID  int64  `json:"user_id"`
+	Type    string `json:"type"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
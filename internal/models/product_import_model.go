@@ -0,0 +1,71 @@
+package models
+
+import (
+	"time"
+
+	"modress/internal/audit"
+)
+
+// ProductImportRow é uma linha de um ficheiro de importação (CSV ou NDJSON)
+type ProductImportRow struct {
+	Line int `json:"line"`
+	CreateProductRequest
+	// IsActive fica a nil quando o ficheiro não o indica: os produtos novos ficam
+	// ativos e os existentes mantêm o valor que tinham
+	IsActive *bool `json:"is_active,omitempty"`
+	// ParseErrors guarda erros de conversão encontrados ao ler a linha
+	ParseErrors []string `json:"parse_errors,omitempty"`
+}
+
+// ImportRowError descreve os erros de validação de uma linha
+type ImportRowError struct {
+	Line   int      `json:"line"`
+	SKU    string   `json:"sku,omitempty"`
+	Errors []string `json:"errors"`
+}
+
+// ImportResult resume o resultado de uma importação
+type ImportResult struct {
+	DryRun    bool             `json:"dry_run"`
+	Total     int              `json:"total"`
+	Created   int              `json:"created"`
+	Updated   int              `json:"updated"`
+	Failed    int              `json:"failed"`
+	RowErrors []ImportRowError `json:"row_errors"`
+}
+
+const (
+	ImportJobPending   = "pending"
+	ImportJobRunning   = "running"
+	ImportJobCompleted = "completed"
+	ImportJobFailed    = "failed"
+)
+
+// ProductImportJobPayload é o payload do job product.import
+type ProductImportJobPayload struct {
+	StoreID int64              `json:"store_id"`
+	DryRun  bool               `json:"dry_run"`
+	Rows    []ProductImportRow `json:"rows"`
+
+	// Quem pediu a importação, para os eventos de auditoria escritos pelo worker
+	Actor audit.Actor `json:"actor"`
+}
+
+// ImportJob acompanha uma importação assíncrona
+type ImportJob struct {
+	ID         int64         `json:"id"`
+	StoreID    int64         `json:"store_id"`
+	Status     string        `json:"status"`
+	Total      int           `json:"total"`
+	Processed  int           `json:"processed"`
+	Result     *ImportResult `json:"result,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	CreatedAt  time.Time     `json:"created_at"`
+	FinishedAt *time.Time    `json:"finished_at,omitempty"`
+}
+
+// ProductExportColumns são as colunas do CSV de exportação, na mesma ordem
+// aceite pela importação para permitir reimportar o ficheiro
+var ProductExportColumns = []string{
+	"sku", "title", "description", "price", "cost", "barcode", "quantity", "category", "is_active",
+}
@@ -3,6 +3,12 @@
 	import (
 		"time"
 	)
+	// Ordenações da listagem e da pesquisa de produtos
+	const (
+		ProductSortNewest = "newest"
+		ProductSortRating = "rating"
+	)
+
 	// Product models
 	type Product struct {
 		ID          int64     `db:"id" json:"id"`
@@ -16,8 +22,16 @@
 		Quantity    int       `db:"quantity" json:"quantity" validate:"min=0"`
 		IsActive    bool      `db:"is_active" json:"is_active"`
 		Category    *string   `db:"category" json:"category,omitempty" validate:"omitempty,max=100"`
+		Version     int64     `db:"version" json:"version"`
 		CreatedAt   time.Time `db:"created_at" json:"created_at"`
 		UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
+
+		// Média e número das avaliações publicadas, atualizados a cada alteração das avaliações
+		RatingAverage float64 `db:"rating_average" json:"rating_average"`
+		RatingCount   int     `db:"rating_count" json:"rating_count"`
+
+		// Preenchido quando o produto é apagado; fica assim até ser restaurado ou purgado
+		DeletedAt *time.Time `db:"deleted_at" json:"-"`
 	}
 
 	// Validate product struct
@@ -80,6 +94,9 @@
 		Quantity    int       `json:"quantity"`
 		IsActive    bool      `json:"is_active"`
 		Category    *string   `json:"category,omitempty"`
+		RatingAverage float64 `json:"rating_average"`
+		RatingCount   int     `json:"rating_count"`
+		Version     int64     `json:"version"`
 		CreatedAt   time.Time `json:"created_at"`
 		UpdatedAt   time.Time `json:"updated_at"`
 	}
@@ -104,6 +121,9 @@
 			Quantity:    p.Quantity,
 			IsActive:    p.IsActive,
 			Category:    p.Category,
+			RatingAverage: p.RatingAverage,
+			RatingCount:   p.RatingCount,
+			Version:     p.Version,
 			CreatedAt:   p.CreatedAt,
 			UpdatedAt:   p.UpdatedAt,
 		}
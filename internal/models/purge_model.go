@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// PurgeJobPayload é o payload do job records.purge. O limite é calculado quando o
+// job é criado, para que uma nova tentativa apague exatamente os mesmos registos.
+type PurgeJobPayload struct {
+	DeletedBefore time.Time `json:"deleted_before"`
+}
+
+// PurgeResult conta os registos removidos de vez por um job records.purge
+type PurgeResult struct {
+	DeletedBefore time.Time `json:"deleted_before"`
+	Products      int64     `json:"products"`
+	Stores        int64     `json:"stores"`
+	Users         int64     `json:"users"`
+}
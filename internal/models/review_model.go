@@ -0,0 +1,127 @@
+package models
+
+import "time"
+
+// Estados de uma avaliação. Só as publicadas aparecem na listagem e contam para a
+// média do produto; a moderação esconde as que forem denunciadas com razão.
+const (
+	ReviewPublished = "published"
+	ReviewHidden    = "hidden"
+)
+
+// Estados de uma denúncia
+const (
+	ReviewReportPending   = "pending"
+	ReviewReportDismissed = "dismissed"
+	ReviewReportUpheld    = "upheld"
+)
+
+// Ordenações da listagem de avaliações de um produto
+const (
+	ReviewSortNewest  = "newest"
+	ReviewSortHighest = "highest"
+	ReviewSortLowest  = "lowest"
+)
+
+// Decisões da moderação sobre uma avaliação denunciada
+const (
+	ReviewModerationHide    = "hide"
+	ReviewModerationDismiss = "dismiss"
+)
+
+// MaxReviewPhotos limita as fotografias de cada avaliação
+const MaxReviewPhotos = 5
+
+// Review é a avaliação de um utilizador a um produto. VerifiedPurchase virá das
+// encomendas; enquanto não existirem é sempre false.
+type Review struct {
+	ID               int64      `db:"id" json:"id"`
+	ProductID        int64      `db:"product_id" json:"product_id"`
+	UserID           int64      `db:"user_id" json:"user_id"`
+	Author           string     `db:"author" json:"author"`
+	Rating           int        `db:"rating" json:"rating"`
+	Body             string     `db:"body" json:"body"`
+	VerifiedPurchase bool       `db:"verified_purchase" json:"verified_purchase"`
+	Status           string     `db:"status" json:"status"`
+	Reply            *string    `db:"reply" json:"reply,omitempty"`
+	RepliedAt        *time.Time `db:"replied_at" json:"replied_at,omitempty"`
+	CreatedAt        time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt        time.Time  `db:"updated_at" json:"updated_at"`
+
+	Photos []ReviewPhoto `db:"-" json:"photos"`
+}
+
+// ReviewPhoto é uma fotografia de uma avaliação, guardada com as imagens dos produtos
+type ReviewPhoto struct {
+	ID        int64     `db:"id" json:"id"`
+	ReviewID  int64     `db:"review_id" json:"review_id"`
+	URL       string    `db:"url" json:"url"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+type CreateReviewRequest struct {
+	Rating int    `json:"rating" validate:"required,min=1,max=5"`
+	Body   string `json:"body" validate:"max=5000"`
+}
+
+// Validate create review request
+func (r *CreateReviewRequest) Validate() error {
+	return validate.Struct(r)
+}
+
+type UpdateReviewRequest struct {
+	Rating *int    `json:"rating,omitempty" validate:"omitempty,min=1,max=5"`
+	Body   *string `json:"body,omitempty" validate:"omitempty,max=5000"`
+}
+
+// Validate update review request
+func (r *UpdateReviewRequest) Validate() error {
+	return validate.Struct(r)
+}
+
+// ReplyReviewRequest é a resposta da loja a uma avaliação; uma nova substitui a anterior
+type ReplyReviewRequest struct {
+	Body string `json:"body" validate:"required,max=2000"`
+}
+
+// Validate reply review request
+func (r *ReplyReviewRequest) Validate() error {
+	return validate.Struct(r)
+}
+
+// ReviewReport é a denúncia de uma avaliação por um utilizador
+type ReviewReport struct {
+	ID         int64      `db:"id" json:"id"`
+	ReviewID   int64      `db:"review_id" json:"review_id"`
+	ReporterID int64      `db:"reporter_id" json:"reporter_id"`
+	Reason     string     `db:"reason" json:"reason"`
+	Details    *string    `db:"details" json:"details,omitempty"`
+	Status     string     `db:"status" json:"status"`
+	ResolvedBy *int64     `db:"resolved_by" json:"resolved_by,omitempty"`
+	ResolvedAt *time.Time `db:"resolved_at" json:"resolved_at,omitempty"`
+	CreatedAt  time.Time  `db:"created_at" json:"created_at"`
+
+	// Review é a avaliação denunciada, na listagem da moderação
+	Review *Review `db:"-" json:"review,omitempty"`
+}
+
+type ReportReviewRequest struct {
+	Reason  string  `json:"reason" validate:"required,oneof=spam offensive off_topic fake other"`
+	Details *string `json:"details,omitempty" validate:"omitempty,max=1000"`
+}
+
+// Validate report review request
+func (r *ReportReviewRequest) Validate() error {
+	return validate.Struct(r)
+}
+
+// ModerateReviewRequest decide as denúncias pendentes de uma avaliação: hide dá-lhes
+// razão e esconde a avaliação, dismiss rejeita-as e volta a publicá-la
+type ModerateReviewRequest struct {
+	Action string `json:"action" validate:"required,oneof=hide dismiss"`
+}
+
+// Validate moderate review request
+func (r *ModerateReviewRequest) Validate() error {
+	return validate.Struct(r)
+}
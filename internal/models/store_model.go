@@ -3,6 +3,8 @@ package models
 import (
 	"strings"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 type Store struct {
@@ -14,8 +16,18 @@ type Store struct {
 	LogoURL     *string   `db:"logo_url" json:"logo_url,omitempty" validate:"omitempty,url"`
 	BannerURL   *string   `db:"banner_url" json:"banner_url,omitempty" validate:"omitempty,url"`
 	IsApproved  bool      `db:"is_approved" json:"is_approved"`
+	Version     int64     `db:"version" json:"version"`
 	CreatedAt   time.Time `db:"created_at" json:"created_at"`
 	UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
+
+	// Média e número das avaliações publicadas dos produtos da loja, e número de
+	// seguidores; atualizados a cada alteração
+	RatingAverage float64 `db:"rating_average" json:"rating_average"`
+	RatingCount   int     `db:"rating_count" json:"rating_count"`
+	FollowerCount int     `db:"follower_count" json:"follower_count"`
+
+	// Preenchido quando a loja é apagada; os produtos são apagados com ela
+	DeletedAt *time.Time `db:"deleted_at" json:"-"`
 }
 
 // Validate store struct
@@ -62,30 +74,68 @@ func (r *UpdateStoreRequest) Validate() error {
 }
 
 type StoreResponse struct {
-	ID          int64     `json:"id"`
-	OwnerID     int64     `json:"owner_id"`
-	Name        string    `json:"name"`
-	Slug        string    `json:"slug"`
-	Description *string   `json:"description,omitempty"`
-	LogoURL     *string   `json:"logo_url,omitempty"`
-	BannerURL   *string   `json:"banner_url,omitempty"`
-	IsApproved  bool      `json:"is_approved"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID            int64     `json:"id"`
+	OwnerID       int64     `json:"owner_id"`
+	Name          string    `json:"name"`
+	Slug          string    `json:"slug"`
+	Description   *string   `json:"description,omitempty"`
+	LogoURL       *string   `json:"logo_url,omitempty"`
+	BannerURL     *string   `json:"banner_url,omitempty"`
+	IsApproved    bool      `json:"is_approved"`
+	RatingAverage float64   `json:"rating_average"`
+	RatingCount   int       `json:"rating_count"`
+	FollowerCount int       `json:"follower_count"`
+	Version       int64     `json:"version"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
 }
 
 // ToResponse converte Store para StoreResponse
 func (s *Store) ToResponse() StoreResponse {
 	return StoreResponse{
-		ID:          s.ID,
-		OwnerID:     s.OwnerID,
-		Name:        s.Name,
-		Slug:        s.Slug,
-		Description: s.Description,
-		LogoURL:     s.LogoURL,
-		BannerURL:   s.BannerURL,
-		IsApproved:  s.IsApproved,
-		CreatedAt:   s.CreatedAt,
-		UpdatedAt:   s.UpdatedAt,
+		ID:            s.ID,
+		OwnerID:       s.OwnerID,
+		Name:          s.Name,
+		Slug:          s.Slug,
+		Description:   s.Description,
+		LogoURL:       s.LogoURL,
+		BannerURL:     s.BannerURL,
+		IsApproved:    s.IsApproved,
+		RatingAverage: s.RatingAverage,
+		RatingCount:   s.RatingCount,
+		FollowerCount: s.FollowerCount,
+		Version:       s.Version,
+		CreatedAt:     s.CreatedAt,
+		UpdatedAt:     s.UpdatedAt,
 	}
 }
+
+// StoreProfile é a página pública da loja: os dados da loja e números calculados
+// no momento, que não contam para a versão
+type StoreProfile struct {
+	StoreResponse
+	StoreStats
+	ResponseStats SellerResponseStats `json:"response_stats"`
+}
+
+// StoreStats conta os produtos visíveis da loja e as categorias em que os tem
+type StoreStats struct {
+	ProductCount int            `db:"product_count" json:"product_count"`
+	Categories   pq.StringArray `db:"categories" json:"categories"`
+	// MemberSince é a data de registo do dono da loja
+	MemberSince time.Time `db:"member_since" json:"member_since"`
+}
+
+// SellerResponseStats mede, nas conversas dos últimos WindowDays dias, quantas vezes
+// o vendedor respondeu aos compradores e quanto tempo demorou. Cada sequência de
+// mensagens seguidas do comprador conta uma vez, a partir da primeira.
+type SellerResponseStats struct {
+	WindowDays int `json:"window_days"`
+	// Received é o número de sequências de mensagens dos compradores, Answered as que
+	// tiveram resposta
+	Received     int     `db:"received" json:"received"`
+	Answered     int     `db:"answered" json:"answered"`
+	ResponseRate float64 `db:"-" json:"response_rate"`
+	// MedianResponseSeconds é nil sem respostas
+	MedianResponseSeconds *int64 `db:"median_response_seconds" json:"median_response_seconds"`
+}
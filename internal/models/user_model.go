@@ -1,6 +1,7 @@
 package models
 
 import (
+	"log/slog"
 	"time"
 	"github.com/go-playground/validator/v10"
 )
@@ -10,13 +11,34 @@ var validate = validator.New()
 type User struct {
 	ID           int64     `db:"id" json:"id"`
 	Username     string    `db:"username" json:"username" validate:"required,alphanum,min=3,max=100"`
-	Email        string    `db:"email" json:"email" validate:"required,email,max=255"`
-	Phone        *string   `db:"phone" json:"phone,omitempty" validate:"omitempty,e164"`
+	Email        string    `db:"email" json:"email" validate:"required,email,max=255" audit:"redact"`
+	Phone        *string   `db:"phone" json:"phone,omitempty" validate:"omitempty,e164" audit:"redact"`
 	PasswordHash string    `db:"password_hash" json:"-"`
 	Role         string    `db:"role" json:"role" validate:"omitempty,oneof=buyer seller admin supplier"`
 	Status       string    `db:"status" json:"status" validate:"omitempty,oneof=active suspended banned"`
 	CreatedAt    time.Time `db:"created_at" json:"created_at"`
 	UpdatedAt    time.Time `db:"updated_at" json:"updated_at"`
+
+	// Bloqueio após falhas de login seguidas
+	FailedLoginAttempts int        `db:"failed_login_attempts" json:"-"`
+	LockedUntil         *time.Time `db:"locked_until" json:"-"`
+
+	// Preenchido quando a conta é apagada; os dados pessoais são anonimizados nesse momento
+	DeletedAt *time.Time `db:"deleted_at" json:"-"`
+}
+
+// IsLocked indica se a conta está bloqueada por falhas de login no instante now
+func (u *User) IsLocked(now time.Time) bool {
+	return u.LockedUntil != nil && now.Before(*u.LockedUntil)
+}
+
+// LogValue garante que o hash da password e os contactos nunca aparecem nos logs
+func (u User) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Int64("id", u.ID),
+		slog.String("role", u.Role),
+		slog.String("status", u.Status),
+	)
 }
 
 // Validate user struct
@@ -36,6 +58,11 @@ func (r *RegisterRequest) Validate() error {
 	return validate.Struct(r)
 }
 
+// LogValue omite a password
+func (r RegisterRequest) LogValue() slog.Value {
+	return slog.GroupValue(slog.String("username", r.Username))
+}
+
 type LoginRequest struct {
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required"`
@@ -46,6 +73,11 @@ func (l *LoginRequest) Validate() error {
 	return validate.Struct(l)
 }
 
+// LogValue omite a password
+func (l LoginRequest) LogValue() slog.Value {
+	return slog.GroupValue()
+}
+
 type UpdateUserRequest struct {
 	Username *string `json:"username" validate:"omitempty,alphanum,min=3,max=100"`
 	Email    *string `json:"email" validate:"omitempty,email,max=255"`
@@ -0,0 +1,111 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Eventos enviados aos webhooks das lojas
+const (
+	WebhookEventProductCreated = "product.created"
+	WebhookEventProductUpdated = "product.updated"
+	WebhookEventProductDeleted = "product.deleted"
+	WebhookEventStockChanged   = "stock.changed"
+	WebhookEventStoreApproved  = "store.approved"
+)
+
+// WebhookEvents são os eventos a que um webhook pode subscrever
+var WebhookEvents = []string{
+	WebhookEventProductCreated,
+	WebhookEventProductUpdated,
+	WebhookEventProductDeleted,
+	WebhookEventStockChanged,
+	WebhookEventStoreApproved,
+}
+
+// Estados de uma entrega
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// Webhook é uma subscrição de uma loja. O segredo assina as entregas e só é mostrado
+// quando é criado.
+type Webhook struct {
+	ID        int64          `db:"id" json:"id"`
+	StoreID   int64          `db:"store_id" json:"store_id"`
+	URL       string         `db:"url" json:"url"`
+	Secret    string         `db:"secret" json:"secret,omitempty" audit:"redact"`
+	Events    pq.StringArray `db:"events" json:"events"`
+	IsActive  bool           `db:"is_active" json:"is_active"`
+	CreatedAt time.Time      `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time      `db:"updated_at" json:"updated_at"`
+}
+
+// CreateWebhookRequest cria uma subscrição
+type CreateWebhookRequest struct {
+	URL    string   `json:"url" validate:"required,url,max=2048"`
+	Events []string `json:"events" validate:"required,min=1,max=20,dive,required"`
+}
+
+// Validate create webhook request
+func (r *CreateWebhookRequest) Validate() error {
+	return validate.Struct(r)
+}
+
+// UpdateWebhookRequest altera os campos indicados de uma subscrição
+type UpdateWebhookRequest struct {
+	URL      *string  `json:"url" validate:"omitempty,url,max=2048"`
+	Events   []string `json:"events" validate:"omitempty,min=1,max=20,dive,required"`
+	IsActive *bool    `json:"is_active"`
+}
+
+// Validate update webhook request
+func (r *UpdateWebhookRequest) Validate() error {
+	return validate.Struct(r)
+}
+
+// WebhookDelivery é uma entrega de um evento a um webhook, com o resultado da
+// última tentativa
+type WebhookDelivery struct {
+	ID             int64           `db:"id" json:"id"`
+	WebhookID      int64           `db:"webhook_id" json:"webhook_id"`
+	EventID        string          `db:"event_id" json:"event_id"`
+	EventType      string          `db:"event_type" json:"event_type"`
+	Payload        json.RawMessage `db:"payload" json:"payload"`
+	Status         string          `db:"status" json:"status"`
+	Attempts       int             `db:"attempts" json:"attempts"`
+	ResponseStatus *int            `db:"response_status" json:"response_status,omitempty"`
+	ResponseBody   *string         `db:"response_body" json:"response_body,omitempty"`
+	Error          *string         `db:"error" json:"error,omitempty"`
+	DurationMs     *int64          `db:"duration_ms" json:"duration_ms,omitempty"`
+	RedeliveryOf   *int64          `db:"redelivery_of" json:"redelivery_of,omitempty"`
+	CreatedAt      time.Time       `db:"created_at" json:"created_at"`
+	LastAttemptAt  *time.Time      `db:"last_attempt_at" json:"last_attempt_at,omitempty"`
+	DeliveredAt    *time.Time      `db:"delivered_at" json:"delivered_at,omitempty"`
+}
+
+// WebhookEvent é o corpo enviado ao recetor
+type WebhookEvent struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	StoreID   int64       `json:"store_id"`
+	Data      interface{} `json:"data"`
+}
+
+// StockChange são os dados do evento stock.changed
+type StockChange struct {
+	ProductID        int64   `json:"product_id"`
+	SKU              *string `json:"sku,omitempty"`
+	PreviousQuantity int     `json:"previous_quantity"`
+	Quantity         int     `json:"quantity"`
+}
+
+// WebhookDeliveryJobPayload é o payload do job webhook.deliver
+type WebhookDeliveryJobPayload struct {
+	DeliveryID int64 `json:"delivery_id"`
+}
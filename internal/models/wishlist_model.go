@@ -0,0 +1,126 @@
+package models
+
+import "time"
+
+// MaxWishlistsPerUser e MaxWishlistItems limitam as listas de cada utilizador e os
+// produtos de cada lista
+const (
+	MaxWishlistsPerUser = 20
+	MaxWishlistItems    = 200
+)
+
+// Alertas enviados a quem guardou um produto numa lista
+const (
+	WishlistAlertPriceDrop   = "price_drop"
+	WishlistAlertBackInStock = "back_in_stock"
+)
+
+// Wishlist é uma lista de produtos guardados por um utilizador, como "Desejos" ou
+// "Guardados para depois". Só as públicas podem ser vistas pelo link de partilha.
+type Wishlist struct {
+	ID         int64     `db:"id" json:"id"`
+	UserID     int64     `db:"user_id" json:"user_id"`
+	Owner      string    `db:"owner" json:"owner"`
+	Name       string    `db:"name" json:"name"`
+	IsPublic   bool      `db:"is_public" json:"is_public"`
+	ShareToken *string   `db:"share_token" json:"share_token,omitempty"`
+	ItemCount  int       `db:"item_count" json:"item_count"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt  time.Time `db:"updated_at" json:"updated_at"`
+
+	Items []WishlistItem `db:"-" json:"items,omitempty"`
+}
+
+// WishlistItem é um produto guardado numa lista, com o preço que tinha quando foi
+// guardado
+type WishlistItem struct {
+	WishlistID      int64     `db:"wishlist_id" json:"wishlist_id"`
+	ProductID       int64     `db:"product_id" json:"product_id"`
+	PriceCentsAtAdd int       `db:"price_cents_at_add" json:"-"`
+	CreatedAt       time.Time `db:"created_at" json:"added_at"`
+
+	PriceAtAdd float64          `db:"-" json:"price_at_add"`
+	Product    *ProductResponse `db:"-" json:"product,omitempty"`
+}
+
+// SharedWishlist é a vista pública de uma lista partilhada: sem o ID da lista, o
+// token nem nenhum identificador ou nome do dono
+type SharedWishlist struct {
+	Name      string               `json:"name"`
+	ItemCount int                  `json:"item_count"`
+	UpdatedAt time.Time            `json:"updated_at"`
+	Items     []SharedWishlistItem `json:"items"`
+}
+
+type SharedWishlistItem struct {
+	ProductID  int64            `json:"product_id"`
+	AddedAt    time.Time        `json:"added_at"`
+	PriceAtAdd float64          `json:"price_at_add"`
+	Product    *ProductResponse `json:"product,omitempty"`
+}
+
+// ToShared devolve a vista pública da lista, com os produtos já carregados
+func (w *Wishlist) ToShared() *SharedWishlist {
+	shared := &SharedWishlist{
+		Name:      w.Name,
+		ItemCount: w.ItemCount,
+		UpdatedAt: w.UpdatedAt,
+		Items:     make([]SharedWishlistItem, len(w.Items)),
+	}
+	for i, item := range w.Items {
+		shared.Items[i] = SharedWishlistItem{
+			ProductID:  item.ProductID,
+			AddedAt:    item.CreatedAt,
+			PriceAtAdd: item.PriceAtAdd,
+			Product:    item.Product,
+		}
+	}
+	return shared
+}
+
+type CreateWishlistRequest struct {
+	Name     string `json:"name" validate:"required,max=100"`
+	IsPublic bool   `json:"is_public"`
+}
+
+// Validate create wishlist request
+func (r *CreateWishlistRequest) Validate() error {
+	return validate.Struct(r)
+}
+
+type UpdateWishlistRequest struct {
+	Name     *string `json:"name,omitempty" validate:"omitempty,min=1,max=100"`
+	IsPublic *bool   `json:"is_public,omitempty"`
+}
+
+// Validate update wishlist request
+func (r *UpdateWishlistRequest) Validate() error {
+	return validate.Struct(r)
+}
+
+type AddWishlistItemRequest struct {
+	ProductID int64 `json:"product_id" validate:"required,min=1"`
+}
+
+// Validate add wishlist item request
+func (r *AddWishlistItemRequest) Validate() error {
+	return validate.Struct(r)
+}
+
+// MoveWishlistItemRequest passa um produto para outra lista do mesmo utilizador
+type MoveWishlistItemRequest struct {
+	WishlistID int64 `json:"wishlist_id" validate:"required,min=1"`
+}
+
+// Validate move wishlist item request
+func (r *MoveWishlistItemRequest) Validate() error {
+	return validate.Struct(r)
+}
+
+// WishlistAlertJobPayload é o payload do job wishlist.alert. O produto é lido quando
+// o job corre, e o alerta só segue se a descida de preço ou o stock se mantiverem.
+type WishlistAlertJobPayload struct {
+	ProductID          int64  `json:"product_id"`
+	Alert              string `json:"alert"`
+	PreviousPriceCents int    `json:"previous_price_cents"`
+}
@@ -0,0 +1,65 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// MemoryStore guarda os baldes no processo. Os limites não são partilhados entre
+// instâncias e perdem-se num restart.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst)}
+		s.buckets[key] = b
+	} else {
+		b.tokens = refill(b.tokens, now.Sub(b.updated), limit)
+	}
+	b.updated = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	return newResult(limit, b.tokens, allowed), nil
+}
+
+func (s *MemoryStore) Sweep(ctx context.Context, idle time.Duration) (int64, error) {
+	cutoff := s.now().Add(-idle)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var removed int64
+	for key, b := range s.buckets {
+		if b.updated.Before(cutoff) {
+			delete(s.buckets, key)
+			removed++
+		}
+	}
+	return removed, nil
+}
@@ -0,0 +1,53 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"modress/internal/database"
+)
+
+// PostgresStore guarda os baldes na tabela rate_limit_buckets, partilhada por todas
+// as instâncias. Cada pedido é um único upsert: o refill e o consumo são calculados
+// na base de dados com o relógio dela, pelo que não há corridas entre instâncias
+// nem dependência da hora de cada máquina.
+type PostgresStore struct {
+	db *database.DB
+}
+
+func NewPostgresStore(db *database.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	// As expressões do SET veem os valores antigos da linha, por isso "allowed"
+	// é calculado com os tokens de antes do pedido
+	query := `
+	INSERT INTO rate_limit_buckets AS b (key, tokens, allowed, updated_at)
+	VALUES ($1, $2::float8 - 1, TRUE, NOW())
+	ON CONFLICT (key) DO UPDATE SET
+		tokens = LEAST($2::float8, b.tokens + EXTRACT(EPOCH FROM NOW() - b.updated_at) * $3::float8)
+			- CASE WHEN LEAST($2::float8, b.tokens + EXTRACT(EPOCH FROM NOW() - b.updated_at) * $3::float8) >= 1 THEN 1 ELSE 0 END,
+		allowed = LEAST($2::float8, b.tokens + EXTRACT(EPOCH FROM NOW() - b.updated_at) * $3::float8) >= 1,
+		updated_at = NOW()
+	RETURNING tokens, allowed`
+
+	var row struct {
+		Tokens  float64 `db:"tokens"`
+		Allowed bool    `db:"allowed"`
+	}
+	if err := s.db.GetContext(ctx, &row, query, key, limit.Burst, limit.Rate); err != nil {
+		return Result{}, fmt.Errorf("error taking rate limit token: %w", err)
+	}
+	return newResult(limit, row.Tokens, row.Allowed), nil
+}
+
+func (s *PostgresStore) Sweep(ctx context.Context, idle time.Duration) (int64, error) {
+	query := `DELETE FROM rate_limit_buckets WHERE updated_at < NOW() - $1::float8 * INTERVAL '1 second'`
+	result, err := s.db.ExecContext(ctx, query, idle.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("error sweeping rate limit buckets: %w", err)
+	}
+	return result.RowsAffected()
+}
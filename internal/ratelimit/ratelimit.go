@@ -0,0 +1,86 @@
+// Package ratelimit implementa limites do tipo token bucket: cada chave (um IP, um
+// utilizador) tem um balde com capacidade Burst que se enche a Rate tokens por
+// segundo, e cada pedido gasta um token.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Limit define a capacidade do balde e a velocidade a que se enche
+type Limit struct {
+	Rate  float64 // tokens por segundo
+	Burst int     // capacidade máxima
+}
+
+// PerMinute devolve um limite de n pedidos por minuto com a rajada indicada
+func PerMinute(n, burst int) Limit {
+	return Limit{Rate: float64(n) / 60, Burst: burst}
+}
+
+// Result descreve o estado do balde depois de um pedido
+type Result struct {
+	Allowed    bool
+	Limit      int           // capacidade do balde
+	Remaining  int           // tokens inteiros que ainda restam
+	Reset      time.Duration // tempo até o balde voltar a estar cheio
+	RetryAfter time.Duration // tempo até haver um token, quando o pedido foi recusado
+}
+
+// Store guarda os baldes. A memória serve para uma instância; com várias
+// instâncias atrás de um balanceador é preciso um store partilhado (Postgres).
+type Store interface {
+	// Take tira um token do balde key, criando-o cheio se ainda não existir
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+	// Sweep apaga os baldes sem pedidos há mais de idle
+	Sweep(ctx context.Context, idle time.Duration) (int64, error)
+}
+
+// refill devolve os tokens do balde depois de elapsed sem pedidos
+func refill(tokens float64, elapsed time.Duration, limit Limit) float64 {
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	return math.Min(float64(limit.Burst), tokens+elapsed.Seconds()*limit.Rate)
+}
+
+// newResult calcula os cabeçalhos a partir dos tokens que ficaram no balde
+func newResult(limit Limit, tokens float64, allowed bool) Result {
+	r := Result{
+		Allowed:   allowed,
+		Limit:     limit.Burst,
+		Remaining: int(math.Max(0, math.Floor(tokens))),
+		Reset:     seconds((float64(limit.Burst) - tokens) / limit.Rate),
+	}
+	if !allowed {
+		r.RetryAfter = seconds((1 - tokens) / limit.Rate)
+	}
+	return r
+}
+
+func seconds(s float64) time.Duration {
+	if s <= 0 || math.IsInf(s, 0) || math.IsNaN(s) {
+		return 0
+	}
+	return time.Duration(s * float64(time.Second))
+}
+
+// RunSweeper apaga periodicamente os baldes parados até ctx ser cancelado. Um balde
+// parado há mais de uma hora já está cheio, que é o mesmo que não existir.
+func RunSweeper(ctx context.Context, store Store, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := store.Sweep(ctx, time.Hour); err != nil && ctx.Err() == nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"modress/internal/database"
+	"modress/internal/models"
+	"time"
+)
+
+// AuditRepository interface
+type AuditRepository interface {
+	Create(ctx context.Context, event *models.AuditEvent) error
+	List(ctx context.Context, filter models.AuditFilter) ([]models.AuditEvent, error)
+}
+
+type auditRepo struct {
+	db *database.DB
+}
+
+func NewAuditRepository(db *database.DB) AuditRepository {
+	return &auditRepo{db: db}
+}
+
+func (r *auditRepo) Create(ctx context.Context, event *models.AuditEvent) error {
+	query := `
+	INSERT INTO audit_events (
+		actor_id, actor_role, ip, request_id, action, entity_type, entity_id, changes
+	) VALUES (
+		:actor_id, :actor_role, :ip, :request_id, :action, :entity_type, :entity_id, :changes
+	)
+	RETURNING id, created_at`
+
+	return r.db.NamedGetContext(ctx, event, query, event)
+}
+
+func (r *auditRepo) List(ctx context.Context, filter models.AuditFilter) ([]models.AuditEvent, error) {
+	offset := (filter.Page - 1) * filter.Limit
+	query := `
+	SELECT * FROM audit_events
+	WHERE ($1::bigint = 0 OR actor_id = $1)
+	AND ($2 = '' OR entity_type = $2)
+	AND ($3::bigint = 0 OR entity_id = $3)
+	AND ($4 = '' OR action = $4)
+	AND ($5::timestamptz IS NULL OR created_at >= $5)
+	AND ($6::timestamptz IS NULL OR created_at < $6)
+	ORDER BY created_at DESC, id DESC
+	LIMIT $7 OFFSET $8`
+
+	var events []models.AuditEvent
+	err := r.db.SelectContext(ctx, &events, query,
+		filter.ActorID, filter.EntityType, filter.EntityID, filter.Action,
+		nullTime(filter.From), nullTime(filter.To), filter.Limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("error listing audit events: %w", err)
+	}
+
+	return events, nil
+}
+
+// nullTime converte o instante zero em NULL
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,273 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"modress/internal/database"
+	"modress/internal/models"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ChatRepository interface
+type ChatRepository interface {
+	// FindOrCreateConversation devolve a conversa do comprador com a loja, criando-a
+	// se ainda não existir; created indica se foi criada agora
+	FindOrCreateConversation(ctx context.Context, buyerID, storeID int64) (conversation *models.Conversation, created bool, err error)
+	FindConversationByID(ctx context.Context, id int64) (*models.Conversation, error)
+	ListConversations(ctx context.Context, userID int64, page, limit int) ([]models.ConversationSummary, error)
+	// CreateMessage guarda a mensagem e atualiza o last_message_at da conversa
+	CreateMessage(ctx context.Context, message *models.Message) error
+	// ListMessages devolve as mensagens da conversa com ID menor que beforeID (0 para
+	// as mais recentes), da mais recente para a mais antiga
+	ListMessages(ctx context.Context, conversationID, beforeID int64, limit int) ([]models.Message, error)
+	ListUndelivered(ctx context.Context, recipientID int64, limit int) ([]models.Message, error)
+	// MarkDelivered marca como entregues as mensagens ids do destinatário que ainda não
+	// o estavam, e devolve-as
+	MarkDelivered(ctx context.Context, recipientID int64, ids []int64) ([]models.Message, error)
+	// MarkRead marca como lidas as mensagens recebidas na conversa até upToID (0 para
+	// todas) e devolve quantas mudaram e o maior ID marcado
+	MarkRead(ctx context.Context, conversationID, recipientID, upToID int64) (count int64, maxID int64, err error)
+	CountUnread(ctx context.Context, recipientID int64) (int64, error)
+	// ResponseStats mede as respostas da loja às mensagens dos compradores enviadas desde since
+	ResponseStats(ctx context.Context, storeID int64, since time.Time) (*models.SellerResponseStats, error)
+
+	// ListPresenceWatchers devolve quem pode ver a presença de userID: quem tem uma
+	// conversa com ele e, se ele tiver uma loja, quem a segue
+	ListPresenceWatchers(ctx context.Context, userID int64) ([]int64, error)
+	// FilterPresenceVisible devolve os de userIDs cuja presença viewerID pode ver,
+	// pela mesma regra
+	FilterPresenceVisible(ctx context.Context, viewerID int64, userIDs []int64) ([]int64, error)
+}
+
+type chatRepo struct {
+	db *database.DB
+}
+
+func NewChatRepository(db *database.DB) ChatRepository {
+	return &chatRepo{db: db}
+}
+
+func (r *chatRepo) FindOrCreateConversation(ctx context.Context, buyerID, storeID int64) (*models.Conversation, bool, error) {
+	query := `
+	INSERT INTO conversations (buyer_id, store_id)
+	VALUES ($1, $2)
+	ON CONFLICT (buyer_id, store_id) DO NOTHING
+	RETURNING *`
+
+	var conversation models.Conversation
+	err := r.db.GetContext(ctx, &conversation, query, buyerID, storeID)
+	if err == nil {
+		return &conversation, true, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, false, err
+	}
+
+	// Já existia: o ON CONFLICT não devolve a linha
+	query = `SELECT * FROM conversations WHERE buyer_id = $1 AND store_id = $2`
+	if err := r.db.GetContext(ctx, &conversation, query, buyerID, storeID); err != nil {
+		return nil, false, err
+	}
+	return &conversation, false, nil
+}
+
+func (r *chatRepo) FindConversationByID(ctx context.Context, id int64) (*models.Conversation, error) {
+	query := `SELECT * FROM conversations WHERE id = $1`
+	var conversation models.Conversation
+	err := r.db.GetContext(ctx, &conversation, query, id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &conversation, err
+}
+
+func (r *chatRepo) ListConversations(ctx context.Context, userID int64, page, limit int) ([]models.ConversationSummary, error) {
+	offset := (page - 1) * limit
+	query := `
+	SELECT c.*,
+		u.username AS buyer_name,
+		s.name AS store_name,
+		s.owner_id AS seller_id,
+		(SELECT m.content FROM messages m
+			WHERE m.conversation_id = c.id
+			ORDER BY m.id DESC LIMIT 1) AS last_message,
+		(SELECT COUNT(*) FROM messages m
+			WHERE m.conversation_id = c.id AND m.recipient_id = $1 AND m.read_at IS NULL) AS unread_count
+	FROM conversations c
+	JOIN users u ON u.id = c.buyer_id
+	JOIN stores s ON s.id = c.store_id
+	WHERE c.buyer_id = $1 OR s.owner_id = $1
+	ORDER BY COALESCE(c.last_message_at, c.created_at) DESC, c.id DESC
+	LIMIT $2 OFFSET $3`
+
+	var conversations []models.ConversationSummary
+	err := r.db.SelectContext(ctx, &conversations, query, userID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("error listing conversations: %w", err)
+	}
+
+	return conversations, nil
+}
+
+func (r *chatRepo) CreateMessage(ctx context.Context, message *models.Message) error {
+	query := `
+	WITH inserted AS (
+		INSERT INTO messages (conversation_id, sender_id, recipient_id, content, created_at)
+		VALUES (:conversation_id, :sender_id, :recipient_id, :content, :created_at)
+		RETURNING id, created_at
+	), touched AS (
+		UPDATE conversations SET last_message_at = (SELECT created_at FROM inserted)
+		WHERE id = :conversation_id
+	)
+	SELECT id FROM inserted`
+
+	return r.db.NamedGetContext(ctx, &message.ID, query, message)
+}
+
+func (r *chatRepo) ListMessages(ctx context.Context, conversationID, beforeID int64, limit int) ([]models.Message, error) {
+	query := `
+	SELECT * FROM messages
+	WHERE conversation_id = $1
+	AND ($2::bigint = 0 OR id < $2)
+	ORDER BY id DESC
+	LIMIT $3`
+
+	var messages []models.Message
+	err := r.db.SelectContext(ctx, &messages, query, conversationID, beforeID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error listing messages: %w", err)
+	}
+
+	return messages, nil
+}
+
+func (r *chatRepo) ListUndelivered(ctx context.Context, recipientID int64, limit int) ([]models.Message, error) {
+	query := `
+	SELECT * FROM messages
+	WHERE recipient_id = $1 AND delivered_at IS NULL
+	ORDER BY id
+	LIMIT $2`
+
+	var messages []models.Message
+	err := r.db.SelectContext(ctx, &messages, query, recipientID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error listing undelivered messages: %w", err)
+	}
+
+	return messages, nil
+}
+
+func (r *chatRepo) MarkDelivered(ctx context.Context, recipientID int64, ids []int64) ([]models.Message, error) {
+	query := `
+	UPDATE messages SET delivered_at = $3
+	WHERE recipient_id = $1 AND id = ANY($2) AND delivered_at IS NULL
+	RETURNING *`
+
+	var messages []models.Message
+	err := r.db.SelectContext(ctx, &messages, query, recipientID, pq.Array(ids), time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("error marking messages delivered: %w", err)
+	}
+
+	return messages, nil
+}
+
+func (r *chatRepo) MarkRead(ctx context.Context, conversationID, recipientID, upToID int64) (int64, int64, error) {
+	// Uma mensagem lida também foi entregue, mesmo que o recibo de entrega se tenha perdido
+	query := `
+	WITH updated AS (
+		UPDATE messages SET read_at = NOW(), delivered_at = COALESCE(delivered_at, NOW())
+		WHERE conversation_id = $1 AND recipient_id = $2 AND read_at IS NULL
+		AND ($3::bigint = 0 OR id <= $3)
+		RETURNING id
+	)
+	SELECT COUNT(*) AS count, COALESCE(MAX(id), 0) AS max_id FROM updated`
+
+	var result struct {
+		Count int64 `db:"count"`
+		MaxID int64 `db:"max_id"`
+	}
+	if err := r.db.GetContext(ctx, &result, query, conversationID, recipientID, upToID); err != nil {
+		return 0, 0, fmt.Errorf("error marking messages read: %w", err)
+	}
+
+	return result.Count, result.MaxID, nil
+}
+
+func (r *chatRepo) CountUnread(ctx context.Context, recipientID int64) (int64, error) {
+	query := `SELECT COUNT(*) FROM messages WHERE recipient_id = $1 AND read_at IS NULL`
+	var count int64
+	if err := r.db.GetContext(ctx, &count, query, recipientID); err != nil {
+		return 0, fmt.Errorf("error counting unread messages: %w", err)
+	}
+	return count, nil
+}
+
+// ResponseStats agrupa as mensagens seguidas do comprador numa só pergunta, a partir
+// da primeira, e mede o tempo até à mensagem seguinte da loja na mesma conversa. As
+// perguntas ainda sem resposta contam como recebidas mas não entram na mediana.
+func (r *chatRepo) ResponseStats(ctx context.Context, storeID int64, since time.Time) (*models.SellerResponseStats, error) {
+	query := `
+	WITH recent AS (
+		SELECT m.conversation_id, m.created_at, m.sender_id = c.buyer_id AS from_buyer,
+			LAG(m.sender_id = c.buyer_id) OVER (PARTITION BY m.conversation_id ORDER BY m.id) AS previous_from_buyer
+		FROM messages m JOIN conversations c ON c.id = m.conversation_id
+		WHERE c.store_id = $1 AND m.created_at >= $2
+	), questions AS (
+		SELECT q.created_at AS asked_at,
+			(SELECT MIN(a.created_at) FROM recent a
+			 WHERE a.conversation_id = q.conversation_id AND NOT a.from_buyer AND a.created_at >= q.created_at) AS answered_at
+		FROM recent q
+		WHERE q.from_buyer AND q.previous_from_buyer IS DISTINCT FROM TRUE
+	)
+	SELECT
+		COUNT(*) AS received,
+		COUNT(answered_at) AS answered,
+		ROUND(PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY EXTRACT(EPOCH FROM answered_at - asked_at)))::BIGINT AS median_response_seconds
+	FROM questions`
+
+	var stats models.SellerResponseStats
+	if err := r.db.GetContext(ctx, &stats, query, storeID, since); err != nil {
+		return nil, fmt.Errorf("error computing response stats: %w", err)
+	}
+	return &stats, nil
+}
+
+func (r *chatRepo) ListPresenceWatchers(ctx context.Context, userID int64) ([]int64, error) {
+	query := `
+	SELECT s.owner_id FROM conversations c JOIN stores s ON s.id = c.store_id
+	WHERE c.buyer_id = $1
+	UNION
+	SELECT c.buyer_id FROM conversations c JOIN stores s ON s.id = c.store_id
+	WHERE s.owner_id = $1
+	UNION
+	SELECT f.user_id FROM store_followers f JOIN stores s ON s.id = f.store_id
+	WHERE s.owner_id = $1 AND s.deleted_at IS NULL`
+
+	var userIDs []int64
+	if err := r.db.SelectContext(ctx, &userIDs, query, userID); err != nil {
+		return nil, fmt.Errorf("error listing presence watchers: %w", err)
+	}
+	return userIDs, nil
+}
+
+func (r *chatRepo) FilterPresenceVisible(ctx context.Context, viewerID int64, userIDs []int64) ([]int64, error) {
+	query := `
+	SELECT s.owner_id FROM conversations c JOIN stores s ON s.id = c.store_id
+	WHERE c.buyer_id = $1 AND s.owner_id = ANY($2)
+	UNION
+	SELECT c.buyer_id FROM conversations c JOIN stores s ON s.id = c.store_id
+	WHERE s.owner_id = $1 AND c.buyer_id = ANY($2)
+	UNION
+	SELECT s.owner_id FROM store_followers f JOIN stores s ON s.id = f.store_id
+	WHERE f.user_id = $1 AND s.owner_id = ANY($2) AND s.deleted_at IS NULL`
+
+	var visible []int64
+	if err := r.db.SelectContext(ctx, &visible, query, viewerID, pq.Array(userIDs)); err != nil {
+		return nil, fmt.Errorf("error filtering presence: %w", err)
+	}
+	return visible, nil
+}
@@ -0,0 +1,186 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"modress/internal/database"
+	"modress/internal/models"
+)
+
+// CouponRepository interface
+type CouponRepository interface {
+	// Create devolve sql.ErrNoRows se o código já existir
+	Create(ctx context.Context, coupon *models.Coupon) error
+	FindByID(ctx context.Context, id int64) (*models.Coupon, error)
+	FindByCode(ctx context.Context, code string) (*models.Coupon, error)
+	// ListByStore devolve os cupões da loja; storeID 0 devolve os do marketplace
+	ListByStore(ctx context.Context, storeID int64, page, limit int) ([]models.Coupon, error)
+	Update(ctx context.Context, coupon *models.Coupon) error
+	// Delete só apaga cupões que nunca foram usados e devolve false nos outros
+	Delete(ctx context.Context, id int64) (bool, error)
+
+	CountUserRedemptions(ctx context.Context, couponID, userID int64) (int, error)
+	// Redeem regista a utilização com a linha do cupão bloqueada. check recebe o cupão
+	// e as utilizações do utilizador já com as utilizações concorrentes contadas; se
+	// devolver erro nada é registado e o erro é devolvido tal como está.
+	Redeem(ctx context.Context, redemption *models.CouponRedemption, check func(coupon *models.Coupon, userRedemptions int) error) error
+	ListRedemptions(ctx context.Context, couponID int64, page, limit int) ([]models.CouponRedemption, error)
+}
+
+type couponRepo struct {
+	db *database.DB
+}
+
+func NewCouponRepository(db *database.DB) CouponRepository {
+	return &couponRepo{db: db}
+}
+
+func (r *couponRepo) Create(ctx context.Context, coupon *models.Coupon) error {
+	query := `
+	INSERT INTO coupons (
+		store_id, code, description, percent_off, amount_off_cents, min_order_cents,
+		valid_from, valid_until, max_redemptions, max_redemptions_per_user, is_active, created_by
+	) VALUES (
+		:store_id, :code, :description, :percent_off, :amount_off_cents, :min_order_cents,
+		:valid_from, :valid_until, :max_redemptions, :max_redemptions_per_user, :is_active, :created_by
+	)
+	ON CONFLICT (code) DO NOTHING
+	RETURNING id, redemption_count, created_at, updated_at`
+
+	return r.db.NamedGetContext(ctx, coupon, query, coupon)
+}
+
+func (r *couponRepo) FindByID(ctx context.Context, id int64) (*models.Coupon, error) {
+	return r.findOne(ctx, `SELECT * FROM coupons WHERE id = $1`, id)
+}
+
+func (r *couponRepo) FindByCode(ctx context.Context, code string) (*models.Coupon, error) {
+	return r.findOne(ctx, `SELECT * FROM coupons WHERE code = $1`, code)
+}
+
+func (r *couponRepo) findOne(ctx context.Context, query string, args ...interface{}) (*models.Coupon, error) {
+	var coupon models.Coupon
+	err := r.db.GetContext(ctx, &coupon, query, args...)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &coupon, err
+}
+
+func (r *couponRepo) ListByStore(ctx context.Context, storeID int64, page, limit int) ([]models.Coupon, error) {
+	offset := (page - 1) * limit
+	query := `
+	SELECT * FROM coupons
+	WHERE COALESCE(store_id, 0) = $1
+	ORDER BY id DESC
+	LIMIT $2 OFFSET $3`
+
+	var coupons []models.Coupon
+	if err := r.db.SelectContext(ctx, &coupons, query, storeID, limit, offset); err != nil {
+		return nil, fmt.Errorf("error listing coupons: %w", err)
+	}
+	return coupons, nil
+}
+
+func (r *couponRepo) Update(ctx context.Context, coupon *models.Coupon) error {
+	query := `
+	UPDATE coupons SET
+		description = :description, min_order_cents = :min_order_cents,
+		valid_from = :valid_from, valid_until = :valid_until,
+		max_redemptions = :max_redemptions, max_redemptions_per_user = :max_redemptions_per_user,
+		is_active = :is_active, updated_at = NOW()
+	WHERE id = :id
+	RETURNING redemption_count, updated_at`
+
+	err := r.db.NamedGetContext(ctx, coupon, query, coupon)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("error updating coupon: %w", err)
+	}
+	return err
+}
+
+func (r *couponRepo) Delete(ctx context.Context, id int64) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM coupons WHERE id = $1 AND redemption_count = 0`, id)
+	if err != nil {
+		return false, fmt.Errorf("error deleting coupon: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error checking rows affected: %w", err)
+	}
+	return rowsAffected > 0, nil
+}
+
+func (r *couponRepo) CountUserRedemptions(ctx context.Context, couponID, userID int64) (int, error) {
+	query := `SELECT COUNT(*) FROM coupon_redemptions WHERE coupon_id = $1 AND user_id = $2`
+	var count int
+	if err := r.db.GetContext(ctx, &count, query, couponID, userID); err != nil {
+		return 0, fmt.Errorf("error counting coupon redemptions: %w", err)
+	}
+	return count, nil
+}
+
+func (r *couponRepo) Redeem(ctx context.Context, redemption *models.CouponRedemption, check func(coupon *models.Coupon, userRedemptions int) error) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting redemption transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// O FOR UPDATE serializa as utilizações do mesmo cupão: quem chega depois espera
+	// e lê as contagens já com a utilização anterior, por isso os limites não são
+	// ultrapassados mesmo com pedidos em simultâneo
+	var coupon models.Coupon
+	if err := tx.GetContext(ctx, &coupon, `SELECT * FROM coupons WHERE id = $1 FOR UPDATE`, *redemption.CouponID); err != nil {
+		if err == sql.ErrNoRows {
+			return err
+		}
+		return fmt.Errorf("error locking coupon: %w", err)
+	}
+
+	var userRedemptions int
+	query := `SELECT COUNT(*) FROM coupon_redemptions WHERE coupon_id = $1 AND user_id = $2`
+	if err := tx.GetContext(ctx, &userRedemptions, query, coupon.ID, redemption.UserID); err != nil {
+		return fmt.Errorf("error counting coupon redemptions: %w", err)
+	}
+	if err := check(&coupon, userRedemptions); err != nil {
+		return err
+	}
+
+	redemption.CouponCode = coupon.Code
+	redemption.StoreID = coupon.StoreID
+	query = `
+	INSERT INTO coupon_redemptions (coupon_id, coupon_code, store_id, user_id, reference, subtotal_cents, discount_cents, lines)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	RETURNING id, created_at`
+	err = tx.QueryRowxContext(ctx, query, coupon.ID, redemption.CouponCode, redemption.StoreID, redemption.UserID,
+		redemption.Reference, redemption.SubtotalCents, redemption.DiscountCents, redemption.Lines).Scan(&redemption.ID, &redemption.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("error creating coupon redemption: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE coupons SET redemption_count = redemption_count + 1 WHERE id = $1`, coupon.ID); err != nil {
+		return fmt.Errorf("error updating coupon redemption count: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing coupon redemption: %w", err)
+	}
+	return nil
+}
+
+func (r *couponRepo) ListRedemptions(ctx context.Context, couponID int64, page, limit int) ([]models.CouponRedemption, error) {
+	offset := (page - 1) * limit
+	query := `
+	SELECT * FROM coupon_redemptions
+	WHERE coupon_id = $1
+	ORDER BY id DESC
+	LIMIT $2 OFFSET $3`
+
+	var redemptions []models.CouponRedemption
+	if err := r.db.SelectContext(ctx, &redemptions, query, couponID, limit, offset); err != nil {
+		return nil, fmt.Errorf("error listing coupon redemptions: %w", err)
+	}
+	return redemptions, nil
+}
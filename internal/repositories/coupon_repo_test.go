@@ -0,0 +1,111 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"modress/internal/models"
+)
+
+// redeemTestCoupon cria um cupão da loja e regista uma utilização por buyerID
+func redeemTestCoupon(t *testing.T, repo CouponRepository, storeID, buyerID int64) (*models.Coupon, *models.CouponRedemption) {
+	t.Helper()
+	ctx := context.Background()
+
+	percentOff := 10
+	coupon := &models.Coupon{
+		StoreID:    &storeID,
+		Code:       uniqueName("C"),
+		PercentOff: &percentOff,
+		IsActive:   true,
+	}
+	if err := repo.Create(ctx, coupon); err != nil {
+		t.Fatalf("creating coupon: %v", err)
+	}
+
+	redemption := &models.CouponRedemption{
+		CouponID:      &coupon.ID,
+		UserID:        buyerID,
+		SubtotalCents: 1000,
+		DiscountCents: 100,
+		Lines:         json.RawMessage(`[]`),
+	}
+	err := repo.Redeem(ctx, redemption, func(*models.Coupon, int) error { return nil })
+	if err != nil {
+		t.Fatalf("redeeming coupon: %v", err)
+	}
+	return coupon, redemption
+}
+
+func assertRedemptionKept(t *testing.T, repo *couponRepo, redemption *models.CouponRedemption, code string, storeID int64) {
+	t.Helper()
+
+	var kept models.CouponRedemption
+	err := repo.db.GetContext(context.Background(), &kept, `SELECT * FROM coupon_redemptions WHERE id = $1`, redemption.ID)
+	if err != nil {
+		t.Fatalf("reading redemption after purge: %v", err)
+	}
+	if kept.CouponID != nil {
+		t.Errorf("coupon_id = %d, want NULL", *kept.CouponID)
+	}
+	if kept.CouponCode != code {
+		t.Errorf("coupon_code = %q, want %q", kept.CouponCode, code)
+	}
+	if kept.StoreID == nil || *kept.StoreID != storeID {
+		t.Errorf("store_id = %v, want %d", kept.StoreID, storeID)
+	}
+}
+
+func TestStorePurgeKeepsCouponRedemptions(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	couponRepo := NewCouponRepository(db).(*couponRepo)
+	storeRepo := NewStoreRepository(db)
+
+	storeID := insertTestStore(t, db, insertTestUser(t, db))
+	coupon, redemption := redeemTestCoupon(t, couponRepo, storeID, insertTestUser(t, db))
+
+	if _, err := db.ExecContext(ctx, `UPDATE stores SET deleted_at = NOW() - INTERVAL '1 day' WHERE id = $1`, storeID); err != nil {
+		t.Fatalf("deleting store: %v", err)
+	}
+	if _, err := storeRepo.PurgeDeleted(ctx, time.Now()); err != nil {
+		t.Fatalf("PurgeDeleted: %v", err)
+	}
+
+	var stores int
+	if err := db.GetContext(ctx, &stores, `SELECT COUNT(*) FROM stores WHERE id = $1`, storeID); err != nil {
+		t.Fatalf("counting stores: %v", err)
+	}
+	if stores != 0 {
+		t.Fatal("store with a redeemed coupon was not purged")
+	}
+	assertRedemptionKept(t, couponRepo, redemption, coupon.Code, storeID)
+}
+
+func TestUserPurgeKeepsCouponRedemptions(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	couponRepo := NewCouponRepository(db).(*couponRepo)
+	userRepo := NewUserRepository(db)
+
+	ownerID := insertTestUser(t, db)
+	storeID := insertTestStore(t, db, ownerID)
+	coupon, redemption := redeemTestCoupon(t, couponRepo, storeID, insertTestUser(t, db))
+
+	// A loja apagada fica para trás e é removida em cascata com a conta do dono
+	_, err := db.ExecContext(ctx, `UPDATE stores SET deleted_at = NOW() WHERE id = $1`, storeID)
+	if err != nil {
+		t.Fatalf("deleting store: %v", err)
+	}
+	_, err = db.ExecContext(ctx, `UPDATE users SET deleted_at = NOW() - INTERVAL '1 day' WHERE id = $1`, ownerID)
+	if err != nil {
+		t.Fatalf("deleting user: %v", err)
+	}
+	if _, err := userRepo.PurgeDeleted(ctx, time.Now()); err != nil {
+		t.Fatalf("PurgeDeleted: %v", err)
+	}
+
+	assertRedemptionKept(t, couponRepo, redemption, coupon.Code, storeID)
+}
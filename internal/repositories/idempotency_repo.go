@@ -0,0 +1,118 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"modress/internal/database"
+	"modress/internal/models"
+)
+
+// IdempotencyRepository interface
+type IdempotencyRepository interface {
+	Acquire(ctx context.Context, record *models.IdempotencyKey) (bool, *models.IdempotencyKey, error)
+	// Complete e Release só mexem na chave enquanto estiver reservada com lockToken;
+	// Complete devolve sql.ErrNoRows se outro pedido já ficou com ela
+	Complete(ctx context.Context, userID int64, key, lockToken string, response models.StoredResponse) error
+	Release(ctx context.Context, userID int64, key, lockToken string) error
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+type idempotencyRepo struct {
+	db *database.DB
+}
+
+func NewIdempotencyRepository(db *database.DB) IdempotencyRepository {
+	return &idempotencyRepo{db: db}
+}
+
+// Acquire reserva a chave para este pedido. Devolve true se a reserva foi feita;
+// caso contrário devolve o registo existente. Registos expirados, ou presos em
+// "processing" depois de locked_until (a instância morreu a meio), são substituídos.
+func (r *idempotencyRepo) Acquire(ctx context.Context, record *models.IdempotencyKey) (bool, *models.IdempotencyKey, error) {
+	query := `
+	INSERT INTO idempotency_keys (
+		user_id, key, method, path, fingerprint, status, locked_until, lock_token, expires_at
+	) VALUES (
+		:user_id, :key, :method, :path, :fingerprint, :status, :locked_until, :lock_token, :expires_at
+	)
+	ON CONFLICT (user_id, key) DO UPDATE SET
+		method = EXCLUDED.method,
+		path = EXCLUDED.path,
+		fingerprint = EXCLUDED.fingerprint,
+		status = EXCLUDED.status,
+		response_status = NULL,
+		response_headers = NULL,
+		response_body = NULL,
+		locked_until = EXCLUDED.locked_until,
+		lock_token = EXCLUDED.lock_token,
+		created_at = NOW(),
+		expires_at = EXCLUDED.expires_at
+	WHERE idempotency_keys.expires_at < NOW()
+		OR (idempotency_keys.status = 'processing' AND idempotency_keys.locked_until < NOW())
+	RETURNING created_at`
+
+	err := r.db.NamedGetContext(ctx, &record.CreatedAt, query, record)
+	if err == nil {
+		return true, nil, nil
+	}
+	if err != sql.ErrNoRows {
+		return false, nil, fmt.Errorf("error acquiring idempotency key: %w", err)
+	}
+
+	var existing models.IdempotencyKey
+	err = r.db.GetContext(ctx, &existing, `SELECT * FROM idempotency_keys WHERE user_id = $1 AND key = $2`, record.UserID, record.Key)
+	if err == sql.ErrNoRows {
+		// Apagada entretanto (Release ou limpeza); o cliente pode simplesmente repetir
+		return false, nil, nil
+	}
+	if err != nil {
+		return false, nil, fmt.Errorf("error finding idempotency key: %w", err)
+	}
+	return false, &existing, nil
+}
+
+func (r *idempotencyRepo) Complete(ctx context.Context, userID int64, key, lockToken string, response models.StoredResponse) error {
+	headers, err := json.Marshal(response.Headers)
+	if err != nil {
+		return fmt.Errorf("error encoding response headers: %w", err)
+	}
+
+	query := `
+	UPDATE idempotency_keys SET
+		status = 'completed',
+		response_status = $3,
+		response_headers = $4,
+		response_body = $5
+	WHERE user_id = $1 AND key = $2 AND status = 'processing' AND lock_token = $6`
+
+	result, err := r.db.ExecContext(ctx, query, userID, key, response.Status, headers, response.Body, lockToken)
+	if err != nil {
+		return fmt.Errorf("error completing idempotency key: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *idempotencyRepo) Release(ctx context.Context, userID int64, key, lockToken string) error {
+	query := `DELETE FROM idempotency_keys WHERE user_id = $1 AND key = $2 AND status = 'processing' AND lock_token = $3`
+	if _, err := r.db.ExecContext(ctx, query, userID, key, lockToken); err != nil {
+		return fmt.Errorf("error releasing idempotency key: %w", err)
+	}
+	return nil
+}
+
+func (r *idempotencyRepo) DeleteExpired(ctx context.Context) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at < NOW()`)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting expired idempotency keys: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,61 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"modress/internal/models"
+)
+
+func TestIdempotencyCompleteChecksLockToken(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewIdempotencyRepository(db)
+	ctx := context.Background()
+	userID := insertTestUser(t, db)
+	key := uniqueName("key")
+
+	acquire := func(token string, lockedUntil time.Time) {
+		t.Helper()
+		acquired, _, err := repo.Acquire(ctx, &models.IdempotencyKey{
+			UserID:      userID,
+			Key:         key,
+			Method:      "POST",
+			Path:        "/api/v1/products",
+			Fingerprint: "f",
+			Status:      models.IdempotencyStatusProcessing,
+			LockedUntil: lockedUntil,
+			LockToken:   token,
+			ExpiresAt:   time.Now().Add(time.Hour),
+		})
+		if err != nil || !acquired {
+			t.Fatalf("Acquire(%s) = %v, %v, want acquired", token, acquired, err)
+		}
+	}
+
+	// O primeiro pedido passa do locked_until e uma repetição fica com a chave
+	acquire("slow", time.Now().Add(-time.Second))
+	acquire("retry", time.Now().Add(time.Minute))
+
+	slow := models.StoredResponse{Status: 201, Headers: map[string]string{}, Body: []byte(`{"id":1}`)}
+	if err := repo.Complete(ctx, userID, key, "slow", slow); err != sql.ErrNoRows {
+		t.Fatalf("Complete with the expired lock = %v, want sql.ErrNoRows", err)
+	}
+	if err := repo.Release(ctx, userID, key, "slow"); err != nil {
+		t.Fatal(err)
+	}
+
+	retry := models.StoredResponse{Status: 201, Headers: map[string]string{}, Body: []byte(`{"id":2}`)}
+	if err := repo.Complete(ctx, userID, key, "retry", retry); err != nil {
+		t.Fatalf("Complete with the current lock: %v", err)
+	}
+
+	var body []byte
+	if err := db.GetContext(ctx, &body, `SELECT response_body FROM idempotency_keys WHERE user_id = $1 AND key = $2`, userID, key); err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != `{"id":2}` {
+		t.Fatalf("stored body = %s, want the response of the request holding the lock", body)
+	}
+}
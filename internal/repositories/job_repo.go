@@ -0,0 +1,238 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"modress/internal/database"
+	"modress/internal/models"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// JobRepository interface
+type JobRepository interface {
+	Create(ctx context.Context, job *models.Job) error
+	FindByID(ctx context.Context, id int64) (*models.Job, error)
+	List(ctx context.Context, filter models.JobFilter) ([]models.Job, error)
+	ClaimNext(ctx context.Context, workerID string, types []string) (*models.Job, error)
+	// MarkSucceeded, MarkFailed, UpdateProgress e Heartbeat só alteram o job enquanto
+	// estiver reservado por workerID e devolvem sql.ErrNoRows depois de o perder
+	MarkSucceeded(ctx context.Context, id int64, workerID string, result []byte) error
+	MarkFailed(ctx context.Context, id int64, workerID, errMsg string, retryAt *time.Time) error
+	Requeue(ctx context.Context, id int64, workerID, errMsg string) error
+	UpdateProgress(ctx context.Context, id int64, workerID string, progress, total int) error
+	Heartbeat(ctx context.Context, id int64, workerID string) error
+	Retry(ctx context.Context, id int64) error
+	ReleaseStale(ctx context.Context, lockedBefore time.Time) (int64, error)
+}
+
+type jobRepo struct {
+	db *database.DB
+}
+
+func NewJobRepository(db *database.DB) JobRepository {
+	return &jobRepo{db: db}
+}
+
+func (r *jobRepo) Create(ctx context.Context, job *models.Job) error {
+	query := `
+	INSERT INTO jobs (
+		type, payload, status, max_attempts, run_at, created_at, updated_at
+	) VALUES (
+		:type, :payload, :status, :max_attempts, :run_at, :created_at, :updated_at
+	)
+	RETURNING id`
+
+	return r.db.NamedGetContext(ctx, &job.ID, query, job)
+}
+
+func (r *jobRepo) FindByID(ctx context.Context, id int64) (*models.Job, error) {
+	query := `SELECT * FROM jobs WHERE id = $1`
+	var job models.Job
+	err := r.db.GetContext(ctx, &job, query, id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &job, err
+}
+
+func (r *jobRepo) List(ctx context.Context, filter models.JobFilter) ([]models.Job, error) {
+	offset := (filter.Page - 1) * filter.Limit
+	query := `
+	SELECT * FROM jobs
+	WHERE ($1 = '' OR status = $1)
+	AND ($2 = '' OR type = $2)
+	ORDER BY created_at DESC
+	LIMIT $3 OFFSET $4`
+
+	var jobs []models.Job
+	err := r.db.SelectContext(ctx, &jobs, query, filter.Status, filter.Type, filter.Limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("error listing jobs: %w", err)
+	}
+
+	return jobs, nil
+}
+
+// ClaimNext reserva o próximo job pronto a correr. SKIP LOCKED permite que vários
+// workers (ou instâncias) consumam a fila sem se bloquearem uns aos outros.
+func (r *jobRepo) ClaimNext(ctx context.Context, workerID string, types []string) (*models.Job, error) {
+	query := `
+	UPDATE jobs SET
+		status = 'running',
+		attempts = attempts + 1,
+		locked_at = NOW(),
+		locked_by = $1,
+		updated_at = NOW()
+	WHERE id = (
+		SELECT id FROM jobs
+		WHERE status = 'pending' AND run_at <= NOW() AND type = ANY($2)
+		ORDER BY run_at, id
+		FOR UPDATE SKIP LOCKED
+		LIMIT 1
+	)
+	RETURNING *`
+
+	var job models.Job
+	err := r.db.GetContext(ctx, &job, query, workerID, pq.Array(types))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error claiming job: %w", err)
+	}
+
+	return &job, nil
+}
+
+func (r *jobRepo) MarkSucceeded(ctx context.Context, id int64, workerID string, result []byte) error {
+	query := `
+	UPDATE jobs SET
+		status = 'succeeded',
+		result = $2,
+		last_error = NULL,
+		locked_at = NULL,
+		locked_by = NULL,
+		finished_at = NOW(),
+		updated_at = NOW()
+	WHERE id = $1 AND locked_by = $3`
+
+	var resultArg interface{}
+	if result != nil {
+		resultArg = result
+	}
+
+	return r.execOne(ctx, "error marking job succeeded", query, id, resultArg, workerID)
+}
+
+// MarkFailed reagenda o job para retryAt ou, se retryAt for nil, move-o para o estado dead
+func (r *jobRepo) MarkFailed(ctx context.Context, id int64, workerID, errMsg string, retryAt *time.Time) error {
+	if retryAt == nil {
+		query := `
+		UPDATE jobs SET
+			status = 'dead',
+			last_error = $2,
+			locked_at = NULL,
+			locked_by = NULL,
+			finished_at = NOW(),
+			updated_at = NOW()
+		WHERE id = $1 AND locked_by = $3`
+		return r.execOne(ctx, "error marking job dead", query, id, errMsg, workerID)
+	}
+
+	query := `
+	UPDATE jobs SET
+		status = 'pending',
+		last_error = $2,
+		run_at = $3,
+		locked_at = NULL,
+		locked_by = NULL,
+		updated_at = NOW()
+	WHERE id = $1 AND locked_by = $4`
+	return r.execOne(ctx, "error rescheduling job", query, id, errMsg, *retryAt, workerID)
+}
+
+// Requeue devolve à fila um job interrompido sem culpa própria (no shutdown do worker),
+// desfazendo a tentativa contada pelo ClaimNext
+func (r *jobRepo) Requeue(ctx context.Context, id int64, workerID, errMsg string) error {
+	query := `
+	UPDATE jobs SET
+		status = 'pending',
+		attempts = GREATEST(attempts - 1, 0),
+		last_error = $2,
+		run_at = NOW(),
+		locked_at = NULL,
+		locked_by = NULL,
+		updated_at = NOW()
+	WHERE id = $1 AND locked_by = $3`
+	return r.execOne(ctx, "error requeuing job", query, id, errMsg, workerID)
+}
+
+// UpdateProgress também renova o locked_at, tal como o Heartbeat
+func (r *jobRepo) UpdateProgress(ctx context.Context, id int64, workerID string, progress, total int) error {
+	query := `
+	UPDATE jobs SET progress = $3, total = $4, locked_at = NOW(), updated_at = NOW()
+	WHERE id = $1 AND locked_by = $2`
+	return r.execOne(ctx, "error updating job progress", query, id, workerID, progress, total)
+}
+
+// Heartbeat renova o locked_at de um job em execução para que o ReleaseStale não o
+// tome por abandonado enquanto o worker continua vivo
+func (r *jobRepo) Heartbeat(ctx context.Context, id int64, workerID string) error {
+	query := `UPDATE jobs SET locked_at = NOW() WHERE id = $1 AND locked_by = $2`
+	return r.execOne(ctx, "error renewing job lock", query, id, workerID)
+}
+
+// Retry volta a colocar na fila um job dead (ou pendente) para correr imediatamente
+func (r *jobRepo) Retry(ctx context.Context, id int64) error {
+	query := `
+	UPDATE jobs SET
+		status = 'pending',
+		attempts = 0,
+		run_at = NOW(),
+		finished_at = NULL,
+		updated_at = NOW()
+	WHERE id = $1 AND status IN ('dead', 'pending')`
+	return r.execOne(ctx, "error retrying job", query, id)
+}
+
+// ReleaseStale devolve à fila jobs presos em running por workers que morreram. Os que
+// já gastaram todas as tentativas passam a dead, como se a última tivesse falhado.
+func (r *jobRepo) ReleaseStale(ctx context.Context, lockedBefore time.Time) (int64, error) {
+	query := `
+	UPDATE jobs SET
+		status = CASE WHEN attempts >= max_attempts THEN 'dead' ELSE 'pending' END,
+		last_error = 'job lock expired on worker ' || locked_by,
+		finished_at = CASE WHEN attempts >= max_attempts THEN NOW() END,
+		locked_at = NULL,
+		locked_by = NULL,
+		updated_at = NOW()
+	WHERE status = 'running' AND locked_at < $1`
+
+	result, err := r.db.ExecContext(ctx, query, lockedBefore)
+	if err != nil {
+		return 0, fmt.Errorf("error releasing stale jobs: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+func (r *jobRepo) execOne(ctx context.Context, errPrefix, query string, args ...interface{}) error {
+	result, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errPrefix, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
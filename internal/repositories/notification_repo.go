@@ -0,0 +1,125 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"modress/internal/database"
+	"modress/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// NotificationRepository interface
+type NotificationRepository interface {
+	Create(ctx context.Context, notification *models.Notification) error
+	// List devolve as notificações do utilizador, da mais recente para a mais antiga
+	List(ctx context.Context, userID int64, unreadOnly bool, page, limit int) ([]models.Notification, error)
+	CountUnread(ctx context.Context, userID int64) (int64, error)
+	// MarkRead marca a notificação como lida e devolve-a; nil se não for do utilizador
+	MarkRead(ctx context.Context, userID, id int64) (*models.Notification, error)
+	MarkAllRead(ctx context.Context, userID int64) (int64, error)
+	// GetPreferences devolve só as preferências que o utilizador alterou
+	GetPreferences(ctx context.Context, userID int64) ([]models.NotificationPreference, error)
+	UpsertPreferences(ctx context.Context, userID int64, preferences []models.NotificationPreference) error
+}
+
+type notificationRepo struct {
+	db *database.DB
+}
+
+func NewNotificationRepository(db *database.DB) NotificationRepository {
+	return &notificationRepo{db: db}
+}
+
+func (r *notificationRepo) Create(ctx context.Context, notification *models.Notification) error {
+	query := `
+	INSERT INTO notifications (user_id, type, title, body, data)
+	VALUES (:user_id, :type, :title, :body, :data)
+	RETURNING id, created_at`
+
+	return r.db.NamedGetContext(ctx, notification, query, notification)
+}
+
+func (r *notificationRepo) List(ctx context.Context, userID int64, unreadOnly bool, page, limit int) ([]models.Notification, error) {
+	offset := (page - 1) * limit
+	query := `
+	SELECT * FROM notifications
+	WHERE user_id = $1 AND (NOT $2 OR read_at IS NULL)
+	ORDER BY id DESC
+	LIMIT $3 OFFSET $4`
+
+	var notifications []models.Notification
+	err := r.db.SelectContext(ctx, &notifications, query, userID, unreadOnly, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("error listing notifications: %w", err)
+	}
+
+	return notifications, nil
+}
+
+func (r *notificationRepo) CountUnread(ctx context.Context, userID int64) (int64, error) {
+	query := `SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL`
+	var count int64
+	if err := r.db.GetContext(ctx, &count, query, userID); err != nil {
+		return 0, fmt.Errorf("error counting unread notifications: %w", err)
+	}
+	return count, nil
+}
+
+func (r *notificationRepo) MarkRead(ctx context.Context, userID, id int64) (*models.Notification, error) {
+	// Uma notificação já lida mantém a hora da primeira leitura
+	query := `
+	UPDATE notifications SET read_at = COALESCE(read_at, NOW())
+	WHERE id = $1 AND user_id = $2
+	RETURNING *`
+
+	var notification models.Notification
+	err := r.db.GetContext(ctx, &notification, query, id, userID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error marking notification read: %w", err)
+	}
+	return &notification, nil
+}
+
+func (r *notificationRepo) MarkAllRead(ctx context.Context, userID int64) (int64, error) {
+	query := `UPDATE notifications SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL`
+	result, err := r.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return 0, fmt.Errorf("error marking notifications read: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+func (r *notificationRepo) GetPreferences(ctx context.Context, userID int64) ([]models.NotificationPreference, error) {
+	query := `SELECT type, in_app, email FROM notification_preferences WHERE user_id = $1`
+	var preferences []models.NotificationPreference
+	if err := r.db.SelectContext(ctx, &preferences, query, userID); err != nil {
+		return nil, fmt.Errorf("error listing notification preferences: %w", err)
+	}
+	return preferences, nil
+}
+
+func (r *notificationRepo) UpsertPreferences(ctx context.Context, userID int64, preferences []models.NotificationPreference) error {
+	types := make([]string, len(preferences))
+	inApp := make([]bool, len(preferences))
+	email := make([]bool, len(preferences))
+	for i, preference := range preferences {
+		types[i], inApp[i], email[i] = preference.Type, preference.InApp, preference.Email
+	}
+
+	query := `
+	INSERT INTO notification_preferences (user_id, type, in_app, email)
+	SELECT $1, p.type, p.in_app, p.email
+	FROM unnest($2::varchar[], $3::boolean[], $4::boolean[]) AS p(type, in_app, email)
+	ON CONFLICT (user_id, type) DO UPDATE SET in_app = EXCLUDED.in_app, email = EXCLUDED.email`
+
+	_, err := r.db.ExecContext(ctx, query, userID, pq.Array(types), pq.Array(inApp), pq.Array(email))
+	if err != nil {
+		return fmt.Errorf("error saving notification preferences: %w", err)
+	}
+	return nil
+}
@@ -3,33 +3,53 @@ package repositories
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"modress/internal/database"
 	"modress/internal/models"
+	"time"
 
-	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
+// ErrDuplicateSKU é devolvido por Create, Update e Restore quando outro produto não
+// apagado da loja já tem o mesmo SKU
+var ErrDuplicateSKU = errors.New("sku already used by another product of the store")
+
 // ProductRepository interface
 type ProductRepository interface {
 	Create(ctx context.Context, product *models.Product) error
 	FindByID(ctx context.Context, id int64) (*models.Product, error)
+	FindByIDIncludingDeleted(ctx context.Context, id int64) (*models.Product, error)
+	FindByIDs(ctx context.Context, ids []int64) ([]models.Product, error)
 	FindByStoreID(ctx context.Context, storeID int64, page, limit int) ([]models.Product, error)
 	FindByCategory(ctx context.Context, category string, page, limit int) ([]models.Product, error)
 	Update(ctx context.Context, product *models.Product) error
-	Delete(ctx context.Context, id int64) error
-	List(ctx context.Context, page, limit int) ([]models.Product, error)
-	Search(ctx context.Context, query string, page, limit int) ([]models.Product, error)
-	UpdateQuantity(ctx context.Context, id int64, quantity int) error
+	Delete(ctx context.Context, id, version int64) error
+	Restore(ctx context.Context, product *models.Product) error
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
+	List(ctx context.Context, sort string, page, limit int) ([]models.Product, error)
+	Search(ctx context.Context, query, sort string, page, limit int) ([]models.Product, error)
+	UpdateQuantity(ctx context.Context, id int64, quantity int, version int64) error
 	CreateImage(ctx context.Context, image *models.ProductImage) error 
 	FindImagesByProductID(ctx context.Context, productID int64) ([]models.ProductImage, error) 
+	FindBySKU(ctx context.Context, storeID int64, sku string) (*models.Product, error)
+	// UpsertBySKU cria o produto ou atualiza o que já tem o seu SKU na loja e devolve
+	// o estado anterior, nil se foi criado. Na atualização is_active só muda com setActive
+	UpsertBySKU(ctx context.Context, product *models.Product, setActive bool) (*models.Product, error)
+	ForEachByStoreID(ctx context.Context, storeID int64, fn func(*models.Product) error) error
+	// RefreshRating devolve a loja do produto, para recalcular também a sua média
+	RefreshRating(ctx context.Context, id int64) (int64, error)
+	// ListFeed devolve os produtos das lojas seguidas pelo utilizador, dos mais recentes para os mais antigos
+	ListFeed(ctx context.Context, userID int64, page, limit int) ([]models.Product, error)
 
 }
 
 type productRepo struct {
-	db *sqlx.DB
+	db *database.DB
 }
 
-func NewProductRepository(db *sqlx.DB) ProductRepository {
+func NewProductRepository(db *database.DB) ProductRepository {
 	return &productRepo{db: db}
 }
 
@@ -44,18 +64,34 @@ func (r *productRepo) Create(ctx context.Context, product *models.Product) error
 		:store_id, :title, :description, :price_cents, :cost_cents, :sku, :barcode,
 		:quantity, :is_active, :category, :created_at, :updated_at
 	)
-	RETURNING id`
+	RETURNING id, version`
 
-	stmt, err := r.db.PrepareNamedContext(ctx, query)
-	if err != nil {
-		return fmt.Errorf("error preparing query: %w", err)
-	}
-	defer stmt.Close()
+	return skuError(r.db.NamedGetContext(ctx, product, query, product))
+}
 
-	return stmt.GetContext(ctx, &product.ID, product)
+// skuError converte a violação do índice único de SKU em ErrDuplicateSKU
+func skuError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "idx_products_store_sku_unique" {
+		return ErrDuplicateSKU
+	}
+	return err
 }
 
+// As consultas ignoram os produtos apagados (deleted_at preenchido), exceto
+// FindByIDIncludingDeleted, usada para os restaurar.
+
 func (r *productRepo) FindByID(ctx context.Context, id int64) (*models.Product, error) {
+	query := `SELECT * FROM products WHERE id = $1 AND deleted_at IS NULL`
+	var product models.Product
+	err := r.db.GetContext(ctx, &product, query, id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &product, err
+}
+
+func (r *productRepo) FindByIDIncludingDeleted(ctx context.Context, id int64) (*models.Product, error) {
 	query := `SELECT * FROM products WHERE id = $1`
 	var product models.Product
 	err := r.db.GetContext(ctx, &product, query, id)
@@ -65,9 +101,18 @@ func (r *productRepo) FindByID(ctx context.Context, id int64) (*models.Product,
 	return &product, err
 }
 
+func (r *productRepo) FindByIDs(ctx context.Context, ids []int64) ([]models.Product, error) {
+	query := `SELECT * FROM products WHERE id = ANY($1) AND deleted_at IS NULL`
+	var products []models.Product
+	if err := r.db.SelectContext(ctx, &products, query, pq.Array(ids)); err != nil {
+		return nil, fmt.Errorf("error finding products: %w", err)
+	}
+	return products, nil
+}
+
 func (r *productRepo) FindByStoreID(ctx context.Context, storeID int64, page, limit int) ([]models.Product, error) {
 	offset := (page - 1) * limit
-	query := `SELECT * FROM products WHERE store_id = $1 ORDER BY created_at DESC LIMIT $2 OFFSET $3`
+	query := `SELECT * FROM products WHERE store_id = $1 AND deleted_at IS NULL ORDER BY created_at DESC LIMIT $2 OFFSET $3`
 
 	var products []models.Product
 	err := r.db.SelectContext(ctx, &products, query, storeID, limit, offset)
@@ -80,7 +125,7 @@ func (r *productRepo) FindByStoreID(ctx context.Context, storeID int64, page, li
 
 func (r *productRepo) FindByCategory(ctx context.Context, category string, page, limit int) ([]models.Product, error) {
 	offset := (page - 1) * limit
-	query := `SELECT * FROM products WHERE category = $1 AND is_active = true ORDER BY created_at DESC LIMIT $2 OFFSET $3`
+	query := `SELECT * FROM products WHERE category = $1 AND is_active = true AND deleted_at IS NULL ORDER BY created_at DESC LIMIT $2 OFFSET $3`
 
 	var products []models.Product
 	err := r.db.SelectContext(ctx, &products, query, category, limit, offset)
@@ -91,6 +136,8 @@ func (r *productRepo) FindByCategory(ctx context.Context, category string, page,
 	return products, nil
 }
 
+// Update só escreve se product.Version ainda for a versão guardada, e incrementa-a.
+// Devolve sql.ErrNoRows se o produto não existir ou tiver sido alterado entretanto.
 func (r *productRepo) Update(ctx context.Context, product *models.Product) error {
 	query := `
 	UPDATE products SET
@@ -103,29 +150,28 @@ func (r *productRepo) Update(ctx context.Context, product *models.Product) error
 		quantity = :quantity,
 		is_active = :is_active,
 		category = :category,
-		updated_at = :updated_at
-	WHERE id = :id`
-
-	result, err := r.db.NamedExecContext(ctx, query, product)
-	if err != nil {
-		return fmt.Errorf("error updating product: %w", err)
+		updated_at = :updated_at,
+		version = version + 1
+	WHERE id = :id AND version = :version AND deleted_at IS NULL
+	RETURNING version`
+
+	err := skuError(r.db.NamedGetContext(ctx, &product.Version, query, product))
+	if err == sql.ErrNoRows || err == ErrDuplicateSKU {
+		return err
 	}
-
-	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("error checking rows affected: %w", err)
-	}
-
-	if rowsAffected == 0 {
-		return sql.ErrNoRows
+		return fmt.Errorf("error updating product: %w", err)
 	}
 
 	return nil
 }
 
-func (r *productRepo) Delete(ctx context.Context, id int64) error {
-	query := `DELETE FROM products WHERE id = $1`
-	result, err := r.db.ExecContext(ctx, query, id)
+// Delete marca o produto como apagado; só o PurgeDeleted o remove de vez
+func (r *productRepo) Delete(ctx context.Context, id, version int64) error {
+	query := `
+	UPDATE products SET deleted_at = NOW(), updated_at = NOW(), version = version + 1
+	WHERE id = $1 AND version = $2 AND deleted_at IS NULL`
+	result, err := r.db.ExecContext(ctx, query, id, version)
 	if err != nil {
 		return fmt.Errorf("error deleting product: %w", err)
 	}
@@ -142,9 +188,22 @@ func (r *productRepo) Delete(ctx context.Context, id int64) error {
 	return nil
 }
 
-func (r *productRepo) List(ctx context.Context, page, limit int) ([]models.Product, error) {
+// productOrder traduz as ordenações aceites na listagem e na pesquisa; o ID desempata
+var productOrder = map[string]string{
+	models.ProductSortNewest: "created_at DESC, id DESC",
+	models.ProductSortRating: "rating_average DESC, rating_count DESC, id DESC",
+}
+
+func productOrderBy(sort string) string {
+	if order, ok := productOrder[sort]; ok {
+		return order
+	}
+	return productOrder[models.ProductSortNewest]
+}
+
+func (r *productRepo) List(ctx context.Context, sort string, page, limit int) ([]models.Product, error) {
 	offset := (page - 1) * limit
-	query := `SELECT * FROM products WHERE is_active = true ORDER BY created_at DESC LIMIT $1 OFFSET $2`
+	query := `SELECT * FROM products WHERE is_active = true AND deleted_at IS NULL ORDER BY ` + productOrderBy(sort) + ` LIMIT $1 OFFSET $2`
 
 	var products []models.Product
 	err := r.db.SelectContext(ctx, &products, query, limit, offset)
@@ -155,13 +214,13 @@ func (r *productRepo) List(ctx context.Context, page, limit int) ([]models.Produ
 	return products, nil
 }
 
-func (r *productRepo) Search(ctx context.Context, searchQuery string, page, limit int) ([]models.Product, error) {
+func (r *productRepo) Search(ctx context.Context, searchQuery, sort string, page, limit int) ([]models.Product, error) {
 	offset := (page - 1) * limit
 	query := `
 	SELECT * FROM products 
-	WHERE is_active = true 
+	WHERE is_active = true AND deleted_at IS NULL
 	AND (title ILIKE '%' || $1 || '%' OR description ILIKE '%' || $1 || '%' OR category ILIKE '%' || $1 || '%')
-	ORDER BY created_at DESC 
+	ORDER BY ` + productOrderBy(sort) + `
 	LIMIT $2 OFFSET $3`
 
 	var products []models.Product
@@ -173,9 +232,9 @@ func (r *productRepo) Search(ctx context.Context, searchQuery string, page, limi
 	return products, nil
 }
 
-func (r *productRepo) UpdateQuantity(ctx context.Context, id int64, quantity int) error {
-	query := `UPDATE products SET quantity = $1, updated_at = NOW() WHERE id = $2`
-	result, err := r.db.ExecContext(ctx, query, quantity, id)
+func (r *productRepo) UpdateQuantity(ctx context.Context, id int64, quantity int, version int64) error {
+	query := `UPDATE products SET quantity = $1, updated_at = NOW(), version = version + 1 WHERE id = $2 AND version = $3 AND deleted_at IS NULL`
+	result, err := r.db.ExecContext(ctx, query, quantity, id, version)
 	if err != nil {
 		return fmt.Errorf("error updating product quantity: %w", err)
 	}
@@ -201,13 +260,7 @@ func (r *productRepo) CreateImage(ctx context.Context, image *models.ProductImag
     )
     RETURNING id`
 
-    stmt, err := r.db.PrepareNamedContext(ctx, query)
-    if err != nil {
-        return fmt.Errorf("error preparing query: %w", err)
-    }
-    defer stmt.Close()
-
-    return stmt.GetContext(ctx, &image.ID, image)
+    return r.db.NamedGetContext(ctx, &image.ID, query, image)
 }
 
 func (r *productRepo) FindImagesByProductID(ctx context.Context, productID int64) ([]models.ProductImage, error) {
@@ -218,4 +271,170 @@ func (r *productRepo) FindImagesByProductID(ctx context.Context, productID int64
         return nil, fmt.Errorf("error finding product images: %w", err)
     }
     return images, nil
-}
\ No newline at end of file
+}
+func (r *productRepo) FindBySKU(ctx context.Context, storeID int64, sku string) (*models.Product, error) {
+	query := `SELECT * FROM products WHERE store_id = $1 AND sku = $2 AND deleted_at IS NULL LIMIT 1`
+	var product models.Product
+	err := r.db.GetContext(ctx, &product, query, storeID, sku)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &product, err
+}
+
+func (r *productRepo) UpsertBySKU(ctx context.Context, product *models.Product, setActive bool) (*models.Product, error) {
+	before, err := r.upsertBySKU(ctx, product, setActive)
+	if err == errSKUCreatedConcurrently {
+		// A segunda leitura já encontra o produto criado pela outra transação
+		before, err = r.upsertBySKU(ctx, product, setActive)
+	}
+	return before, err
+}
+
+// errSKUCreatedConcurrently indica que outra transação criou o mesmo SKU entre a
+// leitura e o INSERT: o ON CONFLICT espera por ela e atualiza a sua linha sem que o
+// estado anterior tenha sido lido, por isso a transação é desfeita e repetida
+var errSKUCreatedConcurrently = errors.New("product created concurrently with the same sku")
+
+func (r *productRepo) upsertBySKU(ctx context.Context, product *models.Product, setActive bool) (*models.Product, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error starting product upsert transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var before *models.Product
+	var existing models.Product
+	query := `SELECT * FROM products WHERE store_id = $1 AND sku = $2 AND deleted_at IS NULL FOR UPDATE`
+	err = tx.GetContext(ctx, &existing, query, product.StoreID, product.SKU)
+	if err == nil {
+		before = &existing
+	} else if err != sql.ErrNoRows {
+		return nil, fmt.Errorf("error locking product by sku: %w", err)
+	}
+
+	// Na atualização mantém-se created_at, e is_active quando a linha não o indica
+	query = `
+	INSERT INTO products (
+		store_id, title, description, price_cents, cost_cents, sku, barcode,
+		quantity, is_active, category, created_at, updated_at
+	) VALUES (
+		$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12
+	)
+	ON CONFLICT (store_id, sku) WHERE deleted_at IS NULL DO UPDATE SET
+		title = EXCLUDED.title,
+		description = EXCLUDED.description,
+		price_cents = EXCLUDED.price_cents,
+		cost_cents = EXCLUDED.cost_cents,
+		barcode = EXCLUDED.barcode,
+		quantity = EXCLUDED.quantity,
+		category = EXCLUDED.category,
+		is_active = CASE WHEN $13 THEN EXCLUDED.is_active ELSE products.is_active END,
+		updated_at = EXCLUDED.updated_at,
+		version = products.version + 1
+	RETURNING *, (xmax = 0) AS created`
+
+	var row struct {
+		models.Product
+		Created bool `db:"created"`
+	}
+	err = tx.GetContext(ctx, &row, query, product.StoreID, product.Title, product.Description, product.PriceCents,
+		product.CostCents, product.SKU, product.Barcode, product.Quantity, product.IsActive, product.Category,
+		product.CreatedAt, product.UpdatedAt, setActive)
+	if err != nil {
+		return nil, fmt.Errorf("error upserting product: %w", err)
+	}
+	if before == nil && !row.Created {
+		return nil, errSKUCreatedConcurrently
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing product upsert: %w", err)
+	}
+	*product = row.Product
+	return before, nil
+}
+
+// ForEachByStoreID percorre todos os produtos da loja sem os carregar todos em memória
+func (r *productRepo) ForEachByStoreID(ctx context.Context, storeID int64, fn func(*models.Product) error) error {
+	query := `SELECT * FROM products WHERE store_id = $1 AND deleted_at IS NULL ORDER BY id`
+	rows, err := r.db.QueryxContext(ctx, query, storeID)
+	if err != nil {
+		return fmt.Errorf("error querying store products: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var product models.Product
+		if err := rows.StructScan(&product); err != nil {
+			return fmt.Errorf("error scanning product: %w", err)
+		}
+		if err := fn(&product); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// Restore volta a tornar visível um produto apagado e atualiza product com a linha restaurada.
+// Devolve sql.ErrNoRows se o produto não existir ou não estiver apagado.
+func (r *productRepo) Restore(ctx context.Context, product *models.Product) error {
+	query := `
+	UPDATE products SET deleted_at = NULL, updated_at = NOW(), version = version + 1
+	WHERE id = $1 AND deleted_at IS NOT NULL
+	RETURNING *`
+
+	err := skuError(r.db.GetContext(ctx, product, query, product.ID))
+	if err == sql.ErrNoRows || err == ErrDuplicateSKU {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("error restoring product: %w", err)
+	}
+	return nil
+}
+
+// PurgeDeleted remove de vez os produtos apagados antes de before
+func (r *productRepo) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM products WHERE deleted_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("error purging deleted products: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+
+// RefreshRating recalcula a média e o número das avaliações publicadas do produto.
+// Não incrementa a versão: a média não é editada pelo lojista, e uma avaliação nova
+// faria falhar com 412 a edição de quem tinha lido o produto antes dela.
+func (r *productRepo) RefreshRating(ctx context.Context, id int64) (int64, error) {
+	query := `
+	UPDATE products SET
+		rating_average = COALESCE((SELECT ROUND(AVG(rating), 2) FROM reviews WHERE product_id = $1 AND status = 'published'), 0),
+		rating_count = (SELECT COUNT(*) FROM reviews WHERE product_id = $1 AND status = 'published')
+	WHERE id = $1
+	RETURNING store_id`
+
+	var storeID int64
+	if err := r.db.GetContext(ctx, &storeID, query, id); err != nil {
+		return 0, fmt.Errorf("error refreshing product rating: %w", err)
+	}
+	return storeID, nil
+}
+
+func (r *productRepo) ListFeed(ctx context.Context, userID int64, page, limit int) ([]models.Product, error) {
+	offset := (page - 1) * limit
+	query := `
+	SELECT p.* FROM products p
+	JOIN store_followers f ON f.store_id = p.store_id
+	WHERE f.user_id = $1 AND p.is_active = true AND p.deleted_at IS NULL
+	ORDER BY p.created_at DESC, p.id DESC
+	LIMIT $2 OFFSET $3`
+
+	var products []models.Product
+	if err := r.db.SelectContext(ctx, &products, query, userID, limit, offset); err != nil {
+		return nil, fmt.Errorf("error listing product feed: %w", err)
+	}
+	return products, nil
+}
@@ -0,0 +1,71 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"modress/internal/database"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+// openTestDB liga-se à base de dados de TEST_DATABASE_URL e aplica as migrações.
+// Sem a variável os testes que precisam do Postgres são ignorados.
+func openTestDB(t *testing.T) *database.DB {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	db, err := sqlx.ConnectContext(ctx, "postgres", url)
+	if err != nil {
+		t.Fatalf("connecting to test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := database.Migrate(ctx, db); err != nil {
+		t.Fatalf("migrating test database: %v", err)
+	}
+	return database.Wrap(db)
+}
+
+// uniqueName devolve um nome que não colide com os de outros testes na mesma base de dados
+func uniqueName(prefix string) string {
+	return fmt.Sprintf("%s%d", prefix, time.Now().UnixNano())
+}
+
+func insertTestUser(t *testing.T, db *database.DB) int64 {
+	t.Helper()
+
+	name := uniqueName("user")
+	var id int64
+	err := db.GetContext(context.Background(), &id, `
+	INSERT INTO users (username, email, password_hash) VALUES ($1, $2, 'x') RETURNING id`,
+		name, name+"@example.com")
+	if err != nil {
+		t.Fatalf("inserting user: %v", err)
+	}
+	return id
+}
+
+func insertTestStore(t *testing.T, db *database.DB, ownerID int64) int64 {
+	t.Helper()
+
+	name := uniqueName("store")
+	var id int64
+	err := db.GetContext(context.Background(), &id, `
+	INSERT INTO stores (owner_id, name, slug) VALUES ($1, $2, $2) RETURNING id`, ownerID, name)
+	if err != nil {
+		t.Fatalf("inserting store: %v", err)
+	}
+	return id
+}
@@ -0,0 +1,228 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"modress/internal/database"
+	"modress/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// ErrPhotoLimit é devolvido por CreatePhoto quando a avaliação já tem o máximo de fotos
+var ErrPhotoLimit = errors.New("review already has the maximum number of photos")
+
+// ReviewRepository interface
+type ReviewRepository interface {
+	// Create devolve sql.ErrNoRows se o utilizador já avaliou o produto
+	Create(ctx context.Context, review *models.Review) error
+	FindByID(ctx context.Context, id int64) (*models.Review, error)
+	FindByIDs(ctx context.Context, ids []int64) ([]models.Review, error)
+	// ListByProduct devolve as avaliações publicadas do produto
+	ListByProduct(ctx context.Context, productID int64, sort string, page, limit int) ([]models.Review, error)
+	Update(ctx context.Context, review *models.Review) error
+	Delete(ctx context.Context, id int64) error
+	// SetReply guarda a resposta da loja; nil apaga-a
+	SetReply(ctx context.Context, review *models.Review) error
+	SetStatus(ctx context.Context, id int64, status string) error
+
+	// CreatePhoto devolve ErrPhotoLimit se a avaliação já tem limit fotos e
+	// sql.ErrNoRows se a avaliação não existe
+	CreatePhoto(ctx context.Context, photo *models.ReviewPhoto, limit int) error
+	ListPhotos(ctx context.Context, reviewIDs []int64) ([]models.ReviewPhoto, error)
+
+	// CreateReport devolve sql.ErrNoRows se o utilizador já denunciou a avaliação
+	CreateReport(ctx context.Context, report *models.ReviewReport) error
+	ListReports(ctx context.Context, status string, page, limit int) ([]models.ReviewReport, error)
+	// ResolveReports fecha as denúncias pendentes da avaliação com o estado indicado
+	ResolveReports(ctx context.Context, reviewID int64, status string, resolvedBy int64) (int64, error)
+}
+
+type reviewRepo struct {
+	db *database.DB
+}
+
+func NewReviewRepository(db *database.DB) ReviewRepository {
+	return &reviewRepo{db: db}
+}
+
+// reviewSelect junta às avaliações o nome de quem as escreveu
+const reviewSelect = `SELECT r.*, u.username AS author FROM reviews r JOIN users u ON u.id = r.user_id`
+
+// reviewOrder traduz as ordenações aceites na listagem; o ID desempata
+var reviewOrder = map[string]string{
+	models.ReviewSortNewest:  "r.created_at DESC, r.id DESC",
+	models.ReviewSortHighest: "r.rating DESC, r.created_at DESC, r.id DESC",
+	models.ReviewSortLowest:  "r.rating ASC, r.created_at DESC, r.id DESC",
+}
+
+func (r *reviewRepo) Create(ctx context.Context, review *models.Review) error {
+	query := `
+	INSERT INTO reviews (product_id, user_id, rating, body, verified_purchase)
+	VALUES (:product_id, :user_id, :rating, :body, :verified_purchase)
+	ON CONFLICT (product_id, user_id) DO NOTHING
+	RETURNING id, status, created_at, updated_at`
+
+	return r.db.NamedGetContext(ctx, review, query, review)
+}
+
+func (r *reviewRepo) FindByID(ctx context.Context, id int64) (*models.Review, error) {
+	query := reviewSelect + ` WHERE r.id = $1`
+	var review models.Review
+	err := r.db.GetContext(ctx, &review, query, id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &review, err
+}
+
+func (r *reviewRepo) FindByIDs(ctx context.Context, ids []int64) ([]models.Review, error) {
+	query := reviewSelect + ` WHERE r.id = ANY($1)`
+	var reviews []models.Review
+	if err := r.db.SelectContext(ctx, &reviews, query, pq.Array(ids)); err != nil {
+		return nil, fmt.Errorf("error finding reviews: %w", err)
+	}
+	return reviews, nil
+}
+
+func (r *reviewRepo) ListByProduct(ctx context.Context, productID int64, sort string, page, limit int) ([]models.Review, error) {
+	order, ok := reviewOrder[sort]
+	if !ok {
+		order = reviewOrder[models.ReviewSortNewest]
+	}
+
+	offset := (page - 1) * limit
+	query := reviewSelect + `
+	WHERE r.product_id = $1 AND r.status = $2
+	ORDER BY ` + order + `
+	LIMIT $3 OFFSET $4`
+
+	var reviews []models.Review
+	err := r.db.SelectContext(ctx, &reviews, query, productID, models.ReviewPublished, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("error listing reviews: %w", err)
+	}
+
+	return reviews, nil
+}
+
+func (r *reviewRepo) Update(ctx context.Context, review *models.Review) error {
+	query := `
+	UPDATE reviews SET rating = :rating, body = :body, updated_at = NOW()
+	WHERE id = :id
+	RETURNING updated_at`
+
+	err := r.db.NamedGetContext(ctx, &review.UpdatedAt, query, review)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("error updating review: %w", err)
+	}
+	return err
+}
+
+func (r *reviewRepo) Delete(ctx context.Context, id int64) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM reviews WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("error deleting review: %w", err)
+	}
+	return nil
+}
+
+func (r *reviewRepo) SetReply(ctx context.Context, review *models.Review) error {
+	query := `
+	UPDATE reviews SET reply = $2, replied_at = CASE WHEN $2::TEXT IS NULL THEN NULL ELSE NOW() END
+	WHERE id = $1
+	RETURNING replied_at`
+
+	err := r.db.GetContext(ctx, &review.RepliedAt, query, review.ID, review.Reply)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("error replying to review: %w", err)
+	}
+	return err
+}
+
+func (r *reviewRepo) SetStatus(ctx context.Context, id int64, status string) error {
+	if _, err := r.db.ExecContext(ctx, `UPDATE reviews SET status = $2 WHERE id = $1`, id, status); err != nil {
+		return fmt.Errorf("error updating review status: %w", err)
+	}
+	return nil
+}
+
+// CreatePhoto bloqueia a avaliação antes de contar as fotos, para que dois envios
+// em simultâneo não passem ambos o limite
+func (r *reviewRepo) CreatePhoto(ctx context.Context, photo *models.ReviewPhoto, limit int) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting review photo transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var reviewID int64
+	if err := tx.GetContext(ctx, &reviewID, `SELECT id FROM reviews WHERE id = $1 FOR UPDATE`, photo.ReviewID); err != nil {
+		return err
+	}
+
+	var count int
+	if err := tx.GetContext(ctx, &count, `SELECT COUNT(*) FROM review_photos WHERE review_id = $1`, photo.ReviewID); err != nil {
+		return fmt.Errorf("error counting review photos: %w", err)
+	}
+	if count >= limit {
+		return ErrPhotoLimit
+	}
+
+	query := `
+	INSERT INTO review_photos (review_id, url)
+	VALUES ($1, $2)
+	RETURNING id, created_at`
+	if err := tx.QueryRowxContext(ctx, query, photo.ReviewID, photo.URL).Scan(&photo.ID, &photo.CreatedAt); err != nil {
+		return fmt.Errorf("error creating review photo: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+func (r *reviewRepo) ListPhotos(ctx context.Context, reviewIDs []int64) ([]models.ReviewPhoto, error) {
+	query := `SELECT * FROM review_photos WHERE review_id = ANY($1) ORDER BY id`
+	var photos []models.ReviewPhoto
+	if err := r.db.SelectContext(ctx, &photos, query, pq.Array(reviewIDs)); err != nil {
+		return nil, fmt.Errorf("error listing review photos: %w", err)
+	}
+	return photos, nil
+}
+
+func (r *reviewRepo) CreateReport(ctx context.Context, report *models.ReviewReport) error {
+	query := `
+	INSERT INTO review_reports (review_id, reporter_id, reason, details)
+	VALUES (:review_id, :reporter_id, :reason, :details)
+	ON CONFLICT (review_id, reporter_id) DO NOTHING
+	RETURNING id, status, created_at`
+
+	return r.db.NamedGetContext(ctx, report, query, report)
+}
+
+func (r *reviewRepo) ListReports(ctx context.Context, status string, page, limit int) ([]models.ReviewReport, error) {
+	offset := (page - 1) * limit
+	query := `
+	SELECT * FROM review_reports
+	WHERE ($1 = '' OR status = $1)
+	ORDER BY id DESC
+	LIMIT $2 OFFSET $3`
+
+	var reports []models.ReviewReport
+	if err := r.db.SelectContext(ctx, &reports, query, status, limit, offset); err != nil {
+		return nil, fmt.Errorf("error listing review reports: %w", err)
+	}
+	return reports, nil
+}
+
+func (r *reviewRepo) ResolveReports(ctx context.Context, reviewID int64, status string, resolvedBy int64) (int64, error) {
+	query := `
+	UPDATE review_reports SET status = $2, resolved_by = $3, resolved_at = NOW()
+	WHERE review_id = $1 AND status = $4`
+
+	result, err := r.db.ExecContext(ctx, query, reviewID, status, resolvedBy, models.ReviewReportPending)
+	if err != nil {
+		return 0, fmt.Errorf("error resolving review reports: %w", err)
+	}
+	return result.RowsAffected()
+}
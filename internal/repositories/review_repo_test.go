@@ -0,0 +1,59 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"modress/internal/models"
+)
+
+func TestCreatePhotoEnforcesLimitUnderConcurrency(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewReviewRepository(db)
+	ctx := context.Background()
+
+	storeID := insertTestStore(t, db, insertTestUser(t, db))
+	var reviewID int64
+	err := db.GetContext(ctx, &reviewID, `
+	WITH product AS (
+		INSERT INTO products (store_id, title, price_cents, quantity) VALUES ($1, 'Linen shirt', 2999, 1) RETURNING id
+	)
+	INSERT INTO reviews (product_id, user_id, rating) SELECT id, $2, 5 FROM product RETURNING id`, storeID, insertTestUser(t, db))
+	if err != nil {
+		t.Fatalf("inserting review: %v", err)
+	}
+
+	// Dez envios em simultâneo para um limite de três: só três fotos ficam guardadas
+	const limit = 3
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- repo.CreatePhoto(ctx, &models.ReviewPhoto{ReviewID: reviewID, URL: "/uploads/photo.jpg"}, limit)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	created := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			created++
+		case !errors.Is(err, ErrPhotoLimit):
+			t.Fatalf("CreatePhoto: %v", err)
+		}
+	}
+
+	var stored int
+	if err := db.GetContext(ctx, &stored, `SELECT COUNT(*) FROM review_photos WHERE review_id = $1`, reviewID); err != nil {
+		t.Fatalf("counting photos: %v", err)
+	}
+	if created != limit || stored != limit {
+		t.Fatalf("created %d and stored %d photos, want %d", created, stored, limit)
+	}
+}
@@ -4,29 +4,41 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"modress/internal/database"
 	"modress/internal/models"
-
-	"github.com/jmoiron/sqlx"
+	"time"
 )
 
 // StoreRepository interface
 type StoreRepository interface {
 	Create(ctx context.Context, store *models.Store) error
 	FindByID(ctx context.Context, id int64) (*models.Store, error)
+	FindByIDIncludingDeleted(ctx context.Context, id int64) (*models.Store, error)
 	FindByOwnerID(ctx context.Context, ownerID int64) (*models.Store, error)
 	FindBySlug(ctx context.Context, slug string) (*models.Store, error)
 	Update(ctx context.Context, store *models.Store) error
-	Delete(ctx context.Context, id int64) error
+	Delete(ctx context.Context, id, version int64) error
+	Restore(ctx context.Context, store *models.Store) error
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
 	List(ctx context.Context, page, limit int) ([]models.Store, error)
 	ListApproved(ctx context.Context, page, limit int) ([]models.Store, error)
 	ApproveStore(ctx context.Context, id int64) error
+	// RefreshRating recalcula a média das avaliações dos produtos da loja
+	RefreshRating(ctx context.Context, id int64) error
+	Stats(ctx context.Context, id int64) (*models.StoreStats, error)
+
+	// Follow e Unfollow devolvem se alguma coisa mudou
+	Follow(ctx context.Context, userID, storeID int64) (bool, error)
+	Unfollow(ctx context.Context, userID, storeID int64) (bool, error)
+	// ListFollowed devolve as lojas seguidas pelo utilizador, das mais recentes para as mais antigas
+	ListFollowed(ctx context.Context, userID int64, page, limit int) ([]models.Store, error)
 }
 
 type storeRepo struct {
-	db *sqlx.DB
+	db *database.DB
 }
 
-func NewStoreRepository(db *sqlx.DB) StoreRepository {
+func NewStoreRepository(db *database.DB) StoreRepository {
 	return &storeRepo{db: db}
 }
 
@@ -37,18 +49,25 @@ func (r *storeRepo) Create(ctx context.Context, store *models.Store) error {
 	) VALUES (
 		:owner_id, :name, :slug, :description, :logo_url, :banner_url, :is_approved, :created_at, :updated_at
 	)
-	RETURNING id`
-
-	stmt, err := r.db.PrepareNamedContext(ctx, query)
-	if err != nil {
-		return fmt.Errorf("error preparing query: %w", err)
-	}
-	defer stmt.Close()
+	RETURNING id, version`
 
-	return stmt.GetContext(ctx, &store.ID, store)
+	return r.db.NamedGetContext(ctx, store, query, store)
 }
 
+// As consultas ignoram as lojas apagadas (deleted_at preenchido), exceto
+// FindByIDIncludingDeleted, usada para as restaurar.
+
 func (r *storeRepo) FindByID(ctx context.Context, id int64) (*models.Store, error) {
+	query := `SELECT * FROM stores WHERE id = $1 AND deleted_at IS NULL`
+	var store models.Store
+	err := r.db.GetContext(ctx, &store, query, id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &store, err
+}
+
+func (r *storeRepo) FindByIDIncludingDeleted(ctx context.Context, id int64) (*models.Store, error) {
 	query := `SELECT * FROM stores WHERE id = $1`
 	var store models.Store
 	err := r.db.GetContext(ctx, &store, query, id)
@@ -59,7 +78,7 @@ func (r *storeRepo) FindByID(ctx context.Context, id int64) (*models.Store, erro
 }
 
 func (r *storeRepo) FindByOwnerID(ctx context.Context, ownerID int64) (*models.Store, error) {
-	query := `SELECT * FROM stores WHERE owner_id = $1`
+	query := `SELECT * FROM stores WHERE owner_id = $1 AND deleted_at IS NULL`
 	var store models.Store
 	err := r.db.GetContext(ctx, &store, query, ownerID)
 	if err == sql.ErrNoRows {
@@ -69,7 +88,7 @@ func (r *storeRepo) FindByOwnerID(ctx context.Context, ownerID int64) (*models.S
 }
 
 func (r *storeRepo) FindBySlug(ctx context.Context, slug string) (*models.Store, error) {
-	query := `SELECT * FROM stores WHERE slug = $1`
+	query := `SELECT * FROM stores WHERE slug = $1 AND deleted_at IS NULL`
 	var store models.Store
 	err := r.db.GetContext(ctx, &store, query, slug)
 	if err == sql.ErrNoRows {
@@ -78,6 +97,8 @@ func (r *storeRepo) FindBySlug(ctx context.Context, slug string) (*models.Store,
 	return &store, err
 }
 
+// Update só escreve se store.Version ainda for a versão guardada, e incrementa-a.
+// Devolve sql.ErrNoRows se a loja não existir ou tiver sido alterada entretanto.
 func (r *storeRepo) Update(ctx context.Context, store *models.Store) error {
 	query := `
 	UPDATE stores SET
@@ -87,48 +108,94 @@ func (r *storeRepo) Update(ctx context.Context, store *models.Store) error {
 		logo_url = :logo_url,
 		banner_url = :banner_url,
 		is_approved = :is_approved,
-		updated_at = :updated_at
-	WHERE id = :id`
+		updated_at = :updated_at,
+		version = version + 1
+	WHERE id = :id AND version = :version AND deleted_at IS NULL
+	RETURNING version`
 
-	result, err := r.db.NamedExecContext(ctx, query, store)
+	err := r.db.NamedGetContext(ctx, &store.Version, query, store)
+	if err == sql.ErrNoRows {
+		return sql.ErrNoRows
+	}
 	if err != nil {
 		return fmt.Errorf("error updating store: %w", err)
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("error checking rows affected: %w", err)
-	}
+	return nil
+}
 
-	if rowsAffected == 0 {
+// Delete marca a loja e os seus produtos como apagados, com o mesmo deleted_at,
+// para que Restore saiba quais produtos trazer de volta
+func (r *storeRepo) Delete(ctx context.Context, id, version int64) error {
+	query := `
+	WITH deleted AS (
+		UPDATE stores SET deleted_at = NOW(), updated_at = NOW(), version = version + 1
+		WHERE id = $1 AND version = $2 AND deleted_at IS NULL
+		RETURNING id
+	), deleted_products AS (
+		UPDATE products SET deleted_at = NOW(), version = version + 1
+		WHERE store_id IN (SELECT id FROM deleted) AND deleted_at IS NULL
+	)
+	SELECT COUNT(*) FROM deleted`
+
+	var deleted int
+	if err := r.db.GetContext(ctx, &deleted, query, id, version); err != nil {
+		return fmt.Errorf("error deleting store: %w", err)
+	}
+	if deleted == 0 {
 		return sql.ErrNoRows
 	}
 
 	return nil
 }
 
-func (r *storeRepo) Delete(ctx context.Context, id int64) error {
-	query := `DELETE FROM stores WHERE id = $1`
-	result, err := r.db.ExecContext(ctx, query, id)
-	if err != nil {
-		return fmt.Errorf("error deleting store: %w", err)
-	}
+// Restore volta a tornar visível uma loja apagada, com store.Slug, e os produtos
+// apagados juntamente com ela; os que já tinham sido apagados antes continuam apagados.
+// Devolve sql.ErrNoRows se a loja não existir ou não estiver apagada.
+func (r *storeRepo) Restore(ctx context.Context, store *models.Store) error {
+	query := `
+	WITH old AS (
+		SELECT id, deleted_at FROM stores
+		WHERE id = $1 AND deleted_at IS NOT NULL
+		FOR UPDATE
+	), restored_products AS (
+		UPDATE products SET deleted_at = NULL, version = version + 1
+		FROM old
+		WHERE products.store_id = old.id AND products.deleted_at = old.deleted_at
+	)
+	UPDATE stores SET deleted_at = NULL, slug = $2, updated_at = NOW(), version = version + 1
+	FROM old
+	WHERE stores.id = old.id
+	RETURNING stores.*`
 
-	rowsAffected, err := result.RowsAffected()
+	err := r.db.GetContext(ctx, store, query, store.ID, store.Slug)
+	if err == sql.ErrNoRows {
+		return sql.ErrNoRows
+	}
 	if err != nil {
-		return fmt.Errorf("error checking rows affected: %w", err)
+		return fmt.Errorf("error restoring store: %w", err)
 	}
+	return nil
+}
 
-	if rowsAffected == 0 {
-		return sql.ErrNoRows
-	}
+// PurgeDeleted remove de vez as lojas apagadas antes de before. Uma loja com
+// produtos ativos é mantida, e os produtos apagados vão com ela (ON DELETE CASCADE).
+func (r *storeRepo) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	query := `
+	DELETE FROM stores
+	WHERE deleted_at < $1
+	AND NOT EXISTS (SELECT 1 FROM products WHERE products.store_id = stores.id AND products.deleted_at IS NULL)`
 
-	return nil
+	result, err := r.db.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("error purging deleted stores: %w", err)
+	}
+	return result.RowsAffected()
 }
 
 func (r *storeRepo) List(ctx context.Context, page, limit int) ([]models.Store, error) {
 	offset := (page - 1) * limit
-	query := `SELECT * FROM stores ORDER BY created_at DESC LIMIT $1 OFFSET $2`
+	query := `SELECT * FROM stores WHERE deleted_at IS NULL ORDER BY created_at DESC LIMIT $1 OFFSET $2`
 
 	var stores []models.Store
 	err := r.db.SelectContext(ctx, &stores, query, limit, offset)
@@ -141,7 +208,7 @@ func (r *storeRepo) List(ctx context.Context, page, limit int) ([]models.Store,
 
 func (r *storeRepo) ListApproved(ctx context.Context, page, limit int) ([]models.Store, error) {
 	offset := (page - 1) * limit
-	query := `SELECT * FROM stores WHERE is_approved = true ORDER BY created_at DESC LIMIT $1 OFFSET $2`
+	query := `SELECT * FROM stores WHERE is_approved = true AND deleted_at IS NULL ORDER BY created_at DESC LIMIT $1 OFFSET $2`
 
 	var stores []models.Store
 	err := r.db.SelectContext(ctx, &stores, query, limit, offset)
@@ -153,7 +220,7 @@ func (r *storeRepo) ListApproved(ctx context.Context, page, limit int) ([]models
 }
 
 func (r *storeRepo) ApproveStore(ctx context.Context, id int64) error {
-	query := `UPDATE stores SET is_approved = true, updated_at = NOW() WHERE id = $1`
+	query := `UPDATE stores SET is_approved = true, updated_at = NOW(), version = version + 1 WHERE id = $1 AND deleted_at IS NULL`
 	result, err := r.db.ExecContext(ctx, query, id)
 	if err != nil {
 		return fmt.Errorf("error approving store: %w", err)
@@ -170,3 +237,101 @@ func (r *storeRepo) ApproveStore(ctx context.Context, id int64) error {
 
 	return nil
 }
+
+// RefreshRating conta as avaliações publicadas de todos os produtos da loja, mesmo dos
+// apagados. Não incrementa a versão, para não fazer falhar com 412 a edição da loja.
+func (r *storeRepo) RefreshRating(ctx context.Context, id int64) error {
+	query := `
+	WITH ratings AS (
+		SELECT ROUND(AVG(r.rating), 2) AS average, COUNT(*) AS count
+		FROM reviews r JOIN products p ON p.id = r.product_id
+		WHERE p.store_id = $1 AND r.status = 'published'
+	)
+	UPDATE stores SET
+		rating_average = COALESCE(ratings.average, 0),
+		rating_count = ratings.count
+	FROM ratings
+	WHERE stores.id = $1`
+	if _, err := r.db.ExecContext(ctx, query, id); err != nil {
+		return fmt.Errorf("error refreshing store rating: %w", err)
+	}
+	return nil
+}
+
+func (r *storeRepo) Stats(ctx context.Context, id int64) (*models.StoreStats, error) {
+	query := `
+	SELECT
+		(SELECT COUNT(*) FROM products p
+		 WHERE p.store_id = s.id AND p.is_active = true AND p.deleted_at IS NULL) AS product_count,
+		ARRAY(SELECT DISTINCT p.category FROM products p
+		 WHERE p.store_id = s.id AND p.is_active = true AND p.deleted_at IS NULL AND p.category IS NOT NULL
+		 ORDER BY p.category) AS categories,
+		u.created_at AS member_since
+	FROM stores s JOIN users u ON u.id = s.owner_id
+	WHERE s.id = $1`
+
+	var stats models.StoreStats
+	err := r.db.GetContext(ctx, &stats, query, id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error computing store stats: %w", err)
+	}
+	return &stats, nil
+}
+
+// Follow e Unfollow atualizam o follower_count da loja na mesma instrução, e só
+// quando a relação mudou. Tal como a média das avaliações, não mexem na versão.
+func (r *storeRepo) Follow(ctx context.Context, userID, storeID int64) (bool, error) {
+	query := `
+	WITH followed AS (
+		INSERT INTO store_followers (user_id, store_id) VALUES ($1, $2)
+		ON CONFLICT (user_id, store_id) DO NOTHING
+		RETURNING store_id
+	)
+	UPDATE stores SET follower_count = follower_count + 1
+	WHERE id IN (SELECT store_id FROM followed)`
+
+	return r.execChanged(ctx, "error following store", query, userID, storeID)
+}
+
+func (r *storeRepo) Unfollow(ctx context.Context, userID, storeID int64) (bool, error) {
+	query := `
+	WITH unfollowed AS (
+		DELETE FROM store_followers WHERE user_id = $1 AND store_id = $2
+		RETURNING store_id
+	)
+	UPDATE stores SET follower_count = GREATEST(follower_count - 1, 0)
+	WHERE id IN (SELECT store_id FROM unfollowed)`
+
+	return r.execChanged(ctx, "error unfollowing store", query, userID, storeID)
+}
+
+func (r *storeRepo) execChanged(ctx context.Context, message, query string, args ...interface{}) (bool, error) {
+	result, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", message, err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error checking rows affected: %w", err)
+	}
+	return rowsAffected > 0, nil
+}
+
+func (r *storeRepo) ListFollowed(ctx context.Context, userID int64, page, limit int) ([]models.Store, error) {
+	offset := (page - 1) * limit
+	query := `
+	SELECT s.* FROM stores s
+	JOIN store_followers f ON f.store_id = s.id
+	WHERE f.user_id = $1 AND s.deleted_at IS NULL
+	ORDER BY f.created_at DESC, s.id DESC
+	LIMIT $2 OFFSET $3`
+
+	var stores []models.Store
+	if err := r.db.SelectContext(ctx, &stores, query, userID, limit, offset); err != nil {
+		return nil, fmt.Errorf("error listing followed stores: %w", err)
+	}
+	return stores, nil
+}
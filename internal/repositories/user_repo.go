@@ -4,9 +4,10 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"modress/internal/database"
+	"modress/internal/logging"
 	"modress/internal/models"
-
-	"github.com/jmoiron/sqlx"
+	"time"
 )
 
 type UserRepository interface {
@@ -17,13 +18,17 @@ type UserRepository interface {
 	Delete(ctx context.Context, id int64) error
 	List(ctx context.Context, page, limit int) ([]models.User, error)
 	ListAll(ctx context.Context) ([]models.User, error)
+	RecordFailedLogin(ctx context.Context, id int64) (int, error)
+	LockUntil(ctx context.Context, id int64, until time.Time) error
+	ResetFailedLogins(ctx context.Context, id int64) error
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
 }
 
 type userRepo struct {
-	db *sqlx.DB
+	db *database.DB
 }
 
-func NewUserRepository(db *sqlx.DB) UserRepository {
+func NewUserRepository(db *database.DB) UserRepository {
 	return &userRepo{db: db}
 }
 
@@ -36,17 +41,11 @@ func (r *userRepo) Create(ctx context.Context, user *models.User) error {
 	)
 	RETURNING id`
 
-	stmt, err := r.db.PrepareNamedContext(ctx, query)
-	if err != nil {
-		return fmt.Errorf("error preparing query: %w", err)
-	}
-	defer stmt.Close()
-
-	return stmt.GetContext(ctx, &user.ID, user)
+	return r.db.NamedGetContext(ctx, &user.ID, query, user)
 }
 
 func (r *userRepo) FindByEmail(ctx context.Context, email string) (*models.User, error) {
-	query := `SELECT * FROM users WHERE email = $1`
+	query := `SELECT * FROM users WHERE email = $1 AND deleted_at IS NULL`
 	var user models.User
 	err := r.db.GetContext(ctx, &user, query, email)
 	if err == sql.ErrNoRows {
@@ -56,7 +55,7 @@ func (r *userRepo) FindByEmail(ctx context.Context, email string) (*models.User,
 }
 
 func (r *userRepo) FindByID(ctx context.Context, id int64) (*models.User, error) {
-	query := `SELECT * FROM users WHERE id = $1`
+	query := `SELECT * FROM users WHERE id = $1 AND deleted_at IS NULL`
 	var user models.User
 	err := r.db.GetContext(ctx, &user, query, id)
 	if err == sql.ErrNoRows {
@@ -74,7 +73,7 @@ func (r *userRepo) Update(ctx context.Context, user *models.User) error {
 		role = :role,
 		status = :status,
 		updated_at = :updated_at
-	WHERE id = :id`
+	WHERE id = :id AND deleted_at IS NULL`
 
 	result, err := r.db.NamedExecContext(ctx, query, user)
 	if err != nil {
@@ -93,71 +92,76 @@ func (r *userRepo) Update(ctx context.Context, user *models.User) error {
 	return nil
 }
 
+// Delete apaga a conta: os dados pessoais são substituídos por valores anónimos,
+// a password deixa de funcionar e a loja do utilizador e os seus produtos são
+// apagados (soft delete) na mesma instrução. A linha fica para o histórico até o
+// PurgeDeleted a remover.
 func (r *userRepo) Delete(ctx context.Context, id int64) error {
-	query := `DELETE FROM users WHERE id = $1`
-	result, err := r.db.ExecContext(ctx, query, id)
-	if err != nil {
-		return fmt.Errorf("error deleting user: %w", err)
-	}
+	query := `
+	WITH deleted AS (
+		UPDATE users SET
+			username = 'deleted' || id,
+			email = 'deleted-' || id || '@deleted.invalid',
+			phone = NULL,
+			password_hash = '',
+			failed_login_attempts = 0,
+			locked_until = NULL,
+			updated_at = NOW(),
+			deleted_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING id
+	), deleted_stores AS (
+		UPDATE stores SET deleted_at = NOW(), updated_at = NOW(), version = version + 1
+		WHERE owner_id IN (SELECT id FROM deleted) AND deleted_at IS NULL
+		RETURNING id
+	), deleted_products AS (
+		UPDATE products SET deleted_at = NOW(), version = version + 1
+		WHERE store_id IN (SELECT id FROM deleted_stores) AND deleted_at IS NULL
+	)
+	SELECT COUNT(*) FROM deleted`
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("error checking rows affected: %w", err)
+	var deleted int
+	if err := r.db.GetContext(ctx, &deleted, query, id); err != nil {
+		return fmt.Errorf("error deleting user: %w", err)
 	}
-
-	if rowsAffected == 0 {
+	if deleted == 0 {
 		return sql.ErrNoRows
 	}
 
 	return nil
 }
-func getString(s *string) string {
-	if s == nil {
-		return "(null)"
+
+// PurgeDeleted remove de vez as contas apagadas antes de before, exceto as que
+// ainda são donas de uma loja ativa (restaurada por um administrador)
+func (r *userRepo) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	query := `
+	DELETE FROM users
+	WHERE deleted_at < $1
+	AND NOT EXISTS (SELECT 1 FROM stores WHERE stores.owner_id = users.id AND stores.deleted_at IS NULL)`
+
+	result, err := r.db.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("error purging deleted users: %w", err)
 	}
-	return *s
+	return result.RowsAffected()
 }
 
-
 func (r *userRepo) ListAll(ctx context.Context) ([]models.User, error) {
-	query := `SELECT id, username, email, phone, password_hash, role, status, created_at, updated_at FROM users`
+	query := `SELECT id, username, email, phone, password_hash, role, status, created_at, updated_at FROM users WHERE deleted_at IS NULL`
 
 	var users []models.User
 	err := r.db.SelectContext(ctx, &users, query)
 	if err != nil {
-		return nil, fmt.Errorf("error listing all users with passwords: %w", err)
+		return nil, fmt.Errorf("error listing all users: %w", err)
 	}
-for _, user := range users {
-	fmt.Printf(`
-ID: %d
-Username: %s
-Email: %s
-Phone: %s
-Password Hash: %s
-Role: %s
-Status: %s
-Criado em: %s
-Atualizado em: %s
---------------------------
-`,
-		user.ID,
-		user.Username,
-		user.Email,
-		getString(user.Phone),
-		user.PasswordHash,
-		user.Role,
-		user.Status,
-		user.CreatedAt.Format("2006-01-02 15:04:05"),
-		user.UpdatedAt.Format("2006-01-02 15:04:05"),
-	)
-}
 
+	logging.FromContext(ctx).Debug("listed all users", "count", len(users))
 	return users, nil
 }
 
 func (r *userRepo) List(ctx context.Context, page, limit int) ([]models.User, error) {
 	offset := (page - 1) * limit
-	query := `SELECT * FROM users ORDER BY id LIMIT $1 OFFSET $2`
+	query := `SELECT * FROM users WHERE deleted_at IS NULL ORDER BY id LIMIT $1 OFFSET $2`
 
 	var users []models.User
 	err := r.db.SelectContext(ctx, &users, query, limit, offset)
@@ -167,3 +171,34 @@ func (r *userRepo) List(ctx context.Context, page, limit int) ([]models.User, er
 
 	return users, nil
 }
+
+// RecordFailedLogin incrementa o contador de falhas de login e devolve o novo valor.
+// O incremento é feito na base de dados para que tentativas em paralelo contem todas.
+func (r *userRepo) RecordFailedLogin(ctx context.Context, id int64) (int, error) {
+	query := `
+	UPDATE users SET failed_login_attempts = failed_login_attempts + 1
+	WHERE id = $1
+	RETURNING failed_login_attempts`
+
+	var attempts int
+	if err := r.db.GetContext(ctx, &attempts, query, id); err != nil {
+		return 0, fmt.Errorf("error recording failed login: %w", err)
+	}
+	return attempts, nil
+}
+
+func (r *userRepo) LockUntil(ctx context.Context, id int64, until time.Time) error {
+	query := `UPDATE users SET locked_until = $2 WHERE id = $1`
+	if _, err := r.db.ExecContext(ctx, query, id, until); err != nil {
+		return fmt.Errorf("error locking user: %w", err)
+	}
+	return nil
+}
+
+func (r *userRepo) ResetFailedLogins(ctx context.Context, id int64) error {
+	query := `UPDATE users SET failed_login_attempts = 0, locked_until = NULL WHERE id = $1`
+	if _, err := r.db.ExecContext(ctx, query, id); err != nil {
+		return fmt.Errorf("error resetting failed logins: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"modress/internal/database"
+	"modress/internal/models"
+)
+
+// WebhookRepository interface
+type WebhookRepository interface {
+	Create(ctx context.Context, webhook *models.Webhook) error
+	FindByID(ctx context.Context, id int64) (*models.Webhook, error)
+	ListByStore(ctx context.Context, storeID int64) ([]models.Webhook, error)
+	CountByStore(ctx context.Context, storeID int64) (int, error)
+	// ListSubscribed devolve os webhooks ativos da loja subscritos ao evento
+	ListSubscribed(ctx context.Context, storeID int64, event string) ([]models.Webhook, error)
+	Update(ctx context.Context, webhook *models.Webhook) error
+	Delete(ctx context.Context, id int64) error
+
+	CreateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error
+	FindDeliveryByID(ctx context.Context, id int64) (*models.WebhookDelivery, error)
+	ListDeliveries(ctx context.Context, webhookID int64, page, limit int) ([]models.WebhookDelivery, error)
+	// UpdateDeliveryAttempt regista o resultado de uma tentativa de entrega
+	UpdateDeliveryAttempt(ctx context.Context, delivery *models.WebhookDelivery) error
+}
+
+type webhookRepo struct {
+	db *database.DB
+}
+
+func NewWebhookRepository(db *database.DB) WebhookRepository {
+	return &webhookRepo{db: db}
+}
+
+func (r *webhookRepo) Create(ctx context.Context, webhook *models.Webhook) error {
+	query := `
+	INSERT INTO webhooks (store_id, url, secret, events, is_active)
+	VALUES (:store_id, :url, :secret, :events, :is_active)
+	RETURNING id, created_at, updated_at`
+
+	return r.db.NamedGetContext(ctx, webhook, query, webhook)
+}
+
+func (r *webhookRepo) FindByID(ctx context.Context, id int64) (*models.Webhook, error) {
+	query := `SELECT * FROM webhooks WHERE id = $1`
+	var webhook models.Webhook
+	err := r.db.GetContext(ctx, &webhook, query, id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &webhook, err
+}
+
+func (r *webhookRepo) ListByStore(ctx context.Context, storeID int64) ([]models.Webhook, error) {
+	query := `SELECT * FROM webhooks WHERE store_id = $1 ORDER BY id`
+	var webhooks []models.Webhook
+	if err := r.db.SelectContext(ctx, &webhooks, query, storeID); err != nil {
+		return nil, fmt.Errorf("error listing webhooks: %w", err)
+	}
+	return webhooks, nil
+}
+
+func (r *webhookRepo) CountByStore(ctx context.Context, storeID int64) (int, error) {
+	query := `SELECT COUNT(*) FROM webhooks WHERE store_id = $1`
+	var count int
+	if err := r.db.GetContext(ctx, &count, query, storeID); err != nil {
+		return 0, fmt.Errorf("error counting webhooks: %w", err)
+	}
+	return count, nil
+}
+
+func (r *webhookRepo) ListSubscribed(ctx context.Context, storeID int64, event string) ([]models.Webhook, error) {
+	query := `SELECT * FROM webhooks WHERE store_id = $1 AND is_active AND $2 = ANY(events) ORDER BY id`
+	var webhooks []models.Webhook
+	if err := r.db.SelectContext(ctx, &webhooks, query, storeID, event); err != nil {
+		return nil, fmt.Errorf("error listing subscribed webhooks: %w", err)
+	}
+	return webhooks, nil
+}
+
+func (r *webhookRepo) Update(ctx context.Context, webhook *models.Webhook) error {
+	query := `
+	UPDATE webhooks SET url = :url, secret = :secret, events = :events, is_active = :is_active, updated_at = NOW()
+	WHERE id = :id
+	RETURNING updated_at`
+
+	return r.db.NamedGetContext(ctx, &webhook.UpdatedAt, query, webhook)
+}
+
+func (r *webhookRepo) Delete(ctx context.Context, id int64) error {
+	query := `DELETE FROM webhooks WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, id)
+	return err
+}
+
+func (r *webhookRepo) CreateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	query := `
+	INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, payload, status, redelivery_of)
+	VALUES (:webhook_id, :event_id, :event_type, :payload, :status, :redelivery_of)
+	RETURNING id, created_at`
+
+	return r.db.NamedGetContext(ctx, delivery, query, delivery)
+}
+
+func (r *webhookRepo) FindDeliveryByID(ctx context.Context, id int64) (*models.WebhookDelivery, error) {
+	query := `SELECT * FROM webhook_deliveries WHERE id = $1`
+	var delivery models.WebhookDelivery
+	err := r.db.GetContext(ctx, &delivery, query, id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &delivery, err
+}
+
+func (r *webhookRepo) ListDeliveries(ctx context.Context, webhookID int64, page, limit int) ([]models.WebhookDelivery, error) {
+	offset := (page - 1) * limit
+	query := `
+	SELECT * FROM webhook_deliveries
+	WHERE webhook_id = $1
+	ORDER BY id DESC
+	LIMIT $2 OFFSET $3`
+
+	var deliveries []models.WebhookDelivery
+	if err := r.db.SelectContext(ctx, &deliveries, query, webhookID, limit, offset); err != nil {
+		return nil, fmt.Errorf("error listing webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+func (r *webhookRepo) UpdateDeliveryAttempt(ctx context.Context, delivery *models.WebhookDelivery) error {
+	query := `
+	UPDATE webhook_deliveries SET
+		status = :status,
+		attempts = :attempts,
+		response_status = :response_status,
+		response_body = :response_body,
+		error = :error,
+		duration_ms = :duration_ms,
+		last_attempt_at = :last_attempt_at,
+		delivered_at = :delivered_at
+	WHERE id = :id`
+
+	_, err := r.db.NamedExecContext(ctx, query, delivery)
+	return err
+}
@@ -0,0 +1,200 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"modress/internal/database"
+	"modress/internal/models"
+)
+
+// WishlistRepository interface
+type WishlistRepository interface {
+	Create(ctx context.Context, wishlist *models.Wishlist) error
+	FindByID(ctx context.Context, id int64) (*models.Wishlist, error)
+	FindByShareToken(ctx context.Context, token string) (*models.Wishlist, error)
+	ListByUser(ctx context.Context, userID int64) ([]models.Wishlist, error)
+	CountByUser(ctx context.Context, userID int64) (int, error)
+	Update(ctx context.Context, wishlist *models.Wishlist) error
+	Delete(ctx context.Context, id int64) error
+
+	// AddItem devolve sql.ErrNoRows se o produto já estiver na lista
+	AddItem(ctx context.Context, item *models.WishlistItem) error
+	FindItem(ctx context.Context, wishlistID, productID int64) (*models.WishlistItem, error)
+	ListItems(ctx context.Context, wishlistID int64) ([]models.WishlistItem, error)
+	CountItems(ctx context.Context, wishlistID int64) (int, error)
+	RemoveItem(ctx context.Context, wishlistID, productID int64) (bool, error)
+	// MoveItem passa o produto para a outra lista; se já lá estiver, fica só essa
+	// entrada. Devolve false se o produto não estava na lista de origem.
+	MoveItem(ctx context.Context, fromID, toID, productID int64) (bool, error)
+	// ListWatchers devolve os utilizadores que guardaram o produto em alguma lista,
+	// sem as contas apagadas
+	ListWatchers(ctx context.Context, productID int64) ([]int64, error)
+}
+
+type wishlistRepo struct {
+	db *database.DB
+}
+
+func NewWishlistRepository(db *database.DB) WishlistRepository {
+	return &wishlistRepo{db: db}
+}
+
+// wishlistSelect junta às listas o nome do dono e o número de produtos
+const wishlistSelect = `
+	SELECT w.*, u.username AS owner,
+		(SELECT COUNT(*) FROM wishlist_items i WHERE i.wishlist_id = w.id) AS item_count
+	FROM wishlists w JOIN users u ON u.id = w.user_id`
+
+func (r *wishlistRepo) Create(ctx context.Context, wishlist *models.Wishlist) error {
+	query := `
+	INSERT INTO wishlists (user_id, name, is_public, share_token)
+	VALUES (:user_id, :name, :is_public, :share_token)
+	RETURNING id, created_at, updated_at`
+
+	return r.db.NamedGetContext(ctx, wishlist, query, wishlist)
+}
+
+func (r *wishlistRepo) FindByID(ctx context.Context, id int64) (*models.Wishlist, error) {
+	return r.findOne(ctx, wishlistSelect+` WHERE w.id = $1`, id)
+}
+
+func (r *wishlistRepo) FindByShareToken(ctx context.Context, token string) (*models.Wishlist, error) {
+	return r.findOne(ctx, wishlistSelect+` WHERE w.share_token = $1`, token)
+}
+
+func (r *wishlistRepo) findOne(ctx context.Context, query string, args ...interface{}) (*models.Wishlist, error) {
+	var wishlist models.Wishlist
+	err := r.db.GetContext(ctx, &wishlist, query, args...)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &wishlist, err
+}
+
+func (r *wishlistRepo) ListByUser(ctx context.Context, userID int64) ([]models.Wishlist, error) {
+	query := wishlistSelect + ` WHERE w.user_id = $1 ORDER BY w.id`
+	var wishlists []models.Wishlist
+	if err := r.db.SelectContext(ctx, &wishlists, query, userID); err != nil {
+		return nil, fmt.Errorf("error listing wishlists: %w", err)
+	}
+	return wishlists, nil
+}
+
+func (r *wishlistRepo) CountByUser(ctx context.Context, userID int64) (int, error) {
+	var count int
+	if err := r.db.GetContext(ctx, &count, `SELECT COUNT(*) FROM wishlists WHERE user_id = $1`, userID); err != nil {
+		return 0, fmt.Errorf("error counting wishlists: %w", err)
+	}
+	return count, nil
+}
+
+func (r *wishlistRepo) Update(ctx context.Context, wishlist *models.Wishlist) error {
+	query := `
+	UPDATE wishlists SET name = :name, is_public = :is_public, share_token = :share_token, updated_at = NOW()
+	WHERE id = :id
+	RETURNING updated_at`
+
+	err := r.db.NamedGetContext(ctx, &wishlist.UpdatedAt, query, wishlist)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("error updating wishlist: %w", err)
+	}
+	return err
+}
+
+func (r *wishlistRepo) Delete(ctx context.Context, id int64) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM wishlists WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("error deleting wishlist: %w", err)
+	}
+	return nil
+}
+
+func (r *wishlistRepo) AddItem(ctx context.Context, item *models.WishlistItem) error {
+	query := `
+	INSERT INTO wishlist_items (wishlist_id, product_id, price_cents_at_add)
+	VALUES (:wishlist_id, :product_id, :price_cents_at_add)
+	ON CONFLICT (wishlist_id, product_id) DO NOTHING
+	RETURNING created_at`
+
+	return r.db.NamedGetContext(ctx, &item.CreatedAt, query, item)
+}
+
+func (r *wishlistRepo) FindItem(ctx context.Context, wishlistID, productID int64) (*models.WishlistItem, error) {
+	query := `SELECT * FROM wishlist_items WHERE wishlist_id = $1 AND product_id = $2`
+	var item models.WishlistItem
+	err := r.db.GetContext(ctx, &item, query, wishlistID, productID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &item, err
+}
+
+func (r *wishlistRepo) ListItems(ctx context.Context, wishlistID int64) ([]models.WishlistItem, error) {
+	query := `SELECT * FROM wishlist_items WHERE wishlist_id = $1 ORDER BY created_at DESC, product_id DESC`
+	var items []models.WishlistItem
+	if err := r.db.SelectContext(ctx, &items, query, wishlistID); err != nil {
+		return nil, fmt.Errorf("error listing wishlist items: %w", err)
+	}
+	return items, nil
+}
+
+func (r *wishlistRepo) CountItems(ctx context.Context, wishlistID int64) (int, error) {
+	var count int
+	if err := r.db.GetContext(ctx, &count, `SELECT COUNT(*) FROM wishlist_items WHERE wishlist_id = $1`, wishlistID); err != nil {
+		return 0, fmt.Errorf("error counting wishlist items: %w", err)
+	}
+	return count, nil
+}
+
+func (r *wishlistRepo) RemoveItem(ctx context.Context, wishlistID, productID int64) (bool, error) {
+	query := `DELETE FROM wishlist_items WHERE wishlist_id = $1 AND product_id = $2`
+	return r.execChanged(ctx, "error removing wishlist item", query, wishlistID, productID)
+}
+
+func (r *wishlistRepo) MoveItem(ctx context.Context, fromID, toID, productID int64) (bool, error) {
+	// Numa só instrução: a entrada sai da lista de origem e entra na de destino com
+	// o preço e a data originais, a menos que o produto já lá esteja
+	query := `
+	WITH moved AS (
+		DELETE FROM wishlist_items WHERE wishlist_id = $1 AND product_id = $3
+		RETURNING product_id, price_cents_at_add, created_at
+	), inserted AS (
+		INSERT INTO wishlist_items (wishlist_id, product_id, price_cents_at_add, created_at)
+		SELECT $2, product_id, price_cents_at_add, created_at FROM moved
+		ON CONFLICT (wishlist_id, product_id) DO NOTHING
+	)
+	SELECT COUNT(*) FROM moved`
+
+	var moved int
+	if err := r.db.GetContext(ctx, &moved, query, fromID, toID, productID); err != nil {
+		return false, fmt.Errorf("error moving wishlist item: %w", err)
+	}
+	return moved > 0, nil
+}
+
+func (r *wishlistRepo) ListWatchers(ctx context.Context, productID int64) ([]int64, error) {
+	query := `
+	SELECT DISTINCT w.user_id FROM wishlist_items i
+	JOIN wishlists w ON w.id = i.wishlist_id
+	JOIN users u ON u.id = w.user_id
+	WHERE i.product_id = $1 AND u.deleted_at IS NULL
+	ORDER BY w.user_id`
+
+	var userIDs []int64
+	if err := r.db.SelectContext(ctx, &userIDs, query, productID); err != nil {
+		return nil, fmt.Errorf("error listing wishlist watchers: %w", err)
+	}
+	return userIDs, nil
+}
+
+func (r *wishlistRepo) execChanged(ctx context.Context, message, query string, args ...interface{}) (bool, error) {
+	result, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", message, err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error checking rows affected: %w", err)
+	}
+	return rowsAffected > 0, nil
+}
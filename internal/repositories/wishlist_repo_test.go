@@ -0,0 +1,45 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+
+	"modress/internal/models"
+)
+
+func TestListWatchersSkipsDeletedUsers(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewWishlistRepository(db)
+	ctx := context.Background()
+
+	storeID := insertTestStore(t, db, insertTestUser(t, db))
+	var productID int64
+	err := db.GetContext(ctx, &productID, `
+	INSERT INTO products (store_id, title, price_cents, quantity) VALUES ($1, 'Linen shirt', 2999, 1) RETURNING id`, storeID)
+	if err != nil {
+		t.Fatalf("inserting product: %v", err)
+	}
+
+	active := insertTestUser(t, db)
+	deleted := insertTestUser(t, db)
+	for _, userID := range []int64{active, deleted} {
+		wishlist := &models.Wishlist{UserID: userID, Name: "Wishlist"}
+		if err := repo.Create(ctx, wishlist); err != nil {
+			t.Fatalf("creating wishlist: %v", err)
+		}
+		if err := repo.AddItem(ctx, &models.WishlistItem{WishlistID: wishlist.ID, ProductID: productID, PriceCentsAtAdd: 2999}); err != nil {
+			t.Fatalf("adding item: %v", err)
+		}
+	}
+	if _, err := db.ExecContext(ctx, `UPDATE users SET deleted_at = NOW() WHERE id = $1`, deleted); err != nil {
+		t.Fatalf("deleting user: %v", err)
+	}
+
+	watchers, err := repo.ListWatchers(ctx, productID)
+	if err != nil {
+		t.Fatalf("ListWatchers: %v", err)
+	}
+	if len(watchers) != 1 || watchers[0] != active {
+		t.Fatalf("watchers = %v, want only user %d", watchers, active)
+	}
+}
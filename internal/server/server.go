@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Options configura os timeouts do servidor HTTP
+type Options struct {
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// ShutdownTimeout limita o tempo total do shutdown (drenar pedidos e hooks)
+	ShutdownTimeout time.Duration
+	// DrainDelay mantém o servidor a aceitar pedidos, com a readiness a falhar, durante
+	// este tempo antes de drenar, para que o load balancer deixe de enviar tráfego
+	DrainDelay time.Duration
+}
+
+type shutdownHook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// Server gere o ciclo de vida do http.Server e dos recursos que dependem dele
+type Server struct {
+	http           *http.Server
+	opts           Options
+	beforeShutdown []func()
+	hooks          []shutdownHook
+}
+
+func New(addr string, handler http.Handler, opts Options) *Server {
+	return &Server{
+		http: &http.Server{
+			Addr:              addr,
+			Handler:           handler,
+			ReadHeaderTimeout: opts.ReadHeaderTimeout,
+			ReadTimeout:       opts.ReadTimeout,
+			WriteTimeout:      opts.WriteTimeout,
+			IdleTimeout:       opts.IdleTimeout,
+		},
+		opts: opts,
+	}
+}
+
+// BeforeShutdown regista uma função a chamar assim que o shutdown começa, antes de
+// drenar os pedidos (por exemplo, para a readiness começar a falhar)
+func (s *Server) BeforeShutdown(fn func()) {
+	s.beforeShutdown = append(s.beforeShutdown, fn)
+}
+
+// OnShutdown regista uma função a chamar depois de os pedidos HTTP terem drenado.
+// Os hooks correm pela ordem de registo, por isso a base de dados deve ser a última.
+func (s *Server) OnShutdown(name string, fn func(ctx context.Context) error) {
+	s.hooks = append(s.hooks, shutdownHook{name: name, fn: fn})
+}
+
+// Run aceita ligações até ctx ser cancelado (por exemplo por SIGTERM) e depois faz o
+// shutdown ordenado. Devolve erro se o servidor não arrancar ou se o shutdown falhar.
+func (s *Server) Run(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.http.Addr)
+	if err != nil {
+		return fmt.Errorf("error listening on %s: %w", s.http.Addr, err)
+	}
+	return s.Serve(ctx, listener)
+}
+
+// Serve é como Run, mas usa um listener já aberto
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("server listening", "addr", listener.Addr().String())
+		if err := s.http.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serveErr <- err
+		}
+		close(serveErr)
+	}()
+
+	select {
+	case err := <-serveErr:
+		if err != nil {
+			// O servidor falhou sozinho: libertar os restantes recursos antes de sair
+			s.runHooks(context.Background())
+			return fmt.Errorf("server error: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutdown signal received, draining in-flight requests", "drain_delay", s.opts.DrainDelay.String())
+	for _, fn := range s.beforeShutdown {
+		fn()
+	}
+	if s.opts.DrainDelay > 0 {
+		time.Sleep(s.opts.DrainDelay)
+	}
+	return s.shutdown()
+}
+
+func (s *Server) shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.opts.ShutdownTimeout)
+	defer cancel()
+
+	var errs []error
+	if err := s.http.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("http server: %w", err))
+		// Os pedidos que não terminaram a tempo são interrompidos
+		s.http.Close()
+	}
+
+	errs = append(errs, s.runHooks(ctx)...)
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	slog.Info("shutdown complete")
+	return nil
+}
+
+func (s *Server) runHooks(ctx context.Context) []error {
+	var errs []error
+	for _, hook := range s.hooks {
+		slog.Info("stopping component", "component", hook.name)
+		if err := hook.fn(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", hook.name, err))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,359 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"modress/internal/config"
+	"modress/internal/controllers"
+	"modress/internal/health"
+	"modress/internal/hub"
+	"modress/internal/jobs"
+	"modress/internal/models"
+	"modress/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// childEnv faz o binário de teste correr como a API em vez de correr os testes
+const childEnv = "MODRESS_SERVER_TEST_CHILD"
+
+// Eventos escritos pelo processo filho no stdout, um por linha
+const (
+	eventListening     = "listening"
+	eventRequestStart  = "request started"
+	eventJobSucceeded  = "job succeeded"
+	eventRunnerStopped = "job runner stopped"
+	eventDBClosed      = "database closed"
+)
+
+func TestMain(m *testing.M) {
+	if os.Getenv(childEnv) == "1" {
+		if err := runChild(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runChild monta o servidor como o cmd/api: readiness, hub WebSocket, job runner e
+// base de dados, com os hooks de shutdown pela mesma ordem, e corre até ao SIGTERM
+func runChild() error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM)
+	defer stop()
+
+	gin.SetMode(gin.ReleaseMode)
+	emit := func(event string) { fmt.Println(event) }
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+
+	checker := health.NewChecker(time.Second)
+	backend := hub.NewMemoryBackend()
+	if err := backend.Start(ctx); err != nil {
+		return err
+	}
+	wsController := controllers.NewWebSocketController(stubAuthService{}, stubChatService{}, backend, config.WebSocketConfig{
+		MaxMessageSize:        4096,
+		MaxConnectionsPerUser: 5,
+		SendBuffer:            16,
+		PingInterval:          10 * time.Second,
+		PongTimeout:           30 * time.Second,
+		WriteTimeout:          5 * time.Second,
+	})
+	wsController.Start()
+	checker.Add("websocket", wsController.HealthCheck)
+
+	// O job só termina depois de o shutdown começar, para estar a correr quando o
+	// runner é parado
+	shuttingDown := make(chan struct{})
+	runner := jobs.NewRunner(&stubJobRepo{emit: emit}, jobs.Options{Workers: 1, PollInterval: 50 * time.Millisecond})
+	runner.Register("test.slow", func(ctx context.Context, job *models.Job) error {
+		select {
+		case <-shuttingDown:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		time.Sleep(200 * time.Millisecond)
+		return nil
+	})
+	runner.Start()
+
+	router := gin.New()
+	router.GET("/readyz", controllers.NewHealthController(checker).Readiness)
+	router.GET("/slow", func(c *gin.Context) {
+		emit(eventRequestStart)
+		time.Sleep(700 * time.Millisecond)
+		c.String(http.StatusOK, "done")
+	})
+	router.GET("/ws", func(c *gin.Context) { c.Set("userID", int64(1)) }, wsController.HandleConnections)
+
+	srv := New(listener.Addr().String(), router, Options{
+		ShutdownTimeout: 10 * time.Second,
+		DrainDelay:      300 * time.Millisecond,
+	})
+	srv.BeforeShutdown(checker.SetShuttingDown)
+	srv.BeforeShutdown(func() { close(shuttingDown) })
+	srv.OnShutdown("websocket hub", wsController.Shutdown)
+	srv.OnShutdown("websocket hub backend", backend.Close)
+	srv.OnShutdown("job runner", func(ctx context.Context) error {
+		err := runner.Shutdown(ctx)
+		emit(eventRunnerStopped)
+		return err
+	})
+	srv.OnShutdown("database", func(context.Context) error {
+		emit(eventDBClosed)
+		return nil
+	})
+
+	emit(eventListening + " " + listener.Addr().String())
+	return srv.Serve(ctx, listener)
+}
+
+func TestGracefulShutdownOnSIGTERM(t *testing.T) {
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), childEnv+"=1")
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Process.Kill()
+
+	lines := make(chan string, 32)
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+
+	var events []string
+	waitFor := func(prefix string) string {
+		t.Helper()
+		timeout := time.After(10 * time.Second)
+		for {
+			select {
+			case line, ok := <-lines:
+				if !ok {
+					t.Fatalf("child exited before %q", prefix)
+				}
+				events = append(events, line)
+				if strings.HasPrefix(line, prefix) {
+					return line
+				}
+			case <-timeout:
+				t.Fatalf("timed out waiting for %q", prefix)
+			}
+		}
+	}
+
+	addr := strings.TrimPrefix(waitFor(eventListening), eventListening+" ")
+	baseURL := "http://" + addr
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}, Timeout: 5 * time.Second}
+
+	// O listener abre antes de o resto arrancar: esperar que a readiness passe a 200
+	waitForStatus(t, client, baseURL+"/readyz", http.StatusOK, "readiness before shutdown")
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws://"+addr+"/ws", nil)
+	if err != nil {
+		t.Fatalf("dialing websocket: %v", err)
+	}
+	defer ws.Close()
+
+	type result struct {
+		status int
+		body   string
+		err    error
+	}
+	slow := make(chan result, 1)
+	go func() {
+		resp, err := client.Get(baseURL + "/slow")
+		if err != nil {
+			slow <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		slow <- result{status: resp.StatusCode, body: string(body), err: err}
+	}()
+	waitFor(eventRequestStart)
+
+	if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+
+	// Durante o DrainDelay o servidor continua a responder, com a readiness a falhar
+	waitForStatus(t, client, baseURL+"/readyz", http.StatusServiceUnavailable, "readiness after SIGTERM")
+
+	res := <-slow
+	if res.err != nil {
+		t.Fatalf("in-flight request failed: %v", res.err)
+	}
+	if res.status != http.StatusOK || res.body != "done" {
+		t.Fatalf("in-flight request = %d %q, want 200 \"done\"", res.status, res.body)
+	}
+
+	ws.SetReadDeadline(time.Now().Add(10 * time.Second))
+	for {
+		if _, _, err = ws.ReadMessage(); err != nil {
+			break
+		}
+	}
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Fatalf("websocket read error = %v, want close 1001 (going away)", err)
+	}
+
+	waitFor(eventDBClosed)
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("child exited with %v", err)
+	}
+
+	order := []string{eventJobSucceeded, eventRunnerStopped, eventDBClosed}
+	last := -1
+	for _, event := range order {
+		i := indexOf(events, event)
+		if i < 0 {
+			t.Fatalf("event %q missing from %q", event, events)
+		}
+		if i < last {
+			t.Fatalf("events out of order: %q, want %q in that order", events, order)
+		}
+		last = i
+	}
+}
+
+// waitForStatus repete o GET até url responder com want, durante no máximo 2 segundos
+func waitForStatus(t *testing.T, client *http.Client, url string, want int, what string) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		status := getStatus(t, client, url)
+		if status == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s = %d, want %d", what, status, want)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func getStatus(t *testing.T, client *http.Client, url string) int {
+	t.Helper()
+
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+
+	io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode
+}
+
+func indexOf(events []string, event string) int {
+	for i, e := range events {
+		if e == event {
+			return i
+		}
+	}
+	return -1
+}
+
+// stubAuthService só implementa o que o hub WebSocket usa
+type stubAuthService struct {
+	services.AuthService
+}
+
+func (stubAuthService) GetUser(ctx context.Context, id int64) (*models.User, error) {
+	return &models.User{ID: id, Username: fmt.Sprintf("user%d", id)}, nil
+}
+
+// stubChatService não tem mensagens por entregar
+type stubChatService struct {
+	services.ChatService
+}
+
+func (stubChatService) PendingMessages(ctx context.Context, userID int64) ([]models.Message, error) {
+	return nil, nil
+}
+
+func (stubChatService) PresenceWatchers(ctx context.Context, userID int64) ([]int64, error) {
+	return nil, nil
+}
+
+func (stubChatService) MarkDelivered(ctx context.Context, recipientID int64, messageIDs []int64) ([]models.DeliveryReceipt, error) {
+	return nil, nil
+}
+
+// stubJobRepo entrega um único job test.slow e escreve o resultado em emit
+type stubJobRepo struct {
+	emit    func(string)
+	claimed bool
+}
+
+func (r *stubJobRepo) ClaimNext(ctx context.Context, workerID string, types []string) (*models.Job, error) {
+	if r.claimed {
+		return nil, nil
+	}
+	r.claimed = true
+	return &models.Job{ID: 1, Type: "test.slow", Payload: json.RawMessage(`{}`), Attempts: 1, MaxAttempts: 1}, nil
+}
+
+func (r *stubJobRepo) MarkSucceeded(ctx context.Context, id int64, workerID string, result []byte) error {
+	r.emit(eventJobSucceeded)
+	return nil
+}
+
+func (r *stubJobRepo) MarkFailed(ctx context.Context, id int64, workerID, errMsg string, retryAt *time.Time) error {
+	r.emit("job failed: " + errMsg)
+	return nil
+}
+
+func (r *stubJobRepo) Requeue(ctx context.Context, id int64, workerID, errMsg string) error {
+	r.emit("job requeued: " + errMsg)
+	return nil
+}
+
+func (r *stubJobRepo) Create(ctx context.Context, job *models.Job) error { return nil }
+
+func (r *stubJobRepo) FindByID(ctx context.Context, id int64) (*models.Job, error) { return nil, nil }
+
+func (r *stubJobRepo) List(ctx context.Context, filter models.JobFilter) ([]models.Job, error) {
+	return nil, nil
+}
+
+func (r *stubJobRepo) UpdateProgress(ctx context.Context, id int64, workerID string, progress, total int) error {
+	return nil
+}
+
+func (r *stubJobRepo) Heartbeat(ctx context.Context, id int64, workerID string) error { return nil }
+
+func (r *stubJobRepo) Retry(ctx context.Context, id int64) error { return nil }
+
+func (r *stubJobRepo) ReleaseStale(ctx context.Context, lockedBefore time.Time) (int64, error) {
+	return 0, nil
+}
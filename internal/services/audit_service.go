@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"modress/internal/audit"
+	"modress/internal/logging"
+	"modress/internal/models"
+	"modress/internal/repositories"
+	"modress/internal/tracing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// AuditService escreve e consulta o registo de auditoria
+type AuditService interface {
+	// Record regista uma alteração feita pelo actor do contexto. before e after são o
+	// estado da entidade antes e depois (nil numa criação ou remoção). Uma falha ao
+	// escrever o evento é registada nos logs mas não desfaz nem faz falhar a operação.
+	Record(ctx context.Context, action, entityType string, entityID int64, before, after interface{})
+	// RecordChanges regista uma alteração descrita diretamente, sem estado da entidade
+	RecordChanges(ctx context.Context, action, entityType string, entityID int64, changes audit.Changes)
+	ListEvents(ctx context.Context, filter models.AuditFilter) ([]models.AuditEvent, error)
+}
+
+type auditService struct {
+	auditRepo repositories.AuditRepository
+}
+
+func NewAuditService(auditRepo repositories.AuditRepository) AuditService {
+	return &auditService{auditRepo: auditRepo}
+}
+
+func (s *auditService) Record(ctx context.Context, action, entityType string, entityID int64, before, after interface{}) {
+	s.RecordChanges(ctx, action, entityType, entityID, audit.Diff(before, after))
+}
+
+func (s *auditService) RecordChanges(ctx context.Context, action, entityType string, entityID int64, changes audit.Changes) {
+	ctx, span := tracing.Start(ctx, tracerName, "auditService.Record", attribute.String("audit.action", action))
+	defer span.End()
+
+	if err := s.record(ctx, action, entityType, entityID, changes); err != nil {
+		logging.FromContext(ctx).Error("failed to write audit event",
+			"action", action,
+			"entity_type", entityType,
+			"entity_id", entityID,
+			logging.Err(err),
+		)
+	}
+}
+
+func (s *auditService) record(ctx context.Context, action, entityType string, entityID int64, changes audit.Changes) error {
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return fmt.Errorf("error encoding audit changes: %w", err)
+	}
+
+	actor := audit.ActorFrom(ctx)
+	event := &models.AuditEvent{
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+		Changes:    data,
+	}
+	if actor.UserID != 0 {
+		event.ActorID = &actor.UserID
+	}
+	if actor.Role != "" {
+		event.ActorRole = &actor.Role
+	}
+	if actor.IP != "" {
+		event.IP = &actor.IP
+	}
+	if requestID := logging.RequestID(ctx); requestID != "" {
+		event.RequestID = &requestID
+	}
+
+	// A operação já foi feita: o evento é escrito mesmo que o cliente tenha desistido
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+
+	if err := s.auditRepo.Create(ctx, event); err != nil {
+		return fmt.Errorf("error writing audit event: %w", err)
+	}
+	return nil
+}
+
+func (s *auditService) ListEvents(ctx context.Context, filter models.AuditFilter) ([]models.AuditEvent, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "auditService.ListEvents")
+	defer span.End()
+
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.Limit < 1 || filter.Limit > 100 {
+		filter.Limit = 20
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return nil, NewFieldError("from", "range", "from must be before to")
+	}
+
+	events, err := s.auditRepo.List(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("error listing audit events: %w", err)
+	}
+	return events, nil
+}
@@ -5,21 +5,47 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"modress/internal/audit"
+	"modress/internal/logging"
+	"modress/internal/metrics"
 	"modress/internal/models"
 	"modress/internal/repositories"
+	"modress/internal/tracing"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/crypto/bcrypt"
 )
 
 var (
-	ErrEmailExists        = errors.New("email already exists")
-	ErrInvalidCredentials = errors.New("invalid credentials")
-	ErrUserNotFound       = errors.New("user not found")
-	ErrInvalidUserData    = errors.New("invalid user data")
+	ErrEmailExists        = NewError(ErrConflict, "email_taken", "email already exists")
+	ErrInvalidCredentials = NewError(ErrUnauthorized, "invalid_credentials", "invalid credentials")
+	ErrUserNotFound       = NewError(ErrNotFound, "user_not_found", "user not found")
+	ErrAccountLocked      = NewError(ErrRateLimited, "account_locked", "account temporarily locked after too many failed logins")
 )
 
+// LoginLockout configura o bloqueio progressivo de contas: a partir de MaxFailures
+// falhas seguidas a conta fica bloqueada durante Duration, e cada falha seguinte
+// duplica o bloqueio até MaxDuration. MaxFailures 0 desativa o bloqueio.
+type LoginLockout struct {
+	MaxFailures int
+	Duration    time.Duration
+	MaxDuration time.Duration
+}
+
+// lockFor devolve quanto tempo bloquear a conta depois de failures falhas seguidas
+func (l LoginLockout) lockFor(failures int) time.Duration {
+	if l.MaxFailures <= 0 || failures < l.MaxFailures {
+		return 0
+	}
+	d := l.Duration
+	for i := l.MaxFailures; i < failures && d < l.MaxDuration; i++ {
+		d *= 2
+	}
+	return min(d, l.MaxDuration)
+}
+
 type AuthService interface {
 	Register(ctx context.Context, req models.RegisterRequest) (*models.User, error)
 	Login(ctx context.Context, email, password string) (string, *models.User, error)
@@ -31,19 +57,28 @@ type AuthService interface {
 type authService struct {
 	userRepo  repositories.UserRepository
 	jwtSecret string
+	tokenTTL  time.Duration
+	lockout   LoginLockout
+	audit     AuditService
 }
 
-func NewAuthService(userRepo repositories.UserRepository, jwtSecret string) AuthService {
+func NewAuthService(userRepo repositories.UserRepository, jwtSecret string, tokenTTL time.Duration, lockout LoginLockout, auditService AuditService) AuthService {
 	return &authService{
 		userRepo:  userRepo,
 		jwtSecret: jwtSecret,
+		tokenTTL:  tokenTTL,
+		lockout:   lockout,
+		audit:     auditService,
 	}
 }
 
 func (s *authService) Register(ctx context.Context, req models.RegisterRequest) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "authService.Register")
+	defer span.End()
+
 	// Validar request
 	if err := req.Validate(); err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrInvalidUserData, err)
+		return nil, NewValidationError(err)
 	}
 
 	// Verificar se o email já existe
@@ -75,7 +110,7 @@ func (s *authService) Register(ctx context.Context, req models.RegisterRequest)
 
 	// Validar struct
 	if err := newUser.Validate(); err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrInvalidUserData, err)
+		return nil, NewValidationError(err)
 	}
 
 	// Criar no banco
@@ -83,10 +118,16 @@ func (s *authService) Register(ctx context.Context, req models.RegisterRequest)
 		return nil, fmt.Errorf("error creating user: %w", err)
 	}
 
+	logging.FromContext(ctx).Info("user registered", "new_user_id", newUser.ID)
+	// O registo é anónimo: o actor é o próprio utilizador criado
+	s.audit.Record(audit.WithUser(ctx, newUser.ID, newUser.Role), "user.create", models.AuditEntityUser, newUser.ID, nil, newUser)
 	return newUser, nil
 }
 
 func (s *authService) Login(ctx context.Context, email, password string) (string, *models.User, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "authService.Login")
+	defer span.End()
+
 	// Validar entrada
 	if email == "" || password == "" {
 		return "", nil, ErrInvalidCredentials
@@ -98,24 +139,50 @@ func (s *authService) Login(ctx context.Context, email, password string) (string
 		return "", nil, fmt.Errorf("error finding user: %w", err)
 	}
 	if user == nil {
+		metrics.LoginsFailed.WithLabelValues("unknown_user").Inc()
+		logging.FromContext(ctx).Info("login failed", "reason", "unknown_user")
 		return "", nil, ErrInvalidCredentials
 	}
 
+	// Uma conta bloqueada é recusada antes de verificar a senha, para que o
+	// bloqueio trave de facto as tentativas
+	now := time.Now()
+	if user.IsLocked(now) {
+		metrics.LoginsFailed.WithLabelValues("locked").Inc()
+		logging.FromContext(ctx).Info("login failed", "reason", "locked", "login_user_id", user.ID)
+		locked := *ErrAccountLocked
+		locked.RetryAfter = user.LockedUntil.Sub(now)
+		return "", nil, &locked
+	}
+
 	// Verificar se o usuário está ativo
 	if user.Status != "active" {
+		metrics.LoginsFailed.WithLabelValues("inactive_user").Inc()
+		logging.FromContext(ctx).Info("login failed", "reason", "inactive_user", "login_user_id", user.ID)
 		return "", nil, ErrInvalidCredentials
 	}
 
 	// Verificar senha
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		metrics.LoginsFailed.WithLabelValues("wrong_password").Inc()
+		logging.FromContext(ctx).Info("login failed", "reason", "wrong_password", "login_user_id", user.ID)
+		if err := s.recordFailedLogin(ctx, user.ID, now); err != nil {
+			return "", nil, err
+		}
 		return "", nil, ErrInvalidCredentials
 	}
 
+	if user.FailedLoginAttempts > 0 || user.LockedUntil != nil {
+		if err := s.userRepo.ResetFailedLogins(ctx, user.ID); err != nil {
+			return "", nil, fmt.Errorf("error resetting failed logins: %w", err)
+		}
+	}
+
 	// Gerar token JWT
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"sub":  fmt.Sprintf("%d", user.ID),
 		"role": user.Role,
-		"exp":  time.Now().Add(time.Hour * 24).Unix(),
+		"exp":  time.Now().Add(s.tokenTTL).Unix(),
 		"iat":  time.Now().Unix(),
 	})
 
@@ -128,6 +195,9 @@ func (s *authService) Login(ctx context.Context, email, password string) (string
 }
 
 func (s *authService) GetUser(ctx context.Context, id int64) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "authService.GetUser", attribute.Int64("user.id", id))
+	defer span.End()
+
 	if id <= 0 {
 		return nil, ErrUserNotFound
 	}
@@ -143,13 +213,16 @@ func (s *authService) GetUser(ctx context.Context, id int64) (*models.User, erro
 }
 
 func (s *authService) UpdateUser(ctx context.Context, id int64, req models.UpdateUserRequest) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "authService.UpdateUser", attribute.Int64("user.id", id))
+	defer span.End()
+
 	if id <= 0 {
 		return nil, ErrUserNotFound
 	}
 
 	// Validar request
 	if err := req.Validate(); err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrInvalidUserData, err)
+		return nil, NewValidationError(err)
 	}
 
 	// Buscar usuário existente
@@ -172,6 +245,8 @@ func (s *authService) UpdateUser(ctx context.Context, id int64, req models.Updat
 		}
 	}
 
+	before := *user
+
 	// Atualizar campos permitidos
 	if req.Username != nil {
 		user.Username = *req.Username
@@ -186,7 +261,7 @@ func (s *authService) UpdateUser(ctx context.Context, id int64, req models.Updat
 	user.UpdatedAt = time.Now()
 
 	if err := user.Validate(); err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrInvalidUserData, err)
+		return nil, NewValidationError(err)
 	}
 
 	if err := s.userRepo.Update(ctx, user); err != nil {
@@ -195,11 +270,17 @@ func (s *authService) UpdateUser(ctx context.Context, id int64, req models.Updat
 		}
 		return nil, fmt.Errorf("error updating user: %w", err)
 	}
+	s.audit.Record(ctx, "user.update", models.AuditEntityUser, id, &before, user)
 
 	return user, nil
 }
 
+// DeleteUser apaga a conta e anonimiza os dados pessoais; a loja e os produtos do
+// utilizador são apagados com ela. Não há restauro: os dados originais já não existem.
 func (s *authService) DeleteUser(ctx context.Context, id int64) error {
+	ctx, span := tracing.Start(ctx, tracerName, "authService.DeleteUser", attribute.Int64("user.id", id))
+	defer span.End()
+
 	if id <= 0 {
 		return ErrUserNotFound
 	}
@@ -210,6 +291,27 @@ func (s *authService) DeleteUser(ctx context.Context, id int64) error {
 		}
 		return fmt.Errorf("error deleting user: %w", err)
 	}
+	// Sem alterações: o evento não pode guardar os dados pessoais que acabaram de ser apagados
+	s.audit.RecordChanges(ctx, "user.delete", models.AuditEntityUser, id, audit.Changes{})
+	return nil
+}
+
+// recordFailedLogin conta a falha e bloqueia a conta quando atinge o limite
+func (s *authService) recordFailedLogin(ctx context.Context, userID int64, now time.Time) error {
+	failures, err := s.userRepo.RecordFailedLogin(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("error recording failed login: %w", err)
+	}
+
+	lock := s.lockout.lockFor(failures)
+	if lock <= 0 {
+		return nil
+	}
+	if err := s.userRepo.LockUntil(ctx, userID, now.Add(lock)); err != nil {
+		return fmt.Errorf("error locking account: %w", err)
+	}
+	metrics.AccountsLocked.Inc()
+	logging.FromContext(ctx).Warn("account locked", "login_user_id", userID, "failures", failures, "lock_seconds", int(lock.Seconds()))
 	return nil
 }
 
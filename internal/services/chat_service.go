@@ -0,0 +1,329 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"modress/internal/models"
+	"modress/internal/repositories"
+	"modress/internal/tracing"
+	"slices"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	ErrConversationNotFound = NewError(ErrNotFound, "conversation_not_found", "conversation not found")
+	ErrOwnStoreConversation = NewError(ErrValidation, "own_store", "you cannot start a conversation with your own store")
+)
+
+// maxPendingMessages limita as mensagens por entregar enviadas numa nova ligação; as
+// restantes ficam no histórico
+const maxPendingMessages = 100
+
+// notificationPreviewLength é o número de caracteres da mensagem mostrados na notificação
+const notificationPreviewLength = 100
+
+// ChatService guarda as conversas entre compradores e lojas. As mensagens são
+// guardadas antes de serem entregues; a entrega em tempo real é do hub WebSocket.
+type ChatService interface {
+	StartConversation(ctx context.Context, buyerID, storeID int64) (conversation *models.Conversation, created bool, err error)
+	ListConversations(ctx context.Context, userID int64, page, limit int) ([]models.ConversationSummary, error)
+	// GetMessages devolve o histórico da conversa, da mensagem mais recente para a mais
+	// antiga, a partir de beforeID (0 para as mais recentes)
+	GetMessages(ctx context.Context, userID, conversationID, beforeID int64, limit int) ([]models.Message, error)
+	SendMessage(ctx context.Context, senderID int64, req *models.SendMessageRequest) (*models.Message, error)
+	PendingMessages(ctx context.Context, userID int64) ([]models.Message, error)
+	// MarkDelivered marca as mensagens como entregues ao destinatário e devolve um recibo
+	// por conversa; as que já estavam entregues não entram nos recibos
+	MarkDelivered(ctx context.Context, recipientID int64, messageIDs []int64) ([]models.DeliveryReceipt, error)
+	// MarkRead marca como lidas as mensagens recebidas na conversa até upToID (0 para
+	// todas); devolve nil quando não havia nada por ler
+	MarkRead(ctx context.Context, userID, conversationID, upToID int64) (*models.ReadReceipt, error)
+	UnreadCount(ctx context.Context, userID int64) (int64, error)
+	// Recipient devolve a outra parte da conversa, se userID participar nela
+	Recipient(ctx context.Context, userID, conversationID int64) (int64, error)
+	// PresenceWatchers devolve quem recebe as mudanças de presença de userID: quem tem
+	// uma conversa com ele e, se ele tiver uma loja, quem a segue
+	PresenceWatchers(ctx context.Context, userID int64) ([]int64, error)
+	// VisiblePresence devolve os de userIDs cuja presença viewerID pode consultar,
+	// pela mesma regra
+	VisiblePresence(ctx context.Context, viewerID int64, userIDs []int64) ([]int64, error)
+}
+
+type chatService struct {
+	chatRepo      repositories.ChatRepository
+	storeRepo     repositories.StoreRepository
+	notifications NotificationService
+}
+
+func NewChatService(chatRepo repositories.ChatRepository, storeRepo repositories.StoreRepository, notificationService NotificationService) ChatService {
+	return &chatService{
+		chatRepo:      chatRepo,
+		storeRepo:     storeRepo,
+		notifications: notificationService,
+	}
+}
+
+func (s *chatService) StartConversation(ctx context.Context, buyerID, storeID int64) (*models.Conversation, bool, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "chatService.StartConversation", attribute.Int64("user.id", buyerID), attribute.Int64("store.id", storeID))
+	defer span.End()
+
+	store, err := s.storeRepo.FindByID(ctx, storeID)
+	if err != nil {
+		return nil, false, fmt.Errorf("error finding store: %w", err)
+	}
+	if store == nil {
+		return nil, false, ErrStoreNotFound
+	}
+	if store.OwnerID == buyerID {
+		return nil, false, ErrOwnStoreConversation
+	}
+
+	conversation, created, err := s.chatRepo.FindOrCreateConversation(ctx, buyerID, storeID)
+	if err != nil {
+		return nil, false, fmt.Errorf("error starting conversation: %w", err)
+	}
+	return conversation, created, nil
+}
+
+func (s *chatService) ListConversations(ctx context.Context, userID int64, page, limit int) ([]models.ConversationSummary, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "chatService.ListConversations", attribute.Int64("user.id", userID))
+	defer span.End()
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	conversations, err := s.chatRepo.ListConversations(ctx, userID, page, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error listing conversations: %w", err)
+	}
+	return conversations, nil
+}
+
+func (s *chatService) GetMessages(ctx context.Context, userID, conversationID, beforeID int64, limit int) ([]models.Message, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "chatService.GetMessages", attribute.Int64("user.id", userID), attribute.Int64("conversation.id", conversationID))
+	defer span.End()
+
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	if _, _, _, err := s.participant(ctx, userID, conversationID); err != nil {
+		return nil, err
+	}
+
+	messages, err := s.chatRepo.ListMessages(ctx, conversationID, beforeID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error listing messages: %w", err)
+	}
+	return messages, nil
+}
+
+func (s *chatService) SendMessage(ctx context.Context, senderID int64, req *models.SendMessageRequest) (*models.Message, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "chatService.SendMessage", attribute.Int64("user.id", senderID))
+	defer span.End()
+
+	if err := req.Validate(); err != nil {
+		return nil, NewValidationError(err)
+	}
+
+	conversationID := req.ConversationID
+	if conversationID == 0 {
+		conversation, _, err := s.StartConversation(ctx, senderID, req.StoreID)
+		if err != nil {
+			return nil, err
+		}
+		conversationID = conversation.ID
+	}
+
+	_, store, recipientID, err := s.participant(ctx, senderID, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	// O histórico de uma loja apagada continua legível, mas já não recebe mensagens
+	if store.DeletedAt != nil {
+		return nil, ErrStoreNotFound
+	}
+
+	message := &models.Message{
+		ConversationID: conversationID,
+		SenderID:       senderID,
+		RecipientID:    recipientID,
+		Content:        req.Content,
+		CreatedAt:      time.Now(),
+	}
+	if err := s.chatRepo.CreateMessage(ctx, message); err != nil {
+		return nil, fmt.Errorf("error creating message: %w", err)
+	}
+	s.notifications.Notify(ctx, models.NotifyRequest{
+		UserID: recipientID,
+		Type:   models.NotificationMessageReceived,
+		Title:  "New message about " + store.Name,
+		Body:   preview(message.Content, notificationPreviewLength),
+		Data:   map[string]interface{}{"conversation_id": conversationID, "message_id": message.ID},
+	})
+	return message, nil
+}
+
+func (s *chatService) PendingMessages(ctx context.Context, userID int64) ([]models.Message, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "chatService.PendingMessages", attribute.Int64("user.id", userID))
+	defer span.End()
+
+	messages, err := s.chatRepo.ListUndelivered(ctx, userID, maxPendingMessages)
+	if err != nil {
+		return nil, fmt.Errorf("error listing pending messages: %w", err)
+	}
+	return messages, nil
+}
+
+func (s *chatService) MarkDelivered(ctx context.Context, recipientID int64, messageIDs []int64) ([]models.DeliveryReceipt, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "chatService.MarkDelivered", attribute.Int64("user.id", recipientID))
+	defer span.End()
+
+	if len(messageIDs) == 0 {
+		return nil, nil
+	}
+
+	messages, err := s.chatRepo.MarkDelivered(ctx, recipientID, messageIDs)
+	if err != nil {
+		return nil, fmt.Errorf("error marking messages delivered: %w", err)
+	}
+
+	// Numa conversa todas as mensagens recebidas vêm da outra parte: um recibo por
+	// conversa chega a um só remetente
+	var receipts []models.DeliveryReceipt
+	index := make(map[int64]int)
+	for _, message := range messages {
+		i, ok := index[message.ConversationID]
+		if !ok {
+			i = len(receipts)
+			index[message.ConversationID] = i
+			receipts = append(receipts, models.DeliveryReceipt{
+				ConversationID: message.ConversationID,
+				DeliveredAt:    *message.DeliveredAt,
+				SenderID:       message.SenderID,
+			})
+		}
+		receipts[i].MessageIDs = append(receipts[i].MessageIDs, message.ID)
+	}
+	for i := range receipts {
+		slices.Sort(receipts[i].MessageIDs)
+	}
+	return receipts, nil
+}
+
+func (s *chatService) MarkRead(ctx context.Context, userID, conversationID, upToID int64) (*models.ReadReceipt, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "chatService.MarkRead", attribute.Int64("user.id", userID), attribute.Int64("conversation.id", conversationID))
+	defer span.End()
+
+	if upToID < 0 {
+		return nil, NewFieldError("up_to_id", "min", "up_to_id cannot be negative")
+	}
+
+	_, _, otherID, err := s.participant(ctx, userID, conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	count, maxID, err := s.chatRepo.MarkRead(ctx, conversationID, userID, upToID)
+	if err != nil {
+		return nil, fmt.Errorf("error marking messages read: %w", err)
+	}
+	if count == 0 {
+		return nil, nil
+	}
+
+	return &models.ReadReceipt{
+		ConversationID: conversationID,
+		ReaderID:       userID,
+		UpToID:         maxID,
+		Count:          count,
+		ReadAt:         time.Now(),
+		SenderID:       otherID,
+	}, nil
+}
+
+func (s *chatService) UnreadCount(ctx context.Context, userID int64) (int64, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "chatService.UnreadCount", attribute.Int64("user.id", userID))
+	defer span.End()
+
+	count, err := s.chatRepo.CountUnread(ctx, userID)
+	if err != nil {
+		return 0, fmt.Errorf("error counting unread messages: %w", err)
+	}
+	return count, nil
+}
+
+func (s *chatService) Recipient(ctx context.Context, userID, conversationID int64) (int64, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "chatService.Recipient", attribute.Int64("user.id", userID), attribute.Int64("conversation.id", conversationID))
+	defer span.End()
+
+	_, _, otherID, err := s.participant(ctx, userID, conversationID)
+	return otherID, err
+}
+
+func (s *chatService) PresenceWatchers(ctx context.Context, userID int64) ([]int64, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "chatService.PresenceWatchers", attribute.Int64("user.id", userID))
+	defer span.End()
+
+	userIDs, err := s.chatRepo.ListPresenceWatchers(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing presence watchers: %w", err)
+	}
+	return userIDs, nil
+}
+
+func (s *chatService) VisiblePresence(ctx context.Context, viewerID int64, userIDs []int64) ([]int64, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "chatService.VisiblePresence", attribute.Int64("user.id", viewerID))
+	defer span.End()
+
+	visible, err := s.chatRepo.FilterPresenceVisible(ctx, viewerID, userIDs)
+	if err != nil {
+		return nil, fmt.Errorf("error filtering presence: %w", err)
+	}
+	return visible, nil
+}
+
+// participant devolve a conversa, a loja e a outra parte, se userID for o comprador ou
+// o dono da loja. Para quem não participa a conversa não existe.
+func (s *chatService) participant(ctx context.Context, userID, conversationID int64) (*models.Conversation, *models.Store, int64, error) {
+	conversation, err := s.chatRepo.FindConversationByID(ctx, conversationID)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("error finding conversation: %w", err)
+	}
+	if conversation == nil {
+		return nil, nil, 0, ErrConversationNotFound
+	}
+
+	// A loja apagada continua a identificar o vendedor no histórico
+	store, err := s.storeRepo.FindByIDIncludingDeleted(ctx, conversation.StoreID)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("error finding store: %w", err)
+	}
+	if store == nil {
+		return nil, nil, 0, ErrConversationNotFound
+	}
+
+	switch userID {
+	case conversation.BuyerID:
+		return conversation, store, store.OwnerID, nil
+	case store.OwnerID:
+		return conversation, store, conversation.BuyerID, nil
+	default:
+		return nil, nil, 0, ErrConversationNotFound
+	}
+}
+
+// preview corta s em n caracteres, acabando em reticências quando foi cortado
+func preview(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
@@ -0,0 +1,556 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"modress/internal/models"
+	"modress/internal/repositories"
+	"modress/internal/tracing"
+	"sort"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	ErrCouponNotFound      = NewError(ErrNotFound, "coupon_not_found", "coupon not found")
+	ErrCouponCodeTaken     = NewError(ErrConflict, "coupon_code_taken", "a coupon with this code already exists")
+	ErrCouponRedeemed      = NewError(ErrConflict, "coupon_redeemed", "a coupon that has been redeemed cannot be deleted; deactivate it instead")
+	ErrCouponExhausted     = NewError(ErrConflict, "coupon_exhausted", "the coupon has reached its usage limit")
+	ErrCouponUserLimit     = NewError(ErrConflict, "coupon_user_limit_reached", "you have already used this coupon the maximum number of times")
+	ErrCouponInactive      = NewError(ErrUnprocessable, "coupon_inactive", "the coupon is not active")
+	ErrCouponNotStarted    = NewError(ErrUnprocessable, "coupon_not_started", "the coupon is not valid yet")
+	ErrCouponExpired       = NewError(ErrUnprocessable, "coupon_expired", "the coupon has expired")
+	ErrCouponNotApplicable = NewError(ErrUnprocessable, "coupon_not_applicable", "the coupon does not apply to any item in the cart")
+)
+
+// CouponService gere os cupões de desconto das lojas e do marketplace, calcula o
+// desconto de um cupão sobre um carrinho e regista as utilizações. Nas operações de
+// gestão storeID indica a loja dona dos cupões; 0 são os do marketplace, geridos
+// pelos administradores.
+type CouponService interface {
+	CreateCoupon(ctx context.Context, storeID, userID int64, req *models.CreateCouponRequest) (*models.CouponResponse, error)
+	ListCoupons(ctx context.Context, storeID int64, page, limit int) ([]models.CouponResponse, error)
+	GetCoupon(ctx context.Context, storeID, id int64) (*models.CouponResponse, error)
+	UpdateCoupon(ctx context.Context, storeID, id int64, req *models.UpdateCouponRequest) (*models.CouponResponse, error)
+	// DeleteCoupon só apaga cupões nunca usados; os outros ficam no histórico e podem
+	// ser desativados
+	DeleteCoupon(ctx context.Context, storeID, id int64) error
+	ListRedemptions(ctx context.Context, storeID, id int64, page, limit int) ([]models.CouponRedemption, error)
+	// Quote calcula o desconto do cupão sobre os itens, com os preços atuais, sem o usar
+	Quote(ctx context.Context, userID int64, req *models.QuoteCouponRequest) (*models.CouponQuote, error)
+	// Redeem usa o cupão nos itens. Os limites são verificados de novo com o cupão
+	// bloqueado, para que utilizações em simultâneo não os ultrapassem.
+	Redeem(ctx context.Context, userID int64, req *models.RedeemCouponRequest) (*models.CouponRedemption, error)
+}
+
+type couponService struct {
+	couponRepo  repositories.CouponRepository
+	productRepo repositories.ProductRepository
+	audit       AuditService
+}
+
+func NewCouponService(couponRepo repositories.CouponRepository, productRepo repositories.ProductRepository, auditService AuditService) CouponService {
+	return &couponService{
+		couponRepo:  couponRepo,
+		productRepo: productRepo,
+		audit:       auditService,
+	}
+}
+
+func (s *couponService) CreateCoupon(ctx context.Context, storeID, userID int64, req *models.CreateCouponRequest) (*models.CouponResponse, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "couponService.CreateCoupon", attribute.Int64("store.id", storeID))
+	defer span.End()
+
+	if err := req.Validate(); err != nil {
+		return nil, NewValidationError(err)
+	}
+	code, err := couponCode(req.Code)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkValidity(req.ValidFrom, req.ValidUntil); err != nil {
+		return nil, err
+	}
+
+	coupon := &models.Coupon{
+		Code:                  code,
+		Description:           req.Description,
+		PercentOff:            req.PercentOff,
+		MinOrderCents:         toCents(req.MinOrder),
+		ValidFrom:             req.ValidFrom,
+		ValidUntil:            req.ValidUntil,
+		MaxRedemptions:        req.MaxRedemptions,
+		MaxRedemptionsPerUser: req.MaxRedemptionsPerUser,
+		IsActive:              true,
+		CreatedBy:             &userID,
+	}
+	if storeID != 0 {
+		coupon.StoreID = &storeID
+	}
+	if req.AmountOff != nil {
+		amount := toCents(*req.AmountOff)
+		if amount < 1 {
+			return nil, NewFieldError("amount_off", "gt", "amount_off must be at least 0.01")
+		}
+		coupon.AmountOffCents = &amount
+	}
+	if req.IsActive != nil {
+		coupon.IsActive = *req.IsActive
+	}
+
+	if err := s.couponRepo.Create(ctx, coupon); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrCouponCodeTaken
+		}
+		return nil, fmt.Errorf("error creating coupon: %w", err)
+	}
+	s.audit.Record(ctx, "coupon.create", models.AuditEntityCoupon, coupon.ID, nil, coupon)
+
+	response := coupon.ToResponse()
+	return &response, nil
+}
+
+func (s *couponService) ListCoupons(ctx context.Context, storeID int64, page, limit int) ([]models.CouponResponse, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "couponService.ListCoupons", attribute.Int64("store.id", storeID))
+	defer span.End()
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	coupons, err := s.couponRepo.ListByStore(ctx, storeID, page, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error listing coupons: %w", err)
+	}
+
+	responses := make([]models.CouponResponse, len(coupons))
+	for i, coupon := range coupons {
+		responses[i] = coupon.ToResponse()
+	}
+	return responses, nil
+}
+
+func (s *couponService) GetCoupon(ctx context.Context, storeID, id int64) (*models.CouponResponse, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "couponService.GetCoupon", attribute.Int64("store.id", storeID), attribute.Int64("coupon.id", id))
+	defer span.End()
+
+	coupon, err := s.ownedCoupon(ctx, storeID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	response := coupon.ToResponse()
+	return &response, nil
+}
+
+func (s *couponService) UpdateCoupon(ctx context.Context, storeID, id int64, req *models.UpdateCouponRequest) (*models.CouponResponse, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "couponService.UpdateCoupon", attribute.Int64("store.id", storeID), attribute.Int64("coupon.id", id))
+	defer span.End()
+
+	if err := req.Validate(); err != nil {
+		return nil, NewValidationError(err)
+	}
+
+	coupon, err := s.ownedCoupon(ctx, storeID, id)
+	if err != nil {
+		return nil, err
+	}
+	before := *coupon
+
+	if req.Description != nil {
+		coupon.Description = req.Description
+	}
+	if req.MinOrder != nil {
+		coupon.MinOrderCents = toCents(*req.MinOrder)
+	}
+	if req.ValidFrom != nil {
+		coupon.ValidFrom = req.ValidFrom
+	}
+	if req.ValidUntil != nil {
+		coupon.ValidUntil = req.ValidUntil
+	}
+	if req.MaxRedemptions != nil {
+		coupon.MaxRedemptions = optionalLimit(*req.MaxRedemptions)
+	}
+	if req.MaxRedemptionsPerUser != nil {
+		coupon.MaxRedemptionsPerUser = optionalLimit(*req.MaxRedemptionsPerUser)
+	}
+	if req.IsActive != nil {
+		coupon.IsActive = *req.IsActive
+	}
+	if err := checkValidity(coupon.ValidFrom, coupon.ValidUntil); err != nil {
+		return nil, err
+	}
+
+	if err := s.couponRepo.Update(ctx, coupon); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrCouponNotFound
+		}
+		return nil, err
+	}
+	s.audit.Record(ctx, "coupon.update", models.AuditEntityCoupon, id, &before, coupon)
+
+	response := coupon.ToResponse()
+	return &response, nil
+}
+
+func (s *couponService) DeleteCoupon(ctx context.Context, storeID, id int64) error {
+	ctx, span := tracing.Start(ctx, tracerName, "couponService.DeleteCoupon", attribute.Int64("store.id", storeID), attribute.Int64("coupon.id", id))
+	defer span.End()
+
+	coupon, err := s.ownedCoupon(ctx, storeID, id)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := s.couponRepo.Delete(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrCouponRedeemed
+	}
+	s.audit.Record(ctx, "coupon.delete", models.AuditEntityCoupon, id, coupon, nil)
+
+	return nil
+}
+
+func (s *couponService) ListRedemptions(ctx context.Context, storeID, id int64, page, limit int) ([]models.CouponRedemption, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "couponService.ListRedemptions", attribute.Int64("store.id", storeID), attribute.Int64("coupon.id", id))
+	defer span.End()
+
+	if _, err := s.ownedCoupon(ctx, storeID, id); err != nil {
+		return nil, err
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	redemptions, err := s.couponRepo.ListRedemptions(ctx, id, page, limit)
+	if err != nil {
+		return nil, err
+	}
+	for i := range redemptions {
+		setRedemptionAmounts(&redemptions[i])
+	}
+	return redemptions, nil
+}
+
+func (s *couponService) Quote(ctx context.Context, userID int64, req *models.QuoteCouponRequest) (*models.CouponQuote, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "couponService.Quote", attribute.Int64("user.id", userID))
+	defer span.End()
+
+	if err := req.Validate(); err != nil {
+		return nil, NewValidationError(err)
+	}
+
+	coupon, cart, err := s.price(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	userRedemptions, err := s.couponRepo.CountUserRedemptions(ctx, coupon.ID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRedeemable(coupon, userRedemptions, cart.eligible, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return cart.quote(coupon), nil
+}
+
+func (s *couponService) Redeem(ctx context.Context, userID int64, req *models.RedeemCouponRequest) (*models.CouponRedemption, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "couponService.Redeem", attribute.Int64("user.id", userID))
+	defer span.End()
+
+	if err := req.Validate(); err != nil {
+		return nil, NewValidationError(err)
+	}
+
+	coupon, cart, err := s.price(ctx, &req.QuoteCouponRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	quote := cart.quote(coupon)
+	lines, err := json.Marshal(quote.Lines)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding redemption lines: %w", err)
+	}
+	redemption := &models.CouponRedemption{
+		CouponID:      &coupon.ID,
+		UserID:        userID,
+		Reference:     req.Reference,
+		SubtotalCents: cart.subtotal,
+		DiscountCents: cart.discount,
+		Lines:         lines,
+	}
+
+	err = s.couponRepo.Redeem(ctx, redemption, func(locked *models.Coupon, userRedemptions int) error {
+		return checkRedeemable(locked, userRedemptions, cart.eligible, time.Now())
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrCouponNotFound
+		}
+		return nil, err
+	}
+
+	setRedemptionAmounts(redemption)
+	return redemption, nil
+}
+
+// ownedCoupon devolve o cupão se pertencer à loja (ou ao marketplace, com storeID 0).
+// Os cupões dos outros são dados como inexistentes.
+func (s *couponService) ownedCoupon(ctx context.Context, storeID, id int64) (*models.Coupon, error) {
+	coupon, err := s.couponRepo.FindByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("error finding coupon: %w", err)
+	}
+	if coupon == nil || couponStoreID(coupon) != storeID {
+		return nil, ErrCouponNotFound
+	}
+	return coupon, nil
+}
+
+// cartLine é uma linha do carrinho com os valores em cêntimos
+type cartLine struct {
+	product  *models.Product
+	quantity int
+	total    int
+	eligible bool
+	discount int
+}
+
+// pricedCart é o carrinho com os preços atuais e o desconto do cupão já repartido
+type pricedCart struct {
+	lines    []cartLine
+	subtotal int
+	eligible int
+	discount int
+}
+
+// price lê o cupão e os produtos e calcula o desconto. Os itens repetidos juntam-se
+// numa só linha.
+func (s *couponService) price(ctx context.Context, req *models.QuoteCouponRequest) (*models.Coupon, *pricedCart, error) {
+	code, err := couponCode(req.Code)
+	if err != nil {
+		return nil, nil, err
+	}
+	coupon, err := s.couponRepo.FindByCode(ctx, code)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error finding coupon: %w", err)
+	}
+	if coupon == nil {
+		return nil, nil, ErrCouponNotFound
+	}
+
+	quantities := make(map[int64]int, len(req.Items))
+	var ids []int64
+	for _, item := range req.Items {
+		if _, ok := quantities[item.ProductID]; !ok {
+			ids = append(ids, item.ProductID)
+		}
+		quantities[item.ProductID] += item.Quantity
+	}
+
+	products, err := s.productRepo.FindByIDs(ctx, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	byID := make(map[int64]*models.Product, len(products))
+	for i := range products {
+		if products[i].IsActive {
+			byID[products[i].ID] = &products[i]
+		}
+	}
+
+	cart := &pricedCart{lines: make([]cartLine, 0, len(ids))}
+	for _, id := range ids {
+		product, ok := byID[id]
+		if !ok {
+			return nil, nil, ErrProductNotFound
+		}
+		line := cartLine{
+			product:  product,
+			quantity: quantities[id],
+			total:    product.PriceCents * quantities[id],
+			eligible: coupon.StoreID == nil || *coupon.StoreID == product.StoreID,
+		}
+		cart.subtotal += line.total
+		if line.eligible {
+			cart.eligible += line.total
+		}
+		cart.lines = append(cart.lines, line)
+	}
+
+	cart.discount = couponDiscount(coupon, cart.eligible)
+	cart.allocate()
+	return coupon, cart, nil
+}
+
+// couponDiscount é o desconto total sobre o valor elegível: a percentagem
+// arredondada ao cêntimo, ou o valor fixo até ao máximo do valor elegível
+func couponDiscount(coupon *models.Coupon, eligible int) int {
+	if coupon.PercentOff != nil {
+		return int(math.Round(float64(eligible) * float64(*coupon.PercentOff) / 100))
+	}
+	if coupon.AmountOffCents != nil {
+		return min(*coupon.AmountOffCents, eligible)
+	}
+	return 0
+}
+
+// allocate reparte o desconto pelas linhas elegíveis na proporção do valor de cada
+// uma. Os cêntimos que sobram do arredondamento vão para as linhas com maior resto
+// (a primeira em caso de empate), para que a soma das linhas dê sempre o desconto.
+func (c *pricedCart) allocate() {
+	if c.eligible == 0 || c.discount == 0 {
+		return
+	}
+
+	type remainder struct {
+		line  int
+		value int64
+	}
+	var remainders []remainder
+	allocated := 0
+	for i := range c.lines {
+		line := &c.lines[i]
+		if !line.eligible {
+			continue
+		}
+		share := int64(line.total) * int64(c.discount)
+		line.discount = int(share / int64(c.eligible))
+		allocated += line.discount
+		remainders = append(remainders, remainder{line: i, value: share % int64(c.eligible)})
+	}
+
+	sort.SliceStable(remainders, func(i, j int) bool {
+		return remainders[i].value > remainders[j].value
+	})
+	for i := 0; allocated < c.discount; i++ {
+		c.lines[remainders[i%len(remainders)].line].discount++
+		allocated++
+	}
+}
+
+// quote converte o carrinho na resposta da API
+func (c *pricedCart) quote(coupon *models.Coupon) *models.CouponQuote {
+	quote := &models.CouponQuote{
+		CouponID:         coupon.ID,
+		Code:             coupon.Code,
+		Subtotal:         fromCents(c.subtotal),
+		EligibleSubtotal: fromCents(c.eligible),
+		Discount:         fromCents(c.discount),
+		Total:            fromCents(c.subtotal - c.discount),
+		Lines:            make([]models.CouponQuoteLine, len(c.lines)),
+	}
+	for i, line := range c.lines {
+		quote.Lines[i] = models.CouponQuoteLine{
+			ProductID: line.product.ID,
+			StoreID:   line.product.StoreID,
+			Title:     line.product.Title,
+			Quantity:  line.quantity,
+			UnitPrice: fromCents(line.product.PriceCents),
+			LineTotal: fromCents(line.total),
+			Eligible:  line.eligible,
+			Discount:  fromCents(line.discount),
+			Total:     fromCents(line.total - line.discount),
+		}
+	}
+	return quote
+}
+
+// checkRedeemable verifica se o cupão pode ser usado agora, por um utilizador que já
+// o usou userRedemptions vezes, num carrinho com o valor elegível indicado
+func checkRedeemable(coupon *models.Coupon, userRedemptions, eligible int, now time.Time) error {
+	if !coupon.IsActive {
+		return ErrCouponInactive
+	}
+	if coupon.ValidFrom != nil && now.Before(*coupon.ValidFrom) {
+		return ErrCouponNotStarted
+	}
+	if coupon.ValidUntil != nil && !now.Before(*coupon.ValidUntil) {
+		return ErrCouponExpired
+	}
+	if eligible == 0 {
+		return ErrCouponNotApplicable
+	}
+	if eligible < coupon.MinOrderCents {
+		return NewError(ErrUnprocessable, "coupon_min_order_not_met",
+			fmt.Sprintf("the coupon requires an order of at least %.2f", fromCents(coupon.MinOrderCents)))
+	}
+	if coupon.MaxRedemptions != nil && coupon.RedemptionCount >= *coupon.MaxRedemptions {
+		return ErrCouponExhausted
+	}
+	if coupon.MaxRedemptionsPerUser != nil && userRedemptions >= *coupon.MaxRedemptionsPerUser {
+		return ErrCouponUserLimit
+	}
+	return nil
+}
+
+// couponCode normaliza o código para maiúsculas; só são aceites letras, algarismos,
+// hífenes e underscores
+func couponCode(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return "", NewFieldError("code", "required", "code is required")
+	}
+	for _, r := range code {
+		if (r < 'A' || r > 'Z') && (r < '0' || r > '9') && r != '-' && r != '_' {
+			return "", NewFieldError("code", "format", "code may only contain letters, digits, hyphens and underscores")
+		}
+	}
+	return code, nil
+}
+
+func checkValidity(from, until *time.Time) error {
+	if from != nil && until != nil && !until.After(*from) {
+		return NewFieldError("valid_until", "gtfield", "valid_until must be after valid_from")
+	}
+	return nil
+}
+
+func couponStoreID(coupon *models.Coupon) int64 {
+	if coupon.StoreID == nil {
+		return 0
+	}
+	return *coupon.StoreID
+}
+
+// optionalLimit traduz um limite recebido na API: 0 remove o limite
+func optionalLimit(limit int) *int {
+	if limit == 0 {
+		return nil
+	}
+	return &limit
+}
+
+func setRedemptionAmounts(redemption *models.CouponRedemption) {
+	redemption.Subtotal = fromCents(redemption.SubtotalCents)
+	redemption.Discount = fromCents(redemption.DiscountCents)
+	redemption.Total = fromCents(redemption.SubtotalCents - redemption.DiscountCents)
+}
+
+func toCents(amount float64) int {
+	return int(math.Round(amount * 100))
+}
+
+func fromCents(cents int) float64 {
+	return float64(cents) / 100
+}
@@ -0,0 +1,206 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Categorias de erro. Cada erro de domínio pertence a uma delas (errors.Is(err, ErrNotFound)),
+// e é a categoria que decide o status HTTP da resposta.
+var (
+	ErrNotFound      = errors.New("not found")
+	ErrForbidden     = errors.New("forbidden")
+	ErrConflict      = errors.New("conflict")
+	ErrValidation    = errors.New("validation failed")
+	ErrUnauthorized  = errors.New("unauthorized")
+	ErrTooLarge      = errors.New("payload too large")
+	ErrRateLimited   = errors.New("too many requests")
+	ErrUnprocessable = errors.New("unprocessable entity")
+
+	ErrPreconditionFailed = errors.New("precondition failed")
+)
+
+// Error é um erro de domínio com um código estável que os clientes podem usar,
+// ao contrário da mensagem, que pode mudar
+type Error struct {
+	Kind    error        // uma das categorias acima
+	Code    string       // por exemplo "product_not_found"
+	Message string       // mensagem legível, segura para mostrar ao cliente
+	Fields  []FieldError // detalhes por campo, nos erros de validação
+	Err     error        // causa original, apenas para logs
+
+	RetryAfter time.Duration // quando o cliente pode tentar de novo (ErrRateLimited)
+}
+
+// FieldError descreve um campo inválido
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func NewError(kind error, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+// Unwrap permite errors.Is com a categoria e com a causa
+func (e *Error) Unwrap() []error {
+	if e.Err != nil {
+		return []error{e.Kind, e.Err}
+	}
+	return []error{e.Kind}
+}
+
+// Is compara pelo código, para que uma cópia com causa (Wrap) continue a
+// corresponder à variável original: errors.Is(err, ErrProductNotFound)
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// Wrap devolve uma cópia do erro com a causa indicada
+func (e *Error) Wrap(err error) *Error {
+	clone := *e
+	clone.Err = err
+	return &clone
+}
+
+// Erros de domínio partilhados pelos serviços
+var (
+	ErrProductNotFound = NewError(ErrNotFound, "product_not_found", "product not found")
+	ErrProductNotOwned = NewError(ErrForbidden, "product_not_owned", "product does not belong to your store")
+	ErrProductSKUTaken = NewError(ErrConflict, "product_sku_taken", "another product of the store already has this sku")
+	ErrStoreNotFound   = NewError(ErrNotFound, "store_not_found", "store not found")
+	ErrStoreNotOwned   = NewError(ErrForbidden, "store_not_owned", "you are not the owner of this store")
+	ErrStoreExists     = NewError(ErrConflict, "store_exists", "user already has a store")
+	ErrStoreDeleted    = NewError(ErrConflict, "store_deleted", "the product's store is deleted, restore the store first")
+
+	// Controlo de concorrência otimista: ErrVersionMismatch quando o If-Match do
+	// cliente não corresponde à versão atual, ErrEditConflict quando outro pedido
+	// alterou o registo entre a leitura e a escrita
+	ErrVersionMismatch = NewError(ErrPreconditionFailed, "version_mismatch", "the resource has changed since it was fetched")
+	ErrEditConflict    = NewError(ErrConflict, "edit_conflict", "the resource was modified by another request, fetch it again and retry")
+)
+
+// checkVersion compara a versão que o cliente espera (If-Match) com a atual;
+// expected 0 significa que o pedido não trouxe pré-condição
+func checkVersion(expected, current int64) error {
+	if expected != 0 && expected != current {
+		return ErrVersionMismatch
+	}
+	return nil
+}
+
+// versionConflict explica uma escrita condicionada à versão que não afetou nenhuma
+// linha: o registo foi apagado entretanto, ou alterado por outro pedido depois de
+// lido. Com If-Match a alteração é uma pré-condição falhada; sem ele é um conflito.
+func versionConflict(exists bool, expected int64, notFound error) error {
+	if !exists {
+		return notFound
+	}
+	if expected != 0 {
+		return ErrVersionMismatch
+	}
+	return ErrEditConflict
+}
+
+// NewFieldError cria um erro de validação para um único campo
+func NewFieldError(field, code, message string) *Error {
+	return &Error{
+		Kind:    ErrValidation,
+		Code:    "validation_failed",
+		Message: message,
+		Fields:  []FieldError{{Field: field, Code: code, Message: message}},
+	}
+}
+
+// NewValidationError converte erros do validator (ou do binding do gin) num erro de
+// validação com detalhes por campo. Outros erros, como JSON mal formado, passam a
+// "invalid_request" sem expor a mensagem original ao cliente.
+func NewValidationError(err error) *Error {
+	var domainErr *Error
+	if errors.As(err, &domainErr) {
+		return domainErr
+	}
+
+	var ve validator.ValidationErrors
+	if !errors.As(err, &ve) {
+		return &Error{Kind: ErrValidation, Code: "invalid_request", Message: "request body is not valid", Err: err}
+	}
+
+	fields := make([]FieldError, len(ve))
+	for i, fe := range ve {
+		fields[i] = FieldError{
+			Field:   fieldName(fe),
+			Code:    fe.Tag(),
+			Message: fieldErrorMessage(fe),
+		}
+	}
+	return &Error{Kind: ErrValidation, Code: "validation_failed", Message: "validation failed", Fields: fields, Err: err}
+}
+
+// fieldErrorMessage devolve uma mensagem legível para um erro do validator
+func fieldErrorMessage(fe validator.FieldError) string {
+	field := fieldName(fe)
+	unit := ""
+	if fe.Kind() == reflect.String {
+		unit = " characters long"
+	}
+
+	switch fe.Tag() {
+	case "required":
+		return field + " is required"
+	case "email":
+		return field + " must be a valid email address"
+	case "min", "gte":
+		return field + " must be at least " + fe.Param() + unit
+	case "max", "lte":
+		return field + " must be at most " + fe.Param() + unit
+	case "gt":
+		return field + " must be greater than " + fe.Param()
+	case "lt":
+		return field + " must be less than " + fe.Param()
+	case "alphanum":
+		return field + " must contain only alphanumeric characters"
+	case "e164":
+		return field + " must be a valid phone number in E164 format"
+	case "url":
+		return field + " must be a valid URL"
+	case "oneof":
+		return field + " must be one of: " + fe.Param()
+	default:
+		return field + " is invalid"
+	}
+}
+
+// fieldName converte o nome do campo Go para o nome usado no JSON (LogoURL -> logo_url)
+func fieldName(fe validator.FieldError) string {
+	name := fe.Field()
+	var b strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			prevLower := i > 0 && unicode.IsLower(runes[i-1])
+			nextLower := i > 0 && i+1 < len(runes) && unicode.IsUpper(runes[i-1]) && unicode.IsLower(runes[i+1])
+			if prevLower || nextLower {
+				b.WriteByte('_')
+			}
+			b.WriteRune(unicode.ToLower(r))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"modress/internal/models"
+	"modress/internal/repositories"
+	"modress/internal/tracing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	ErrIdempotencyInProgress = NewError(ErrConflict, "idempotency_key_in_use", "a request with this Idempotency-Key is still being processed")
+	ErrIdempotencyKeyReused  = NewError(ErrUnprocessable, "idempotency_key_reused", "this Idempotency-Key was already used with a different request")
+
+	// ErrIdempotencyLockLost é devolvido por Complete quando o pedido demorou mais do
+	// que idempotencyLockTimeout e uma repetição ficou com a chave
+	ErrIdempotencyLockLost = errors.New("idempotency key was taken over by another request")
+)
+
+// idempotencyLockTimeout é quanto tempo um pedido pode ficar em "processing" antes de
+// se assumir que a instância que o tratava morreu
+const idempotencyLockTimeout = 2 * time.Minute
+
+// IdempotencyService interface
+type IdempotencyService interface {
+	// Begin reserva a chave. Devolve a resposta guardada quando o pedido já foi
+	// concluído, ou nil e o token da reserva quando o pedido deve ser executado; o
+	// token é passado a Complete ou Release.
+	Begin(ctx context.Context, userID int64, key, method, path, fingerprint string) (*models.StoredResponse, string, error)
+	Complete(ctx context.Context, userID int64, key, lockToken string, response models.StoredResponse) error
+	Release(ctx context.Context, userID int64, key, lockToken string) error
+	PurgeExpired(ctx context.Context) (int64, error)
+}
+
+type idempotencyService struct {
+	repo repositories.IdempotencyRepository
+	ttl  time.Duration
+}
+
+func NewIdempotencyService(repo repositories.IdempotencyRepository, ttl time.Duration) IdempotencyService {
+	return &idempotencyService{
+		repo: repo,
+		ttl:  ttl,
+	}
+}
+
+func (s *idempotencyService) Begin(ctx context.Context, userID int64, key, method, path, fingerprint string) (*models.StoredResponse, string, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "idempotencyService.Begin", attribute.Int64("user.id", userID))
+	defer span.End()
+
+	token, err := newLockToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	acquired, existing, err := s.repo.Acquire(ctx, &models.IdempotencyKey{
+		UserID:      userID,
+		Key:         key,
+		Method:      method,
+		Path:        path,
+		Fingerprint: fingerprint,
+		Status:      models.IdempotencyStatusProcessing,
+		LockedUntil: now.Add(idempotencyLockTimeout),
+		LockToken:   token,
+		ExpiresAt:   now.Add(s.ttl),
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("error acquiring idempotency key: %w", err)
+	}
+	if acquired {
+		return nil, token, nil
+	}
+	if existing == nil {
+		// O registo desapareceu entre o insert e a leitura: outro pedido com a mesma
+		// chave acabou de falhar. Tratar como concorrente e deixar o cliente repetir.
+		return nil, "", ErrIdempotencyInProgress
+	}
+
+	if existing.Fingerprint != fingerprint {
+		return nil, "", ErrIdempotencyKeyReused
+	}
+	if existing.Status != models.IdempotencyStatusCompleted || existing.ResponseStatus == nil {
+		return nil, "", ErrIdempotencyInProgress
+	}
+
+	response := &models.StoredResponse{
+		Status: *existing.ResponseStatus,
+		Body:   existing.ResponseBody,
+	}
+	if existing.ResponseHeaders != nil {
+		if err := json.Unmarshal(*existing.ResponseHeaders, &response.Headers); err != nil {
+			return nil, "", fmt.Errorf("error decoding stored response headers: %w", err)
+		}
+	}
+	return response, "", nil
+}
+
+func newLockToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating idempotency lock token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (s *idempotencyService) Complete(ctx context.Context, userID int64, key, lockToken string, response models.StoredResponse) error {
+	ctx, span := tracing.Start(ctx, tracerName, "idempotencyService.Complete", attribute.Int64("user.id", userID))
+	defer span.End()
+
+	if err := s.repo.Complete(ctx, userID, key, lockToken, response); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrIdempotencyLockLost
+		}
+		return fmt.Errorf("error storing idempotent response: %w", err)
+	}
+	return nil
+}
+
+func (s *idempotencyService) Release(ctx context.Context, userID int64, key, lockToken string) error {
+	ctx, span := tracing.Start(ctx, tracerName, "idempotencyService.Release", attribute.Int64("user.id", userID))
+	defer span.End()
+
+	if err := s.repo.Release(ctx, userID, key, lockToken); err != nil {
+		return fmt.Errorf("error releasing idempotency key: %w", err)
+	}
+	return nil
+}
+
+func (s *idempotencyService) PurgeExpired(ctx context.Context) (int64, error) {
+	n, err := s.repo.DeleteExpired(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error purging idempotency keys: %w", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"modress/internal/models"
+	"modress/internal/repositories"
+	"modress/internal/tracing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	ErrJobNotFound     = NewError(ErrNotFound, "job_not_found", "job not found")
+	ErrJobNotRetryable = NewError(ErrConflict, "job_not_retryable", "only dead or pending jobs can be retried")
+)
+
+// JobNotifier acorda os workers quando um job novo é colocado na fila
+type JobNotifier interface {
+	Notify()
+}
+
+// JobService interface
+type JobService interface {
+	Enqueue(ctx context.Context, req models.EnqueueJobRequest) (*models.Job, error)
+	GetJob(ctx context.Context, id int64) (*models.Job, error)
+	ListJobs(ctx context.Context, filter models.JobFilter) ([]models.Job, error)
+	RetryJob(ctx context.Context, id int64) (*models.Job, error)
+}
+
+type jobService struct {
+	jobRepo  repositories.JobRepository
+	notifier JobNotifier
+	audit    AuditService
+}
+
+func NewJobService(jobRepo repositories.JobRepository, notifier JobNotifier, auditService AuditService) JobService {
+	return &jobService{
+		jobRepo:  jobRepo,
+		notifier: notifier,
+		audit:    auditService,
+	}
+}
+
+func (s *jobService) Enqueue(ctx context.Context, req models.EnqueueJobRequest) (*models.Job, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "jobService.Enqueue")
+	defer span.End()
+
+	if req.Type == "" {
+		return nil, NewFieldError("type", "required", "type is required")
+	}
+
+	payload, err := json.Marshal(req.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding job payload: %w", err)
+	}
+
+	now := time.Now()
+	job := &models.Job{
+		Type:        req.Type,
+		Payload:     payload,
+		Status:      models.JobStatusPending,
+		MaxAttempts: req.MaxAttempts,
+		RunAt:       req.RunAt,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if job.MaxAttempts < 1 {
+		job.MaxAttempts = 5
+	}
+	if job.RunAt.IsZero() {
+		job.RunAt = now
+	}
+
+	if err := s.jobRepo.Create(ctx, job); err != nil {
+		return nil, fmt.Errorf("error enqueuing job: %w", err)
+	}
+
+	if s.notifier != nil && !job.RunAt.After(now) {
+		s.notifier.Notify()
+	}
+
+	return job, nil
+}
+
+func (s *jobService) GetJob(ctx context.Context, id int64) (*models.Job, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "jobService.GetJob", attribute.Int64("job.id", id))
+	defer span.End()
+
+	job, err := s.jobRepo.FindByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("error finding job: %w", err)
+	}
+	if job == nil {
+		return nil, ErrJobNotFound
+	}
+	return job, nil
+}
+
+func (s *jobService) ListJobs(ctx context.Context, filter models.JobFilter) ([]models.Job, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "jobService.ListJobs")
+	defer span.End()
+
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.Limit < 1 || filter.Limit > 100 {
+		filter.Limit = 20
+	}
+
+	jobs, err := s.jobRepo.List(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("error listing jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+func (s *jobService) RetryJob(ctx context.Context, id int64) (*models.Job, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "jobService.RetryJob", attribute.Int64("job.id", id))
+	defer span.End()
+
+	before, err := s.GetJob(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.jobRepo.Retry(ctx, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrJobNotRetryable
+		}
+		return nil, fmt.Errorf("error retrying job: %w", err)
+	}
+
+	if s.notifier != nil {
+		s.notifier.Notify()
+	}
+
+	job, err := s.GetJob(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	s.audit.Record(ctx, "job.retry", models.AuditEntityJob, id, before, job)
+	return job, nil
+}
@@ -0,0 +1,293 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"modress/internal/hub"
+	"modress/internal/logging"
+	"modress/internal/mail"
+	"modress/internal/models"
+	"modress/internal/repositories"
+	"modress/internal/tracing"
+	"modress/internal/wsproto"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	ErrNotificationNotFound = NewError(ErrNotFound, "notification_not_found", "notification not found")
+)
+
+// RealtimePublisher entrega um evento às ligações WebSocket do utilizador, em
+// qualquer instância
+type RealtimePublisher interface {
+	Publish(ctx context.Context, event hub.Event) error
+}
+
+// NotificationService guarda as notificações dos utilizadores e entrega-as pelos
+// canais que cada um escolheu: na aplicação (guardada e enviada pelo WebSocket) e
+// por email (num job notification.email)
+type NotificationService interface {
+	// Notify envia uma notificação de outro serviço. Como na auditoria, uma falha é
+	// registada nos logs mas não faz falhar a operação que a originou.
+	Notify(ctx context.Context, req models.NotifyRequest)
+	List(ctx context.Context, userID int64, unreadOnly bool, page, limit int) ([]models.Notification, error)
+	UnreadCount(ctx context.Context, userID int64) (int64, error)
+	MarkRead(ctx context.Context, userID, id int64) (*models.Notification, error)
+	MarkAllRead(ctx context.Context, userID int64) (int64, error)
+	// GetPreferences devolve as preferências de todos os tipos, com as por omissão
+	// nos que o utilizador nunca alterou
+	GetPreferences(ctx context.Context, userID int64) ([]models.NotificationPreference, error)
+	UpdatePreferences(ctx context.Context, userID int64, req *models.UpdateNotificationPreferencesRequest) ([]models.NotificationPreference, error)
+	HandleEmailJob(ctx context.Context, payload models.NotificationEmailJobPayload) error
+}
+
+type notificationService struct {
+	notificationRepo repositories.NotificationRepository
+	userRepo         repositories.UserRepository
+	jobService       JobService
+	publisher        RealtimePublisher
+	mailer           mail.Sender
+}
+
+func NewNotificationService(notificationRepo repositories.NotificationRepository, userRepo repositories.UserRepository, jobService JobService, publisher RealtimePublisher, mailer mail.Sender) NotificationService {
+	return &notificationService{
+		notificationRepo: notificationRepo,
+		userRepo:         userRepo,
+		jobService:       jobService,
+		publisher:        publisher,
+		mailer:           mailer,
+	}
+}
+
+func (s *notificationService) Notify(ctx context.Context, req models.NotifyRequest) {
+	ctx, span := tracing.Start(ctx, tracerName, "notificationService.Notify", attribute.Int64("user.id", req.UserID), attribute.String("notification.type", req.Type))
+	defer span.End()
+
+	// A operação que a originou já foi feita: a notificação segue mesmo que o cliente
+	// tenha desistido
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+
+	if err := s.notify(ctx, req); err != nil {
+		logging.FromContext(ctx).Error("failed to send notification",
+			"user_id", req.UserID,
+			"type", req.Type,
+			logging.Err(err),
+		)
+	}
+}
+
+func (s *notificationService) notify(ctx context.Context, req models.NotifyRequest) error {
+	preference, err := s.preference(ctx, req.UserID, req.Type)
+	if err != nil {
+		return err
+	}
+
+	if preference.InApp {
+		data := json.RawMessage("{}")
+		if req.Data != nil {
+			if data, err = json.Marshal(req.Data); err != nil {
+				return fmt.Errorf("error encoding notification data: %w", err)
+			}
+		}
+		notification := &models.Notification{
+			UserID: req.UserID,
+			Type:   req.Type,
+			Title:  req.Title,
+			Body:   req.Body,
+			Data:   data,
+		}
+		if err := s.notificationRepo.Create(ctx, notification); err != nil {
+			return fmt.Errorf("error creating notification: %w", err)
+		}
+		s.push(ctx, notification)
+	}
+
+	if preference.Email {
+		_, err := s.jobService.Enqueue(ctx, models.EnqueueJobRequest{
+			Type: models.JobTypeNotificationEmail,
+			Payload: models.NotificationEmailJobPayload{
+				UserID:  req.UserID,
+				Type:    req.Type,
+				Subject: req.Title,
+				Body:    req.Body,
+			},
+			MaxAttempts: 5,
+		})
+		if err != nil {
+			return fmt.Errorf("error enqueueing notification email: %w", err)
+		}
+	}
+	return nil
+}
+
+// push envia a notificação às ligações do utilizador. Quem não estiver ligado vê-a
+// na lista quando voltar.
+func (s *notificationService) push(ctx context.Context, notification *models.Notification) {
+	frame, err := wsproto.Encode(wsproto.TypeNotification, "", notification)
+	if err != nil {
+		logging.FromContext(ctx).Error("error encoding notification event", logging.Err(err))
+		return
+	}
+	if err := s.publisher.Publish(ctx, hub.Event{UserID: notification.UserID, Frame: frame}); err != nil {
+		logging.FromContext(ctx).Warn("failed to publish notification", "notification_id", notification.ID, logging.Err(err))
+	}
+}
+
+// preference devolve a preferência do utilizador para o tipo, ou a por omissão
+func (s *notificationService) preference(ctx context.Context, userID int64, notificationType string) (models.NotificationPreference, error) {
+	preferences, err := s.GetPreferences(ctx, userID)
+	if err != nil {
+		return models.NotificationPreference{}, err
+	}
+	for _, preference := range preferences {
+		if preference.Type == notificationType {
+			return preference, nil
+		}
+	}
+	return models.NotificationPreference{}, fmt.Errorf("unknown notification type %q", notificationType)
+}
+
+func (s *notificationService) List(ctx context.Context, userID int64, unreadOnly bool, page, limit int) ([]models.Notification, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "notificationService.List", attribute.Int64("user.id", userID))
+	defer span.End()
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	notifications, err := s.notificationRepo.List(ctx, userID, unreadOnly, page, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error listing notifications: %w", err)
+	}
+	return notifications, nil
+}
+
+func (s *notificationService) UnreadCount(ctx context.Context, userID int64) (int64, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "notificationService.UnreadCount", attribute.Int64("user.id", userID))
+	defer span.End()
+
+	count, err := s.notificationRepo.CountUnread(ctx, userID)
+	if err != nil {
+		return 0, fmt.Errorf("error counting unread notifications: %w", err)
+	}
+	return count, nil
+}
+
+func (s *notificationService) MarkRead(ctx context.Context, userID, id int64) (*models.Notification, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "notificationService.MarkRead", attribute.Int64("user.id", userID), attribute.Int64("notification.id", id))
+	defer span.End()
+
+	notification, err := s.notificationRepo.MarkRead(ctx, userID, id)
+	if err != nil {
+		return nil, fmt.Errorf("error marking notification read: %w", err)
+	}
+	// As notificações de outros utilizadores não existem para este
+	if notification == nil {
+		return nil, ErrNotificationNotFound
+	}
+	return notification, nil
+}
+
+func (s *notificationService) MarkAllRead(ctx context.Context, userID int64) (int64, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "notificationService.MarkAllRead", attribute.Int64("user.id", userID))
+	defer span.End()
+
+	count, err := s.notificationRepo.MarkAllRead(ctx, userID)
+	if err != nil {
+		return 0, fmt.Errorf("error marking notifications read: %w", err)
+	}
+	return count, nil
+}
+
+func (s *notificationService) GetPreferences(ctx context.Context, userID int64) ([]models.NotificationPreference, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "notificationService.GetPreferences", attribute.Int64("user.id", userID))
+	defer span.End()
+
+	stored, err := s.notificationRepo.GetPreferences(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error finding notification preferences: %w", err)
+	}
+
+	preferences := make([]models.NotificationPreference, len(models.NotificationTypes))
+	copy(preferences, models.NotificationTypes)
+	for i := range preferences {
+		for _, preference := range stored {
+			if preference.Type == preferences[i].Type {
+				preferences[i] = preference
+			}
+		}
+	}
+	return preferences, nil
+}
+
+func (s *notificationService) UpdatePreferences(ctx context.Context, userID int64, req *models.UpdateNotificationPreferencesRequest) ([]models.NotificationPreference, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "notificationService.UpdatePreferences", attribute.Int64("user.id", userID))
+	defer span.End()
+
+	if err := req.Validate(); err != nil {
+		return nil, NewValidationError(err)
+	}
+
+	// Um tipo repetido fica com o último valor
+	index := make(map[string]int)
+	var preferences []models.NotificationPreference
+	for _, update := range req.Preferences {
+		if !knownNotificationType(update.Type) {
+			return nil, NewFieldError("type", "oneof", "unknown notification type "+update.Type)
+		}
+		preference := models.NotificationPreference{Type: update.Type, InApp: *update.InApp, Email: *update.Email}
+		if j, ok := index[update.Type]; ok {
+			preferences[j] = preference
+			continue
+		}
+		index[update.Type] = len(preferences)
+		preferences = append(preferences, preference)
+	}
+
+	if err := s.notificationRepo.UpsertPreferences(ctx, userID, preferences); err != nil {
+		return nil, fmt.Errorf("error updating notification preferences: %w", err)
+	}
+	return s.GetPreferences(ctx, userID)
+}
+
+func knownNotificationType(notificationType string) bool {
+	for _, known := range models.NotificationTypes {
+		if known.Type == notificationType {
+			return true
+		}
+	}
+	return false
+}
+
+// HandleEmailJob processa o job notification.email. Uma conta apagada entretanto já
+// não recebe o email.
+func (s *notificationService) HandleEmailJob(ctx context.Context, payload models.NotificationEmailJobPayload) error {
+	ctx, span := tracing.Start(ctx, tracerName, "notificationService.HandleEmailJob", attribute.Int64("user.id", payload.UserID), attribute.String("notification.type", payload.Type))
+	defer span.End()
+
+	user, err := s.userRepo.FindByID(ctx, payload.UserID)
+	if err != nil {
+		return fmt.Errorf("error finding user: %w", err)
+	}
+	if user == nil {
+		logging.FromContext(ctx).Info("notification email skipped: user not found", "user_id", payload.UserID)
+		return nil
+	}
+
+	err = s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: payload.Subject,
+		Body:    payload.Body,
+	})
+	if err != nil {
+		return fmt.Errorf("error sending notification email: %w", err)
+	}
+	return nil
+}
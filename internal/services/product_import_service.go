@@ -0,0 +1,525 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"modress/internal/audit"
+	"modress/internal/jobs"
+	"modress/internal/logging"
+	"modress/internal/metrics"
+	"modress/internal/models"
+	"modress/internal/repositories"
+	"modress/internal/tracing"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// MaxImportRows limita o número de linhas aceites num único ficheiro
+const MaxImportRows = 50000
+
+var ErrImportJobNotFound = NewError(ErrNotFound, "import_job_not_found", "import job not found")
+
+// ProductImportService interface
+type ProductImportService interface {
+	ImportProducts(ctx context.Context, storeID int64, rows []models.ProductImportRow, dryRun bool) (*models.ImportResult, error)
+	StartImportJob(ctx context.Context, storeID int64, rows []models.ProductImportRow, dryRun bool) (*models.ImportJob, error)
+	GetImportJob(ctx context.Context, storeID int64, jobID int64) (*models.ImportJob, error)
+	HandleImportJob(ctx context.Context, payload models.ProductImportJobPayload) error
+	ExportProducts(ctx context.Context, storeID int64, w io.Writer) error
+}
+
+type productImportService struct {
+	productRepo   repositories.ProductRepository
+	storeRepo     repositories.StoreRepository
+	jobService    JobService
+	audit         AuditService
+	notifications NotificationService
+	webhooks      WebhookService
+	wishlists     WishlistService
+}
+
+func NewProductImportService(productRepo repositories.ProductRepository, storeRepo repositories.StoreRepository, jobService JobService, auditService AuditService, notificationService NotificationService, webhookService WebhookService, wishlistService WishlistService) ProductImportService {
+	return &productImportService{
+		productRepo:   productRepo,
+		storeRepo:     storeRepo,
+		jobService:    jobService,
+		audit:         auditService,
+		notifications: notificationService,
+		webhooks:      webhookService,
+		wishlists:     wishlistService,
+	}
+}
+
+func (s *productImportService) ImportProducts(ctx context.Context, storeID int64, rows []models.ProductImportRow, dryRun bool) (*models.ImportResult, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "productImportService.ImportProducts", attribute.Int64("store.id", storeID))
+	defer span.End()
+
+	return s.importRows(ctx, storeID, rows, dryRun, nil)
+}
+
+// StartImportJob coloca a importação na fila de jobs e devolve o job para acompanhamento
+func (s *productImportService) StartImportJob(ctx context.Context, storeID int64, rows []models.ProductImportRow, dryRun bool) (*models.ImportJob, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "productImportService.StartImportJob", attribute.Int64("store.id", storeID))
+	defer span.End()
+
+	job, err := s.jobService.Enqueue(ctx, models.EnqueueJobRequest{
+		Type: models.JobTypeProductImport,
+		Payload: models.ProductImportJobPayload{
+			StoreID: storeID,
+			DryRun:  dryRun,
+			Rows:    rows,
+			Actor:   audit.ActorFrom(ctx),
+		},
+		MaxAttempts: 3,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	importJob := toImportJob(job, storeID)
+	importJob.Total = len(rows)
+	return importJob, nil
+}
+
+func (s *productImportService) GetImportJob(ctx context.Context, storeID int64, jobID int64) (*models.ImportJob, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "productImportService.GetImportJob", attribute.Int64("store.id", storeID), attribute.Int64("job.id", jobID))
+	defer span.End()
+
+	job, err := s.jobService.GetJob(ctx, jobID)
+	if err != nil {
+		if errors.Is(err, ErrJobNotFound) {
+			return nil, ErrImportJobNotFound
+		}
+		return nil, err
+	}
+	if job.Type != models.JobTypeProductImport {
+		return nil, ErrImportJobNotFound
+	}
+
+	// Descodificar apenas o store_id para não carregar todas as linhas
+	var owner struct {
+		StoreID int64 `json:"store_id"`
+	}
+	if err := json.Unmarshal(job.Payload, &owner); err != nil || owner.StoreID != storeID {
+		return nil, ErrImportJobNotFound
+	}
+
+	return toImportJob(job, storeID), nil
+}
+
+// HandleImportJob processa o job product.import na fila de jobs
+func (s *productImportService) HandleImportJob(ctx context.Context, payload models.ProductImportJobPayload) error {
+	ctx, span := tracing.Start(ctx, tracerName, "productImportService.HandleImportJob")
+	defer span.End()
+
+	// O worker escreve as alterações em nome de quem pediu a importação
+	ctx = audit.WithActor(ctx, payload.Actor)
+
+	total := len(payload.Rows)
+	jobs.ReportProgress(ctx, 0, total)
+
+	result, err := s.importRows(ctx, payload.StoreID, payload.Rows, payload.DryRun, func(processed int) {
+		jobs.ReportProgress(ctx, processed, total)
+	})
+	if err != nil {
+		return err
+	}
+
+	return jobs.SetResult(ctx, result)
+}
+
+// toImportJob converte um job genérico na vista de progresso exposta ao lojista
+func toImportJob(job *models.Job, storeID int64) *models.ImportJob {
+	importJob := &models.ImportJob{
+		ID:         job.ID,
+		StoreID:    storeID,
+		Total:      job.Total,
+		Processed:  job.Progress,
+		CreatedAt:  job.CreatedAt,
+		FinishedAt: job.FinishedAt,
+	}
+
+	switch job.Status {
+	case models.JobStatusPending:
+		importJob.Status = models.ImportJobPending
+	case models.JobStatusRunning:
+		importJob.Status = models.ImportJobRunning
+	case models.JobStatusSucceeded:
+		importJob.Status = models.ImportJobCompleted
+	default:
+		importJob.Status = models.ImportJobFailed
+	}
+
+	if job.LastError != nil && job.Status == models.JobStatusDead {
+		importJob.Error = *job.LastError
+	}
+
+	if job.Result != nil {
+		var result models.ImportResult
+		if err := json.Unmarshal(*job.Result, &result); err == nil {
+			importJob.Result = &result
+		}
+	}
+
+	return importJob
+}
+
+// ExportProducts escreve o catálogo da loja em CSV, linha a linha
+func (s *productImportService) ExportProducts(ctx context.Context, storeID int64, w io.Writer) error {
+	ctx, span := tracing.Start(ctx, tracerName, "productImportService.ExportProducts", attribute.Int64("store.id", storeID))
+	defer span.End()
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(models.ProductExportColumns); err != nil {
+		return fmt.Errorf("error writing csv header: %w", err)
+	}
+
+	count := 0
+	err := s.productRepo.ForEachByStoreID(ctx, storeID, func(p *models.Product) error {
+		record := []string{
+			derefString(p.SKU),
+			p.Title,
+			derefString(p.Description),
+			formatCents(p.PriceCents),
+			"",
+			derefString(p.Barcode),
+			strconv.Itoa(p.Quantity),
+			derefString(p.Category),
+			strconv.FormatBool(p.IsActive),
+		}
+		if p.CostCents != nil {
+			record[4] = formatCents(*p.CostCents)
+		}
+		if err := writer.Write(record); err != nil {
+			return fmt.Errorf("error writing csv row: %w", err)
+		}
+
+		// Enviar ao cliente em blocos para não acumular o catálogo inteiro
+		count++
+		if count%100 == 0 {
+			writer.Flush()
+			if err := writer.Error(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error exporting products: %w", err)
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func (s *productImportService) importRows(ctx context.Context, storeID int64, rows []models.ProductImportRow, dryRun bool, onProgress func(int)) (*models.ImportResult, error) {
+	result := &models.ImportResult{
+		DryRun:    dryRun,
+		Total:     len(rows),
+		RowErrors: []models.ImportRowError{},
+	}
+
+	seen := make(map[string]int)
+	for i := range rows {
+		row := &rows[i]
+		if onProgress != nil && i > 0 && i%50 == 0 {
+			onProgress(i)
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		sku := strings.TrimSpace(derefString(row.SKU))
+		rowErrs := validateImportRow(row)
+		if sku != "" {
+			if firstLine, dup := seen[sku]; dup {
+				rowErrs = append(rowErrs, fmt.Sprintf("duplicate sku in file (first seen on line %d)", firstLine))
+			} else {
+				seen[sku] = row.Line
+			}
+		}
+		if len(rowErrs) > 0 {
+			addRowError(result, row.Line, sku, rowErrs...)
+			continue
+		}
+
+		if dryRun {
+			existing, err := s.productRepo.FindBySKU(ctx, storeID, sku)
+			if err != nil {
+				return nil, fmt.Errorf("error finding product by sku: %w", err)
+			}
+			if existing == nil {
+				result.Created++
+			} else {
+				result.Updated++
+			}
+			continue
+		}
+
+		// O upsert resolve a concorrência com outras importações e criações do mesmo
+		// SKU no índice único, em vez de procurar e depois criar
+		product := newProductFromImport(storeID, sku, row)
+		before, err := s.productRepo.UpsertBySKU(ctx, product, row.IsActive != nil)
+		if err != nil {
+			addRowError(result, row.Line, sku, fmt.Sprintf("error saving product: %v", err))
+			continue
+		}
+
+		if before == nil {
+			metrics.ProductsCreated.WithLabelValues("import").Inc()
+			s.audit.Record(ctx, "product.create", models.AuditEntityProduct, product.ID, nil, product)
+			s.webhooks.Dispatch(ctx, storeID, models.WebhookEventProductCreated, product.ToResponse())
+			result.Created++
+			continue
+		}
+
+		// Os mesmos avisos que a edição pela API: esgotado ao lojista e descida de
+		// preço ou regresso ao stock a quem tem o produto numa lista de desejos
+		s.audit.Record(ctx, "product.update", models.AuditEntityProduct, product.ID, before, product)
+		if before.Quantity > 0 && product.Quantity == 0 {
+			notifyOutOfStock(ctx, s.storeRepo, s.notifications, product)
+		}
+		s.wishlists.ProductChanged(ctx, before, product)
+		s.webhooks.Dispatch(ctx, storeID, models.WebhookEventProductUpdated, product.ToResponse())
+		if before.Quantity != product.Quantity {
+			s.webhooks.Dispatch(ctx, storeID, models.WebhookEventStockChanged, models.StockChange{
+				ProductID:        product.ID,
+				SKU:              product.SKU,
+				PreviousQuantity: before.Quantity,
+				Quantity:         product.Quantity,
+			})
+		}
+		result.Updated++
+	}
+
+	if onProgress != nil {
+		onProgress(len(rows))
+	}
+
+	logging.FromContext(ctx).Info("product import finished",
+		"store_id", storeID,
+		"dry_run", dryRun,
+		"total", result.Total,
+		"created", result.Created,
+		"updated", result.Updated,
+		"failed", result.Failed,
+	)
+	return result, nil
+}
+
+func addRowError(result *models.ImportResult, line int, sku string, errs ...string) {
+	result.Failed++
+	result.RowErrors = append(result.RowErrors, models.ImportRowError{
+		Line:   line,
+		SKU:    sku,
+		Errors: errs,
+	})
+}
+
+// ParseProductCSV lê um CSV com cabeçalho cujas colunas correspondem a CreateProductRequest
+func ParseProductCSV(r io.Reader) ([]models.ProductImportRow, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("csv file is empty")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading csv header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		columns[name] = i
+	}
+	if _, ok := columns["sku"]; !ok {
+		return nil, fmt.Errorf("csv header must include a sku column")
+	}
+	if _, ok := columns["title"]; !ok {
+		return nil, fmt.Errorf("csv header must include a title column")
+	}
+
+	var rows []models.ProductImportRow
+	line := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			return nil, fmt.Errorf("error reading csv line %d: %w", line, err)
+		}
+		if len(rows) >= MaxImportRows {
+			return nil, fmt.Errorf("file exceeds the limit of %d rows", MaxImportRows)
+		}
+
+		get := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		row := models.ProductImportRow{Line: line}
+		row.Title = get("title")
+		row.Description = optionalString(get("description"))
+		row.SKU = optionalString(get("sku"))
+		row.Barcode = optionalString(get("barcode"))
+		row.Category = optionalString(get("category"))
+
+		if v := get("price"); v != "" {
+			price, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				row.ParseErrors = append(row.ParseErrors, "price must be a number")
+			}
+			row.Price = price
+		} else {
+			row.ParseErrors = append(row.ParseErrors, "price is required")
+		}
+		if v := get("cost"); v != "" {
+			cost, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				row.ParseErrors = append(row.ParseErrors, "cost must be a number")
+			} else {
+				row.Cost = &cost
+			}
+		}
+		if v := get("quantity"); v != "" {
+			quantity, err := strconv.Atoi(v)
+			if err != nil {
+				row.ParseErrors = append(row.ParseErrors, "quantity must be an integer")
+			}
+			row.Quantity = quantity
+		}
+		if v := get("is_active"); v != "" {
+			active, err := strconv.ParseBool(v)
+			if err != nil {
+				row.ParseErrors = append(row.ParseErrors, "is_active must be true or false")
+			} else {
+				row.IsActive = &active
+			}
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// ParseProductNDJSON lê um objeto CreateProductRequest por linha
+func ParseProductNDJSON(r io.Reader) ([]models.ProductImportRow, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var rows []models.ProductImportRow
+	line := 0
+	for scanner.Scan() {
+		line++
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		if len(rows) >= MaxImportRows {
+			return nil, fmt.Errorf("file exceeds the limit of %d rows", MaxImportRows)
+		}
+
+		var fields struct {
+			models.CreateProductRequest
+			IsActive *bool `json:"is_active"`
+		}
+		row := models.ProductImportRow{Line: line}
+		if err := json.Unmarshal(data, &fields); err != nil {
+			row.ParseErrors = append(row.ParseErrors, "invalid json: "+err.Error())
+		}
+		row.CreateProductRequest = fields.CreateProductRequest
+		row.IsActive = fields.IsActive
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading ndjson: %w", err)
+	}
+
+	return rows, nil
+}
+
+func validateImportRow(row *models.ProductImportRow) []string {
+	errs := append([]string{}, row.ParseErrors...)
+	if strings.TrimSpace(derefString(row.SKU)) == "" {
+		errs = append(errs, "sku is required")
+	}
+	if err := row.Validate(); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			for _, fe := range ve {
+				errs = append(errs, fieldErrorMessage(fe))
+			}
+		} else {
+			errs = append(errs, err.Error())
+		}
+	}
+	return errs
+}
+
+func newProductFromImport(storeID int64, sku string, row *models.ProductImportRow) *models.Product {
+	now := time.Now()
+	product := &models.Product{
+		StoreID:   storeID,
+		SKU:       &sku,
+		IsActive:  true,
+		CreatedAt: now,
+	}
+	applyImportRow(product, row)
+	return product
+}
+
+// applyImportRow copia os campos da linha para o produto, mantendo o ID e a loja
+func applyImportRow(product *models.Product, row *models.ProductImportRow) {
+	product.Title = row.Title
+	product.Description = row.Description
+	product.PriceCents = int(math.Round(row.Price * 100))
+	product.CostCents = nil
+	if row.Cost != nil {
+		costCents := int(math.Round(*row.Cost * 100))
+		product.CostCents = &costCents
+	}
+	product.Barcode = row.Barcode
+	product.Quantity = row.Quantity
+	product.Category = row.Category
+	if row.IsActive != nil {
+		product.IsActive = *row.IsActive
+	}
+	product.UpdatedAt = time.Now()
+}
+
+func optionalString(v string) *string {
+	if v == "" {
+		return nil
+	}
+	return &v
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func formatCents(cents int) string {
+	return strconv.FormatFloat(float64(cents)/100, 'f', 2, 64)
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"modress/internal/models"
+	"modress/internal/repositories"
+)
+
+func TestImportUpdatesNotifyLikeProductUpdates(t *testing.T) {
+	products := newMemProductRepo(
+		models.Product{ID: 1, StoreID: 7, Title: "Blue shirt", SKU: strPtr("TS-BLUE"), PriceCents: 2000, Quantity: 0, IsActive: true},
+		models.Product{ID: 2, StoreID: 7, Title: "Red shirt", SKU: strPtr("TS-RED"), PriceCents: 2000, Quantity: 5, IsActive: true},
+	)
+	jobService := &recordingJobService{}
+	notifications := &recordingNotificationService{}
+	svc := NewProductImportService(products, stubStoreRepo{ownerID: 70}, jobService, stubAuditService{}, notifications,
+		stubWebhookService{}, NewWishlistService(nil, products, jobService, notifications))
+
+	result, err := svc.ImportProducts(context.Background(), 7, []models.ProductImportRow{
+		// Volta ao stock e baixa de preço
+		{Line: 2, CreateProductRequest: models.CreateProductRequest{SKU: strPtr("TS-BLUE"), Title: "Blue shirt", Price: 15, Quantity: 3}},
+		// Esgota
+		{Line: 3, CreateProductRequest: models.CreateProductRequest{SKU: strPtr("TS-RED"), Title: "Red shirt", Price: 20, Quantity: 0}},
+		// Novo produto: nada para avisar
+		{Line: 4, CreateProductRequest: models.CreateProductRequest{SKU: strPtr("TS-GREEN"), Title: "Green shirt", Price: 20, Quantity: 0}},
+	}, false)
+	if err != nil {
+		t.Fatalf("ImportProducts: %v", err)
+	}
+	if result.Created != 1 || result.Updated != 2 || result.Failed != 0 {
+		t.Fatalf("result = %+v, want 1 created and 2 updated", result)
+	}
+
+	alerts := map[string]int64{}
+	for _, req := range jobService.enqueued {
+		payload := req.Payload.(models.WishlistAlertJobPayload)
+		alerts[payload.Alert] = payload.ProductID
+	}
+	if len(jobService.enqueued) != 2 || alerts[models.WishlistAlertPriceDrop] != 1 || alerts[models.WishlistAlertBackInStock] != 1 {
+		t.Fatalf("wishlist alerts = %+v, want a price drop and a back in stock alert for product 1", jobService.enqueued)
+	}
+
+	if len(notifications.sent) != 1 {
+		t.Fatalf("notifications = %+v, want one out of stock notification", notifications.sent)
+	}
+	sent := notifications.sent[0]
+	data, _ := sent.Data.(map[string]interface{})
+	if sent.Type != models.NotificationProductOutOfStock || sent.UserID != 70 || data["product_id"] != int64(2) {
+		t.Fatalf("notification = %+v, want product 2 out of stock for the store owner", sent)
+	}
+}
+
+func TestImportKeepsIsActiveFromExport(t *testing.T) {
+	products := newMemProductRepo(
+		models.Product{ID: 1, StoreID: 7, Title: "Blue shirt", SKU: strPtr("TS-BLUE"), PriceCents: 2000, IsActive: true},
+		models.Product{ID: 2, StoreID: 7, Title: "Red shirt", SKU: strPtr("TS-RED"), PriceCents: 2000, IsActive: false},
+	)
+	jobService := &recordingJobService{}
+	notifications := &recordingNotificationService{}
+	svc := NewProductImportService(products, stubStoreRepo{ownerID: 70}, jobService, stubAuditService{}, notifications,
+		stubWebhookService{}, NewWishlistService(nil, products, jobService, notifications))
+
+	// Um ficheiro exportado desativa o produto; uma linha sem is_active não mexe no valor
+	rows, err := ParseProductCSV(strings.NewReader(strings.Join(models.ProductExportColumns, ",") + "\n" +
+		"TS-BLUE,Blue shirt,,20.00,,,0,,false\n" +
+		"TS-RED,Red shirt,,20.00,,,0,,\n" +
+		"TS-GREEN,Green shirt,,20.00,,,0,,\n"))
+	if err != nil {
+		t.Fatalf("ParseProductCSV: %v", err)
+	}
+	if _, err := svc.ImportProducts(context.Background(), 7, rows, false); err != nil {
+		t.Fatalf("ImportProducts: %v", err)
+	}
+
+	for sku, want := range map[string]bool{"TS-BLUE": false, "TS-RED": false, "TS-GREEN": true} {
+		if got := products.bySKU[sku].IsActive; got != want {
+			t.Errorf("%s is_active = %v, want %v", sku, got, want)
+		}
+	}
+}
+
+func strPtr(s string) *string { return &s }
+
+// memProductRepo guarda os produtos de uma loja indexados pelo SKU
+type memProductRepo struct {
+	repositories.ProductRepository
+	bySKU  map[string]*models.Product
+	nextID int64
+}
+
+func newMemProductRepo(products ...models.Product) *memProductRepo {
+	r := &memProductRepo{bySKU: map[string]*models.Product{}, nextID: 100}
+	for i := range products {
+		product := products[i]
+		r.bySKU[*product.SKU] = &product
+	}
+	return r
+}
+
+func (r *memProductRepo) UpsertBySKU(ctx context.Context, product *models.Product, setActive bool) (*models.Product, error) {
+	existing, ok := r.bySKU[*product.SKU]
+	if !ok {
+		r.nextID++
+		product.ID = r.nextID
+		product.Version = 1
+		stored := *product
+		r.bySKU[*product.SKU] = &stored
+		return nil, nil
+	}
+
+	before := *existing
+	product.ID = existing.ID
+	if !setActive {
+		product.IsActive = existing.IsActive
+	}
+	product.Version = existing.Version + 1
+	*existing = *product
+	return &before, nil
+}
+
+type stubStoreRepo struct {
+	repositories.StoreRepository
+	ownerID int64
+}
+
+func (r stubStoreRepo) FindByID(ctx context.Context, id int64) (*models.Store, error) {
+	return &models.Store{ID: id, OwnerID: r.ownerID}, nil
+}
+
+type stubAuditService struct {
+	AuditService
+}
+
+func (stubAuditService) Record(ctx context.Context, action, entityType string, entityID int64, before, after interface{}) {
+}
+
+type stubWebhookService struct {
+	WebhookService
+}
+
+func (stubWebhookService) Dispatch(ctx context.Context, storeID int64, event string, data interface{}) {
+}
+
+type recordingNotificationService struct {
+	NotificationService
+	sent []models.NotifyRequest
+}
+
+func (s *recordingNotificationService) Notify(ctx context.Context, req models.NotifyRequest) {
+	s.sent = append(s.sent, req)
+}
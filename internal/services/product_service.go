@@ -3,10 +3,17 @@ package services
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"modress/internal/audit"
+	"modress/internal/logging"
+	"modress/internal/metrics"
 	"modress/internal/models"
 	"modress/internal/repositories"
+	"modress/internal/tracing"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // ProductService interface
@@ -15,31 +22,49 @@ type ProductService interface {
 	GetProductByID(ctx context.Context, id int64) (*models.ProductResponse, error)
 	GetProductsByStoreID(ctx context.Context, storeID int64, page, limit int) ([]models.ProductResponse, error)
 	GetProductsByCategory(ctx context.Context, category string, page, limit int) ([]models.ProductResponse, error)
-	UpdateProduct(ctx context.Context, id int64, storeID int64, req *models.UpdateProductRequest) (*models.ProductResponse, error)
-	DeleteProduct(ctx context.Context, id int64, storeID int64) error
-	ListProducts(ctx context.Context, page, limit int) ([]models.ProductResponse, error)
-	SearchProducts(ctx context.Context, query string, page, limit int) ([]models.ProductResponse, error)
-	UpdateProductQuantity(ctx context.Context, id int64, storeID int64, quantity int) error
+	// version é a versão que o cliente espera (If-Match); 0 aceita qualquer versão
+	UpdateProduct(ctx context.Context, id int64, storeID int64, version int64, req *models.UpdateProductRequest) (*models.ProductResponse, error)
+	DeleteProduct(ctx context.Context, id int64, storeID int64, version int64) error
+	// RestoreProduct restaura um produto apagado da loja storeID; storeID 0 (administradores)
+	// aceita qualquer loja
+	RestoreProduct(ctx context.Context, id int64, storeID int64) (*models.ProductResponse, error)
+	// sort é uma das ordenações models.ProductSort*; vazio ordena pelos mais recentes
+	ListProducts(ctx context.Context, sort string, page, limit int) ([]models.ProductResponse, error)
+	SearchProducts(ctx context.Context, query, sort string, page, limit int) ([]models.ProductResponse, error)
+	// GetFeed devolve os produtos das lojas que o utilizador segue, dos mais recentes para os mais antigos
+	GetFeed(ctx context.Context, userID int64, page, limit int) ([]models.ProductResponse, error)
+	UpdateProductQuantity(ctx context.Context, id int64, storeID int64, version int64, quantity int) error
 	GetStoreByOwnerID(ctx context.Context, ownerID int64) (*models.StoreResponse, error) 
 	CreateProductImage(ctx context.Context, productID, storeID int64, image *models.ProductImage) error
 	GetProductImages(ctx context.Context, productID int64) ([]models.ProductImage, error) 
 }
 
 type productService struct {
-	productRepo repositories.ProductRepository
-	storeRepo   repositories.StoreRepository
+	productRepo   repositories.ProductRepository
+	storeRepo     repositories.StoreRepository
+	audit         AuditService
+	notifications NotificationService
+	webhooks      WebhookService
+	wishlists     WishlistService
 }
 
-func NewProductService(productRepo repositories.ProductRepository, storeRepo repositories.StoreRepository) ProductService {
+func NewProductService(productRepo repositories.ProductRepository, storeRepo repositories.StoreRepository, auditService AuditService, notificationService NotificationService, webhookService WebhookService, wishlistService WishlistService) ProductService {
 	return &productService{
-		productRepo: productRepo,
-		storeRepo:   storeRepo,
+		productRepo:   productRepo,
+		storeRepo:     storeRepo,
+		audit:         auditService,
+		notifications: notificationService,
+		webhooks:      webhookService,
+		wishlists:     wishlistService,
 	}
 }
 
 func (s *productService) CreateProduct(ctx context.Context, storeID int64, req *models.CreateProductRequest) (*models.ProductResponse, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "productService.CreateProduct", attribute.Int64("store.id", storeID))
+	defer span.End()
+
 	if err := req.Validate(); err != nil {
-		return nil, fmt.Errorf("validation error: %w", err)
+		return nil, NewValidationError(err)
 	}
 
 	// Verificar se a loja existe
@@ -48,7 +73,7 @@ func (s *productService) CreateProduct(ctx context.Context, storeID int64, req *
 		return nil, fmt.Errorf("error finding store: %w", err)
 	}
 	if store == nil {
-		return nil, fmt.Errorf("store not found")
+		return nil, ErrStoreNotFound
 	}
 
 	now := time.Now()
@@ -72,20 +97,29 @@ func (s *productService) CreateProduct(ctx context.Context, storeID int64, req *
 	}
 
 	if err := s.productRepo.Create(ctx, product); err != nil {
+		if errors.Is(err, repositories.ErrDuplicateSKU) {
+			return nil, ErrProductSKUTaken
+		}
 		return nil, fmt.Errorf("error creating product: %w", err)
 	}
+	metrics.ProductsCreated.WithLabelValues("api").Inc()
+	s.audit.Record(ctx, "product.create", models.AuditEntityProduct, product.ID, nil, product)
 
 	response := product.ToResponse()
+	s.webhooks.Dispatch(ctx, storeID, models.WebhookEventProductCreated, response)
 	return &response, nil
 }
 
 func (s *productService) GetProductByID(ctx context.Context, id int64) (*models.ProductResponse, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "productService.GetProductByID", attribute.Int64("product.id", id))
+	defer span.End()
+
 	product, err := s.productRepo.FindByID(ctx, id)
 	if err != nil {
 		return nil, fmt.Errorf("error finding product: %w", err)
 	}
 	if product == nil {
-		return nil, fmt.Errorf("product not found")
+		return nil, ErrProductNotFound
 	}
 
 	response := product.ToResponse()
@@ -93,6 +127,9 @@ func (s *productService) GetProductByID(ctx context.Context, id int64) (*models.
 }
 
 func (s *productService) GetProductsByStoreID(ctx context.Context, storeID int64, page, limit int) ([]models.ProductResponse, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "productService.GetProductsByStoreID", attribute.Int64("store.id", storeID))
+	defer span.End()
+
 	if page < 1 {
 		page = 1
 	}
@@ -114,6 +151,9 @@ func (s *productService) GetProductsByStoreID(ctx context.Context, storeID int64
 }
 
 func (s *productService) GetProductsByCategory(ctx context.Context, category string, page, limit int) ([]models.ProductResponse, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "productService.GetProductsByCategory")
+	defer span.End()
+
 	if page < 1 {
 		page = 1
 	}
@@ -134,9 +174,12 @@ func (s *productService) GetProductsByCategory(ctx context.Context, category str
 	return responses, nil
 }
 
-func (s *productService) UpdateProduct(ctx context.Context, id int64, storeID int64, req *models.UpdateProductRequest) (*models.ProductResponse, error) {
+func (s *productService) UpdateProduct(ctx context.Context, id int64, storeID int64, version int64, req *models.UpdateProductRequest) (*models.ProductResponse, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "productService.UpdateProduct", attribute.Int64("product.id", id), attribute.Int64("store.id", storeID))
+	defer span.End()
+
 	if err := req.Validate(); err != nil {
-		return nil, fmt.Errorf("validation error: %w", err)
+		return nil, NewValidationError(err)
 	}
 
 	product, err := s.productRepo.FindByID(ctx, id)
@@ -144,14 +187,19 @@ func (s *productService) UpdateProduct(ctx context.Context, id int64, storeID in
 		return nil, fmt.Errorf("error finding product: %w", err)
 	}
 	if product == nil {
-		return nil, fmt.Errorf("product not found")
+		return nil, ErrProductNotFound
 	}
 
 	// Verificar se o produto pertence à loja
 	if product.StoreID != storeID {
-		return nil, fmt.Errorf("unauthorized: product does not belong to store")
+		return nil, ErrProductNotOwned
+	}
+	if err := checkVersion(version, product.Version); err != nil {
+		return nil, err
 	}
 
+	before := *product
+
 	// Atualizar apenas os campos fornecidos
 	if req.Title != nil {
 		product.Title = *req.Title
@@ -185,54 +233,135 @@ func (s *productService) UpdateProduct(ctx context.Context, id int64, storeID in
 	product.UpdatedAt = time.Now()
 
 	if err := s.productRepo.Update(ctx, product); err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("product not found")
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, s.writeConflict(ctx, id, version)
+		}
+		if errors.Is(err, repositories.ErrDuplicateSKU) {
+			return nil, ErrProductSKUTaken
 		}
 		return nil, fmt.Errorf("error updating product: %w", err)
 	}
+	s.audit.Record(ctx, "product.update", models.AuditEntityProduct, id, &before, product)
+	if before.Quantity > 0 && product.Quantity == 0 {
+		s.notifyOutOfStock(ctx, product)
+	}
+	s.wishlists.ProductChanged(ctx, &before, product)
 
 	response := product.ToResponse()
+	s.webhooks.Dispatch(ctx, storeID, models.WebhookEventProductUpdated, response)
+	if before.Quantity != product.Quantity {
+		s.dispatchStockChanged(ctx, product, before.Quantity)
+	}
 	return &response, nil
 }
 
 func (s *productService) GetStoreByOwnerID(ctx context.Context, ownerID int64) (*models.StoreResponse, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "productService.GetStoreByOwnerID", attribute.Int64("owner.id", ownerID))
+	defer span.End()
+
 	store, err := s.storeRepo.FindByOwnerID(ctx, ownerID)
 	if err != nil {
 		return nil, fmt.Errorf("error finding store by owner ID: %w", err)
 	}
 	if store == nil {
-		return nil, fmt.Errorf("store not found")
+		return nil, ErrStoreNotFound
 	}
 
 	response := store.ToResponse()
 	return &response, nil
 }
 
-func (s *productService) DeleteProduct(ctx context.Context, id int64, storeID int64) error {
+func (s *productService) DeleteProduct(ctx context.Context, id int64, storeID int64, version int64) error {
+	ctx, span := tracing.Start(ctx, tracerName, "productService.DeleteProduct", attribute.Int64("product.id", id), attribute.Int64("store.id", storeID))
+	defer span.End()
+
 	product, err := s.productRepo.FindByID(ctx, id)
 	if err != nil {
 		return fmt.Errorf("error finding product: %w", err)
 	}
 	if product == nil {
-		return fmt.Errorf("product not found")
+		return ErrProductNotFound
 	}
 
 	// Verificar se o produto pertence à loja
 	if product.StoreID != storeID {
-		return fmt.Errorf("unauthorized: product does not belong to store")
+		return ErrProductNotOwned
+	}
+	if err := checkVersion(version, product.Version); err != nil {
+		return err
 	}
 
-	if err := s.productRepo.Delete(ctx, id); err != nil {
-		if err == sql.ErrNoRows {
-			return fmt.Errorf("product not found")
+	if err := s.productRepo.Delete(ctx, id, product.Version); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return s.writeConflict(ctx, id, version)
 		}
 		return fmt.Errorf("error deleting product: %w", err)
 	}
+	s.audit.Record(ctx, "product.delete", models.AuditEntityProduct, id, product, nil)
+	s.webhooks.Dispatch(ctx, product.StoreID, models.WebhookEventProductDeleted, product.ToResponse())
 
 	return nil
 }
 
-func (s *productService) ListProducts(ctx context.Context, page, limit int) ([]models.ProductResponse, error) {
+func (s *productService) RestoreProduct(ctx context.Context, id int64, storeID int64) (*models.ProductResponse, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "productService.RestoreProduct", attribute.Int64("product.id", id), attribute.Int64("store.id", storeID))
+	defer span.End()
+
+	product, err := s.productRepo.FindByIDIncludingDeleted(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("error finding product: %w", err)
+	}
+	if product == nil {
+		return nil, ErrProductNotFound
+	}
+	if storeID != 0 && product.StoreID != storeID {
+		return nil, ErrProductNotOwned
+	}
+
+	// Restaurar um produto que não está apagado não faz nada
+	if product.DeletedAt == nil {
+		response := product.ToResponse()
+		return &response, nil
+	}
+
+	// Os produtos de uma loja apagada voltam com a loja
+	store, err := s.storeRepo.FindByID(ctx, product.StoreID)
+	if err != nil {
+		return nil, fmt.Errorf("error finding store: %w", err)
+	}
+	if store == nil {
+		return nil, ErrStoreDeleted
+	}
+
+	if err := s.productRepo.Restore(ctx, product); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// Restaurado ou purgado por outro pedido entretanto
+			return s.GetProductByID(ctx, id)
+		}
+		if errors.Is(err, repositories.ErrDuplicateSKU) {
+			// Entretanto foi criado outro produto com o mesmo SKU
+			return nil, ErrProductSKUTaken
+		}
+		return nil, fmt.Errorf("error restoring product: %w", err)
+	}
+	logging.FromContext(ctx).Info("product restored", "product_id", id)
+	s.audit.Record(ctx, "product.restore", models.AuditEntityProduct, id, nil, product)
+
+	// Para quem recebe os webhooks o produto restaurado volta a existir, tal como está
+	response := product.ToResponse()
+	s.webhooks.Dispatch(ctx, product.StoreID, models.WebhookEventProductUpdated, response)
+	return &response, nil
+}
+
+func (s *productService) ListProducts(ctx context.Context, sort string, page, limit int) ([]models.ProductResponse, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "productService.ListProducts")
+	defer span.End()
+
+	sort, err := productSort(sort)
+	if err != nil {
+		return nil, err
+	}
+
 	if page < 1 {
 		page = 1
 	}
@@ -240,7 +369,7 @@ func (s *productService) ListProducts(ctx context.Context, page, limit int) ([]m
 		limit = 20
 	}
 
-	products, err := s.productRepo.List(ctx, page, limit)
+	products, err := s.productRepo.List(ctx, sort, page, limit)
 	if err != nil {
 		return nil, fmt.Errorf("error listing products: %w", err)
 	}
@@ -253,7 +382,15 @@ func (s *productService) ListProducts(ctx context.Context, page, limit int) ([]m
 	return responses, nil
 }
 
-func (s *productService) SearchProducts(ctx context.Context, query string, page, limit int) ([]models.ProductResponse, error) {
+func (s *productService) SearchProducts(ctx context.Context, query, sort string, page, limit int) ([]models.ProductResponse, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "productService.SearchProducts")
+	defer span.End()
+
+	sort, err := productSort(sort)
+	if err != nil {
+		return nil, err
+	}
+
 	if page < 1 {
 		page = 1
 	}
@@ -261,7 +398,7 @@ func (s *productService) SearchProducts(ctx context.Context, query string, page,
 		limit = 20
 	}
 
-	products, err := s.productRepo.Search(ctx, query, page, limit)
+	products, err := s.productRepo.Search(ctx, query, sort, page, limit)
 	if err != nil {
 		return nil, fmt.Errorf("error searching products: %w", err)
 	}
@@ -274,39 +411,139 @@ func (s *productService) SearchProducts(ctx context.Context, query string, page,
 	return responses, nil
 }
 
-func (s *productService) UpdateProductQuantity(ctx context.Context, id int64, storeID int64, quantity int) error {
+func (s *productService) GetFeed(ctx context.Context, userID int64, page, limit int) ([]models.ProductResponse, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "productService.GetFeed", attribute.Int64("user.id", userID))
+	defer span.End()
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	products, err := s.productRepo.ListFeed(ctx, userID, page, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]models.ProductResponse, len(products))
+	for i, product := range products {
+		responses[i] = product.ToResponse()
+	}
+
+	return responses, nil
+}
+
+// productSort valida a ordenação pedida na listagem ou na pesquisa
+func productSort(sort string) (string, error) {
+	switch sort {
+	case "":
+		return models.ProductSortNewest, nil
+	case models.ProductSortNewest, models.ProductSortRating:
+		return sort, nil
+	}
+	return "", NewFieldError("sort", "oneof", "sort must be one of: newest, rating")
+}
+
+func (s *productService) UpdateProductQuantity(ctx context.Context, id int64, storeID int64, version int64, quantity int) error {
+	ctx, span := tracing.Start(ctx, tracerName, "productService.UpdateProductQuantity", attribute.Int64("product.id", id), attribute.Int64("store.id", storeID))
+	defer span.End()
+
 	product, err := s.productRepo.FindByID(ctx, id)
 	if err != nil {
 		return fmt.Errorf("error finding product: %w", err)
 	}
 	if product == nil {
-		return fmt.Errorf("product not found")
+		return ErrProductNotFound
 	}
 
 	// Verificar se o produto pertence à loja
 	if product.StoreID != storeID {
-		return fmt.Errorf("unauthorized: product does not belong to store")
+		return ErrProductNotOwned
+	}
+	if err := checkVersion(version, product.Version); err != nil {
+		return err
 	}
 
 	if quantity < 0 {
-		return fmt.Errorf("quantity cannot be negative")
+		return NewFieldError("quantity", "min", "quantity cannot be negative")
 	}
 
-	if err := s.productRepo.UpdateQuantity(ctx, id, quantity); err != nil {
-		if err == sql.ErrNoRows {
-			return fmt.Errorf("product not found")
+	if err := s.productRepo.UpdateQuantity(ctx, id, quantity, product.Version); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return s.writeConflict(ctx, id, version)
 		}
 		return fmt.Errorf("error updating product quantity: %w", err)
 	}
+	s.audit.RecordChanges(ctx, "product.update_quantity", models.AuditEntityProduct, id, audit.Changes{
+		"quantity": {Before: product.Quantity, After: quantity},
+	})
+	if product.Quantity > 0 && quantity == 0 {
+		s.notifyOutOfStock(ctx, product)
+	}
+	if product.Quantity != quantity {
+		before := *product
+		product.Quantity = quantity
+		s.dispatchStockChanged(ctx, product, before.Quantity)
+		s.wishlists.ProductChanged(ctx, &before, product)
+	}
 
 	return nil
 }
 
+// dispatchStockChanged envia o evento stock.changed com a quantidade anterior e a atual
+func (s *productService) dispatchStockChanged(ctx context.Context, product *models.Product, previous int) {
+	s.webhooks.Dispatch(ctx, product.StoreID, models.WebhookEventStockChanged, models.StockChange{
+		ProductID:        product.ID,
+		SKU:              product.SKU,
+		PreviousQuantity: previous,
+		Quantity:         product.Quantity,
+	})
+}
+
+// notifyOutOfStock avisa o dono da loja de que o produto esgotou
+func (s *productService) notifyOutOfStock(ctx context.Context, product *models.Product) {
+	notifyOutOfStock(ctx, s.storeRepo, s.notifications, product)
+}
+
+// notifyOutOfStock é partilhada com a importação, que altera os produtos pelo mesmo
+// caminho que a edição pela API
+func notifyOutOfStock(ctx context.Context, storeRepo repositories.StoreRepository, notifications NotificationService, product *models.Product) {
+	store, err := storeRepo.FindByID(ctx, product.StoreID)
+	if err != nil || store == nil {
+		logging.FromContext(ctx).Warn("out of stock notification skipped: store not found",
+			"product_id", product.ID,
+			"store_id", product.StoreID,
+			logging.Err(err),
+		)
+		return
+	}
+	notifications.Notify(ctx, models.NotifyRequest{
+		UserID: store.OwnerID,
+		Type:   models.NotificationProductOutOfStock,
+		Title:  "Product out of stock",
+		Body:   fmt.Sprintf("%s is out of stock.", product.Title),
+		Data:   map[string]interface{}{"product_id": product.ID, "store_id": product.StoreID},
+	})
+}
+
+// writeConflict explica uma escrita no produto que não afetou nenhuma linha
+func (s *productService) writeConflict(ctx context.Context, id, version int64) error {
+	current, err := s.productRepo.FindByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("error finding product: %w", err)
+	}
+	return versionConflict(current != nil, version, ErrProductNotFound)
+}
 
 func (s *productService) CreateProductImage(ctx context.Context, productID, storeID int64, image *models.ProductImage) error {
+    ctx, span := tracing.Start(ctx, tracerName, "productService.CreateProductImage", attribute.Int64("product.id", productID), attribute.Int64("store.id", storeID))
+    defer span.End()
+
     // Validate image
     if err := image.Validate(); err != nil {
-        return fmt.Errorf("validation error: %w", err)
+        return NewValidationError(err)
     }
 
     // Verify product exists and belongs to the store
@@ -315,10 +552,10 @@ func (s *productService) CreateProductImage(ctx context.Context, productID, stor
         return fmt.Errorf("error finding product: %w", err)
     }
     if product == nil {
-        return fmt.Errorf("product not found")
+        return ErrProductNotFound
     }
     if product.StoreID != storeID {
-        return fmt.Errorf("unauthorized: product does not belong to store")
+        return ErrProductNotOwned
     }
 
     // Set product ID and creation time
@@ -329,11 +566,15 @@ func (s *productService) CreateProductImage(ctx context.Context, productID, stor
     if err := s.productRepo.CreateImage(ctx, image); err != nil {
         return fmt.Errorf("error creating product image: %w", err)
     }
+    s.audit.Record(ctx, "product.create_image", models.AuditEntityProduct, productID, nil, image)
 
     return nil
 }
 
 func (s *productService) GetProductImages(ctx context.Context, productID int64) ([]models.ProductImage, error) {
+    ctx, span := tracing.Start(ctx, tracerName, "productService.GetProductImages", attribute.Int64("product.id", productID))
+    defer span.End()
+
     images, err := s.productRepo.FindImagesByProductID(ctx, productID)
     if err != nil {
         return nil, fmt.Errorf("error retrieving product images: %w", err)
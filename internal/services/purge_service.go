@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"modress/internal/jobs"
+	"modress/internal/logging"
+	"modress/internal/models"
+	"modress/internal/repositories"
+	"modress/internal/tracing"
+	"time"
+)
+
+// PurgeService remove de vez os produtos, lojas e contas apagados há mais tempo
+// do que o período de retenção
+type PurgeService interface {
+	SchedulePurge(ctx context.Context) (*models.Job, error)
+	HandlePurgeJob(ctx context.Context, payload models.PurgeJobPayload) error
+}
+
+type purgeService struct {
+	productRepo repositories.ProductRepository
+	storeRepo   repositories.StoreRepository
+	userRepo    repositories.UserRepository
+	jobService  JobService
+	retention   time.Duration
+	audit       AuditService
+}
+
+func NewPurgeService(productRepo repositories.ProductRepository, storeRepo repositories.StoreRepository, userRepo repositories.UserRepository, jobService JobService, retention time.Duration, auditService AuditService) PurgeService {
+	return &purgeService{
+		productRepo: productRepo,
+		storeRepo:   storeRepo,
+		userRepo:    userRepo,
+		jobService:  jobService,
+		retention:   retention,
+		audit:       auditService,
+	}
+}
+
+// SchedulePurge coloca na fila um job records.purge para os registos apagados antes
+// de agora menos o período de retenção
+func (s *purgeService) SchedulePurge(ctx context.Context) (*models.Job, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "purgeService.SchedulePurge")
+	defer span.End()
+
+	payload := models.PurgeJobPayload{
+		DeletedBefore: time.Now().Add(-s.retention),
+	}
+	job, err := s.jobService.Enqueue(ctx, models.EnqueueJobRequest{
+		Type:        models.JobTypePurgeDeleted,
+		Payload:     payload,
+		MaxAttempts: 3,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.audit.Record(ctx, "records.purge", models.AuditEntityJob, job.ID, nil, &payload)
+	return job, nil
+}
+
+// HandlePurgeJob processa o job records.purge. Os produtos vão primeiro e as contas
+// por último, para que cada passo só apague linhas já sem dependentes ativos.
+func (s *purgeService) HandlePurgeJob(ctx context.Context, payload models.PurgeJobPayload) error {
+	ctx, span := tracing.Start(ctx, tracerName, "purgeService.HandlePurgeJob")
+	defer span.End()
+
+	result := models.PurgeResult{DeletedBefore: payload.DeletedBefore}
+	var err error
+
+	if result.Products, err = s.productRepo.PurgeDeleted(ctx, payload.DeletedBefore); err != nil {
+		return fmt.Errorf("error purging products: %w", err)
+	}
+	if result.Stores, err = s.storeRepo.PurgeDeleted(ctx, payload.DeletedBefore); err != nil {
+		return fmt.Errorf("error purging stores: %w", err)
+	}
+	if result.Users, err = s.userRepo.PurgeDeleted(ctx, payload.DeletedBefore); err != nil {
+		return fmt.Errorf("error purging users: %w", err)
+	}
+
+	logging.FromContext(ctx).Info("deleted records purged",
+		"deleted_before", payload.DeletedBefore,
+		"products", result.Products,
+		"stores", result.Stores,
+		"users", result.Users,
+	)
+	return jobs.SetResult(ctx, result)
+}
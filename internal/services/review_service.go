@@ -0,0 +1,551 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"modress/internal/audit"
+	"modress/internal/logging"
+	"modress/internal/models"
+	"modress/internal/repositories"
+	"modress/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	ErrReviewNotFound     = NewError(ErrNotFound, "review_not_found", "review not found")
+	ErrReviewNotOwned     = NewError(ErrForbidden, "review_not_owned", "you are not the author of this review")
+	ErrReviewExists       = NewError(ErrConflict, "review_exists", "you have already reviewed this product")
+	ErrOwnProductReview   = NewError(ErrForbidden, "own_product_review", "you cannot review your own store's products")
+	ErrOwnReviewReport    = NewError(ErrForbidden, "own_review_report", "you cannot report your own review")
+	ErrReviewReported     = NewError(ErrConflict, "review_already_reported", "you have already reported this review")
+	ErrReviewPhotoLimit   = NewError(ErrConflict, "review_photo_limit", fmt.Sprintf("a review can have at most %d photos", models.MaxReviewPhotos))
+	ErrNoPendingReports   = NewError(ErrConflict, "no_pending_reports", "the review has no pending reports")
+	errReviewStatusFilter = NewFieldError("status", "oneof", "status must be one of: pending, dismissed, upheld")
+)
+
+// ReviewService gere as avaliações dos produtos, as respostas das lojas e a
+// moderação das denúncias. A média e o número das avaliações publicadas ficam
+// guardados no produto e na loja e são recalculados a cada alteração.
+type ReviewService interface {
+	// sort é uma das ordenações models.ReviewSort*; vazio ordena pelas mais recentes
+	ListReviews(ctx context.Context, productID int64, sort string, page, limit int) ([]models.Review, error)
+	CreateReview(ctx context.Context, userID, productID int64, req *models.CreateReviewRequest) (*models.Review, error)
+	UpdateReview(ctx context.Context, userID, id int64, req *models.UpdateReviewRequest) (*models.Review, error)
+	// DeleteReview apaga uma avaliação do utilizador; userID 0 (administradores)
+	// aceita qualquer avaliação
+	DeleteReview(ctx context.Context, userID, id int64) error
+	// AddPhoto junta à avaliação uma imagem já guardada em url
+	AddPhoto(ctx context.Context, userID, id int64, url string) (*models.ReviewPhoto, error)
+	// Reply guarda a resposta da loja storeID a uma avaliação de um dos seus produtos
+	Reply(ctx context.Context, storeID, id int64, req *models.ReplyReviewRequest) (*models.Review, error)
+	DeleteReply(ctx context.Context, storeID, id int64) (*models.Review, error)
+	Report(ctx context.Context, userID, id int64, req *models.ReportReviewRequest) (*models.ReviewReport, error)
+	// ListReports devolve as denúncias com o estado indicado (pending por omissão),
+	// cada uma com a avaliação denunciada
+	ListReports(ctx context.Context, status string, page, limit int) ([]models.ReviewReport, error)
+	Moderate(ctx context.Context, moderatorID, id int64, req *models.ModerateReviewRequest) (*models.Review, error)
+}
+
+type reviewService struct {
+	reviewRepo    repositories.ReviewRepository
+	productRepo   repositories.ProductRepository
+	storeRepo     repositories.StoreRepository
+	notifications NotificationService
+	audit         AuditService
+}
+
+func NewReviewService(reviewRepo repositories.ReviewRepository, productRepo repositories.ProductRepository, storeRepo repositories.StoreRepository, notificationService NotificationService, auditService AuditService) ReviewService {
+	return &reviewService{
+		reviewRepo:    reviewRepo,
+		productRepo:   productRepo,
+		storeRepo:     storeRepo,
+		notifications: notificationService,
+		audit:         auditService,
+	}
+}
+
+func (s *reviewService) ListReviews(ctx context.Context, productID int64, sort string, page, limit int) ([]models.Review, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "reviewService.ListReviews", attribute.Int64("product.id", productID))
+	defer span.End()
+
+	switch sort {
+	case "":
+		sort = models.ReviewSortNewest
+	case models.ReviewSortNewest, models.ReviewSortHighest, models.ReviewSortLowest:
+	default:
+		return nil, NewFieldError("sort", "oneof", "sort must be one of: newest, highest, lowest")
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	product, err := s.productRepo.FindByID(ctx, productID)
+	if err != nil {
+		return nil, fmt.Errorf("error finding product: %w", err)
+	}
+	if product == nil {
+		return nil, ErrProductNotFound
+	}
+
+	reviews, err := s.reviewRepo.ListByProduct(ctx, productID, sort, page, limit)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.attachPhotos(ctx, reviews); err != nil {
+		return nil, err
+	}
+
+	return reviews, nil
+}
+
+func (s *reviewService) CreateReview(ctx context.Context, userID, productID int64, req *models.CreateReviewRequest) (*models.Review, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "reviewService.CreateReview", attribute.Int64("user.id", userID), attribute.Int64("product.id", productID))
+	defer span.End()
+
+	if err := req.Validate(); err != nil {
+		return nil, NewValidationError(err)
+	}
+
+	product, err := s.productRepo.FindByID(ctx, productID)
+	if err != nil {
+		return nil, fmt.Errorf("error finding product: %w", err)
+	}
+	if product == nil {
+		return nil, ErrProductNotFound
+	}
+
+	store, err := s.storeRepo.FindByID(ctx, product.StoreID)
+	if err != nil {
+		return nil, fmt.Errorf("error finding store: %w", err)
+	}
+	if store != nil && store.OwnerID == userID {
+		return nil, ErrOwnProductReview
+	}
+
+	review := &models.Review{
+		ProductID: productID,
+		UserID:    userID,
+		Rating:    req.Rating,
+		Body:      req.Body,
+		// Sem encomendas não há compras a verificar
+		VerifiedPurchase: false,
+	}
+	if err := s.reviewRepo.Create(ctx, review); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrReviewExists
+		}
+		return nil, fmt.Errorf("error creating review: %w", err)
+	}
+
+	// Devolve a avaliação com o nome do autor, como na listagem
+	created, err := s.reviewRepo.FindByID(ctx, review.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error finding review: %w", err)
+	}
+	if created == nil {
+		return nil, ErrReviewNotFound
+	}
+	created.Photos = []models.ReviewPhoto{}
+
+	logging.FromContext(ctx).Info("review created", "review_id", created.ID, "product_id", productID)
+	s.audit.Record(ctx, "review.create", models.AuditEntityReview, created.ID, nil, created)
+	s.refreshRating(ctx, productID)
+
+	if store != nil {
+		s.notifications.Notify(ctx, models.NotifyRequest{
+			UserID: store.OwnerID,
+			Type:   models.NotificationReviewReceived,
+			Title:  fmt.Sprintf("New %d-star review", created.Rating),
+			Body:   fmt.Sprintf("%s reviewed %s: %s", created.Author, product.Title, preview(created.Body, notificationPreviewLength)),
+			Data:   map[string]interface{}{"product_id": productID, "review_id": created.ID},
+		})
+	}
+
+	return created, nil
+}
+
+func (s *reviewService) UpdateReview(ctx context.Context, userID, id int64, req *models.UpdateReviewRequest) (*models.Review, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "reviewService.UpdateReview", attribute.Int64("user.id", userID), attribute.Int64("review.id", id))
+	defer span.End()
+
+	if err := req.Validate(); err != nil {
+		return nil, NewValidationError(err)
+	}
+
+	review, err := s.ownReview(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	before := *review
+	if req.Rating != nil {
+		review.Rating = *req.Rating
+	}
+	if req.Body != nil {
+		review.Body = *req.Body
+	}
+
+	if err := s.reviewRepo.Update(ctx, review); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrReviewNotFound
+		}
+		return nil, err
+	}
+
+	s.audit.Record(ctx, "review.update", models.AuditEntityReview, review.ID, &before, review)
+	if review.Rating != before.Rating && review.Status == models.ReviewPublished {
+		s.refreshRating(ctx, review.ProductID)
+	}
+
+	return s.withPhotos(ctx, review)
+}
+
+func (s *reviewService) DeleteReview(ctx context.Context, userID, id int64) error {
+	ctx, span := tracing.Start(ctx, tracerName, "reviewService.DeleteReview", attribute.Int64("user.id", userID), attribute.Int64("review.id", id))
+	defer span.End()
+
+	review, err := s.ownReview(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.reviewRepo.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	logging.FromContext(ctx).Info("review deleted", "review_id", id, "product_id", review.ProductID)
+	s.audit.Record(ctx, "review.delete", models.AuditEntityReview, id, review, nil)
+	if review.Status == models.ReviewPublished {
+		s.refreshRating(ctx, review.ProductID)
+	}
+
+	return nil
+}
+
+func (s *reviewService) AddPhoto(ctx context.Context, userID, id int64, url string) (*models.ReviewPhoto, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "reviewService.AddPhoto", attribute.Int64("user.id", userID), attribute.Int64("review.id", id))
+	defer span.End()
+
+	if _, err := s.ownReview(ctx, userID, id); err != nil {
+		return nil, err
+	}
+
+	photo := &models.ReviewPhoto{ReviewID: id, URL: url}
+	if err := s.reviewRepo.CreatePhoto(ctx, photo, models.MaxReviewPhotos); err != nil {
+		switch {
+		case errors.Is(err, repositories.ErrPhotoLimit):
+			return nil, ErrReviewPhotoLimit
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrReviewNotFound
+		}
+		return nil, err
+	}
+
+	return photo, nil
+}
+
+func (s *reviewService) Reply(ctx context.Context, storeID, id int64, req *models.ReplyReviewRequest) (*models.Review, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "reviewService.Reply", attribute.Int64("store.id", storeID), attribute.Int64("review.id", id))
+	defer span.End()
+
+	if err := req.Validate(); err != nil {
+		return nil, NewValidationError(err)
+	}
+
+	review, err := s.storeReview(ctx, storeID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	before := review.Reply
+	review.Reply = &req.Body
+	if err := s.reviewRepo.SetReply(ctx, review); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrReviewNotFound
+		}
+		return nil, err
+	}
+
+	s.audit.RecordChanges(ctx, "review.reply", models.AuditEntityReview, id, audit.Changes{
+		"reply": {Before: before, After: review.Reply},
+	})
+
+	// Só a primeira resposta é notificada; as edições seguintes não
+	if before == nil {
+		s.notifications.Notify(ctx, models.NotifyRequest{
+			UserID: review.UserID,
+			Type:   models.NotificationReviewReplied,
+			Title:  "The seller replied to your review",
+			Body:   preview(req.Body, notificationPreviewLength),
+			Data:   map[string]interface{}{"product_id": review.ProductID, "review_id": id},
+		})
+	}
+
+	return s.withPhotos(ctx, review)
+}
+
+func (s *reviewService) DeleteReply(ctx context.Context, storeID, id int64) (*models.Review, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "reviewService.DeleteReply", attribute.Int64("store.id", storeID), attribute.Int64("review.id", id))
+	defer span.End()
+
+	review, err := s.storeReview(ctx, storeID, id)
+	if err != nil {
+		return nil, err
+	}
+	if review.Reply == nil {
+		return s.withPhotos(ctx, review)
+	}
+
+	before := review.Reply
+	review.Reply = nil
+	if err := s.reviewRepo.SetReply(ctx, review); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrReviewNotFound
+		}
+		return nil, err
+	}
+
+	s.audit.RecordChanges(ctx, "review.reply", models.AuditEntityReview, id, audit.Changes{
+		"reply": {Before: before, After: nil},
+	})
+	return s.withPhotos(ctx, review)
+}
+
+func (s *reviewService) Report(ctx context.Context, userID, id int64, req *models.ReportReviewRequest) (*models.ReviewReport, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "reviewService.Report", attribute.Int64("user.id", userID), attribute.Int64("review.id", id))
+	defer span.End()
+
+	if err := req.Validate(); err != nil {
+		return nil, NewValidationError(err)
+	}
+
+	review, err := s.reviewRepo.FindByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("error finding review: %w", err)
+	}
+	// As escondidas já foram moderadas: para quem denuncia não existem
+	if review == nil || review.Status != models.ReviewPublished {
+		return nil, ErrReviewNotFound
+	}
+	if review.UserID == userID {
+		return nil, ErrOwnReviewReport
+	}
+
+	report := &models.ReviewReport{
+		ReviewID:   id,
+		ReporterID: userID,
+		Reason:     req.Reason,
+		Details:    req.Details,
+	}
+	if err := s.reviewRepo.CreateReport(ctx, report); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrReviewReported
+		}
+		return nil, fmt.Errorf("error creating review report: %w", err)
+	}
+
+	logging.FromContext(ctx).Info("review reported", "review_id", id, "report_id", report.ID, "reason", report.Reason)
+	return report, nil
+}
+
+func (s *reviewService) ListReports(ctx context.Context, status string, page, limit int) ([]models.ReviewReport, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "reviewService.ListReports")
+	defer span.End()
+
+	switch status {
+	case "":
+		status = models.ReviewReportPending
+	case models.ReviewReportPending, models.ReviewReportDismissed, models.ReviewReportUpheld:
+	default:
+		return nil, errReviewStatusFilter
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	reports, err := s.reviewRepo.ListReports(ctx, status, page, limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(reports) == 0 {
+		return []models.ReviewReport{}, nil
+	}
+
+	ids := make([]int64, 0, len(reports))
+	for _, report := range reports {
+		ids = append(ids, report.ReviewID)
+	}
+	reviews, err := s.reviewRepo.FindByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.attachPhotos(ctx, reviews); err != nil {
+		return nil, err
+	}
+
+	byID := make(map[int64]*models.Review, len(reviews))
+	for i := range reviews {
+		byID[reviews[i].ID] = &reviews[i]
+	}
+	for i := range reports {
+		reports[i].Review = byID[reports[i].ReviewID]
+	}
+
+	return reports, nil
+}
+
+func (s *reviewService) Moderate(ctx context.Context, moderatorID, id int64, req *models.ModerateReviewRequest) (*models.Review, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "reviewService.Moderate", attribute.Int64("review.id", id), attribute.String("moderation.action", req.Action))
+	defer span.End()
+
+	if err := req.Validate(); err != nil {
+		return nil, NewValidationError(err)
+	}
+
+	review, err := s.reviewRepo.FindByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("error finding review: %w", err)
+	}
+	if review == nil {
+		return nil, ErrReviewNotFound
+	}
+
+	reportStatus, reviewStatus := models.ReviewReportDismissed, models.ReviewPublished
+	if req.Action == models.ReviewModerationHide {
+		reportStatus, reviewStatus = models.ReviewReportUpheld, models.ReviewHidden
+	}
+
+	resolved, err := s.reviewRepo.ResolveReports(ctx, id, reportStatus, moderatorID)
+	if err != nil {
+		return nil, err
+	}
+	// Sem denúncias pendentes só faz sentido voltar a publicar uma escondida
+	if resolved == 0 && review.Status == reviewStatus {
+		return nil, ErrNoPendingReports
+	}
+
+	if review.Status != reviewStatus {
+		if err := s.reviewRepo.SetStatus(ctx, id, reviewStatus); err != nil {
+			return nil, err
+		}
+		previous := review.Status
+		review.Status = reviewStatus
+		s.audit.RecordChanges(ctx, "review."+req.Action, models.AuditEntityReview, id, audit.Changes{
+			"status": {Before: previous, After: reviewStatus},
+		})
+		s.refreshRating(ctx, review.ProductID)
+	} else {
+		s.audit.RecordChanges(ctx, "review."+req.Action, models.AuditEntityReview, id, nil)
+	}
+
+	logging.FromContext(ctx).Info("review moderated", "review_id", id, "action", req.Action, "reports", resolved)
+	return s.withPhotos(ctx, review)
+}
+
+// ownReview devolve a avaliação se for do utilizador; userID 0 aceita qualquer uma
+func (s *reviewService) ownReview(ctx context.Context, userID, id int64) (*models.Review, error) {
+	review, err := s.reviewRepo.FindByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("error finding review: %w", err)
+	}
+	if review == nil {
+		return nil, ErrReviewNotFound
+	}
+	if userID != 0 && review.UserID != userID {
+		return nil, ErrReviewNotOwned
+	}
+	return review, nil
+}
+
+// storeReview devolve a avaliação se for de um produto da loja
+func (s *reviewService) storeReview(ctx context.Context, storeID, id int64) (*models.Review, error) {
+	review, err := s.reviewRepo.FindByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("error finding review: %w", err)
+	}
+	if review == nil {
+		return nil, ErrReviewNotFound
+	}
+
+	product, err := s.productRepo.FindByID(ctx, review.ProductID)
+	if err != nil {
+		return nil, fmt.Errorf("error finding product: %w", err)
+	}
+	if product == nil {
+		return nil, ErrProductNotFound
+	}
+	if product.StoreID != storeID {
+		return nil, ErrProductNotOwned
+	}
+
+	return review, nil
+}
+
+// withPhotos devolve a avaliação com as suas fotografias
+func (s *reviewService) withPhotos(ctx context.Context, review *models.Review) (*models.Review, error) {
+	reviews := []models.Review{*review}
+	if err := s.attachPhotos(ctx, reviews); err != nil {
+		return nil, err
+	}
+	return &reviews[0], nil
+}
+
+// attachPhotos carrega de uma vez as fotografias das avaliações
+func (s *reviewService) attachPhotos(ctx context.Context, reviews []models.Review) error {
+	if len(reviews) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(reviews))
+	for i := range reviews {
+		ids[i] = reviews[i].ID
+		reviews[i].Photos = []models.ReviewPhoto{}
+	}
+
+	photos, err := s.reviewRepo.ListPhotos(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	index := make(map[int64]int, len(reviews))
+	for i := range reviews {
+		index[reviews[i].ID] = i
+	}
+	for _, photo := range photos {
+		i := index[photo.ReviewID]
+		reviews[i].Photos = append(reviews[i].Photos, photo)
+	}
+
+	return nil
+}
+
+// refreshRating recalcula a média do produto e a da sua loja. A alteração da
+// avaliação já foi guardada: uma falha fica nos logs e a média acerta na alteração
+// seguinte.
+func (s *reviewService) refreshRating(ctx context.Context, productID int64) {
+	storeID, err := s.productRepo.RefreshRating(ctx, productID)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to refresh product rating",
+			"product_id", productID,
+			logging.Err(err),
+		)
+		return
+	}
+	if err := s.storeRepo.RefreshRating(ctx, storeID); err != nil {
+		logging.FromContext(ctx).Error("failed to refresh store rating",
+			"store_id", storeID,
+			logging.Err(err),
+		)
+	}
+}
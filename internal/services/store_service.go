@@ -3,38 +3,70 @@ package services
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"math"
+	"modress/internal/audit"
+	"modress/internal/logging"
+	"modress/internal/metrics"
 	"modress/internal/models"
 	"modress/internal/repositories"
+	"modress/internal/tracing"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // StoreService interface
 type StoreService interface {
 	CreateStore(ctx context.Context, ownerID int64, req *models.CreateStoreRequest) (*models.StoreResponse, error)
 	GetStoreByID(ctx context.Context, id int64) (*models.StoreResponse, error)
-	GetStoreBySlug(ctx context.Context, slug string) (*models.StoreResponse, error)
+	// GetStoreBySlug devolve o perfil público da loja, com as estatísticas calculadas no momento
+	GetStoreBySlug(ctx context.Context, slug string) (*models.StoreProfile, error)
 	GetStoreByOwnerID(ctx context.Context, ownerID int64) (*models.StoreResponse, error)
-	UpdateStore(ctx context.Context, id int64, ownerID int64, req *models.UpdateStoreRequest) (*models.StoreResponse, error)
-	DeleteStore(ctx context.Context, id int64, ownerID int64) error
+	// version é a versão que o cliente espera (If-Match); 0 aceita qualquer versão
+	UpdateStore(ctx context.Context, id int64, ownerID int64, version int64, req *models.UpdateStoreRequest) (*models.StoreResponse, error)
+	DeleteStore(ctx context.Context, id int64, ownerID int64, version int64) error
+	// RestoreStore restaura uma loja apagada do dono ownerID, com os produtos apagados
+	// com ela; ownerID 0 (administradores) aceita qualquer dono
+	RestoreStore(ctx context.Context, id int64, ownerID int64) (*models.StoreResponse, error)
 	ListStores(ctx context.Context, page, limit int) ([]models.StoreResponse, error)
 	ListApprovedStores(ctx context.Context, page, limit int) ([]models.StoreResponse, error)
 	ApproveStore(ctx context.Context, id int64) error
+	FollowStore(ctx context.Context, userID, storeID int64) error
+	UnfollowStore(ctx context.Context, userID, storeID int64) error
+	ListFollowedStores(ctx context.Context, userID int64, page, limit int) ([]models.StoreResponse, error)
 }
 
+var ErrOwnStoreFollow = NewError(ErrValidation, "own_store", "you cannot follow your own store")
+
+// responseStatsWindow é o período das conversas usado nas estatísticas de resposta
+const responseStatsWindow = 90 * 24 * time.Hour
+
 type storeService struct {
-	storeRepo repositories.StoreRepository
+	storeRepo     repositories.StoreRepository
+	chatRepo      repositories.ChatRepository
+	audit         AuditService
+	notifications NotificationService
+	webhooks      WebhookService
 }
 
-func NewStoreService(storeRepo repositories.StoreRepository) StoreService {
+func NewStoreService(storeRepo repositories.StoreRepository, chatRepo repositories.ChatRepository, auditService AuditService, notificationService NotificationService, webhookService WebhookService) StoreService {
 	return &storeService{
-		storeRepo: storeRepo,
+		storeRepo:     storeRepo,
+		chatRepo:      chatRepo,
+		audit:         auditService,
+		notifications: notificationService,
+		webhooks:      webhookService,
 	}
 }
 
 func (s *storeService) CreateStore(ctx context.Context, ownerID int64, req *models.CreateStoreRequest) (*models.StoreResponse, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "storeService.CreateStore", attribute.Int64("owner.id", ownerID))
+	defer span.End()
+
 	if err := req.Validate(); err != nil {
-		return nil, fmt.Errorf("validation error: %w", err)
+		return nil, NewValidationError(err)
 	}
 
 	// Verificar se o usuário já possui uma loja
@@ -43,7 +75,7 @@ func (s *storeService) CreateStore(ctx context.Context, ownerID int64, req *mode
 		return nil, fmt.Errorf("error checking existing store: %w", err)
 	}
 	if existingStore != nil {
-		return nil, fmt.Errorf("user already has a store")
+		return nil, ErrStoreExists
 	}
 
 	now := time.Now()
@@ -74,53 +106,91 @@ func (s *storeService) CreateStore(ctx context.Context, ownerID int64, req *mode
 	if err := s.storeRepo.Create(ctx, store); err != nil {
 		return nil, fmt.Errorf("error creating store: %w", err)
 	}
+	s.audit.Record(ctx, "store.create", models.AuditEntityStore, store.ID, nil, store)
 
 	response := store.ToResponse()
 	return &response, nil
 }
 
 func (s *storeService) GetStoreByID(ctx context.Context, id int64) (*models.StoreResponse, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "storeService.GetStoreByID", attribute.Int64("store.id", id))
+	defer span.End()
+
 	store, err := s.storeRepo.FindByID(ctx, id)
 	if err != nil {
 		return nil, fmt.Errorf("error finding store: %w", err)
 	}
 	if store == nil {
-		return nil, fmt.Errorf("store not found")
+		return nil, ErrStoreNotFound
 	}
 
 	response := store.ToResponse()
 	return &response, nil
 }
 
-func (s *storeService) GetStoreBySlug(ctx context.Context, slug string) (*models.StoreResponse, error) {
+func (s *storeService) GetStoreBySlug(ctx context.Context, slug string) (*models.StoreProfile, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "storeService.GetStoreBySlug")
+	defer span.End()
+
 	store, err := s.storeRepo.FindBySlug(ctx, slug)
 	if err != nil {
 		return nil, fmt.Errorf("error finding store: %w", err)
 	}
 	if store == nil {
-		return nil, fmt.Errorf("store not found")
+		return nil, ErrStoreNotFound
 	}
 
-	response := store.ToResponse()
-	return &response, nil
+	stats, err := s.storeRepo.Stats(ctx, store.ID)
+	if err != nil {
+		return nil, err
+	}
+	if stats == nil {
+		return nil, ErrStoreNotFound
+	}
+	if stats.Categories == nil {
+		stats.Categories = []string{}
+	}
+
+	// As mensagens enviadas pelo WebSocket e pela API REST ficam todas guardadas pelo
+	// ChatService: as estatísticas saem daí
+	responseStats, err := s.chatRepo.ResponseStats(ctx, store.ID, time.Now().Add(-responseStatsWindow))
+	if err != nil {
+		return nil, err
+	}
+	responseStats.WindowDays = int(responseStatsWindow / (24 * time.Hour))
+	if responseStats.Received > 0 {
+		responseStats.ResponseRate = math.Round(float64(responseStats.Answered)/float64(responseStats.Received)*100) / 100
+	}
+
+	return &models.StoreProfile{
+		StoreResponse: store.ToResponse(),
+		StoreStats:    *stats,
+		ResponseStats: *responseStats,
+	}, nil
 }
 
 func (s *storeService) GetStoreByOwnerID(ctx context.Context, ownerID int64) (*models.StoreResponse, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "storeService.GetStoreByOwnerID", attribute.Int64("owner.id", ownerID))
+	defer span.End()
+
 	store, err := s.storeRepo.FindByOwnerID(ctx, ownerID)
 	if err != nil {
 		return nil, fmt.Errorf("error finding store: %w", err)
 	}
 	if store == nil {
-		return nil, fmt.Errorf("store not found")
+		return nil, ErrStoreNotFound
 	}
 
 	response := store.ToResponse()
 	return &response, nil
 }
 
-func (s *storeService) UpdateStore(ctx context.Context, id int64, ownerID int64, req *models.UpdateStoreRequest) (*models.StoreResponse, error) {
+func (s *storeService) UpdateStore(ctx context.Context, id int64, ownerID int64, version int64, req *models.UpdateStoreRequest) (*models.StoreResponse, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "storeService.UpdateStore", attribute.Int64("store.id", id), attribute.Int64("owner.id", ownerID))
+	defer span.End()
+
 	if err := req.Validate(); err != nil {
-		return nil, fmt.Errorf("validation error: %w", err)
+		return nil, NewValidationError(err)
 	}
 
 	store, err := s.storeRepo.FindByID(ctx, id)
@@ -128,14 +198,19 @@ func (s *storeService) UpdateStore(ctx context.Context, id int64, ownerID int64,
 		return nil, fmt.Errorf("error finding store: %w", err)
 	}
 	if store == nil {
-		return nil, fmt.Errorf("store not found")
+		return nil, ErrStoreNotFound
 	}
 
 	// Verificar se o usuário é o dono da loja
 	if store.OwnerID != ownerID {
-		return nil, fmt.Errorf("unauthorized: not store owner")
+		return nil, ErrStoreNotOwned
+	}
+	if err := checkVersion(version, store.Version); err != nil {
+		return nil, err
 	}
 
+	before := *store
+
 	// Atualizar apenas os campos fornecidos
 	if req.Name != nil {
 		store.Name = *req.Name
@@ -163,41 +238,114 @@ func (s *storeService) UpdateStore(ctx context.Context, id int64, ownerID int64,
 	store.UpdatedAt = time.Now()
 
 	if err := s.storeRepo.Update(ctx, store); err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("store not found")
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, s.writeConflict(ctx, id, version)
 		}
 		return nil, fmt.Errorf("error updating store: %w", err)
 	}
+	s.audit.Record(ctx, "store.update", models.AuditEntityStore, id, &before, store)
 
 	response := store.ToResponse()
 	return &response, nil
 }
 
-func (s *storeService) DeleteStore(ctx context.Context, id int64, ownerID int64) error {
+func (s *storeService) DeleteStore(ctx context.Context, id int64, ownerID int64, version int64) error {
+	ctx, span := tracing.Start(ctx, tracerName, "storeService.DeleteStore", attribute.Int64("store.id", id), attribute.Int64("owner.id", ownerID))
+	defer span.End()
+
 	store, err := s.storeRepo.FindByID(ctx, id)
 	if err != nil {
 		return fmt.Errorf("error finding store: %w", err)
 	}
 	if store == nil {
-		return fmt.Errorf("store not found")
+		return ErrStoreNotFound
 	}
 
 	// Verificar se o usuário é o dono da loja
 	if store.OwnerID != ownerID {
-		return fmt.Errorf("unauthorized: not store owner")
+		return ErrStoreNotOwned
+	}
+	if err := checkVersion(version, store.Version); err != nil {
+		return err
 	}
 
-	if err := s.storeRepo.Delete(ctx, id); err != nil {
-		if err == sql.ErrNoRows {
-			return fmt.Errorf("store not found")
+	if err := s.storeRepo.Delete(ctx, id, store.Version); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return s.writeConflict(ctx, id, version)
 		}
 		return fmt.Errorf("error deleting store: %w", err)
 	}
+	s.audit.Record(ctx, "store.delete", models.AuditEntityStore, id, store, nil)
 
 	return nil
 }
 
+func (s *storeService) RestoreStore(ctx context.Context, id int64, ownerID int64) (*models.StoreResponse, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "storeService.RestoreStore", attribute.Int64("store.id", id), attribute.Int64("owner.id", ownerID))
+	defer span.End()
+
+	store, err := s.storeRepo.FindByIDIncludingDeleted(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("error finding store: %w", err)
+	}
+	if store == nil {
+		return nil, ErrStoreNotFound
+	}
+	if ownerID != 0 && store.OwnerID != ownerID {
+		return nil, ErrStoreNotOwned
+	}
+
+	// Restaurar uma loja que não está apagada não faz nada
+	if store.DeletedAt == nil {
+		response := store.ToResponse()
+		return &response, nil
+	}
+
+	// Cada utilizador tem no máximo uma loja ativa
+	existing, err := s.storeRepo.FindByOwnerID(ctx, store.OwnerID)
+	if err != nil {
+		return nil, fmt.Errorf("error checking existing store: %w", err)
+	}
+	if existing != nil {
+		return nil, ErrStoreExists
+	}
+
+	// O slug pode ter sido ocupado por outra loja enquanto esta esteve apagada
+	existingSlug, err := s.storeRepo.FindBySlug(ctx, store.Slug)
+	if err != nil {
+		return nil, fmt.Errorf("error checking slug: %w", err)
+	}
+	if existingSlug != nil {
+		store.Slug = fmt.Sprintf("%s-%d", store.Slug, time.Now().Unix())
+	}
+
+	if err := s.storeRepo.Restore(ctx, store); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// Restaurada ou purgada por outro pedido entretanto
+			return s.GetStoreByID(ctx, id)
+		}
+		return nil, fmt.Errorf("error restoring store: %w", err)
+	}
+	logging.FromContext(ctx).Info("store restored", "store_id", id)
+	s.audit.Record(ctx, "store.restore", models.AuditEntityStore, id, nil, store)
+
+	response := store.ToResponse()
+	return &response, nil
+}
+
+// writeConflict explica uma escrita na loja que não afetou nenhuma linha
+func (s *storeService) writeConflict(ctx context.Context, id, version int64) error {
+	current, err := s.storeRepo.FindByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("error finding store: %w", err)
+	}
+	return versionConflict(current != nil, version, ErrStoreNotFound)
+}
+
 func (s *storeService) ListStores(ctx context.Context, page, limit int) ([]models.StoreResponse, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "storeService.ListStores")
+	defer span.End()
+
 	if page < 1 {
 		page = 1
 	}
@@ -219,6 +367,9 @@ func (s *storeService) ListStores(ctx context.Context, page, limit int) ([]model
 }
 
 func (s *storeService) ListApprovedStores(ctx context.Context, page, limit int) ([]models.StoreResponse, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "storeService.ListApprovedStores")
+	defer span.End()
+
 	if page < 1 {
 		page = 1
 	}
@@ -240,12 +391,95 @@ func (s *storeService) ListApprovedStores(ctx context.Context, page, limit int)
 }
 
 func (s *storeService) ApproveStore(ctx context.Context, id int64) error {
+	ctx, span := tracing.Start(ctx, tracerName, "storeService.ApproveStore", attribute.Int64("store.id", id))
+	defer span.End()
+
+	store, err := s.storeRepo.FindByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("error finding store: %w", err)
+	}
+	if store == nil {
+		return ErrStoreNotFound
+	}
+
 	if err := s.storeRepo.ApproveStore(ctx, id); err != nil {
-		if err == sql.ErrNoRows {
-			return fmt.Errorf("store not found")
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrStoreNotFound
 		}
 		return fmt.Errorf("error approving store: %w", err)
 	}
+	metrics.StoresApproved.Inc()
+	logging.FromContext(ctx).Info("store approved", "store_id", id)
+	s.audit.RecordChanges(ctx, "store.approve", models.AuditEntityStore, id, audit.Changes{
+		"is_approved": {Before: store.IsApproved, After: true},
+	})
+	if !store.IsApproved {
+		s.notifications.Notify(ctx, models.NotifyRequest{
+			UserID: store.OwnerID,
+			Type:   models.NotificationStoreApproved,
+			Title:  "Your store has been approved",
+			Body:   fmt.Sprintf("%s is now visible to buyers.", store.Name),
+			Data:   map[string]interface{}{"store_id": store.ID},
+		})
+		store.IsApproved = true
+		s.webhooks.Dispatch(ctx, store.ID, models.WebhookEventStoreApproved, store.ToResponse())
+	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+func (s *storeService) FollowStore(ctx context.Context, userID, storeID int64) error {
+	ctx, span := tracing.Start(ctx, tracerName, "storeService.FollowStore", attribute.Int64("user.id", userID), attribute.Int64("store.id", storeID))
+	defer span.End()
+
+	store, err := s.storeRepo.FindByID(ctx, storeID)
+	if err != nil {
+		return fmt.Errorf("error finding store: %w", err)
+	}
+	if store == nil {
+		return ErrStoreNotFound
+	}
+	if store.OwnerID == userID {
+		return ErrOwnStoreFollow
+	}
+
+	// Seguir uma loja já seguida não muda nada
+	if _, err := s.storeRepo.Follow(ctx, userID, storeID); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *storeService) UnfollowStore(ctx context.Context, userID, storeID int64) error {
+	ctx, span := tracing.Start(ctx, tracerName, "storeService.UnfollowStore", attribute.Int64("user.id", userID), attribute.Int64("store.id", storeID))
+	defer span.End()
+
+	if _, err := s.storeRepo.Unfollow(ctx, userID, storeID); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *storeService) ListFollowedStores(ctx context.Context, userID int64, page, limit int) ([]models.StoreResponse, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "storeService.ListFollowedStores", attribute.Int64("user.id", userID))
+	defer span.End()
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	stores, err := s.storeRepo.ListFollowed(ctx, userID, page, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]models.StoreResponse, len(stores))
+	for i, store := range stores {
+		responses[i] = store.ToResponse()
+	}
+
+	return responses, nil
+}
@@ -0,0 +1,4 @@
+package services
+
+// tracerName identifica os spans criados pelos serviços
+const tracerName = "modress/internal/services"
@@ -0,0 +1,487 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"modress/internal/audit"
+	"modress/internal/jobs"
+	"modress/internal/logging"
+	"modress/internal/models"
+	"modress/internal/repositories"
+	"modress/internal/tracing"
+	"modress/internal/webhook"
+	"slices"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	ErrWebhookNotFound         = NewError(ErrNotFound, "webhook_not_found", "webhook not found")
+	ErrWebhookDeliveryNotFound = NewError(ErrNotFound, "webhook_delivery_not_found", "webhook delivery not found")
+	ErrWebhookLimitReached     = NewError(ErrConflict, "webhook_limit_reached", fmt.Sprintf("a store can have at most %d webhooks", maxWebhooksPerStore))
+	ErrWebhookInactive         = NewError(ErrConflict, "webhook_inactive", "the webhook is disabled")
+)
+
+// maxWebhooksPerStore limita as subscrições de cada loja
+const maxWebhooksPerStore = 10
+
+// WebhookService gere os webhooks das lojas e entrega-lhes os eventos. Cada entrega
+// fica registada e é feita por um job webhook.deliver, repetido com backoff
+// exponencial enquanto o recetor não responder 2xx.
+type WebhookService interface {
+	// Dispatch envia o evento aos webhooks da loja subscritos a ele. Como na auditoria,
+	// uma falha é registada nos logs mas não faz falhar a operação que o originou.
+	Dispatch(ctx context.Context, storeID int64, event string, data interface{})
+	// CreateWebhook cria a subscrição e devolve-a com o segredo, que não volta a ser mostrado
+	CreateWebhook(ctx context.Context, storeID int64, req *models.CreateWebhookRequest) (*models.Webhook, error)
+	ListWebhooks(ctx context.Context, storeID int64) ([]models.Webhook, error)
+	GetWebhook(ctx context.Context, storeID, id int64) (*models.Webhook, error)
+	UpdateWebhook(ctx context.Context, storeID, id int64, req *models.UpdateWebhookRequest) (*models.Webhook, error)
+	DeleteWebhook(ctx context.Context, storeID, id int64) error
+	// RotateSecret troca o segredo e devolve o webhook com o novo
+	RotateSecret(ctx context.Context, storeID, id int64) (*models.Webhook, error)
+	ListDeliveries(ctx context.Context, storeID, webhookID int64, page, limit int) ([]models.WebhookDelivery, error)
+	// Redeliver volta a enviar uma entrega, numa nova entrega com o mesmo event_id
+	Redeliver(ctx context.Context, storeID, webhookID, deliveryID int64) (*models.WebhookDelivery, error)
+	HandleDeliveryJob(ctx context.Context, payload models.WebhookDeliveryJobPayload) error
+}
+
+type webhookService struct {
+	webhookRepo repositories.WebhookRepository
+	jobService  JobService
+	client      *webhook.Client
+	maxAttempts int
+	audit       AuditService
+}
+
+func NewWebhookService(webhookRepo repositories.WebhookRepository, jobService JobService, client *webhook.Client, maxAttempts int, auditService AuditService) WebhookService {
+	return &webhookService{
+		webhookRepo: webhookRepo,
+		jobService:  jobService,
+		client:      client,
+		maxAttempts: maxAttempts,
+		audit:       auditService,
+	}
+}
+
+func (s *webhookService) Dispatch(ctx context.Context, storeID int64, event string, data interface{}) {
+	ctx, span := tracing.Start(ctx, tracerName, "webhookService.Dispatch", attribute.Int64("store.id", storeID), attribute.String("webhook.event", event))
+	defer span.End()
+
+	// A operação que o originou já foi feita: o evento segue mesmo que o cliente
+	// tenha desistido
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+
+	if err := s.dispatch(ctx, storeID, event, data); err != nil {
+		logging.FromContext(ctx).Error("failed to dispatch webhook event",
+			"store_id", storeID,
+			"event", event,
+			logging.Err(err),
+		)
+	}
+}
+
+func (s *webhookService) dispatch(ctx context.Context, storeID int64, event string, data interface{}) error {
+	webhooks, err := s.webhookRepo.ListSubscribed(ctx, storeID, event)
+	if err != nil {
+		return err
+	}
+	if len(webhooks) == 0 {
+		return nil
+	}
+
+	eventID, err := newEventID()
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(models.WebhookEvent{
+		ID:        eventID,
+		Type:      event,
+		CreatedAt: time.Now().UTC(),
+		StoreID:   storeID,
+		Data:      data,
+	})
+	if err != nil {
+		return fmt.Errorf("error encoding webhook event: %w", err)
+	}
+
+	var errs []error
+	for _, wh := range webhooks {
+		delivery := &models.WebhookDelivery{
+			WebhookID: wh.ID,
+			EventID:   eventID,
+			EventType: event,
+			Payload:   payload,
+			Status:    models.WebhookDeliveryPending,
+		}
+		if err := s.enqueue(ctx, delivery); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// enqueue regista a entrega e coloca na fila o job que a faz
+func (s *webhookService) enqueue(ctx context.Context, delivery *models.WebhookDelivery) error {
+	if err := s.webhookRepo.CreateDelivery(ctx, delivery); err != nil {
+		return fmt.Errorf("error creating webhook delivery: %w", err)
+	}
+
+	_, err := s.jobService.Enqueue(ctx, models.EnqueueJobRequest{
+		Type:        models.JobTypeWebhookDelivery,
+		Payload:     models.WebhookDeliveryJobPayload{DeliveryID: delivery.ID},
+		MaxAttempts: s.maxAttempts,
+	})
+	if err != nil {
+		// Sem job a entrega nunca seria feita: fica falhada, e pode ser reenviada
+		message := "could not be queued"
+		delivery.Status = models.WebhookDeliveryFailed
+		delivery.Error = &message
+		if saveErr := s.webhookRepo.UpdateDeliveryAttempt(ctx, delivery); saveErr != nil {
+			logging.FromContext(ctx).Error("error updating webhook delivery", "delivery_id", delivery.ID, logging.Err(saveErr))
+		}
+		return fmt.Errorf("error enqueueing webhook delivery: %w", err)
+	}
+	return nil
+}
+
+func newEventID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating event ID: %w", err)
+	}
+	return "evt_" + hex.EncodeToString(b), nil
+}
+
+func (s *webhookService) CreateWebhook(ctx context.Context, storeID int64, req *models.CreateWebhookRequest) (*models.Webhook, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "webhookService.CreateWebhook", attribute.Int64("store.id", storeID))
+	defer span.End()
+
+	if err := req.Validate(); err != nil {
+		return nil, NewValidationError(err)
+	}
+	if err := validateWebhookURL(req.URL); err != nil {
+		return nil, err
+	}
+	events, err := webhookEvents(req.Events)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := s.webhookRepo.CountByStore(ctx, storeID)
+	if err != nil {
+		return nil, fmt.Errorf("error counting webhooks: %w", err)
+	}
+	if count >= maxWebhooksPerStore {
+		return nil, ErrWebhookLimitReached
+	}
+
+	secret, err := webhook.NewSecret()
+	if err != nil {
+		return nil, fmt.Errorf("error generating webhook secret: %w", err)
+	}
+	wh := &models.Webhook{
+		StoreID:  storeID,
+		URL:      req.URL,
+		Secret:   secret,
+		Events:   events,
+		IsActive: true,
+	}
+	if err := s.webhookRepo.Create(ctx, wh); err != nil {
+		return nil, fmt.Errorf("error creating webhook: %w", err)
+	}
+	s.audit.Record(ctx, "webhook.create", models.AuditEntityWebhook, wh.ID, nil, wh)
+
+	return wh, nil
+}
+
+func (s *webhookService) ListWebhooks(ctx context.Context, storeID int64) ([]models.Webhook, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "webhookService.ListWebhooks", attribute.Int64("store.id", storeID))
+	defer span.End()
+
+	webhooks, err := s.webhookRepo.ListByStore(ctx, storeID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing webhooks: %w", err)
+	}
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+	return webhooks, nil
+}
+
+func (s *webhookService) GetWebhook(ctx context.Context, storeID, id int64) (*models.Webhook, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "webhookService.GetWebhook", attribute.Int64("store.id", storeID), attribute.Int64("webhook.id", id))
+	defer span.End()
+
+	wh, err := s.ownedWebhook(ctx, storeID, id)
+	if err != nil {
+		return nil, err
+	}
+	wh.Secret = ""
+	return wh, nil
+}
+
+func (s *webhookService) UpdateWebhook(ctx context.Context, storeID, id int64, req *models.UpdateWebhookRequest) (*models.Webhook, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "webhookService.UpdateWebhook", attribute.Int64("store.id", storeID), attribute.Int64("webhook.id", id))
+	defer span.End()
+
+	if err := req.Validate(); err != nil {
+		return nil, NewValidationError(err)
+	}
+
+	wh, err := s.ownedWebhook(ctx, storeID, id)
+	if err != nil {
+		return nil, err
+	}
+	before := *wh
+
+	if req.URL != nil {
+		if err := validateWebhookURL(*req.URL); err != nil {
+			return nil, err
+		}
+		wh.URL = *req.URL
+	}
+	if req.Events != nil {
+		if wh.Events, err = webhookEvents(req.Events); err != nil {
+			return nil, err
+		}
+	}
+	if req.IsActive != nil {
+		wh.IsActive = *req.IsActive
+	}
+
+	if err := s.webhookRepo.Update(ctx, wh); err != nil {
+		return nil, fmt.Errorf("error updating webhook: %w", err)
+	}
+	s.audit.Record(ctx, "webhook.update", models.AuditEntityWebhook, id, &before, wh)
+
+	wh.Secret = ""
+	return wh, nil
+}
+
+func (s *webhookService) DeleteWebhook(ctx context.Context, storeID, id int64) error {
+	ctx, span := tracing.Start(ctx, tracerName, "webhookService.DeleteWebhook", attribute.Int64("store.id", storeID), attribute.Int64("webhook.id", id))
+	defer span.End()
+
+	wh, err := s.ownedWebhook(ctx, storeID, id)
+	if err != nil {
+		return err
+	}
+
+	// As entregas do webhook são apagadas com ele; os jobs que ainda as tinham na
+	// fila terminam sem fazer nada
+	if err := s.webhookRepo.Delete(ctx, id); err != nil {
+		return fmt.Errorf("error deleting webhook: %w", err)
+	}
+	s.audit.Record(ctx, "webhook.delete", models.AuditEntityWebhook, id, wh, nil)
+
+	return nil
+}
+
+func (s *webhookService) RotateSecret(ctx context.Context, storeID, id int64) (*models.Webhook, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "webhookService.RotateSecret", attribute.Int64("store.id", storeID), attribute.Int64("webhook.id", id))
+	defer span.End()
+
+	wh, err := s.ownedWebhook(ctx, storeID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if wh.Secret, err = webhook.NewSecret(); err != nil {
+		return nil, fmt.Errorf("error generating webhook secret: %w", err)
+	}
+	if err := s.webhookRepo.Update(ctx, wh); err != nil {
+		return nil, fmt.Errorf("error updating webhook: %w", err)
+	}
+	s.audit.RecordChanges(ctx, "webhook.rotate_secret", models.AuditEntityWebhook, id, audit.Changes{
+		"secret": {Before: audit.Redacted, After: audit.Redacted},
+	})
+
+	return wh, nil
+}
+
+func (s *webhookService) ListDeliveries(ctx context.Context, storeID, webhookID int64, page, limit int) ([]models.WebhookDelivery, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "webhookService.ListDeliveries", attribute.Int64("store.id", storeID), attribute.Int64("webhook.id", webhookID))
+	defer span.End()
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	if _, err := s.ownedWebhook(ctx, storeID, webhookID); err != nil {
+		return nil, err
+	}
+
+	deliveries, err := s.webhookRepo.ListDeliveries(ctx, webhookID, page, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error listing webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+func (s *webhookService) Redeliver(ctx context.Context, storeID, webhookID, deliveryID int64) (*models.WebhookDelivery, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "webhookService.Redeliver", attribute.Int64("store.id", storeID), attribute.Int64("webhook.id", webhookID), attribute.Int64("webhook.delivery_id", deliveryID))
+	defer span.End()
+
+	wh, err := s.ownedWebhook(ctx, storeID, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	if !wh.IsActive {
+		return nil, ErrWebhookInactive
+	}
+
+	original, err := s.webhookRepo.FindDeliveryByID(ctx, deliveryID)
+	if err != nil {
+		return nil, fmt.Errorf("error finding webhook delivery: %w", err)
+	}
+	if original == nil || original.WebhookID != webhookID {
+		return nil, ErrWebhookDeliveryNotFound
+	}
+
+	delivery := &models.WebhookDelivery{
+		WebhookID:    webhookID,
+		EventID:      original.EventID,
+		EventType:    original.EventType,
+		Payload:      original.Payload,
+		Status:       models.WebhookDeliveryPending,
+		RedeliveryOf: &original.ID,
+	}
+	if err := s.enqueue(ctx, delivery); err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// ownedWebhook devolve o webhook se pertencer à loja; os de outras lojas não existem
+// para esta
+func (s *webhookService) ownedWebhook(ctx context.Context, storeID, id int64) (*models.Webhook, error) {
+	wh, err := s.webhookRepo.FindByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("error finding webhook: %w", err)
+	}
+	if wh == nil || wh.StoreID != storeID {
+		return nil, ErrWebhookNotFound
+	}
+	return wh, nil
+}
+
+func validateWebhookURL(raw string) error {
+	if err := webhook.ValidateURL(raw); err != nil {
+		return NewFieldError("url", "url", "url is invalid: "+err.Error())
+	}
+	return nil
+}
+
+// webhookEvents valida os eventos pedidos e devolve-os sem repetições
+func webhookEvents(requested []string) ([]string, error) {
+	var events []string
+	for _, event := range requested {
+		if !slices.Contains(models.WebhookEvents, event) {
+			return nil, NewFieldError("events", "oneof", "unknown webhook event "+event)
+		}
+		if !slices.Contains(events, event) {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// HandleDeliveryJob processa o job webhook.deliver. Uma resposta que não seja 2xx
+// devolve erro para que o job seja repetido; na última tentativa a entrega fica
+// falhada. Entregas de webhooks apagados ou desativados entretanto não são feitas.
+func (s *webhookService) HandleDeliveryJob(ctx context.Context, payload models.WebhookDeliveryJobPayload) error {
+	ctx, span := tracing.Start(ctx, tracerName, "webhookService.HandleDeliveryJob", attribute.Int64("webhook.delivery_id", payload.DeliveryID))
+	defer span.End()
+
+	delivery, err := s.webhookRepo.FindDeliveryByID(ctx, payload.DeliveryID)
+	if err != nil {
+		return fmt.Errorf("error finding webhook delivery: %w", err)
+	}
+	if delivery == nil || delivery.Status != models.WebhookDeliveryPending {
+		return nil
+	}
+	wh, err := s.webhookRepo.FindByID(ctx, delivery.WebhookID)
+	if err != nil {
+		return fmt.Errorf("error finding webhook: %w", err)
+	}
+	if wh == nil {
+		return nil
+	}
+	if !wh.IsActive {
+		message := "webhook is disabled"
+		delivery.Status = models.WebhookDeliveryFailed
+		delivery.Error = &message
+		return s.saveAttempt(ctx, delivery)
+	}
+
+	result, deliverErr := s.client.Deliver(ctx, webhook.Request{
+		URL:        wh.URL,
+		Secret:     wh.Secret,
+		Event:      delivery.EventType,
+		DeliveryID: delivery.ID,
+		Body:       delivery.Payload,
+	})
+
+	now := time.Now()
+	durationMs := result.Duration.Milliseconds()
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+	delivery.DurationMs = &durationMs
+	delivery.ResponseStatus = nil
+	delivery.ResponseBody = nil
+	delivery.Error = nil
+	if result.StatusCode != 0 {
+		delivery.ResponseStatus = &result.StatusCode
+		delivery.ResponseBody = &result.Body
+	}
+
+	if deliverErr == nil && result.OK() {
+		delivery.Status = models.WebhookDeliverySucceeded
+		delivery.DeliveredAt = &now
+		return s.saveAttempt(ctx, delivery)
+	}
+
+	failure := deliverErr
+	if failure == nil {
+		failure = fmt.Errorf("receiver responded with status %d", result.StatusCode)
+	}
+	message := failure.Error()
+	delivery.Error = &message
+
+	// Um endereço interno não vai deixar de o ser: não vale a pena repetir
+	permanent := errors.Is(deliverErr, webhook.ErrPrivateAddress)
+	// Interrompida pelo shutdown, a tentativa volta à fila mesmo sendo a última
+	interrupted := ctx.Err() != nil
+	if permanent || (jobs.LastAttempt(ctx) && !interrupted) {
+		delivery.Status = models.WebhookDeliveryFailed
+	}
+	if err := s.saveAttempt(ctx, delivery); err != nil {
+		return err
+	}
+
+	if permanent {
+		return jobs.Permanent(failure)
+	}
+	return failure
+}
+
+func (s *webhookService) saveAttempt(ctx context.Context, delivery *models.WebhookDelivery) error {
+	// O resultado é guardado mesmo que a tentativa tenha sido interrompida
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+
+	if err := s.webhookRepo.UpdateDeliveryAttempt(ctx, delivery); err != nil {
+		return fmt.Errorf("error updating webhook delivery: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,440 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"modress/internal/jobs"
+	"modress/internal/models"
+	"modress/internal/repositories"
+	"modress/internal/webhook"
+)
+
+const testBaseBackoff = 50 * time.Millisecond
+
+// receiver é um recetor de webhooks que responde com os status indicados, por ordem;
+// depois do último responde sempre 200. Um status 0 faz o pedido ficar sem resposta
+// até o teste terminar.
+type receiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	requests []receivedRequest
+	release  chan struct{}
+}
+
+type receivedRequest struct {
+	at     time.Time
+	header http.Header
+	body   []byte
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	r := &receiver{statuses: statuses, release: make(chan struct{})}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+
+		r.mu.Lock()
+		r.requests = append(r.requests, receivedRequest{at: time.Now(), header: req.Header.Clone(), body: body})
+		status := http.StatusOK
+		if len(r.statuses) > 0 {
+			status, r.statuses = r.statuses[0], r.statuses[1:]
+		}
+		r.mu.Unlock()
+
+		if status == 0 {
+			<-r.release
+			return
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(func() {
+		close(r.release)
+		r.Close()
+	})
+	return r
+}
+
+func (r *receiver) received() []receivedRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]receivedRequest(nil), r.requests...)
+}
+
+// runDeliveryJob corre o job webhook.deliver da entrega num jobs.Runner, como em
+// produção, até o job terminar com sucesso ou passar a dead
+func runDeliveryJob(t *testing.T, svc WebhookService, deliveryID int64, maxAttempts int) *models.Job {
+	t.Helper()
+
+	payload, _ := json.Marshal(models.WebhookDeliveryJobPayload{DeliveryID: deliveryID})
+	repo := newMemJobRepo(&models.Job{
+		ID:          1,
+		Type:        models.JobTypeWebhookDelivery,
+		Payload:     payload,
+		Status:      models.JobStatusPending,
+		MaxAttempts: maxAttempts,
+		RunAt:       time.Now(),
+	})
+	runner := jobs.NewRunner(repo, jobs.Options{
+		Workers:      1,
+		PollInterval: 10 * time.Millisecond,
+		BaseBackoff:  testBaseBackoff,
+		MaxBackoff:   time.Second,
+	})
+	runner.Register(models.JobTypeWebhookDelivery, jobs.Handle(svc.HandleDeliveryJob))
+	runner.Start()
+	defer runner.Shutdown(context.Background())
+
+	select {
+	case <-repo.finished:
+	case <-time.After(10 * time.Second):
+		t.Fatal("delivery job did not finish")
+	}
+	return repo.get()
+}
+
+func newTestWebhookService(repo *memWebhookRepo, jobService JobService, opts webhook.Options) WebhookService {
+	return NewWebhookService(repo, jobService, webhook.NewClient(opts), 5, nil)
+}
+
+func TestWebhookDeliveryRetriesWithBackoff(t *testing.T) {
+	recv := newReceiver(t, http.StatusInternalServerError, http.StatusBadGateway, http.StatusOK)
+	repo := newMemWebhookRepo()
+	wh := repo.addWebhook(1, recv.URL, true)
+	delivery := repo.addDelivery(wh.ID, "evt_retry")
+	svc := newTestWebhookService(repo, nil, webhook.Options{Timeout: time.Second, AllowPrivateNetworks: true})
+
+	job := runDeliveryJob(t, svc, delivery.ID, 5)
+
+	if job.Status != models.JobStatusSucceeded || job.Attempts != 3 {
+		t.Fatalf("job = %s after %d attempts, want succeeded after 3", job.Status, job.Attempts)
+	}
+	saved := repo.delivery(delivery.ID)
+	if saved.Status != models.WebhookDeliverySucceeded || saved.Attempts != 3 || saved.DeliveredAt == nil {
+		t.Fatalf("delivery = %s after %d attempts, want succeeded after 3", saved.Status, saved.Attempts)
+	}
+	if saved.Error != nil {
+		t.Fatalf("delivery error = %q, want none after success", *saved.Error)
+	}
+
+	requests := recv.received()
+	if len(requests) != 3 {
+		t.Fatalf("receiver got %d requests, want 3", len(requests))
+	}
+	// O atraso dobra a cada tentativa
+	for i := 1; i < len(requests); i++ {
+		gap := requests[i].at.Sub(requests[i-1].at)
+		if want := testBaseBackoff << (i - 1); gap < want {
+			t.Errorf("attempt %d came %v after the previous one, want at least %v", i+1, gap, want)
+		}
+	}
+	for _, req := range requests {
+		if req.header.Get(webhook.HeaderDelivery) != "1" || string(req.body) != string(delivery.Payload) {
+			t.Fatalf("retried request differs from the first: %v %s", req.header, req.body)
+		}
+	}
+}
+
+func TestWebhookDeliveryRetriesOnTimeout(t *testing.T) {
+	recv := newReceiver(t, 0, http.StatusNoContent)
+	repo := newMemWebhookRepo()
+	wh := repo.addWebhook(1, recv.URL, true)
+	delivery := repo.addDelivery(wh.ID, "evt_timeout")
+	svc := newTestWebhookService(repo, nil, webhook.Options{Timeout: 100 * time.Millisecond, AllowPrivateNetworks: true})
+
+	job := runDeliveryJob(t, svc, delivery.ID, 5)
+
+	if job.Status != models.JobStatusSucceeded || job.Attempts != 2 {
+		t.Fatalf("job = %s after %d attempts, want succeeded after 2", job.Status, job.Attempts)
+	}
+	saved := repo.delivery(delivery.ID)
+	if saved.Status != models.WebhookDeliverySucceeded || saved.ResponseStatus == nil || *saved.ResponseStatus != http.StatusNoContent {
+		t.Fatalf("delivery = %+v, want succeeded with status 204", saved)
+	}
+	if len(recv.received()) != 2 {
+		t.Fatalf("receiver got %d requests, want 2", len(recv.received()))
+	}
+}
+
+func TestWebhookDeliveryFailsAfterLastAttempt(t *testing.T) {
+	recv := newReceiver(t, http.StatusInternalServerError, http.StatusServiceUnavailable)
+	repo := newMemWebhookRepo()
+	wh := repo.addWebhook(1, recv.URL, true)
+	delivery := repo.addDelivery(wh.ID, "evt_failed")
+	svc := newTestWebhookService(repo, nil, webhook.Options{Timeout: time.Second, AllowPrivateNetworks: true})
+
+	job := runDeliveryJob(t, svc, delivery.ID, 2)
+
+	if job.Status != models.JobStatusDead || job.Attempts != 2 {
+		t.Fatalf("job = %s after %d attempts, want dead after 2", job.Status, job.Attempts)
+	}
+	saved := repo.delivery(delivery.ID)
+	if saved.Status != models.WebhookDeliveryFailed || saved.Attempts != 2 {
+		t.Fatalf("delivery = %s after %d attempts, want failed after 2", saved.Status, saved.Attempts)
+	}
+	if saved.ResponseStatus == nil || *saved.ResponseStatus != http.StatusServiceUnavailable {
+		t.Fatalf("delivery response status = %v, want 503", saved.ResponseStatus)
+	}
+}
+
+func TestWebhookDeliveryToPrivateAddressIsNotRetried(t *testing.T) {
+	recv := newReceiver(t)
+	repo := newMemWebhookRepo()
+	wh := repo.addWebhook(1, recv.URL, true)
+	delivery := repo.addDelivery(wh.ID, "evt_private")
+	svc := newTestWebhookService(repo, nil, webhook.Options{Timeout: time.Second})
+
+	job := runDeliveryJob(t, svc, delivery.ID, 5)
+
+	if job.Status != models.JobStatusDead || job.Attempts != 1 {
+		t.Fatalf("job = %s after %d attempts, want dead after 1", job.Status, job.Attempts)
+	}
+	saved := repo.delivery(delivery.ID)
+	if saved.Status != models.WebhookDeliveryFailed || saved.Error == nil || !strings.Contains(*saved.Error, webhook.ErrPrivateAddress.Error()) {
+		t.Fatalf("delivery = %+v, want failed with %q", saved, webhook.ErrPrivateAddress)
+	}
+	if len(recv.received()) != 0 {
+		t.Fatal("the receiver on a private address was called")
+	}
+}
+
+func TestRedeliverKeepsEventID(t *testing.T) {
+	recv := newReceiver(t)
+	repo := newMemWebhookRepo()
+	wh := repo.addWebhook(1, recv.URL, true)
+	original := repo.addDelivery(wh.ID, "evt_original")
+	original.Status = models.WebhookDeliveryFailed
+	repo.UpdateDeliveryAttempt(context.Background(), original)
+
+	jobService := &recordingJobService{}
+	svc := newTestWebhookService(repo, jobService, webhook.Options{Timeout: time.Second, AllowPrivateNetworks: true})
+
+	redelivery, err := svc.Redeliver(context.Background(), 1, wh.ID, original.ID)
+	if err != nil {
+		t.Fatalf("Redeliver: %v", err)
+	}
+	if redelivery.ID == original.ID || redelivery.RedeliveryOf == nil || *redelivery.RedeliveryOf != original.ID {
+		t.Fatalf("redelivery = %+v, want a new delivery of %d", redelivery, original.ID)
+	}
+	if redelivery.EventID != original.EventID || string(redelivery.Payload) != string(original.Payload) {
+		t.Fatalf("redelivery event = %s %s, want %s %s", redelivery.EventID, redelivery.Payload, original.EventID, original.Payload)
+	}
+
+	if len(jobService.enqueued) != 1 {
+		t.Fatalf("enqueued %d jobs, want 1", len(jobService.enqueued))
+	}
+	payload := jobService.enqueued[0].Payload.(models.WebhookDeliveryJobPayload)
+	if payload.DeliveryID != redelivery.ID {
+		t.Fatalf("job delivers %d, want the redelivery %d", payload.DeliveryID, redelivery.ID)
+	}
+
+	if err := svc.HandleDeliveryJob(context.Background(), payload); err != nil {
+		t.Fatalf("HandleDeliveryJob: %v", err)
+	}
+	requests := recv.received()
+	if len(requests) != 1 {
+		t.Fatalf("receiver got %d requests, want 1", len(requests))
+	}
+	var event models.WebhookEvent
+	if err := json.Unmarshal(requests[0].body, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.ID != original.EventID {
+		t.Fatalf("redelivered event id = %q, want %q", event.ID, original.EventID)
+	}
+	if got := repo.delivery(original.ID).Status; got != models.WebhookDeliveryFailed {
+		t.Fatalf("original delivery status = %s, want it unchanged", got)
+	}
+}
+
+func TestRedeliverChecksWebhook(t *testing.T) {
+	repo := newMemWebhookRepo()
+	active := repo.addWebhook(1, "https://example.com/hook", true)
+	inactive := repo.addWebhook(1, "https://example.com/hook", false)
+	other := repo.addWebhook(2, "https://example.com/hook", true)
+	delivery := repo.addDelivery(active.ID, "evt_1")
+	svc := newTestWebhookService(repo, &recordingJobService{}, webhook.Options{})
+
+	tests := []struct {
+		name       string
+		storeID    int64
+		webhookID  int64
+		deliveryID int64
+		want       error
+	}{
+		{"another store's webhook", 1, other.ID, delivery.ID, ErrWebhookNotFound},
+		{"delivery of another webhook", 2, other.ID, delivery.ID, ErrWebhookDeliveryNotFound},
+		{"inactive webhook", 1, inactive.ID, delivery.ID, ErrWebhookInactive},
+		{"unknown delivery", 1, active.ID, 999, ErrWebhookDeliveryNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.Redeliver(context.Background(), tt.storeID, tt.webhookID, tt.deliveryID)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Redeliver = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// memWebhookRepo guarda os webhooks e as entregas em memória
+type memWebhookRepo struct {
+	repositories.WebhookRepository
+
+	mu         sync.Mutex
+	webhooks   map[int64]models.Webhook
+	deliveries map[int64]models.WebhookDelivery
+}
+
+func newMemWebhookRepo() *memWebhookRepo {
+	return &memWebhookRepo{
+		webhooks:   make(map[int64]models.Webhook),
+		deliveries: make(map[int64]models.WebhookDelivery),
+	}
+}
+
+func (r *memWebhookRepo) addWebhook(storeID int64, url string, active bool) models.Webhook {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	wh := models.Webhook{ID: int64(len(r.webhooks) + 1), StoreID: storeID, URL: url, Secret: "whsec_test", IsActive: active}
+	r.webhooks[wh.ID] = wh
+	return wh
+}
+
+func (r *memWebhookRepo) addDelivery(webhookID int64, eventID string) *models.WebhookDelivery {
+	payload, _ := json.Marshal(models.WebhookEvent{ID: eventID, Type: models.WebhookEventProductCreated, StoreID: 1})
+	delivery := &models.WebhookDelivery{
+		WebhookID: webhookID,
+		EventID:   eventID,
+		EventType: models.WebhookEventProductCreated,
+		Payload:   payload,
+		Status:    models.WebhookDeliveryPending,
+	}
+	r.CreateDelivery(context.Background(), delivery)
+	return delivery
+}
+
+func (r *memWebhookRepo) delivery(id int64) models.WebhookDelivery {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.deliveries[id]
+}
+
+func (r *memWebhookRepo) FindByID(ctx context.Context, id int64) (*models.Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	wh, ok := r.webhooks[id]
+	if !ok {
+		return nil, nil
+	}
+	return &wh, nil
+}
+
+func (r *memWebhookRepo) CreateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delivery.ID = int64(len(r.deliveries) + 1)
+	delivery.CreatedAt = time.Now()
+	r.deliveries[delivery.ID] = *delivery
+	return nil
+}
+
+func (r *memWebhookRepo) FindDeliveryByID(ctx context.Context, id int64) (*models.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delivery, ok := r.deliveries[id]
+	if !ok {
+		return nil, nil
+	}
+	return &delivery, nil
+}
+
+func (r *memWebhookRepo) UpdateDeliveryAttempt(ctx context.Context, delivery *models.WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deliveries[delivery.ID] = *delivery
+	return nil
+}
+
+// recordingJobService regista os jobs colocados na fila sem os correr
+type recordingJobService struct {
+	JobService
+	enqueued []models.EnqueueJobRequest
+}
+
+func (s *recordingJobService) Enqueue(ctx context.Context, req models.EnqueueJobRequest) (*models.Job, error) {
+	s.enqueued = append(s.enqueued, req)
+	return &models.Job{ID: int64(len(s.enqueued)), Type: req.Type}, nil
+}
+
+// memJobRepo é uma fila com um só job, com as mesmas transições da tabela jobs
+type memJobRepo struct {
+	repositories.JobRepository
+
+	mu       sync.Mutex
+	job      models.Job
+	finished chan struct{}
+}
+
+func newMemJobRepo(job *models.Job) *memJobRepo {
+	return &memJobRepo{job: *job, finished: make(chan struct{})}
+}
+
+func (r *memJobRepo) get() *models.Job {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job := r.job
+	return &job
+}
+
+func (r *memJobRepo) ClaimNext(ctx context.Context, workerID string, types []string) (*models.Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.job.Status != models.JobStatusPending || time.Now().Before(r.job.RunAt) {
+		return nil, nil
+	}
+	r.job.Status = models.JobStatusRunning
+	r.job.Attempts++
+	r.job.LockedBy = &workerID
+	job := r.job
+	return &job, nil
+}
+
+func (r *memJobRepo) MarkSucceeded(ctx context.Context, id int64, workerID string, result []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.job.Status = models.JobStatusSucceeded
+	close(r.finished)
+	return nil
+}
+
+func (r *memJobRepo) MarkFailed(ctx context.Context, id int64, workerID, errMsg string, retryAt *time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.job.LastError = &errMsg
+	if retryAt == nil {
+		r.job.Status = models.JobStatusDead
+		close(r.finished)
+		return nil
+	}
+	r.job.Status = models.JobStatusPending
+	r.job.RunAt = *retryAt
+	return nil
+}
+
+func (r *memJobRepo) Heartbeat(ctx context.Context, id int64, workerID string) error {
+	return nil
+}
+
+func (r *memJobRepo) ReleaseStale(ctx context.Context, lockedBefore time.Time) (int64, error) {
+	return 0, nil
+}
@@ -0,0 +1,458 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"modress/internal/jobs"
+	"modress/internal/logging"
+	"modress/internal/models"
+	"modress/internal/repositories"
+	"modress/internal/tracing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	ErrWishlistNotFound     = NewError(ErrNotFound, "wishlist_not_found", "wishlist not found")
+	ErrWishlistItemNotFound = NewError(ErrNotFound, "wishlist_item_not_found", "product is not in the wishlist")
+	ErrWishlistItemExists   = NewError(ErrConflict, "wishlist_item_exists", "product is already in the wishlist")
+	ErrWishlistLimitReached = NewError(ErrConflict, "wishlist_limit_reached", fmt.Sprintf("a user can have at most %d wishlists", models.MaxWishlistsPerUser))
+	ErrWishlistFull         = NewError(ErrConflict, "wishlist_full", fmt.Sprintf("a wishlist can hold at most %d products", models.MaxWishlistItems))
+)
+
+// WishlistService gere as listas de produtos guardados e avisa quem guardou um
+// produto quando o preço baixa ou quando volta a haver stock. Os avisos são
+// enviados por um job wishlist.alert, para que a alteração do produto não espere
+// pelas notificações de todos os interessados.
+type WishlistService interface {
+	ListWishlists(ctx context.Context, userID int64) ([]models.Wishlist, error)
+	CreateWishlist(ctx context.Context, userID int64, req *models.CreateWishlistRequest) (*models.Wishlist, error)
+	// GetWishlist devolve a lista do utilizador com os produtos
+	GetWishlist(ctx context.Context, userID, id int64) (*models.Wishlist, error)
+	// GetSharedWishlist devolve a lista pública com o token indicado, só com os produtos
+	// ativos e sem identificar o dono
+	GetSharedWishlist(ctx context.Context, token string) (*models.SharedWishlist, error)
+	UpdateWishlist(ctx context.Context, userID, id int64, req *models.UpdateWishlistRequest) (*models.Wishlist, error)
+	DeleteWishlist(ctx context.Context, userID, id int64) error
+	AddItem(ctx context.Context, userID, wishlistID int64, req *models.AddWishlistItemRequest) (*models.WishlistItem, error)
+	RemoveItem(ctx context.Context, userID, wishlistID, productID int64) error
+	MoveItem(ctx context.Context, userID, wishlistID, productID int64, req *models.MoveWishlistItemRequest) error
+	// ProductChanged é chamado pelo ProductService e pela importação depois de alterar um produto e põe
+	// na fila os avisos de descida de preço e de regresso ao stock. Como na auditoria,
+	// uma falha é registada nos logs mas não faz falhar a alteração.
+	ProductChanged(ctx context.Context, before, after *models.Product)
+	HandleAlertJob(ctx context.Context, payload models.WishlistAlertJobPayload) error
+}
+
+type wishlistService struct {
+	wishlistRepo  repositories.WishlistRepository
+	productRepo   repositories.ProductRepository
+	jobService    JobService
+	notifications NotificationService
+}
+
+func NewWishlistService(wishlistRepo repositories.WishlistRepository, productRepo repositories.ProductRepository, jobService JobService, notificationService NotificationService) WishlistService {
+	return &wishlistService{
+		wishlistRepo:  wishlistRepo,
+		productRepo:   productRepo,
+		jobService:    jobService,
+		notifications: notificationService,
+	}
+}
+
+func (s *wishlistService) ListWishlists(ctx context.Context, userID int64) ([]models.Wishlist, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "wishlistService.ListWishlists", attribute.Int64("user.id", userID))
+	defer span.End()
+
+	wishlists, err := s.wishlistRepo.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing wishlists: %w", err)
+	}
+	return wishlists, nil
+}
+
+func (s *wishlistService) CreateWishlist(ctx context.Context, userID int64, req *models.CreateWishlistRequest) (*models.Wishlist, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "wishlistService.CreateWishlist", attribute.Int64("user.id", userID))
+	defer span.End()
+
+	if err := req.Validate(); err != nil {
+		return nil, NewValidationError(err)
+	}
+
+	count, err := s.wishlistRepo.CountByUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error counting wishlists: %w", err)
+	}
+	if count >= models.MaxWishlistsPerUser {
+		return nil, ErrWishlistLimitReached
+	}
+
+	wishlist := &models.Wishlist{
+		UserID: userID,
+		Name:   req.Name,
+	}
+	if err := s.setPublic(wishlist, req.IsPublic); err != nil {
+		return nil, err
+	}
+	if err := s.wishlistRepo.Create(ctx, wishlist); err != nil {
+		return nil, fmt.Errorf("error creating wishlist: %w", err)
+	}
+
+	created, err := s.wishlistRepo.FindByID(ctx, wishlist.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error finding wishlist: %w", err)
+	}
+	return created, nil
+}
+
+func (s *wishlistService) GetWishlist(ctx context.Context, userID, id int64) (*models.Wishlist, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "wishlistService.GetWishlist", attribute.Int64("user.id", userID), attribute.Int64("wishlist.id", id))
+	defer span.End()
+
+	wishlist, err := s.ownedWishlist(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.attachItems(ctx, wishlist, false); err != nil {
+		return nil, err
+	}
+	return wishlist, nil
+}
+
+func (s *wishlistService) GetSharedWishlist(ctx context.Context, token string) (*models.SharedWishlist, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "wishlistService.GetSharedWishlist")
+	defer span.End()
+
+	wishlist, err := s.wishlistRepo.FindByShareToken(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("error finding wishlist: %w", err)
+	}
+	// Uma lista tornada privada mantém o token, mas o link deixa de funcionar
+	if wishlist == nil || !wishlist.IsPublic {
+		return nil, ErrWishlistNotFound
+	}
+	if err := s.attachItems(ctx, wishlist, true); err != nil {
+		return nil, err
+	}
+	return wishlist.ToShared(), nil
+}
+
+func (s *wishlistService) UpdateWishlist(ctx context.Context, userID, id int64, req *models.UpdateWishlistRequest) (*models.Wishlist, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "wishlistService.UpdateWishlist", attribute.Int64("user.id", userID), attribute.Int64("wishlist.id", id))
+	defer span.End()
+
+	if err := req.Validate(); err != nil {
+		return nil, NewValidationError(err)
+	}
+
+	wishlist, err := s.ownedWishlist(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != nil {
+		wishlist.Name = *req.Name
+	}
+	if req.IsPublic != nil {
+		if err := s.setPublic(wishlist, *req.IsPublic); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.wishlistRepo.Update(ctx, wishlist); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrWishlistNotFound
+		}
+		return nil, err
+	}
+	return wishlist, nil
+}
+
+func (s *wishlistService) DeleteWishlist(ctx context.Context, userID, id int64) error {
+	ctx, span := tracing.Start(ctx, tracerName, "wishlistService.DeleteWishlist", attribute.Int64("user.id", userID), attribute.Int64("wishlist.id", id))
+	defer span.End()
+
+	if _, err := s.ownedWishlist(ctx, userID, id); err != nil {
+		return err
+	}
+	return s.wishlistRepo.Delete(ctx, id)
+}
+
+func (s *wishlistService) AddItem(ctx context.Context, userID, wishlistID int64, req *models.AddWishlistItemRequest) (*models.WishlistItem, error) {
+	ctx, span := tracing.Start(ctx, tracerName, "wishlistService.AddItem", attribute.Int64("user.id", userID), attribute.Int64("wishlist.id", wishlistID))
+	defer span.End()
+
+	if err := req.Validate(); err != nil {
+		return nil, NewValidationError(err)
+	}
+
+	if _, err := s.ownedWishlist(ctx, userID, wishlistID); err != nil {
+		return nil, err
+	}
+
+	product, err := s.productRepo.FindByID(ctx, req.ProductID)
+	if err != nil {
+		return nil, fmt.Errorf("error finding product: %w", err)
+	}
+	if product == nil || !product.IsActive {
+		return nil, ErrProductNotFound
+	}
+
+	count, err := s.wishlistRepo.CountItems(ctx, wishlistID)
+	if err != nil {
+		return nil, fmt.Errorf("error counting wishlist items: %w", err)
+	}
+	if count >= models.MaxWishlistItems {
+		return nil, ErrWishlistFull
+	}
+
+	item := &models.WishlistItem{
+		WishlistID:      wishlistID,
+		ProductID:       product.ID,
+		PriceCentsAtAdd: product.PriceCents,
+	}
+	if err := s.wishlistRepo.AddItem(ctx, item); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrWishlistItemExists
+		}
+		return nil, fmt.Errorf("error adding wishlist item: %w", err)
+	}
+
+	response := product.ToResponse()
+	item.PriceAtAdd = float64(item.PriceCentsAtAdd) / 100
+	item.Product = &response
+	return item, nil
+}
+
+func (s *wishlistService) RemoveItem(ctx context.Context, userID, wishlistID, productID int64) error {
+	ctx, span := tracing.Start(ctx, tracerName, "wishlistService.RemoveItem", attribute.Int64("user.id", userID), attribute.Int64("wishlist.id", wishlistID), attribute.Int64("product.id", productID))
+	defer span.End()
+
+	if _, err := s.ownedWishlist(ctx, userID, wishlistID); err != nil {
+		return err
+	}
+
+	removed, err := s.wishlistRepo.RemoveItem(ctx, wishlistID, productID)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return ErrWishlistItemNotFound
+	}
+	return nil
+}
+
+func (s *wishlistService) MoveItem(ctx context.Context, userID, wishlistID, productID int64, req *models.MoveWishlistItemRequest) error {
+	ctx, span := tracing.Start(ctx, tracerName, "wishlistService.MoveItem", attribute.Int64("user.id", userID), attribute.Int64("wishlist.id", wishlistID), attribute.Int64("product.id", productID))
+	defer span.End()
+
+	if err := req.Validate(); err != nil {
+		return NewValidationError(err)
+	}
+	if req.WishlistID == wishlistID {
+		return NewFieldError("wishlist_id", "nefield", "the product is already in this wishlist")
+	}
+
+	if _, err := s.ownedWishlist(ctx, userID, wishlistID); err != nil {
+		return err
+	}
+	if _, err := s.ownedWishlist(ctx, userID, req.WishlistID); err != nil {
+		return err
+	}
+
+	count, err := s.wishlistRepo.CountItems(ctx, req.WishlistID)
+	if err != nil {
+		return fmt.Errorf("error counting wishlist items: %w", err)
+	}
+	if count >= models.MaxWishlistItems {
+		return ErrWishlistFull
+	}
+
+	moved, err := s.wishlistRepo.MoveItem(ctx, wishlistID, req.WishlistID, productID)
+	if err != nil {
+		return err
+	}
+	if !moved {
+		return ErrWishlistItemNotFound
+	}
+	return nil
+}
+
+// ownedWishlist devolve a lista se pertencer ao utilizador. As listas dos outros
+// são dadas como inexistentes, para não revelar as privadas.
+func (s *wishlistService) ownedWishlist(ctx context.Context, userID, id int64) (*models.Wishlist, error) {
+	wishlist, err := s.wishlistRepo.FindByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("error finding wishlist: %w", err)
+	}
+	if wishlist == nil || wishlist.UserID != userID {
+		return nil, ErrWishlistNotFound
+	}
+	return wishlist, nil
+}
+
+// setPublic muda a visibilidade da lista. O token é criado da primeira vez que a
+// lista fica pública e mantém-se, para que o link partilhado não mude.
+func (s *wishlistService) setPublic(wishlist *models.Wishlist, public bool) error {
+	wishlist.IsPublic = public
+	if public && wishlist.ShareToken == nil {
+		token, err := newShareToken()
+		if err != nil {
+			return err
+		}
+		wishlist.ShareToken = &token
+	}
+	return nil
+}
+
+// attachItems junta à lista os produtos guardados. Os apagados não aparecem; numa
+// lista partilhada também não aparecem os desativados.
+func (s *wishlistService) attachItems(ctx context.Context, wishlist *models.Wishlist, activeOnly bool) error {
+	items, err := s.wishlistRepo.ListItems(ctx, wishlist.ID)
+	if err != nil {
+		return err
+	}
+	wishlist.Items = []models.WishlistItem{}
+	if len(items) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(items))
+	for i, item := range items {
+		ids[i] = item.ProductID
+	}
+	products, err := s.productRepo.FindByIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+	byID := make(map[int64]models.ProductResponse, len(products))
+	for _, product := range products {
+		if activeOnly && !product.IsActive {
+			continue
+		}
+		byID[product.ID] = product.ToResponse()
+	}
+
+	for _, item := range items {
+		product, ok := byID[item.ProductID]
+		if !ok {
+			continue
+		}
+		item.PriceAtAdd = float64(item.PriceCentsAtAdd) / 100
+		item.Product = &product
+		wishlist.Items = append(wishlist.Items, item)
+	}
+	wishlist.ItemCount = len(wishlist.Items)
+	return nil
+}
+
+func newShareToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating share token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (s *wishlistService) ProductChanged(ctx context.Context, before, after *models.Product) {
+	ctx, span := tracing.Start(ctx, tracerName, "wishlistService.ProductChanged", attribute.Int64("product.id", after.ID))
+	defer span.End()
+
+	// Um produto desativado não está à venda: não há nada para avisar
+	if !after.IsActive {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+
+	if after.PriceCents < before.PriceCents {
+		s.enqueueAlert(ctx, after.ID, models.WishlistAlertPriceDrop, before.PriceCents)
+	}
+	if before.Quantity == 0 && after.Quantity > 0 {
+		s.enqueueAlert(ctx, after.ID, models.WishlistAlertBackInStock, before.PriceCents)
+	}
+}
+
+func (s *wishlistService) enqueueAlert(ctx context.Context, productID int64, alert string, previousPriceCents int) {
+	_, err := s.jobService.Enqueue(ctx, models.EnqueueJobRequest{
+		Type: models.JobTypeWishlistAlert,
+		Payload: models.WishlistAlertJobPayload{
+			ProductID:          productID,
+			Alert:              alert,
+			PreviousPriceCents: previousPriceCents,
+		},
+		MaxAttempts: 5,
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to enqueue wishlist alert",
+			"product_id", productID,
+			"alert", alert,
+			logging.Err(err),
+		)
+	}
+}
+
+// HandleAlertJob processa o job wishlist.alert e notifica cada utilizador que tem o
+// produto numa lista, uma só vez mesmo que o tenha em várias. Se entretanto o preço
+// voltou a subir, o stock acabou ou o produto foi desativado, não há aviso.
+func (s *wishlistService) HandleAlertJob(ctx context.Context, payload models.WishlistAlertJobPayload) error {
+	ctx, span := tracing.Start(ctx, tracerName, "wishlistService.HandleAlertJob", attribute.Int64("product.id", payload.ProductID), attribute.String("wishlist.alert", payload.Alert))
+	defer span.End()
+
+	product, err := s.productRepo.FindByID(ctx, payload.ProductID)
+	if err != nil {
+		return fmt.Errorf("error finding product: %w", err)
+	}
+	if product == nil || !product.IsActive {
+		return nil
+	}
+
+	notification := models.NotifyRequest{
+		Data: map[string]interface{}{
+			"product_id": product.ID,
+			"store_id":   product.StoreID,
+			"price":      float64(product.PriceCents) / 100,
+		},
+	}
+	switch payload.Alert {
+	case models.WishlistAlertPriceDrop:
+		if product.PriceCents >= payload.PreviousPriceCents {
+			return nil
+		}
+		notification.Type = models.NotificationPriceDrop
+		notification.Title = "Price drop"
+		notification.Body = fmt.Sprintf("%s is now %.2f, down from %.2f.", product.Title,
+			float64(product.PriceCents)/100, float64(payload.PreviousPriceCents)/100)
+	case models.WishlistAlertBackInStock:
+		if product.Quantity == 0 {
+			return nil
+		}
+		notification.Type = models.NotificationBackInStock
+		notification.Title = "Back in stock"
+		notification.Body = fmt.Sprintf("%s is back in stock.", product.Title)
+	default:
+		return jobs.Permanent(fmt.Errorf("unknown wishlist alert %q", payload.Alert))
+	}
+
+	userIDs, err := s.wishlistRepo.ListWatchers(ctx, product.ID)
+	if err != nil {
+		return err
+	}
+	for _, userID := range userIDs {
+		notification.UserID = userID
+		s.notifications.Notify(ctx, notification)
+	}
+
+	logging.FromContext(ctx).Info("wishlist alert sent",
+		"product_id", product.ID,
+		"alert", payload.Alert,
+		"recipients", len(userIDs),
+	)
+	return nil
+}
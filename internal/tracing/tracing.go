@@ -0,0 +1,111 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+// Options configura o exportador de traces
+type Options struct {
+	Exporter    string // none, stdout ou otlp
+	Endpoint    string // URL ou host:porta do coletor OTLP/HTTP
+	Insecure    bool   // OTLP sem TLS
+	ServiceName string
+	SampleRatio float64 // fração de traces novos a amostrar (os pedidos com trace pai seguem o pai)
+}
+
+// Setup instala o TracerProvider global e o propagador W3C. Com o exportador "none"
+// os spans continuam a ser criados (e os trace IDs propagados), mas não são exportados.
+// A função devolvida envia os spans pendentes e deve ser chamada no shutdown.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", opts.ServiceName),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("error building trace resource: %w", err)
+	}
+
+	providerOpts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	}
+
+	switch strings.ToLower(opts.Exporter) {
+	case "", ExporterNone:
+	case ExporterStdout:
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if err != nil {
+			return nil, fmt.Errorf("error creating stdout trace exporter: %w", err)
+		}
+		// Síncrono, para que os spans apareçam logo a seguir ao pedido quando se testa localmente
+		providerOpts = append(providerOpts, sdktrace.WithSyncer(exporter))
+	case ExporterOTLP:
+		var clientOpts []otlptracehttp.Option
+		switch {
+		case strings.Contains(opts.Endpoint, "://"):
+			clientOpts = append(clientOpts, otlptracehttp.WithEndpointURL(opts.Endpoint))
+		case opts.Endpoint != "":
+			clientOpts = append(clientOpts, otlptracehttp.WithEndpoint(opts.Endpoint))
+		}
+		if opts.Insecure {
+			clientOpts = append(clientOpts, otlptracehttp.WithInsecure())
+		}
+		exporter, err := otlptracehttp.New(ctx, clientOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("error creating otlp trace exporter: %w", err)
+		}
+		providerOpts = append(providerOpts, sdktrace.WithBatcher(exporter))
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", opts.Exporter)
+	}
+
+	provider := sdktrace.NewTracerProvider(providerOpts...)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Start abre um span filho do span em ctx com o tracer indicado
+func Start(ctx context.Context, tracer string, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracer).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// RecordError marca o span como falhado. Não faz nada se err for nil.
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// TraceID devolve o trace ID do span em ctx, ou "" se não houver span válido
+func TraceID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
@@ -0,0 +1,247 @@
+// Package webhook assina e entrega os eventos enviados aos sistemas das lojas.
+//
+// Cada pedido leva o cabeçalho X-Modress-Signature: "t=<unix>,v1=<hex>", em que v1 é
+// o HMAC-SHA256, com o segredo do webhook, de "<t>.<corpo>". O recetor recalcula-o com
+// Verify e rejeita assinaturas antigas, o que impede que um pedido capturado seja
+// repetido mais tarde.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Cabeçalhos de cada entrega
+const (
+	HeaderSignature = "X-Modress-Signature"
+	HeaderEvent     = "X-Modress-Event"
+	HeaderDelivery  = "X-Modress-Delivery"
+)
+
+// maxResponseBody é a parte da resposta do recetor guardada no registo de entregas
+const maxResponseBody = 1024
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrSignatureExpired = errors.New("webhook signature expired")
+	ErrPrivateAddress   = errors.New("webhook address is not public")
+)
+
+// NewSecret gera um segredo para um webhook novo
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Sign devolve o valor do cabeçalho X-Modress-Signature para o corpo no instante t
+func Sign(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + ",v1=" + signature(secret, ts, body)
+}
+
+func signature(secret, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify confirma que header assina body com secret e não tem mais de tolerance
+func Verify(secret, header string, body []byte, tolerance time.Duration) error {
+	var ts string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			ts = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrInvalidSignature
+	}
+	if age := time.Since(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return ErrSignatureExpired
+	}
+
+	expected := signature(secret, ts, body)
+	for _, sig := range signatures {
+		if hmac.Equal([]byte(sig), []byte(expected)) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// ValidateURL aceita só URLs http(s) absolutas, sem credenciais
+func ValidateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("scheme must be http or https")
+	}
+	if u.Hostname() == "" {
+		return errors.New("host is required")
+	}
+	if u.User != nil {
+		return errors.New("credentials are not allowed in the URL")
+	}
+	return nil
+}
+
+// Request é uma entrega a fazer
+type Request struct {
+	URL        string
+	Secret     string
+	Event      string
+	DeliveryID int64
+	Body       []byte
+}
+
+// Result é a resposta do recetor. StatusCode é 0 quando não houve resposta.
+type Result struct {
+	StatusCode int
+	Body       string
+	Duration   time.Duration
+}
+
+// OK indica se o recetor aceitou a entrega (2xx)
+func (r Result) OK() bool {
+	return r.StatusCode >= 200 && r.StatusCode < 300
+}
+
+// Options configura o Client
+type Options struct {
+	Timeout time.Duration
+	// AllowPrivateNetworks permite entregar a endereços de loopback, privados ou
+	// link-local. Desligado, um vendedor não consegue usar os webhooks para chegar
+	// a serviços internos.
+	AllowPrivateNetworks bool
+}
+
+// Client entrega os eventos. Os redirecionamentos não são seguidos: o recetor tem de
+// responder no URL subscrito.
+type Client struct {
+	http *http.Client
+}
+
+func NewClient(opts Options) *Client {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+
+	dialer := &net.Dialer{Timeout: opts.Timeout}
+	if !opts.AllowPrivateNetworks {
+		// O endereço é verificado depois da resolução de DNS, no momento da ligação,
+		// para que um nome que resolve para um IP interno também seja recusado
+		dialer.Control = func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+				return ErrPrivateAddress
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &Client{http: &http.Client{
+		Timeout:   opts.Timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}}
+}
+
+// Deliver envia o evento. Um erro significa que não houve resposta; uma resposta
+// que não seja 2xx é devolvida sem erro, no Result.
+func (c *Client) Deliver(ctx context.Context, req Request) (Result, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, req.URL, bytes.NewReader(req.Body))
+	if err != nil {
+		return Result{}, fmt.Errorf("error creating webhook request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("User-Agent", "Modress-Webhooks/1.0")
+	httpReq.Header.Set(HeaderEvent, req.Event)
+	httpReq.Header.Set(HeaderDelivery, strconv.FormatInt(req.DeliveryID, 10))
+	httpReq.Header.Set(HeaderSignature, Sign(req.Secret, time.Now(), req.Body))
+
+	start := time.Now()
+	resp, err := c.http.Do(httpReq)
+	result := Result{Duration: time.Since(start)}
+	if err != nil {
+		return result, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	// Ler o resto (até um limite) deixa a ligação ser reutilizada
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	result.StatusCode = resp.StatusCode
+	// O corpo vai para uma coluna TEXT: sem bytes nulos nem UTF-8 inválido
+	result.Body = strings.ToValidUTF8(strings.ReplaceAll(string(body), "\x00", ""), "\uFFFD")
+	result.Duration = time.Since(start)
+	return result, nil
+}
+
+// blockedNets são as redes não públicas que os métodos de net.IP não cobrem: a
+// rede "este host" (0.0.0.0/8) e o espaço partilhado dos operadores (CGNAT)
+var blockedNets = []*net.IPNet{
+	mustParseCIDR("0.0.0.0/8"),
+	mustParseCIDR("100.64.0.0/10"),
+}
+
+func mustParseCIDR(s string) *net.IPNet {
+	_, network, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return network
+}
+
+func publicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, network := range blockedNets {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,184 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	body := []byte(`{"id":"evt_1","type":"product.created"}`)
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		secret string
+		header string
+		body   []byte
+		want   error
+	}{
+		{"valid", "secret", Sign("secret", now, body), body, nil},
+		{"wrong secret", "other", Sign("secret", now, body), body, ErrInvalidSignature},
+		{"tampered body", "secret", Sign("secret", now, body), []byte(`{"id":"evt_2"}`), ErrInvalidSignature},
+		{"expired", "secret", Sign("secret", now.Add(-10*time.Minute), body), body, ErrSignatureExpired},
+		{"too far in the future", "secret", Sign("secret", now.Add(10*time.Minute), body), body, ErrSignatureExpired},
+		{"within tolerance", "secret", Sign("secret", now.Add(-4*time.Minute), body), body, nil},
+		{"missing timestamp", "secret", "v1=" + signature("secret", "0", body), body, ErrInvalidSignature},
+		{"missing signature", "secret", "t=" + strconv.FormatInt(now.Unix(), 10), body, ErrInvalidSignature},
+		{"garbage", "secret", "not a signature", body, ErrInvalidSignature},
+		{
+			// Durante a troca de segredo o recetor pode aceitar qualquer uma das assinaturas
+			"one of several signatures",
+			"secret",
+			Sign("secret", now, body) + ",v1=" + strings.Repeat("0", 64),
+			body,
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.secret, tt.header, tt.body, 5*time.Minute)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Verify = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeliverSignsRequest(t *testing.T) {
+	body := []byte(`{"id":"evt_1"}`)
+	var got *http.Request
+	var gotBody []byte
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusAccepted)
+		io.WriteString(w, "thanks\x00")
+	}))
+	defer receiver.Close()
+
+	client := NewClient(Options{Timeout: time.Second, AllowPrivateNetworks: true})
+	result, err := client.Deliver(context.Background(), Request{
+		URL:        receiver.URL,
+		Secret:     "secret",
+		Event:      "product.created",
+		DeliveryID: 42,
+		Body:       body,
+	})
+	if err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+	if !result.OK() || result.StatusCode != http.StatusAccepted || result.Body != "thanks" {
+		t.Fatalf("result = %+v, want 202 \"thanks\"", result)
+	}
+
+	if got.Method != http.MethodPost || got.Header.Get(HeaderEvent) != "product.created" || got.Header.Get(HeaderDelivery) != "42" {
+		t.Fatalf("request = %s %v, want POST with the event and delivery headers", got.Method, got.Header)
+	}
+	if err := Verify("secret", got.Header.Get(HeaderSignature), gotBody, time.Minute); err != nil {
+		t.Fatalf("signature of the delivered request: %v", err)
+	}
+}
+
+func TestDeliverReturnsFailedResponses(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+	}{
+		{"server error", http.StatusInternalServerError},
+		{"redirect is not followed", http.StatusFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Location", "http://example.com/")
+				w.WriteHeader(tt.status)
+			}))
+			defer receiver.Close()
+
+			client := NewClient(Options{Timeout: time.Second, AllowPrivateNetworks: true})
+			result, err := client.Deliver(context.Background(), Request{URL: receiver.URL, Secret: "secret", Body: []byte(`{}`)})
+			if err != nil {
+				t.Fatalf("Deliver: %v", err)
+			}
+			if result.OK() || result.StatusCode != tt.status {
+				t.Fatalf("result = %+v, want status %d", result, tt.status)
+			}
+		})
+	}
+}
+
+func TestDeliverTimesOut(t *testing.T) {
+	release := make(chan struct{})
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer receiver.Close()
+	defer close(release)
+
+	client := NewClient(Options{Timeout: 100 * time.Millisecond, AllowPrivateNetworks: true})
+	result, err := client.Deliver(context.Background(), Request{URL: receiver.URL, Secret: "secret", Body: []byte(`{}`)})
+	if err == nil {
+		t.Fatalf("Deliver to a receiver that never answers = %+v, want an error", result)
+	}
+	if result.StatusCode != 0 {
+		t.Fatalf("status = %d, want 0 without a response", result.StatusCode)
+	}
+}
+
+func TestDeliverRefusesPrivateAddresses(t *testing.T) {
+	var called bool
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer receiver.Close()
+	port := receiver.URL[strings.LastIndex(receiver.URL, ":")+1:]
+
+	client := NewClient(Options{Timeout: time.Second})
+	// O nome é verificado depois de resolvido, por isso localhost também é recusado
+	for _, url := range []string{receiver.URL, "http://localhost:" + port, "http://[::1]:" + port, "http://10.0.0.1:" + port} {
+		_, err := client.Deliver(context.Background(), Request{URL: url, Secret: "secret", Body: []byte(`{}`)})
+		if !errors.Is(err, ErrPrivateAddress) {
+			t.Errorf("Deliver to %s = %v, want ErrPrivateAddress", url, err)
+		}
+	}
+	if called {
+		t.Fatal("the receiver on a private address was called")
+	}
+}
+
+func TestPublicIP(t *testing.T) {
+	tests := map[string]bool{
+		"8.8.8.8":           true,
+		"2606:4700::1111":   true,
+		"127.0.0.1":         false,
+		"10.1.2.3":          false,
+		"172.16.0.1":        false,
+		"192.168.1.1":       false,
+		"169.254.169.254":   false,
+		"0.0.0.0":           false,
+		"0.1.2.3":           false,
+		"100.64.0.1":        false,
+		"100.127.255.254":   false,
+		"::ffff:100.64.0.1": false,
+		"100.128.0.1":       true,
+		"::1":               false,
+		"fe80::1":           false,
+		"fd00::1":           false,
+		"224.0.0.1":         false,
+	}
+	for addr, want := range tests {
+		if got := publicIP(net.ParseIP(addr)); got != want {
+			t.Errorf("publicIP(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+// Package wsclient é um cliente Go do WebSocket /api/v1/ws, para testes e ferramentas.
+// Fala o protocolo de wsproto: Send envia um frame e espera pelo ack (ou erro) com o
+// mesmo ID, e os eventos enviados pelo servidor por iniciativa própria chegam por
+// Events.
+package wsclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"modress/internal/models"
+	"modress/internal/wsproto"
+
+	"github.com/gorilla/websocket"
+)
+
+// ErrClosed é devolvido depois de a ligação fechar
+var ErrClosed = errors.New("websocket connection closed")
+
+// Client é uma ligação autenticada ao WebSocket
+type Client struct {
+	conn   *websocket.Conn
+	events chan wsproto.Envelope
+
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	pending map[string]chan wsproto.Envelope
+	nextID  atomic.Int64
+
+	closing atomic.Bool
+	done    chan struct{}
+	err     error // motivo do fecho, válido depois de done fechar
+}
+
+// Dial liga-se a url (por exemplo ws://localhost:8080/api/v1/ws) com o token JWT
+func Dial(ctx context.Context, url, token string) (*Client, error) {
+	conn, err := dial(ctx, url, token)
+	if err != nil {
+		return nil, err
+	}
+	return newClient(conn), nil
+}
+
+func dial(ctx context.Context, url, token string) (*websocket.Conn, error) {
+	dialer := websocket.Dialer{Subprotocols: []string{wsproto.Subprotocol}}
+	header := http.Header{"Authorization": []string{"Bearer " + token}}
+
+	conn, resp, err := dialer.DialContext(ctx, url, header)
+	if err != nil {
+		if resp != nil {
+			return nil, fmt.Errorf("websocket dial failed with status %d: %w", resp.StatusCode, err)
+		}
+		return nil, fmt.Errorf("websocket dial failed: %w", err)
+	}
+	return conn, nil
+}
+
+// newClient começa a ler de conn; os handlers da ligação têm de estar definidos antes
+func newClient(conn *websocket.Conn) *Client {
+	c := &Client{
+		conn:    conn,
+		events:  make(chan wsproto.Envelope, 64),
+		pending: make(map[string]chan wsproto.Envelope),
+		done:    make(chan struct{}),
+	}
+	go c.readLoop()
+	return c
+}
+
+// Events devolve os eventos enviados pelo servidor que não respondem a um Send
+// (chat.message, chat.delivered, presence, ...). É fechado quando a ligação fecha.
+func (c *Client) Events() <-chan wsproto.Envelope {
+	return c.events
+}
+
+// Next espera pelo próximo evento do tipo indicado, descartando os outros
+func (c *Client) Next(ctx context.Context, eventType string) (wsproto.Envelope, error) {
+	for {
+		select {
+		case env, ok := <-c.events:
+			if !ok {
+				return wsproto.Envelope{}, c.closeErr()
+			}
+			if env.Type == eventType {
+				return env, nil
+			}
+		case <-ctx.Done():
+			return wsproto.Envelope{}, ctx.Err()
+		}
+	}
+}
+
+// Send envia um frame e espera pela resposta do servidor. Devolve o ack, ou o erro
+// enviado pelo servidor como *wsproto.Error.
+func (c *Client) Send(ctx context.Context, eventType string, payload interface{}) (wsproto.Envelope, error) {
+	id := strconv.FormatInt(c.nextID.Add(1), 10)
+	reply := make(chan wsproto.Envelope, 1)
+
+	c.mu.Lock()
+	c.pending[id] = reply
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	if err := c.SendRaw(eventType, id, payload); err != nil {
+		return wsproto.Envelope{}, err
+	}
+
+	select {
+	case env := <-reply:
+		if env.Type == wsproto.TypeError {
+			var protoErr wsproto.Error
+			if err := json.Unmarshal(env.Payload, &protoErr); err != nil {
+				return env, fmt.Errorf("error decoding error payload: %w", err)
+			}
+			return env, &protoErr
+		}
+		return env, nil
+	case <-c.done:
+		return wsproto.Envelope{}, c.closeErr()
+	case <-ctx.Done():
+		return wsproto.Envelope{}, ctx.Err()
+	}
+}
+
+// SendRaw envia um frame sem esperar pela resposta; id vazio dispensa o ack
+func (c *Client) SendRaw(eventType, id string, payload interface{}) error {
+	data, err := wsproto.Encode(eventType, id, payload)
+	if err != nil {
+		return err
+	}
+	return c.WriteFrame(data)
+}
+
+// WriteFrame envia bytes tal como estão, para testar frames inválidos
+func (c *Client) WriteFrame(data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// SendMessage envia uma mensagem numa conversa e devolve-a como foi guardada
+func (c *Client) SendMessage(ctx context.Context, conversationID int64, content string) (*models.Message, error) {
+	return c.sendChat(ctx, wsproto.ChatSend{ConversationID: conversationID, Content: content})
+}
+
+// SendToStore envia uma mensagem na conversa com a loja, criada se ainda não existir
+func (c *Client) SendToStore(ctx context.Context, storeID int64, content string) (*models.Message, error) {
+	return c.sendChat(ctx, wsproto.ChatSend{StoreID: storeID, Content: content})
+}
+
+func (c *Client) sendChat(ctx context.Context, req wsproto.ChatSend) (*models.Message, error) {
+	ack, err := c.Send(ctx, wsproto.TypeChatSend, req)
+	if err != nil {
+		return nil, err
+	}
+	var message models.Message
+	if err := json.Unmarshal(ack.Payload, &message); err != nil {
+		return nil, fmt.Errorf("error decoding chat.send ack: %w", err)
+	}
+	return &message, nil
+}
+
+// MarkRead marca como lidas as mensagens recebidas na conversa até upToID (0 para
+// todas). Devolve nil quando não havia nada por ler.
+func (c *Client) MarkRead(ctx context.Context, conversationID, upToID int64) (*models.ReadReceipt, error) {
+	ack, err := c.Send(ctx, wsproto.TypeChatRead, wsproto.ChatRead{ConversationID: conversationID, UpToID: upToID})
+	if err != nil {
+		return nil, err
+	}
+	if len(ack.Payload) == 0 {
+		return nil, nil
+	}
+	var receipt models.ReadReceipt
+	if err := json.Unmarshal(ack.Payload, &receipt); err != nil {
+		return nil, fmt.Errorf("error decoding chat.read ack: %w", err)
+	}
+	return &receipt, nil
+}
+
+// Typing indica à outra parte da conversa que o utilizador está (ou deixou de estar) a escrever
+func (c *Client) Typing(ctx context.Context, conversationID int64, typing bool) error {
+	_, err := c.Send(ctx, wsproto.TypeTyping, wsproto.Typing{ConversationID: conversationID, Typing: typing})
+	return err
+}
+
+// Close fecha a ligação com um close frame normal
+func (c *Client) Close() error {
+	c.closing.Store(true)
+	c.writeMu.Lock()
+	c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	c.writeMu.Unlock()
+	err := c.conn.Close()
+	<-c.done
+	return err
+}
+
+// Err devolve o motivo do fecho da ligação, ou nil enquanto está aberta
+func (c *Client) Err() error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		return nil
+	}
+}
+
+func (c *Client) closeErr() error {
+	<-c.done
+	if c.err != nil {
+		return c.err
+	}
+	return ErrClosed
+}
+
+// readLoop entrega as respostas a quem as espera em Send e os restantes eventos em Events
+func (c *Client) readLoop() {
+	defer func() {
+		close(c.events)
+		close(c.done)
+	}()
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if c.closing.Load() || websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				c.err = ErrClosed
+			} else {
+				c.err = fmt.Errorf("%w: %v", ErrClosed, err)
+			}
+			return
+		}
+
+		var env wsproto.Envelope
+		if err := json.Unmarshal(data, &env); err != nil {
+			continue
+		}
+
+		if env.ID != "" && (env.Type == wsproto.TypeAck || env.Type == wsproto.TypeError) {
+			c.mu.Lock()
+			reply, ok := c.pending[env.ID]
+			c.mu.Unlock()
+			if ok {
+				reply <- env
+				continue
+			}
+		}
+
+		// Quem não lê Events não pode bloquear as respostas: com o buffer cheio o
+		// evento mais antigo é descartado
+		select {
+		case c.events <- env:
+		default:
+			select {
+			case <-c.events:
+			default:
+			}
+			c.events <- env
+		}
+	}
+}
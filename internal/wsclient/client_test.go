@@ -0,0 +1,418 @@
+package wsclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"modress/internal/config"
+	"modress/internal/controllers"
+	"modress/internal/hub"
+	"modress/internal/middleware"
+	"modress/internal/models"
+	"modress/internal/services"
+	"modress/internal/wsproto"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+)
+
+const testSecret = "wsclient-test-secret"
+
+// testConversationID é a única conversa dos testes, entre os utilizadores 1 e 2
+const testConversationID = 10
+
+// newTestServer arranca o hub WebSocket da API, com a autenticação por JWT, num
+// servidor httptest e devolve o URL do /ws; o /presence fica no mesmo servidor
+func newTestServer(t *testing.T, cfg config.WebSocketConfig) string {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	wsController := controllers.NewWebSocketController(stubAuthService{}, &stubChatService{}, hub.NewMemoryBackend(), cfg)
+	wsController.Start()
+
+	router := gin.New()
+	router.Use(middleware.ErrorMiddleware())
+	router.GET("/ws", middleware.AuthMiddleware(testSecret), wsController.HandleConnections)
+	router.GET("/presence", middleware.AuthMiddleware(testSecret), wsController.Presence)
+	srv := httptest.NewServer(router)
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		wsController.Shutdown(ctx)
+		srv.Close()
+	})
+	return "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+}
+
+func testConfig() config.WebSocketConfig {
+	return config.WebSocketConfig{
+		MaxMessageSize:        4096,
+		MaxConnectionsPerUser: 5,
+		SendBuffer:            16,
+		PingInterval:          time.Minute,
+		PongTimeout:           time.Minute,
+		WriteTimeout:          5 * time.Second,
+	}
+}
+
+func dialAs(t *testing.T, url string, userID int64) *Client {
+	t.Helper()
+
+	client := newClient(dialConnAs(t, url, userID))
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// dialConnAs abre a ligação sem começar a ler, para o teste mudar os handlers antes
+func dialConnAs(t *testing.T, url string, userID int64) *websocket.Conn {
+	t.Helper()
+
+	conn, err := dial(testContext(t), url, tokenFor(t, userID))
+	if err != nil {
+		t.Fatalf("dialing as user %d: %v", userID, err)
+	}
+	return conn
+}
+
+func tokenFor(t *testing.T, userID int64) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":  fmt.Sprintf("%d", userID),
+		"role": "buyer",
+		"exp":  time.Now().Add(time.Hour).Unix(),
+	})
+	signed, err := token.SignedString([]byte(testSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestDialWithoutValidToken(t *testing.T) {
+	url := newTestServer(t, testConfig())
+
+	_, err := Dial(testContext(t), url, "not-a-token")
+	if err == nil || !strings.Contains(err.Error(), "status 401") {
+		t.Fatalf("Dial with an invalid token = %v, want status 401", err)
+	}
+}
+
+func TestSendReceivesAck(t *testing.T) {
+	client := dialAs(t, newTestServer(t, testConfig()), 1)
+
+	ack, err := client.Send(testContext(t), wsproto.TypeTyping, wsproto.Typing{ConversationID: testConversationID, Typing: true})
+	if err != nil {
+		t.Fatalf("typing: %v", err)
+	}
+	if ack.Type != wsproto.TypeAck || ack.V != wsproto.Version {
+		t.Fatalf("reply = %+v, want a v%d ack", ack, wsproto.Version)
+	}
+
+	// Um chat.read sem nada por ler é confirmado sem payload
+	receipt, err := client.MarkRead(testContext(t), testConversationID, 0)
+	if err != nil {
+		t.Fatalf("MarkRead: %v", err)
+	}
+	if receipt != nil {
+		t.Fatalf("MarkRead receipt = %+v, want nil", receipt)
+	}
+}
+
+func TestErrorFrames(t *testing.T) {
+	client := dialAs(t, newTestServer(t, testConfig()), 1)
+	ctx := testContext(t)
+
+	// Sem JSON válido o servidor não sabe o ID, e o erro chega como evento
+	if err := client.WriteFrame([]byte(`{not json`)); err != nil {
+		t.Fatal(err)
+	}
+	assertErrorEvent(t, client, "", wsproto.CodeInvalidFrame)
+
+	if err := client.WriteFrame([]byte(`{"v":2,"type":"typing","id":"old"}`)); err != nil {
+		t.Fatal(err)
+	}
+	assertErrorEvent(t, client, "old", wsproto.CodeUnsupportedVersion)
+
+	tests := []struct {
+		name      string
+		eventType string
+		payload   interface{}
+		code      string
+	}{
+		{"unknown type", "chat.unknown", nil, wsproto.CodeUnknownType},
+		{"missing payload", wsproto.TypeChatSend, nil, wsproto.CodeInvalidPayload},
+		{"invalid payload", wsproto.TypeChatSend, "hello", wsproto.CodeInvalidPayload},
+		{"service error", wsproto.TypeChatSend, wsproto.ChatSend{ConversationID: 99, Content: "hello"}, "conversation_not_found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reply, err := client.Send(ctx, tt.eventType, tt.payload)
+			var protoErr *wsproto.Error
+			if !errors.As(err, &protoErr) {
+				t.Fatalf("Send error = %v, want *wsproto.Error", err)
+			}
+			if protoErr.Code != tt.code {
+				t.Fatalf("error code = %q, want %q", protoErr.Code, tt.code)
+			}
+			if reply.Type != wsproto.TypeError || reply.ID == "" {
+				t.Fatalf("reply = %+v, want an error frame with the frame's ID", reply)
+			}
+		})
+	}
+
+	// A ligação continua utilizável depois dos erros
+	if _, err := client.Send(ctx, wsproto.TypeTyping, wsproto.Typing{ConversationID: testConversationID}); err != nil {
+		t.Fatalf("typing after errors: %v", err)
+	}
+}
+
+func assertErrorEvent(t *testing.T, client *Client, id, code string) {
+	t.Helper()
+
+	env, err := client.Next(testContext(t), wsproto.TypeError)
+	if err != nil {
+		t.Fatalf("waiting for error event: %v", err)
+	}
+	var protoErr wsproto.Error
+	if decodeErr := env.DecodePayload(&protoErr); decodeErr != nil {
+		t.Fatal(decodeErr)
+	}
+	if env.ID != id || protoErr.Code != code {
+		t.Fatalf("error event id=%q code=%q, want id=%q code=%q", env.ID, protoErr.Code, id, code)
+	}
+}
+
+func TestChatSendRoundTrip(t *testing.T) {
+	url := newTestServer(t, testConfig())
+	buyer := dialAs(t, url, 1)
+	seller := dialAs(t, url, 2)
+	ctx := testContext(t)
+
+	sent, err := buyer.SendMessage(ctx, testConversationID, "is this still available?")
+	if err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+	if sent.ID == 0 || sent.SenderID != 1 || sent.RecipientID != 2 {
+		t.Fatalf("ack message = %+v, want a stored message from 1 to 2", sent)
+	}
+
+	env, err := seller.Next(ctx, wsproto.TypeChatMessage)
+	if err != nil {
+		t.Fatalf("waiting for chat.message: %v", err)
+	}
+	var received models.Message
+	if err := env.DecodePayload(&received); err != nil {
+		t.Fatal(err)
+	}
+	if received.ID != sent.ID || received.Content != sent.Content {
+		t.Fatalf("received %+v, want %+v", received, sent)
+	}
+
+	env, err = buyer.Next(ctx, wsproto.TypeChatDelivered)
+	if err != nil {
+		t.Fatalf("waiting for chat.delivered: %v", err)
+	}
+	var receipt models.DeliveryReceipt
+	if err := env.DecodePayload(&receipt); err != nil {
+		t.Fatal(err)
+	}
+	if len(receipt.MessageIDs) != 1 || receipt.MessageIDs[0] != sent.ID {
+		t.Fatalf("delivery receipt = %+v, want message %d", receipt, sent.ID)
+	}
+}
+
+func TestPingPong(t *testing.T) {
+	cfg := testConfig()
+	cfg.PingInterval = 50 * time.Millisecond
+	cfg.PongTimeout = 300 * time.Millisecond
+	url := newTestServer(t, cfg)
+
+	// Um cliente que responde aos pings mantém a ligação muito para lá do PongTimeout
+	conn := dialConnAs(t, url, 1)
+	var pings atomic.Int32
+	conn.SetPingHandler(func(data string) error {
+		pings.Add(1)
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+	client := newClient(conn)
+	t.Cleanup(func() { client.Close() })
+
+	// Um cliente que ignora os pings é desligado pelo servidor
+	silentConn := dialConnAs(t, url, 2)
+	silentConn.SetPingHandler(func(string) error { return nil })
+	silent := newClient(silentConn)
+	t.Cleanup(func() { silent.Close() })
+
+	time.Sleep(4 * cfg.PongTimeout)
+
+	if n := pings.Load(); n < 5 {
+		t.Fatalf("client received %d pings, want at least 5", n)
+	}
+	if _, err := client.Send(testContext(t), wsproto.TypeTyping, wsproto.Typing{ConversationID: testConversationID}); err != nil {
+		t.Fatalf("client answering pings was disconnected: %v", err)
+	}
+	if err := silent.Err(); err == nil {
+		t.Fatal("client ignoring pings is still connected")
+	}
+}
+
+func TestPresenceOnlyReachesContacts(t *testing.T) {
+	url := newTestServer(t, testConfig())
+	seller := dialAs(t, url, 2)
+	stranger := dialAs(t, url, 3)
+	dialAs(t, url, 1)
+	ctx := testContext(t)
+
+	env, err := seller.Next(ctx, wsproto.TypePresence)
+	if err != nil {
+		t.Fatalf("waiting for presence: %v", err)
+	}
+	var presence wsproto.Presence
+	if err := env.DecodePayload(&presence); err != nil {
+		t.Fatal(err)
+	}
+	if presence.UserID != 1 || !presence.Online {
+		t.Fatalf("presence = %+v, want user 1 online", presence)
+	}
+
+	// O ack chega depois de qualquer evento já enviado à ligação
+	if _, err := stranger.MarkRead(ctx, testConversationID, 0); err != nil {
+		t.Fatal(err)
+	}
+	for drained := false; !drained; {
+		select {
+		case env := <-stranger.Events():
+			if env.Type == wsproto.TypePresence {
+				t.Fatalf("user without a conversation received %s", env.Payload)
+			}
+		default:
+			drained = true
+		}
+	}
+}
+
+func TestPresenceEndpointOnlyShowsContacts(t *testing.T) {
+	url := newTestServer(t, testConfig())
+	dialAs(t, url, 2)
+	dialAs(t, url, 3)
+
+	req, err := http.NewRequestWithContext(testContext(t), http.MethodGet,
+		"http"+strings.TrimPrefix(strings.TrimSuffix(url, "/ws"), "ws")+"/presence?user_ids=2,3", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+tokenFor(t, 1))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Online []int64 `json:"online"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || len(body.Online) != 1 || body.Online[0] != 2 {
+		t.Fatalf("presence = %d %v, want only user 2 online", resp.StatusCode, body.Online)
+	}
+}
+
+// stubAuthService só implementa o que o hub WebSocket usa
+type stubAuthService struct {
+	services.AuthService
+}
+
+func (stubAuthService) GetUser(ctx context.Context, id int64) (*models.User, error) {
+	return &models.User{ID: id, Username: fmt.Sprintf("user%d", id)}, nil
+}
+
+// stubChatService tem uma única conversa, testConversationID, entre os utilizadores 1 e 2
+type stubChatService struct {
+	services.ChatService
+	nextID atomic.Int64
+}
+
+func otherParticipant(userID int64) int64 {
+	if userID == 1 {
+		return 2
+	}
+	return 1
+}
+
+func (s *stubChatService) SendMessage(ctx context.Context, senderID int64, req *models.SendMessageRequest) (*models.Message, error) {
+	if req.ConversationID != testConversationID {
+		return nil, services.NewError(services.ErrNotFound, "conversation_not_found", "conversation not found")
+	}
+	return &models.Message{
+		ID:             s.nextID.Add(1),
+		ConversationID: req.ConversationID,
+		SenderID:       senderID,
+		RecipientID:    otherParticipant(senderID),
+		Content:        req.Content,
+		CreatedAt:      time.Now(),
+	}, nil
+}
+
+func (s *stubChatService) PendingMessages(ctx context.Context, userID int64) ([]models.Message, error) {
+	return nil, nil
+}
+
+func (s *stubChatService) MarkDelivered(ctx context.Context, recipientID int64, messageIDs []int64) ([]models.DeliveryReceipt, error) {
+	if len(messageIDs) == 0 {
+		return nil, nil
+	}
+	return []models.DeliveryReceipt{{
+		ConversationID: testConversationID,
+		MessageIDs:     messageIDs,
+		DeliveredAt:    time.Now(),
+		SenderID:       otherParticipant(recipientID),
+	}}, nil
+}
+
+func (s *stubChatService) MarkRead(ctx context.Context, userID, conversationID, upToID int64) (*models.ReadReceipt, error) {
+	return nil, nil
+}
+
+// A presença de cada um dos participantes da conversa só é visível para o outro
+func (s *stubChatService) PresenceWatchers(ctx context.Context, userID int64) ([]int64, error) {
+	if userID != 1 && userID != 2 {
+		return nil, nil
+	}
+	return []int64{otherParticipant(userID)}, nil
+}
+
+func (s *stubChatService) VisiblePresence(ctx context.Context, viewerID int64, userIDs []int64) ([]int64, error) {
+	var visible []int64
+	for _, id := range userIDs {
+		if (viewerID == 1 || viewerID == 2) && id == otherParticipant(viewerID) {
+			visible = append(visible, id)
+		}
+	}
+	return visible, nil
+}
+
+func (s *stubChatService) Recipient(ctx context.Context, userID, conversationID int64) (int64, error) {
+	if conversationID != testConversationID {
+		return 0, services.NewError(services.ErrNotFound, "conversation_not_found", "conversation not found")
+	}
+	return otherParticipant(userID), nil
+}
@@ -0,0 +1,146 @@
+// Package wsproto define o protocolo do WebSocket /api/v1/ws. Cada frame é um
+// Envelope JSON com a versão do protocolo, o tipo do evento, um ID opcional escolhido
+// por quem envia e o payload do tipo. O servidor responde a cada frame do cliente
+// que traga ID com um ack (ou um error) com o mesmo ID.
+package wsproto
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	// Version é a versão do protocolo; frames com outra versão são recusados
+	Version = 1
+	// Subprotocol é o valor de Sec-WebSocket-Protocol aceite pelo servidor
+	Subprotocol = "modress.v1"
+
+	// MaxIDLength limita o ID escolhido pelo cliente
+	MaxIDLength = 64
+)
+
+// Tipos de evento. Os comentários indicam quem envia e o payload.
+const (
+	TypeChatSend      = "chat.send"      // cliente: ChatSend; ack com a models.Message guardada
+	TypeChatMessage   = "chat.message"   // servidor: models.Message recebida
+	TypeChatDelivered = "chat.delivered" // servidor: models.DeliveryReceipt
+	TypeChatRead      = "chat.read"      // cliente: ChatRead; servidor: models.ReadReceipt
+	TypeTyping        = "typing"         // cliente e servidor: Typing
+	TypePresence      = "presence"       // servidor: Presence
+	TypeNotification  = "notification"   // servidor: notificação para o utilizador
+	TypeAck           = "ack"            // servidor: confirma o frame com o mesmo ID
+	TypeError         = "error"          // servidor: Error, com o ID do frame que falhou
+)
+
+// Códigos de erro do próprio protocolo; os erros dos pedidos usam os códigos da API REST
+const (
+	CodeInvalidFrame       = "invalid_frame"
+	CodeUnsupportedVersion = "unsupported_version"
+	CodeUnknownType        = "unknown_type"
+	CodeInvalidPayload     = "invalid_payload"
+	CodeInternal           = "internal_error"
+)
+
+// Envelope é um frame do protocolo
+type Envelope struct {
+	V       int             `json:"v"`
+	Type    string          `json:"type"`
+	ID      string          `json:"id,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// ChatSend envia uma mensagem na conversa ConversationID, ou na conversa com a loja
+// StoreID (criada se ainda não existir)
+type ChatSend struct {
+	ConversationID int64  `json:"conversation_id,omitempty"`
+	StoreID        int64  `json:"store_id,omitempty"`
+	Content        string `json:"content"`
+}
+
+// ChatRead marca como lidas as mensagens recebidas na conversa até UpToID (0 para todas)
+type ChatRead struct {
+	ConversationID int64 `json:"conversation_id"`
+	UpToID         int64 `json:"up_to_id,omitempty"`
+}
+
+// Typing indica que um utilizador começou ou parou de escrever numa conversa. O
+// servidor preenche UserID antes de o reencaminhar à outra parte.
+type Typing struct {
+	ConversationID int64 `json:"conversation_id"`
+	UserID         int64 `json:"user_id,omitempty"`
+	Typing         bool  `json:"typing"`
+}
+
+// Presence indica que um utilizador se ligou ou desligou
+type Presence struct {
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+	Online   bool   `json:"online"`
+}
+
+// FieldError descreve um campo inválido num pedido
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error é o payload de um evento error
+type Error struct {
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Errors  []FieldError `json:"errors,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// NewError constrói um erro do protocolo
+func NewError(code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Encode codifica um frame com o payload indicado (nil para nenhum)
+func Encode(eventType, id string, payload interface{}) ([]byte, error) {
+	env := Envelope{V: Version, Type: eventType, ID: id}
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding %s payload: %w", eventType, err)
+		}
+		env.Payload = data
+	}
+	return json.Marshal(env)
+}
+
+// Decode lê um frame e valida o envelope. Quando o JSON é válido o envelope é
+// devolvido mesmo com erro, para que a resposta possa levar o ID do frame.
+func Decode(data []byte) (Envelope, *Error) {
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return Envelope{}, NewError(CodeInvalidFrame, "frame is not a valid JSON envelope")
+	}
+	if len(env.ID) > MaxIDLength {
+		env.ID = ""
+		return env, NewError(CodeInvalidFrame, fmt.Sprintf("id must be at most %d characters", MaxIDLength))
+	}
+	if env.V != Version {
+		return env, NewError(CodeUnsupportedVersion, fmt.Sprintf("unsupported protocol version, use v=%d", Version))
+	}
+	if env.Type == "" {
+		return env, NewError(CodeInvalidFrame, "type is required")
+	}
+	return env, nil
+}
+
+// DecodePayload lê o payload do frame para v
+func (e Envelope) DecodePayload(v interface{}) *Error {
+	if len(e.Payload) == 0 {
+		return NewError(CodeInvalidPayload, e.Type+" requires a payload")
+	}
+	if err := json.Unmarshal(e.Payload, v); err != nil {
+		return NewError(CodeInvalidPayload, "invalid "+e.Type+" payload: "+err.Error())
+	}
+	return nil
+}